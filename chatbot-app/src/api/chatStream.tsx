@@ -0,0 +1,178 @@
+// Client for the chat stream, see chatbot-backend/chatbot/service/conversation/stream.go for the event schema
+
+export const STREAM_PROTOCOL_VERSION = 1;
+
+export type StreamEventData = {
+  v: number;
+  conversationid?: string;
+  text?: string;
+  tool?: string;
+  prompttokens?: number;
+  responsetokens?: number;
+  interrupted?: boolean;
+  code?: string;
+  message?: string;
+};
+
+export type StreamEvent = {
+  id: string;
+  event: string;
+  data: StreamEventData;
+};
+
+export class StreamError extends Error {
+  code: string;
+
+  constructor(code: string, message: string) {
+    super(message);
+    this.code = code;
+  }
+}
+
+export type ChatRequest = {
+  conversationid: string;
+  message: string;
+  attachments?: File[];
+};
+
+// chatRequestBody builds the body of a chat request, a multipart form when files are attached
+export const chatRequestBody = (
+  request: ChatRequest
+): FormData | { conversationid: string; message: string } => {
+  if (!request.attachments || request.attachments.length === 0) {
+    return { conversationid: request.conversationid, message: request.message };
+  }
+  const form = new FormData();
+  form.append("conversationid", request.conversationid);
+  form.append("message", request.message);
+  for (const file of request.attachments) {
+    form.append("attachments", file);
+  }
+  return form;
+};
+
+const chatRequestInit = (request: ChatRequest): RequestInit => {
+  const body = chatRequestBody(request);
+  // the browser sets the multipart content type with its boundary itself
+  return body instanceof FormData
+    ? { body }
+    : {
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body),
+      };
+};
+
+const maxResumeAttempts = 3;
+const resumeDelayMs = 1000;
+
+// parseStreamEvents takes the complete events out of the received text and returns what is left of an unfinished event
+export const parseStreamEvents = (
+  buffer: string
+): { events: StreamEvent[]; rest: string } => {
+  const events: StreamEvent[] = [];
+  const blocks = buffer.split("\n\n");
+  const rest = blocks.pop() ?? "";
+
+  for (const block of blocks) {
+    let id = "";
+    let event = "message";
+    let data = "";
+    for (const line of block.split("\n")) {
+      if (line.startsWith(":")) continue; // heartbeat comment
+      const separator = line.indexOf(":");
+      const field = separator === -1 ? line : line.slice(0, separator);
+      const value =
+        separator === -1 ? "" : line.slice(separator + 1).replace(/^ /, "");
+      if (field === "id") id = value;
+      else if (field === "event") event = value;
+      else if (field === "data") data += data === "" ? value : "\n" + value;
+    }
+    if (data === "") continue;
+    events.push({ id, event, data: JSON.parse(data) as StreamEventData });
+  }
+  return { events, rest };
+};
+
+// streamChat sends the message and calls onDelta with each piece of the response until it is done.
+// If the connection drops, it reconnects with the last event id to resume where it stopped
+export const streamChat = async (
+  url: string,
+  resumeUrl: (conversationid: string) => string,
+  request: ChatRequest,
+  onDelta: (text: string) => void
+): Promise<void> => {
+  let lastEventId = "";
+
+  const readEvents = async (response: Response): Promise<boolean> => {
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`);
+    }
+    if (!response.body) {
+      throw new Error("Response body is null or undefined.");
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = "";
+    while (true) {
+      const { done, value } = await reader.read();
+      if (done) return false; // closed before the response was finished
+      buffer += decoder.decode(value, { stream: true });
+      const parsed = parseStreamEvents(buffer);
+      buffer = parsed.rest;
+
+      for (const { id, event, data } of parsed.events) {
+        if (id) lastEventId = id;
+        if (data.v !== STREAM_PROTOCOL_VERSION) {
+          console.warn("Unexpected stream protocol version", data.v);
+        }
+        switch (event) {
+          case "delta":
+            onDelta(data.text ?? "");
+            break;
+          case "tool":
+            console.debug("Chatbot called tool", data.tool);
+            break;
+          case "usage":
+            console.debug("Token usage", data.prompttokens, data.responsetokens);
+            break;
+          case "done":
+            return true;
+          case "error":
+            throw new StreamError(
+              data.code ?? "unknown",
+              data.message ?? "unable to get response from chatbot"
+            );
+        }
+      }
+    }
+  };
+
+  let finished = false;
+  try {
+    finished = await readEvents(
+      await fetch(url, { method: "POST", ...chatRequestInit(request) })
+    );
+  } catch (error) {
+    // only a dropped connection after the stream started can be resumed
+    if (error instanceof StreamError || lastEventId === "") throw error;
+    console.warn("Stream interrupted, resuming", error);
+  }
+
+  for (let attempt = 1; !finished; attempt++) {
+    if (attempt > maxResumeAttempts) {
+      throw new Error("Lost connection to the chatbot stream.");
+    }
+    await new Promise((resolve) => setTimeout(resolve, resumeDelayMs));
+    try {
+      finished = await readEvents(
+        await fetch(resumeUrl(request.conversationid), {
+          headers: { "Last-Event-ID": lastEventId },
+        })
+      );
+    } catch (error) {
+      if (error instanceof StreamError) throw error;
+      console.warn("Resuming stream failed", error);
+    }
+  }
+};
@@ -9,6 +9,12 @@ import ReactMarkdown from "react-markdown";
 import SendIcon from "@mui/icons-material/Send";
 import axios, { AxiosError, HttpStatusCode } from "axios";
 import remarkGfm from "remark-gfm";
+import AttachFileIcon from "@mui/icons-material/AttachFile";
+import {
+  StreamError,
+  chatRequestBody,
+  streamChat,
+} from "../api/chatStream";
 
 export type ConversationSuccessResponse = {
   conversationid: string;
@@ -22,6 +28,7 @@ const ConversationPage = () => {
     { role: "user" | "chatbot"; content: string }[]
   >([]); // Array of objects to manage user/chatbot messages
   const [userInput, setUserInput] = useState<string>("");
+  const [attachments, setAttachments] = useState<File[]>([]);
   const [chatbotDescription, setChatbotDescription] = useState<string>("");
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
@@ -74,127 +81,72 @@ const ConversationPage = () => {
     }
 
     const userMessage = userInput;
+    const userAttachments = attachments;
     setUserInput("");
+    setAttachments([]);
     setLoading(true);
     setError(null); // Clear any previous errors
     setGeminiResponse(""); // Clear previous streaming response
     setConversation((prev) => [
       ...prev,
-      { role: "user", content: userMessage }, // Add user message to conversation state
+      {
+        role: "user",
+        content:
+          userAttachments.length > 0
+            ? `${userMessage}\n\n_Attached: ${userAttachments
+                .map((file) => file.name)
+                .join(", ")}_`
+            : userMessage,
+      }, // Add user message to conversation state
     ]);
 
     if (isStreaming) {
+      let chatbotFullResponse = ""; // To store the full response for conversation history
       try {
-        const response = await fetch(
-          chatStreamConversationApiUrl + `/${username}/${chatbotname}`, // Use absolute URL
+        await streamChat(
+          chatStreamConversationApiUrl + `/${username}/${chatbotname}`,
+          (conversationid) =>
+            chatStreamConversationApiUrl +
+            `/${username}/${chatbotname}/${conversationid}`,
           {
-            method: "POST",
-            headers: {
-              "Content-Type": "application/json",
-            },
-            body: JSON.stringify({
-              conversationid: conversationID,
-              message: userMessage,
-            }),
+            conversationid: conversationID,
+            message: userMessage,
+            attachments: userAttachments,
+          },
+          (text) => {
+            chatbotFullResponse += text;
+            setGeminiResponse(chatbotFullResponse); // Update streaming UI
           }
         );
-
-        if (!response.ok) {
-          console.error("HTTP error!", response.status, response.statusText);
-          throw new Error(`HTTP error! status: ${response.status}`);
-        }
-
-        if (!response.body) {
-          console.error("Response body is null or undefined.");
+        console.log("Stream completed.");
+        setConversation((prev) => [
+          ...prev,
+          { role: "chatbot", content: chatbotFullResponse }, // Add full chatbot response
+        ]);
+      } catch (streamError) {
+        console.error("Stream error:", streamError);
+        if (streamError instanceof StreamError) {
+          setError(`Error from chatbot: ${streamError.message}. Please try again.`);
+        } else {
           setError(
-            "Error: Response body is null or undefined. Please try again."
+            "Error fetching streaming response. Please check your network and try again."
           );
-          return;
         }
-
-        const reader = response.body.getReader();
-        const decoder = new TextDecoder();
-        let accumulatedResponse = "";
-        let chatbotFullResponse = ""; // To store the full response for conversation history
-
-        const processStream = () => {
-          reader
-            .read()
-            .then(({ done, value }) => {
-              if (done) {
-                console.log("Stream completed.");
-                // console.log("Full response:", chatbotFullResponse);
-                setConversation((prev) => [
-                  ...prev,
-                  { role: "chatbot", content: chatbotFullResponse }, // Add full chatbot response
-                ]);
-                setLoading(false); // Remove loading state
-                setGeminiResponse("");
-                return;
-              }
-              const decodedChunk = decoder.decode(value, { stream: true });
-              // console.log("Decoded chunk:", decodedChunk);
-              // remove data: prefix from the decoded chunk
-              var cleanedChunk = decodedChunk.replace(/^data:\s/, "");
-              // console.log("Cleaned chunk:", cleanedChunk);
-
-              if (cleanedChunk.endsWith("\n\n")) {
-                // console.log("the pair of trailing newlines detected, removing them.");
-                cleanedChunk = cleanedChunk.slice(0, -2); // Remove trailing \n\n if it exists
-              }
-
-              if (cleanedChunk === "event: close\ndata: done") {
-                console.log("Stream end detected.");
-                // console.log("Full response:", chatbotFullResponse);
-                setConversation((prev) => [
-                  ...prev,
-                  { role: "chatbot", content: chatbotFullResponse }, // Add full chatbot response
-                ]);
-                setLoading(false); // Remove loading state
-                setGeminiResponse("");
-                return;
-              }
-
-              accumulatedResponse += cleanedChunk;
-              chatbotFullResponse += cleanedChunk; // Append to full response
-
-              // console.log("Accumulated response:", accumulatedResponse);
-
-              setGeminiResponse(accumulatedResponse); // Update streaming UI
-              processStream(); // Continue reading the stream
-            })
-            .catch((streamError) => {
-              console.error("Stream reading error:", streamError);
-              setError(
-                "Error streaming response from chatbot. Please try again."
-              );
-              setIsStreaming(false); // Streaming stopped due to error
-              setLoading(false);
-              reader.cancel(); // Cancel the reader on error
-            });
-        };
-
-        processStream(); // Start streaming
-
-        // Clear geminiResponse here, before stream starts to ensure clean UI
+        setIsStreaming(false); // Streaming stopped due to error
+      } finally {
+        setLoading(false); // Remove loading state
         setGeminiResponse("");
-      } catch (fetchError) {
-        console.error("Fetch error:", fetchError);
-        setError(
-          "Error fetching streaming response. Please check your network and try again."
-        );
-        setIsStreaming(false); // Streaming stopped due to fetch error
-        setLoading(false);
       }
     } else {
       // Non-streaming API call
       try {
         const chatConversationResponse = await chatConversationApi.post(
           `/${username}/${chatbotname}`,
-          {
+          chatRequestBody({
             conversationid: conversationID,
             message: userMessage,
-          }
+            attachments: userAttachments,
+          })
         );
         // Append chatbot response
         setConversation((prev) => [
@@ -379,6 +331,23 @@ const ConversationPage = () => {
           onChange={(e) => setUserInput(e.target.value)}
         />
         <div className="w-fit">
+          <label
+            className="border rounded-lg flex gap-1 items-center m-auto mb-1 p-1 cursor-pointer"
+            title="Attach images or PDFs"
+          >
+            <AttachFileIcon />
+            {attachments.length > 0 ? `${attachments.length} file(s)` : "Attach"}
+            <input
+              type="file"
+              className="hidden"
+              multiple
+              accept="image/jpeg,image/png,image/webp,application/pdf"
+              disabled={loading}
+              onChange={(e) =>
+                setAttachments(Array.from(e.target.files ?? []).slice(0, 4))
+              }
+            />
+          </label>
           <button
             className="border rounded-lg flex gap-1 items-center m-auto disabled:opacity-50"
             onClick={sendConversation}
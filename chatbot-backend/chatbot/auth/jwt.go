@@ -2,8 +2,9 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -38,62 +40,87 @@ func CreateJWT(secret []byte, userid int, username string) (string, error) {
 	return tokenString, nil
 }
 
+var errTokenMissing = errors.New("token missing, permission denied")
+
 func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStoreInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := GetTokenFromRequest(r)
-		if tokenString == "" {
-			utils.WriteError(w, http.StatusTeapot, fmt.Errorf("token missing, permission denied"))
-			return
-		}
-		// tokenString = tokenString[7:] //remove the bearer prefix
-		token, err := validateToken(tokenString)
+		u, err := authenticateRequest(r, store)
 		if err != nil {
-			log.Printf("failed to validate token: %v", err)
+			if errors.Is(err, errTokenMissing) {
+				utils.WriteError(w, http.StatusTeapot, err)
+				return
+			}
+			slog.WarnContext(r.Context(), "Rejected token", "error", err)
 			permissionDenied(w)
 			return
 		}
 
-		if !token.Valid {
-			log.Printf("invalid token")
-			permissionDenied(w)
-			return
-		}
+		handlerFunc(w, r.WithContext(contextWithUser(r.Context(), u)))
+	}
+}
 
-		claims := token.Claims.(jwt.MapClaims)
-		str := claims["userid"].(string)
-		userID, err := strconv.Atoi(str)
+// WithOptionalJWTAuth sets the user in the request context when the request has a valid token.
+// Requests without a valid token are still passed on to the handler without user details,
+// for endpoints that are public but behave differently for logged in users
+func WithOptionalJWTAuth(handlerFunc http.HandlerFunc, store types.UserStoreInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := authenticateRequest(r, store)
 		if err != nil {
-			log.Printf("failed to convert userID to int: %v", err)
-			permissionDenied(w)
+			if !errors.Is(err, errTokenMissing) {
+				slog.WarnContext(r.Context(), "Ignoring invalid token", "error", err)
+			}
+			handlerFunc(w, r)
 			return
 		}
 
-		u, err := store.GetUserByID(userID)
-		if err != nil {
-			log.Printf("failed to get user by id: %v", err)
-			permissionDenied(w)
-			return
-		}
+		handlerFunc(w, r.WithContext(contextWithUser(r.Context(), u)))
+	}
+}
 
-		if u == nil {
-			log.Printf("user not found")
-			permissionDenied(w)
-			return
-		}
+// authenticateRequest validates the token in the request and returns the user it belongs to
+func authenticateRequest(r *http.Request, store types.UserStoreInterface) (*types.User, error) {
+	tokenString := GetTokenFromRequest(r)
+	if tokenString == "" {
+		return nil, errTokenMissing
+	}
+	// tokenString = tokenString[7:] //remove the bearer prefix
+	token, err := validateToken(tokenString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token: %v", err)
+	}
 
-		if u.Username != claims["username"].(string) || u.Userid != userID {
-			log.Printf("jwt claims mismatched for userid %d, wrong userid %t, wrong username %t ", u.Userid, u.Userid != userID, u.Username != claims["username"].(string))
-			permissionDenied(w)
-			return
-		}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	str := claims["userid"].(string)
+	userID, err := strconv.Atoi(str)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert userID to int: %v", err)
+	}
 
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, UserIDKey, u.Userid)
-		ctx = context.WithValue(ctx, UsernameKey, u.Username)
-		r = r.WithContext(ctx)
+	u, err := store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %v", err)
+	}
 
-		handlerFunc(w, r)
+	if u == nil {
+		return nil, fmt.Errorf("user not found")
 	}
+
+	if u.Username != claims["username"].(string) || u.Userid != userID {
+		return nil, fmt.Errorf("jwt claims mismatched for userid %d, wrong userid %t, wrong username %t ", u.Userid, u.Userid != userID, u.Username != claims["username"].(string))
+	}
+
+	return u, nil
+}
+
+func contextWithUser(ctx context.Context, u *types.User) context.Context {
+	logging.AddFields(ctx, "user", u.Username)
+	ctx = context.WithValue(ctx, UserIDKey, u.Userid)
+	ctx = context.WithValue(ctx, UsernameKey, u.Username)
+	return ctx
 }
 
 func GetTokenFromRequest(r *http.Request) string {
@@ -267,11 +267,11 @@ func TestValidateTokenMiddleware(t *testing.T) {
 
 type mockUserStore struct{}
 
-func (m *mockUserStore) GetUserByName(username string) (*types.User, error) {
+func (m *mockUserStore) GetUserByName(ctx context.Context, username string) (*types.User, error) {
 	return nil, nil
 }
 
-func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
 	return &types.User{
 		Userid:      1,
 		Username:    "testuser",
@@ -281,10 +281,71 @@ func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
 	}, nil
 }
 
-func (m *mockUserStore) CreateUser(types.RegisterUserPayload) error {
+func (m *mockUserStore) CreateUser(context.Context, types.RegisterUserPayload) error {
 	return nil
 }
 
-func (m *mockUserStore) UpdateUserLastlogin(int) error {
+func (m *mockUserStore) UpdateUserLastlogin(context.Context, int) error {
 	return nil
 }
+
+func TestOptionalJWTAuthMiddleware(t *testing.T) {
+	secret := []byte(config.Envs.JWTSecret)
+	validToken, err := CreateJWT(secret, 1, "testuser")
+	if err != nil {
+		t.Fatalf("error creating validToken jwt: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		token            string
+		expectedUsername string
+	}{
+		{
+			name:             "valid token",
+			token:            validToken,
+			expectedUsername: "testuser",
+		},
+		{
+			name:             "no token",
+			token:            "",
+			expectedUsername: "",
+		},
+		{
+			name:             "invalid token",
+			token:            expiredToken,
+			expectedUsername: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, "/test", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.token != "" {
+				request.AddCookie(&http.Cookie{
+					Name:  CookieName,
+					Value: test.token,
+				})
+			}
+
+			var capturedUsername string
+			responseRecorder := httptest.NewRecorder()
+			router := http.NewServeMux()
+			router.HandleFunc("/test", WithOptionalJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+				capturedUsername = GetUsernameFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}, &mockUserStore{}))
+			router.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != http.StatusOK {
+				t.Errorf("expected status code %d, got %d", http.StatusOK, responseRecorder.Code)
+			}
+			if capturedUsername != test.expectedUsername {
+				t.Errorf("expected username %q in context, got %q", test.expectedUsername, capturedUsername)
+			}
+		})
+	}
+}
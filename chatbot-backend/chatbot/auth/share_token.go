@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ShareTokenExpiration is how long a visitor can chat with a password protected chatbot before entering the password again
+const ShareTokenExpiration = 2 * time.Hour
+
+// CreateShareToken signs a token letting the holder chat with the password protected chatbot, so the password does not
+// have to be checked against its hash on every request. Changing the password invalidates the tokens issued for it
+func CreateShareToken(secret []byte, chatbotID int, passwordHash string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"chatbotid": chatbotID,
+		"password":  passwordFingerprint(passwordHash),
+		"expiredAt": time.Now().Add(ShareTokenExpiration).Unix(),
+	})
+	return token.SignedString(shareTokenKey(secret))
+}
+
+// ValidShareToken reports whether tokenString was issued by CreateShareToken for the chatbot and its current password
+// and has not expired
+func ValidShareToken(secret []byte, tokenString string, chatbotID int, passwordHash string) bool {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return shareTokenKey(secret), nil
+	})
+	if err != nil || !token.Valid {
+		return false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	tokenChatbotID, ok := claims["chatbotid"].(float64)
+	if !ok || int(tokenChatbotID) != chatbotID {
+		return false
+	}
+	expiredAt, ok := claims["expiredAt"].(float64)
+	if !ok || time.Now().Unix() > int64(expiredAt) {
+		return false
+	}
+	fingerprint, ok := claims["password"].(string)
+	return ok && subtle.ConstantTimeCompare([]byte(fingerprint), []byte(passwordFingerprint(passwordHash))) == 1
+}
+
+// shareTokenKey derives the key share tokens are signed with from the JWT secret, so a share token can never
+// pass for a login token or the other way around
+func shareTokenKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("share-token"))
+	return mac.Sum(nil)
+}
+
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,33 @@
+package auth
+
+import "testing"
+
+func TestShareToken(t *testing.T) {
+	secret := []byte("jwt-secret")
+	token, err := CreateShareToken(secret, 7, "password-hash")
+	if err != nil {
+		t.Fatalf("error creating share token: %v", err)
+	}
+
+	if !ValidShareToken(secret, token, 7, "password-hash") {
+		t.Error("expected the share token to be valid for its chatbot and password")
+	}
+	if ValidShareToken(secret, token, 8, "password-hash") {
+		t.Error("expected the share token to be invalid for another chatbot")
+	}
+	if ValidShareToken(secret, token, 7, "changed-password-hash") {
+		t.Error("expected the share token to be invalid after the password changed")
+	}
+	if ValidShareToken([]byte("other-secret"), token, 7, "password-hash") {
+		t.Error("expected the share token to be invalid with another secret")
+	}
+
+	// a login token signed with the same secret is not a share token
+	loginToken, err := CreateJWT(secret, 7, "test user")
+	if err != nil {
+		t.Fatalf("error creating jwt: %v", err)
+	}
+	if ValidShareToken(secret, loginToken, 7, "password-hash") {
+		t.Error("expected a login token to be rejected as a share token")
+	}
+}
@@ -21,6 +21,25 @@ type Config struct {
 	API_FILE_EXPIRATION_HOUR int64
 	GEMINI_API_KEY           string
 	MODEL_NAME               string
+	LogLevel                 string
+	OTLPEndpoint             string
+	ServiceName              string
+	ReadTimeoutSeconds       int64
+	WriteTimeoutSeconds      int64
+	IdleTimeoutSeconds       int64
+	ShutdownTimeoutSeconds   int64
+	TurnSpoolPath            string
+	StreamChunkDelayMs       int64
+	StreamHeartbeatSeconds   int64
+	StreamResumeSeconds      int64
+	HistoryTokenLimit        int64
+	ToolAllowedHosts         string
+	ToolTimeoutSeconds       int64
+	WebhookAllowedHosts      string
+	WebhookTimeoutSeconds    int64
+	RetentionDays            int64
+	PurgeIntervalMinutes     int64
+	RedactPII                bool
 }
 
 var Envs = initConfig()
@@ -41,6 +60,25 @@ func initConfig() Config {
 		MODEL_NAME:               getEnv("MODEL_NAME", "gemini-2.0-flash-thinking-exp-01-21"),
 		JWTSecret:                getEnvSecretFileorOS("JWT_SECRET", "should-have-jwt-secret-here"),
 		GEMINI_API_KEY:           getEnvSecretFileorOS("GEMINI_API_KEY", ""),
+		LogLevel:                 getEnv("LOG_LEVEL", "info"),
+		OTLPEndpoint:             getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		ServiceName:              getEnv("OTEL_SERVICE_NAME", "chatbot-backend"),
+		ReadTimeoutSeconds:       getEnvInt("READ_TIMEOUT_SECONDS", 60),
+		WriteTimeoutSeconds:      getEnvInt("WRITE_TIMEOUT_SECONDS", 120),
+		IdleTimeoutSeconds:       getEnvInt("IDLE_TIMEOUT_SECONDS", 120),
+		ShutdownTimeoutSeconds:   getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30),
+		TurnSpoolPath:            getEnv("TURN_SPOOL_PATH", "database_files/spool/turns.jsonl"),
+		StreamChunkDelayMs:       getEnvInt("STREAM_CHUNK_DELAY_MS", 100),
+		StreamHeartbeatSeconds:   getEnvInt("STREAM_HEARTBEAT_SECONDS", 15),
+		StreamResumeSeconds:      getEnvInt("STREAM_RESUME_SECONDS", 30),
+		HistoryTokenLimit:        getEnvInt("HISTORY_TOKEN_LIMIT", 32000),
+		ToolAllowedHosts:         getEnv("TOOL_ALLOWED_HOSTS", ""),
+		ToolTimeoutSeconds:       getEnvInt("TOOL_TIMEOUT_SECONDS", 10),
+		WebhookAllowedHosts:      getEnv("WEBHOOK_ALLOWED_HOSTS", ""),
+		WebhookTimeoutSeconds:    getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+		RetentionDays:            getEnvInt("RETENTION_DAYS", 0),
+		PurgeIntervalMinutes:     getEnvInt("PURGE_INTERVAL_MINUTES", 60),
+		RedactPII:                getEnvBool("REDACT_PII", false),
 	}
 }
 
@@ -100,3 +138,18 @@ func getEnvInt(key string, fallback int64) int64 {
 	log.Printf("Environment variable %s not set, using fallback value: %d", key, fallback)
 	return fallback
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("Environment variable %s is not a boolean, using fallback value: %t", key, fallback)
+			return fallback
+		}
+
+		return boolValue
+	}
+
+	log.Printf("Environment variable %s not set, using fallback value: %t", key, fallback)
+	return fallback
+}
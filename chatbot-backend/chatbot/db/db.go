@@ -3,12 +3,122 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// tables that must exist before the server can start
+var requiredTables = []string{
+	"users",
+	"chatbots",
+	"conversations",
+	"apifiles",
+	"workspaces",
+	"workspace_members",
+	"workspace_invitations",
+	"chatbot_allowlist",
+	"chatbot_revisions",
+	"chatbot_templates",
+	"attachments",
+	"conversation_summaries",
+	"chatbot_tools",
+	"tool_calls",
+	"chatbot_webhooks",
+	"webhook_deliveries",
+	"message_feedback",
+	"conversation_branches",
+	"conversation_purges",
+	"moderation_rules",
+	"flagged_messages",
+}
+
+// columns added to existing tables after they were first created, older databases
+// are brought up to date by adding any missing column. New columns are always
+// appended to the end of the table so that SELECT * keeps the same column order.
+// backfill is run once right after the column is added to an existing table
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+	backfill   string
+}{
+	{"chatbots", "workspaceid", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"chatbots", "sharemode", "TEXT NOT NULL DEFAULT 'private'", "UPDATE chatbots SET sharemode='public' WHERE isShared=1"},
+	{"chatbots", "sharetoken", "TEXT NOT NULL DEFAULT ''", ""},
+	{"chatbots", "sharepassword", "TEXT NOT NULL DEFAULT ''", ""},
+	{"conversations", "revisionid", "INTEGER NOT NULL DEFAULT 0", ""},
+	// existing messages are numbered in the order they were inserted
+	{"conversations", "sequence", "INTEGER NOT NULL DEFAULT 0", `UPDATE conversations SET sequence = (
+	SELECT COUNT(*) FROM conversations AS earlier
+	WHERE earlier.conversationid = conversations.conversationid AND earlier.chatid <= conversations.chatid)`},
+	{"conversations", "interrupted", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"chatbots", "historystrategy", "TEXT NOT NULL DEFAULT 'window'", ""},
+	{"chatbots", "historytokenlimit", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"chatbots", "allowedorigins", "TEXT NOT NULL DEFAULT ''", ""},
+	{"chatbots", "widgettheme", "TEXT NOT NULL DEFAULT ''", ""},
+	{"conversations", "branch", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"chatbots", "retentiondays", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"chatbots", "redactpii", "INTEGER NOT NULL DEFAULT 0", ""},
+	// the question of a rated response is the message before it on its branch, which can be on a parent branch
+	{"message_feedback", "questionchatid", "INTEGER NOT NULL DEFAULT 0", `UPDATE message_feedback SET questionchatid = COALESCE((
+	WITH RECURSIVE path(branch, before) AS (
+		SELECT branch, sequence FROM conversations WHERE chatid = message_feedback.chatid
+		UNION ALL
+		SELECT fork.parentbranch, MIN(path.before, fork.forksequence) FROM path
+		JOIN conversation_branches AS fork ON fork.conversationid = message_feedback.conversationid AND fork.branch = path.branch
+	)
+	SELECT CASE WHEN question.role = 'user' THEN question.chatid ELSE 0 END
+	FROM path JOIN conversations AS question ON question.conversationid = message_feedback.conversationid
+		AND question.branch = path.branch AND question.sequence < path.before
+	ORDER BY question.sequence DESC LIMIT 1), 0)`},
+}
+
+// statements run on every start up to fill in data for features added after the rows were created.
+// They must be safe to run repeatedly
+var backfillStatements = []string{
+	// chatbots created before revisions were tracked start with their current configuration as revision 1
+	`INSERT INTO chatbot_revisions (chatbotid, revision, chatbotname, description, behaviour, usercontext, filepath, fileUpdatedDate, author, message, createddate)
+	SELECT chatbotid, 1, chatbotname, description, behaviour, usercontext, filepath, fileUpdatedDate, username, 'Initial revision', updateddate
+	FROM chatbots WHERE chatbotid NOT IN (SELECT chatbotid FROM chatbot_revisions)`,
+}
+
+// indexes created on every start up once the columns they cover exist
+var indexStatements = []string{
+	// a branch of a conversation cannot have two messages at the same position, so concurrent or replayed turns cannot interleave.
+	// Branches reuse the positions after their fork, so the index on the conversation alone is replaced
+	`DROP INDEX IF EXISTS conversations_sequence`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS conversations_branch_sequence ON conversations (conversationid, branch, sequence)`,
+	`CREATE INDEX IF NOT EXISTS conversations_chatbotid ON conversations (chatbotid)`,
+	`CREATE INDEX IF NOT EXISTS attachments_conversationid ON attachments (conversationid)`,
+	`CREATE INDEX IF NOT EXISTS tool_calls_conversationid ON tool_calls (conversationid)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, nextattempt)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhookid ON webhook_deliveries (webhookid)`,
+	`CREATE INDEX IF NOT EXISTS message_feedback_chatbotid ON message_feedback (chatbotid, rating)`,
+	`CREATE INDEX IF NOT EXISTS conversation_purges_chatbotid ON conversation_purges (chatbotid)`,
+	`CREATE INDEX IF NOT EXISTS moderation_rules_chatbotid ON moderation_rules (chatbotid)`,
+	`CREATE INDEX IF NOT EXISTS flagged_messages_chatbotid ON flagged_messages (chatbotid)`,
+}
+
+// the full-text index of conversation messages, kept up to date by triggers. It only holds the tokens and reads
+// the text from the conversations table. SQLite only has FTS5 when built with the sqlite_fts5 tag
+var searchStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS conversations_fts USING fts5(chat, content='conversations', content_rowid='chatid', tokenize='porter unicode61')`,
+	`CREATE TRIGGER IF NOT EXISTS conversations_fts_insert AFTER INSERT ON conversations BEGIN
+		INSERT INTO conversations_fts (rowid, chat) VALUES (new.chatid, new.chat);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS conversations_fts_delete AFTER DELETE ON conversations BEGIN
+		INSERT INTO conversations_fts (conversations_fts, rowid, chat) VALUES ('delete', old.chatid, old.chat);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS conversations_fts_update AFTER UPDATE OF chat ON conversations BEGIN
+		INSERT INTO conversations_fts (conversations_fts, rowid, chat) VALUES ('delete', old.chatid, old.chat);
+		INSERT INTO conversations_fts (rowid, chat) VALUES (new.chatid, new.chat);
+	END`,
+}
+
 func GetDBConnection() (*sql.DB, error) {
 	return sql.Open("sqlite3", config.Envs.DATABASE_PATH)
 }
@@ -23,6 +133,10 @@ func InitDB() (bool, error) {
 	defer db.Close()
 
 	if checktablesexist(db) {
+		if err := migrate(db); err != nil {
+			log.Printf("Error migrating database: %s\n", err)
+			return false, err
+		}
 		return true, errors.New("all tables already exist")
 	}
 
@@ -54,6 +168,16 @@ func InitDB() (bool, error) {
 		isShared BOOLEAN NOT NULL DEFAULT FALSE,
 		filepath TEXT NOT NULL DEFAULT '',
 		fileUpdatedDate TEXT NOT NULL DEFAULT '',
+		workspaceid INTEGER NOT NULL DEFAULT 0,
+		sharemode TEXT NOT NULL DEFAULT 'private',
+		sharetoken TEXT NOT NULL DEFAULT '',
+		sharepassword TEXT NOT NULL DEFAULT '',
+		historystrategy TEXT NOT NULL DEFAULT 'window',
+		historytokenlimit INTEGER NOT NULL DEFAULT 0,
+		allowedorigins TEXT NOT NULL DEFAULT '',
+		widgettheme TEXT NOT NULL DEFAULT '',
+		retentiondays INTEGER NOT NULL DEFAULT 0,
+		redactpii INTEGER NOT NULL DEFAULT 0,
 		FOREIGN KEY(username) REFERENCES users(username),
 		UNIQUE(username, chatbotname)
 	);`)
@@ -72,6 +196,10 @@ func InitDB() (bool, error) {
 		role TEXT NOT NULL,
 		chat TEXT NOT NULL,
 		createddate TEXT NOT NULL,
+		revisionid INTEGER NOT NULL DEFAULT 0,
+		sequence INTEGER NOT NULL DEFAULT 0,
+		interrupted INTEGER NOT NULL DEFAULT 0,
+		branch INTEGER NOT NULL DEFAULT 0,
 		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid),
 		FOREIGN KEY(username) REFERENCES users(username),
 		FOREIGN KEY(chatbotname) REFERENCES chatbots(chatbotname)
@@ -95,23 +223,443 @@ func InitDB() (bool, error) {
 		return false, err
 	}
 
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS workspaces (
+		workspaceid INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		owner TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(owner) REFERENCES users(username)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising workspaces table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS workspace_members (
+		workspaceid INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		role TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(workspaceid) REFERENCES workspaces(workspaceid),
+		FOREIGN KEY(username) REFERENCES users(username),
+		UNIQUE(workspaceid, username)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising workspace_members table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS workspace_invitations (
+		inviteid INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspaceid INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		role TEXT NOT NULL,
+		invitedby TEXT NOT NULL,
+		status TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(workspaceid) REFERENCES workspaces(workspaceid),
+		FOREIGN KEY(username) REFERENCES users(username)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising workspace_invitations table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS chatbot_allowlist (
+		chatbotid INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid),
+		FOREIGN KEY(username) REFERENCES users(username),
+		UNIQUE(chatbotid, username)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising chatbot_allowlist table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS chatbot_revisions (
+		revisionid INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatbotid INTEGER NOT NULL,
+		revision INTEGER NOT NULL,
+		chatbotname TEXT NOT NULL,
+		description TEXT NOT NULL,
+		behaviour TEXT NOT NULL,
+		usercontext TEXT NOT NULL,
+		filepath TEXT NOT NULL,
+		fileUpdatedDate TEXT NOT NULL,
+		author TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid),
+		UNIQUE(chatbotid, revision)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising chatbot_revisions table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS chatbot_templates (
+		templateid INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL,
+		behaviour TEXT NOT NULL,
+		usercontext TEXT NOT NULL,
+		filepath TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(username) REFERENCES users(username),
+		UNIQUE(username, name)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising chatbot_templates table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS attachments (
+		attachmentid INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversationid TEXT NOT NULL,
+		chatbotid INTEGER NOT NULL,
+		chatid INTEGER NOT NULL DEFAULT 0,
+		filename TEXT NOT NULL,
+		filepath TEXT NOT NULL,
+		mimetype TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising attachments table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS conversation_summaries (
+		conversationid TEXT PRIMARY KEY,
+		chatbotid INTEGER NOT NULL,
+		summary TEXT NOT NULL,
+		uptosequence INTEGER NOT NULL,
+		updateddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising conversation_summaries table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS chatbot_tools (
+		toolid INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatbotid INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		url TEXT NOT NULL DEFAULT '',
+		parameters TEXT NOT NULL DEFAULT '',
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid),
+		UNIQUE(chatbotid, name)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising chatbot_tools table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS tool_calls (
+		toolcallid INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversationid TEXT NOT NULL,
+		chatbotid INTEGER NOT NULL,
+		chatid INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		arguments TEXT NOT NULL,
+		result TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		durationms INTEGER NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising tool_calls table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS chatbot_webhooks (
+		webhookid INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatbotid INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising chatbot_webhooks table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		deliveryid INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhookid INTEGER NOT NULL,
+		chatbotid INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		responsestatus INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		nextattempt INTEGER NOT NULL,
+		createddate TEXT NOT NULL,
+		updateddate TEXT NOT NULL,
+		FOREIGN KEY(webhookid) REFERENCES chatbot_webhooks(webhookid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising webhook_deliveries table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS message_feedback (
+		feedbackid INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatid INTEGER NOT NULL UNIQUE,
+		conversationid TEXT NOT NULL,
+		chatbotid INTEGER NOT NULL,
+		revisionid INTEGER NOT NULL DEFAULT 0,
+		rating TEXT NOT NULL,
+		comment TEXT NOT NULL DEFAULT '',
+		username TEXT NOT NULL DEFAULT '',
+		createddate TEXT NOT NULL,
+		updateddate TEXT NOT NULL,
+		questionchatid INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(chatid) REFERENCES conversations(chatid),
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising message_feedback table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS conversation_branches (
+		conversationid TEXT NOT NULL,
+		branch INTEGER NOT NULL,
+		parentbranch INTEGER NOT NULL,
+		forksequence INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		PRIMARY KEY (conversationid, branch)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising conversation_branches table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS conversation_purges (
+		purgeid INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatbotid INTEGER NOT NULL,
+		conversations INTEGER NOT NULL,
+		messages INTEGER NOT NULL,
+		retentiondays INTEGER NOT NULL,
+		cutoffdate TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising conversation_purges table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS moderation_rules (
+		ruleid INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatbotid INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		pattern TEXT NOT NULL,
+		action TEXT NOT NULL,
+		stage TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising moderation_rules table: %s\n", err)
+		return false, err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS flagged_messages (
+		flagid INTEGER PRIMARY KEY AUTOINCREMENT,
+		chatbotid INTEGER NOT NULL,
+		conversationid TEXT NOT NULL,
+		stage TEXT NOT NULL,
+		action TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		content TEXT NOT NULL,
+		createddate TEXT NOT NULL,
+		FOREIGN KEY(chatbotid) REFERENCES chatbots(chatbotid)
+	);`)
+	if err != nil {
+		log.Printf("Error initalising flagged_messages table: %s\n", err)
+		return false, err
+	}
+
+	if err = migrate(db); err != nil {
+		log.Printf("Error migrating database: %s\n", err)
+		return false, err
+	}
+
 	return true, err
 }
 
+// migrate brings the tables of an existing database up to date
+func migrate(db *sql.DB) error {
+	if err := migrateColumns(db); err != nil {
+		return err
+	}
+	for _, statement := range backfillStatements {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	for _, statement := range indexStatements {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return migrateSearch(db)
+}
+
+// migrateSearch creates the full-text index of conversation messages and indexes the existing messages when it
+// is new. Without FTS5 the server still starts, with conversation search unavailable
+func migrateSearch(db *sql.DB) error {
+	var available bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available); err != nil {
+		return err
+	}
+	if !available {
+		log.Println("SQLite was built without FTS5, conversation search is disabled. Build with -tags sqlite_fts5 to enable it")
+		// a database indexed by a build with FTS5 has triggers writing to the index, which would fail every new message
+		return dropSearchTriggers(db)
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type='table' AND name='conversations_fts'").Scan(&exists); err != nil {
+		return err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(searchTriggers)), ", ")
+	args := make([]interface{}, len(searchTriggers))
+	for i, trigger := range searchTriggers {
+		args[i] = trigger
+	}
+	var triggers int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='trigger' AND name IN ("+placeholders+")", args...).Scan(&triggers); err != nil {
+		return err
+	}
+
+	for _, statement := range searchStatements {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	// the triggers are missing when a build without FTS5 used the database, so messages saved meanwhile are not indexed
+	if !exists || triggers < len(searchTriggers) {
+		log.Println("Indexing existing conversation messages for search")
+		if _, err := db.Exec("INSERT INTO conversations_fts (conversations_fts) VALUES ('rebuild')"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchTriggers are the triggers created by searchStatements to keep the full-text index up to date
+var searchTriggers = []string{"conversations_fts_insert", "conversations_fts_delete", "conversations_fts_update"}
+
+func dropSearchTriggers(db *sql.DB) error {
+	for _, trigger := range searchTriggers {
+		if _, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateColumns(db *sql.DB) error {
+	for _, migration := range columnMigrations {
+		exists, err := columnExists(db, migration.table, migration.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		log.Printf("Adding column '%s' to table '%s'\n", migration.column, migration.table)
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", migration.table, migration.column, migration.definition))
+		if err != nil {
+			return err
+		}
+		if migration.backfill != "" {
+			if _, err = db.Exec(migration.backfill); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func columnExists(db *sql.DB, table string, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 func checktablesexist(db *sql.DB) bool {
 	var answer bool = true
 
-	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name IN ('users', 'chatbots', 'conversations', 'apifiles');")
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(requiredTables)), ", ")
+	args := make([]interface{}, len(requiredTables))
+	for i, table := range requiredTables {
+		args[i] = table
+	}
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name IN ("+placeholders+");", args...)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer rows.Close()
 	// Read results into a map
-	tableExists := map[string]bool{
-		"users":         false,
-		"chatbots":      false,
-		"conversations": false,
-		"apifiles":      false,
+	tableExists := map[string]bool{}
+	for _, table := range requiredTables {
+		tableExists[table] = false
 	}
 
 	for rows.Next() {
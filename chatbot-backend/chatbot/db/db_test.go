@@ -0,0 +1,45 @@
+//go:build !sqlite_fts5
+
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+)
+
+func TestMigrateSearchWithoutFTS5(t *testing.T) {
+	previous := config.Envs.DATABASE_PATH
+	config.Envs.DATABASE_PATH = filepath.Join(t.TempDir(), "test.db")
+	t.Cleanup(func() { config.Envs.DATABASE_PATH = previous })
+
+	if _, err := InitDB(); err != nil {
+		t.Fatalf("error creating tables: %v", err)
+	}
+	db, err := GetDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like a database indexed by a build with FTS5, whose index this build cannot write to
+	_, err = db.Exec(`CREATE TRIGGER conversations_fts_insert AFTER INSERT ON conversations BEGIN
+		INSERT INTO conversations_fts (rowid, chat) VALUES (new.chatid, new.chat);
+	END`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := InitDB(); !exists {
+		t.Fatalf("error migrating database: %v", err)
+	}
+	db, err = GetDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("INSERT INTO conversations (conversationid, chatbotid, username, chatbotname, role, chat, createddate) VALUES ('conv', 1, 'owner', 'bot', 'user', 'hello', '')")
+	if err != nil {
+		t.Errorf("expected messages to be saved once search is disabled, got %v", err)
+	}
+}
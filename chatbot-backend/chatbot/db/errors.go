@@ -0,0 +1,27 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// IsBusy reports whether err is SQLite refusing the write because another connection holds the lock,
+// in which case the same write is expected to succeed when tried again later
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// IsUniqueViolation reports whether err is SQLite rejecting a row that has the same value as another row
+// in a column that must be unique
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
+}
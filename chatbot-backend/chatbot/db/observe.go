@@ -0,0 +1,23 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/tracing"
+)
+
+// TrackQuery starts a span for a store method and returns the context to run its queries with.
+// Calling the returned function ends the span and records the query duration, so stores use
+//
+//	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.GetChatbotsByID")
+//	defer endQuery()
+func TrackQuery(ctx context.Context, query string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.StartDB(ctx, query)
+	return ctx, func() {
+		span.End()
+		metrics.ObserveDBQuery(query, start)
+	}
+}
@@ -0,0 +1,214 @@
+// Package moderation checks visitor messages before they are sent to the model and model responses as they
+// are streamed, against the keyword and regex rules of the chatbot and an optional classifier. Messages are
+// let through, flagged for the owner to review, or blocked
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/retention"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+)
+
+// MaxRulesPerChatbot keeps checking every streamed chunk against the rules cheap
+const MaxRulesPerChatbot = 50
+
+// BlockedResponse replaces a blocked model response in the conversation
+const BlockedResponse = "This response was withheld because it goes against the content rules of this chatbot."
+
+// flagged content is cut to this many bytes so a long message does not fill the review queue
+const maxFlaggedContentBytes = 4000
+
+// Decision is what moderation decided for a message, an empty Action lets it through
+type Decision struct {
+	Action string
+	Reason string
+}
+
+func (d Decision) Blocked() bool {
+	return d.Action == types.ModerationActionBlock
+}
+
+func (d Decision) Flagged() bool {
+	return d.Action == types.ModerationActionFlag
+}
+
+// stronger returns the decision that acts more on the message, the first one when both act the same
+func stronger(a, b Decision) Decision {
+	if b.Blocked() && !a.Blocked() || b.Flagged() && a.Action == "" {
+		return b
+	}
+	return a
+}
+
+// Classifier decides on messages with a model or service, after the rules of the chatbot let them through.
+// Classify is given the stage of the message and returns a Decision with an empty Action for messages that are fine
+type Classifier interface {
+	Classify(ctx context.Context, stage string, text string) (Decision, error)
+}
+
+// Validate checks a rule before it is saved. Regex rules must compile, keywords must have more than spaces
+func Validate(rule types.NewModerationRule) error {
+	if strings.TrimSpace(rule.Pattern) == "" {
+		return fmt.Errorf("pattern must not be empty")
+	}
+	if _, err := compile(rule.Kind, rule.Pattern); err != nil {
+		return err
+	}
+	return nil
+}
+
+// compile turns the pattern of a rule into a regular expression. Keywords match as whole words in any case,
+// with any spacing between the words of a phrase
+func compile(kind string, pattern string) (*regexp.Regexp, error) {
+	switch kind {
+	case types.ModerationKindKeyword:
+		words := strings.Fields(pattern)
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		expression := strings.Join(words, `\s+`)
+		// \b only separates words from what is around them when the keyword starts or ends with a word character
+		pattern = strings.TrimSpace(pattern)
+		if first, _ := utf8.DecodeRuneInString(pattern); isWordChar(first) {
+			expression = `\b` + expression
+		}
+		if last, _ := utf8.DecodeLastRuneInString(pattern); isWordChar(last) {
+			expression += `\b`
+		}
+		return regexp.Compile("(?i)" + expression)
+	case types.ModerationKindRegex:
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		return expression, nil
+	default:
+		return nil, fmt.Errorf("unknown rule kind %s", kind)
+	}
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// Moderator checks messages and records the ones it flags or blocks. A nil Moderator lets everything through
+type Moderator struct {
+	store      types.ModerationStoreInterface
+	classifier Classifier
+}
+
+// NewModerator returns a moderator applying the rules in store, and the classifier if it is not nil
+func NewModerator(store types.ModerationStoreInterface, classifier Classifier) *Moderator {
+	return &Moderator{store: store, classifier: classifier}
+}
+
+// HasClassifier reports whether messages are also checked by a classifier
+func (m *Moderator) HasClassifier() bool {
+	return m != nil && m.classifier != nil
+}
+
+type compiledRule struct {
+	types.ModerationRule
+	expression *regexp.Regexp
+}
+
+// Filter checks the messages of one chatbot. A nil Filter lets everything through
+type Filter struct {
+	moderator *Moderator
+	chatbot   *types.Chatbot
+	rules     []compiledRule
+}
+
+// Filter loads the moderation rules of the chatbot. Rules that no longer compile are left out
+func (m *Moderator) Filter(ctx context.Context, chatbot *types.Chatbot) (*Filter, error) {
+	if m == nil {
+		return nil, nil
+	}
+	rules, err := m.store.GetRulesByChatbotID(ctx, chatbot.Chatbotid)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &Filter{moderator: m, chatbot: chatbot}
+	for _, rule := range rules {
+		expression, err := compile(rule.Kind, rule.Pattern)
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping moderation rule that does not compile", "ruleid", rule.Ruleid, "error", err)
+			continue
+		}
+		filter.rules = append(filter.rules, compiledRule{ModerationRule: rule, expression: expression})
+	}
+	return filter, nil
+}
+
+// Match checks text against the rules of the stage only, cheap enough to run on every streamed chunk.
+// A blocking rule wins over a flagging one
+func (f *Filter) Match(stage string, text string) Decision {
+	decision := Decision{}
+	if f == nil {
+		return decision
+	}
+	for _, rule := range f.rules {
+		if rule.Stage != stage && rule.Stage != types.ModerationStageBoth {
+			continue
+		}
+		if rule.expression.MatchString(text) {
+			decision = stronger(decision, Decision{Action: rule.Action, Reason: fmt.Sprintf("%s rule %d: %s", rule.Kind, rule.Ruleid, rule.Pattern)})
+			if decision.Blocked() {
+				return decision
+			}
+		}
+	}
+	return decision
+}
+
+// Check checks text against the rules of the stage and, unless a rule already blocks it, the classifier.
+// Messages the classifier cannot decide on are let through
+func (f *Filter) Check(ctx context.Context, stage string, text string) Decision {
+	decision := f.Match(stage, text)
+	if f == nil || decision.Blocked() || !f.moderator.HasClassifier() {
+		return decision
+	}
+	classified, err := f.moderator.classifier.Classify(ctx, stage, text)
+	if err != nil {
+		slog.WarnContext(ctx, "Error classifying message, letting it through", "stage", stage, "error", err)
+		return decision
+	}
+	return stronger(decision, classified)
+}
+
+// Record saves a message moderation flagged or blocked for the owner to review. Personal data is redacted from it
+// if the chatbot's messages are saved redacted
+func (f *Filter) Record(ctx context.Context, conversationID string, stage string, decision Decision, content string) {
+	if f == nil || decision.Action == "" {
+		return
+	}
+	metrics.ModerationActionsTotal.WithLabelValues(stage, decision.Action).Inc()
+	slog.InfoContext(ctx, "Message moderated", "stage", stage, "action", decision.Action, "reason", decision.Reason)
+
+	if retention.RedactsPII(f.chatbot) {
+		content = retention.RedactPII(content)
+	}
+	if len(content) > maxFlaggedContentBytes {
+		content = strings.ToValidUTF8(content[:maxFlaggedContentBytes], "") + "…"
+	}
+	_, err := f.moderator.store.CreateFlaggedMessage(ctx, types.FlaggedMessage{
+		Chatbotid:      f.chatbot.Chatbotid,
+		Conversationid: conversationID,
+		Stage:          stage,
+		Action:         decision.Action,
+		Reason:         decision.Reason,
+		Content:        content,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error recording moderated message", "error", err)
+	}
+}
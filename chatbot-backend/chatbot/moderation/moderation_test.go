@@ -0,0 +1,158 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+type mockModerationStore struct {
+	types.ModerationStoreInterface
+	rules   []types.ModerationRule
+	flagged []types.FlaggedMessage
+}
+
+func (m *mockModerationStore) GetRulesByChatbotID(ctx context.Context, chatbotID int) ([]types.ModerationRule, error) {
+	return m.rules, nil
+}
+
+func (m *mockModerationStore) CreateFlaggedMessage(ctx context.Context, flagged types.FlaggedMessage) (int, error) {
+	m.flagged = append(m.flagged, flagged)
+	return len(m.flagged), nil
+}
+
+type mockClassifier struct {
+	decision Decision
+	err      error
+	calls    int
+}
+
+func (c *mockClassifier) Classify(ctx context.Context, stage string, text string) (Decision, error) {
+	c.calls++
+	return c.decision, c.err
+}
+
+func newFilter(t *testing.T, store *mockModerationStore, classifier Classifier) *Filter {
+	filter, err := NewModerator(store, classifier).Filter(context.Background(), &types.Chatbot{Chatbotid: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+func TestKeywordRules(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		matches bool
+	}{
+		{"refund", "Can I get a REFUND?", true},
+		{"refund", "refunds are processed weekly", false},
+		{"credit card", "my credit\n card was charged", true},
+		{"c++", "I write C++ daily", true},
+		{"a.b", "axb", false},
+	}
+	for _, tt := range tests {
+		expression, err := compile(types.ModerationKindKeyword, tt.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		if expression.MatchString(tt.text) != tt.matches {
+			t.Errorf("%q in %q: expected match %v", tt.pattern, tt.text, tt.matches)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []types.NewModerationRule{
+		{Kind: types.ModerationKindKeyword, Pattern: "refund"},
+		{Kind: types.ModerationKindRegex, Pattern: `(?i)\bkill\s+(yourself|urself)\b`},
+	}
+	for _, rule := range valid {
+		if err := Validate(rule); err != nil {
+			t.Errorf("%+v: unexpected error %v", rule, err)
+		}
+	}
+	invalid := []types.NewModerationRule{
+		{Kind: types.ModerationKindKeyword, Pattern: "   "},
+		{Kind: types.ModerationKindRegex, Pattern: "(unclosed"},
+		{Kind: "classifier", Pattern: "refund"},
+	}
+	for _, rule := range invalid {
+		if err := Validate(rule); err == nil {
+			t.Errorf("%+v: expected an error", rule)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	store := &mockModerationStore{rules: []types.ModerationRule{
+		{Ruleid: 1, Kind: types.ModerationKindKeyword, Pattern: "competitor", Action: types.ModerationActionFlag, Stage: types.ModerationStageBoth},
+		{Ruleid: 2, Kind: types.ModerationKindRegex, Pattern: `\d{3}-\d{2}-\d{4}`, Action: types.ModerationActionBlock, Stage: types.ModerationStageOutput},
+		{Ruleid: 3, Kind: types.ModerationKindRegex, Pattern: "(broken", Action: types.ModerationActionBlock, Stage: types.ModerationStageBoth},
+	}}
+	filter := newFilter(t, store, nil)
+
+	if decision := filter.Match(types.ModerationStageInput, "hello"); decision.Action != "" {
+		t.Errorf("expected a message matching no rule to be let through, got %+v", decision)
+	}
+	if decision := filter.Match(types.ModerationStageInput, "is the competitor cheaper? 123-45-6789"); !decision.Flagged() {
+		t.Errorf("expected output rules to be skipped for input, got %+v", decision)
+	}
+	decision := filter.Match(types.ModerationStageOutput, "the competitor's number is 123-45-6789")
+	if !decision.Blocked() || !strings.Contains(decision.Reason, "rule 2") {
+		t.Errorf("expected the blocking rule to win over the flagging one, got %+v", decision)
+	}
+
+	var nilFilter *Filter
+	if decision := nilFilter.Check(context.Background(), types.ModerationStageInput, "competitor"); decision.Action != "" {
+		t.Errorf("expected a nil filter to let everything through, got %+v", decision)
+	}
+}
+
+func TestCheckWithClassifier(t *testing.T) {
+	store := &mockModerationStore{rules: []types.ModerationRule{
+		{Ruleid: 1, Kind: types.ModerationKindKeyword, Pattern: "banned", Action: types.ModerationActionBlock, Stage: types.ModerationStageBoth},
+	}}
+	classifier := &mockClassifier{decision: Decision{Action: types.ModerationActionFlag, Reason: "harassment"}}
+	filter := newFilter(t, store, classifier)
+	ctx := context.Background()
+
+	if decision := filter.Check(ctx, types.ModerationStageInput, "a banned word"); !decision.Blocked() || classifier.calls != 0 {
+		t.Errorf("expected messages blocked by a rule not to be classified, got %+v after %d calls", decision, classifier.calls)
+	}
+	if decision := filter.Check(ctx, types.ModerationStageInput, "you are useless"); !decision.Flagged() || decision.Reason != "harassment" {
+		t.Errorf("expected the classifier to flag the message, got %+v", decision)
+	}
+
+	classifier.err = errors.New("classifier unavailable")
+	if decision := filter.Check(ctx, types.ModerationStageInput, "you are useless"); decision.Action != "" {
+		t.Errorf("expected messages the classifier cannot decide on to be let through, got %+v", decision)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	store := &mockModerationStore{}
+	filter, _ := NewModerator(store, nil).Filter(context.Background(), &types.Chatbot{Chatbotid: 7, Redactpii: true})
+	ctx := context.Background()
+
+	filter.Record(ctx, "conversation", types.ModerationStageInput, Decision{}, "let through")
+	if len(store.flagged) != 0 {
+		t.Fatalf("expected messages let through not to be recorded, got %+v", store.flagged)
+	}
+
+	filter.Record(ctx, "conversation", types.ModerationStageInput, Decision{Action: types.ModerationActionFlag, Reason: "keyword rule 1: refund"}, "refund to jane@example.com "+strings.Repeat("x", maxFlaggedContentBytes))
+	if len(store.flagged) != 1 {
+		t.Fatalf("expected the flagged message to be recorded, got %+v", store.flagged)
+	}
+	flagged := store.flagged[0]
+	if flagged.Chatbotid != 7 || flagged.Conversationid != "conversation" || flagged.Action != types.ModerationActionFlag {
+		t.Errorf("unexpected record %+v", flagged)
+	}
+	if !strings.HasPrefix(flagged.Content, "refund to [email] ") || len(flagged.Content) > maxFlaggedContentBytes+len("…") {
+		t.Errorf("expected the content to be redacted and cut short, got %d bytes starting %.30q", len(flagged.Content), flagged.Content)
+	}
+}
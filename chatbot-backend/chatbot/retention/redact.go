@@ -0,0 +1,59 @@
+package retention
+
+import (
+	"regexp"
+	"strings"
+)
+
+// what redacted personal data is replaced with in saved messages
+const (
+	RedactedEmail = "[email]"
+	RedactedCard  = "[card number]"
+	RedactedPhone = "[phone number]"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// 13 to 19 digits, optionally grouped with spaces or dashes
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// an optional country code and area code followed by groups of 3 or 4 digits, so dates and short numbers are left alone
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\b\d{3,4}[ .-]?\d{3,4}(?:[ .-]?\d{3,4})?\b`)
+)
+
+// RedactPII replaces email addresses, card numbers and phone numbers in text. Only digit sequences passing
+// the Luhn check are taken for card numbers, so long order or reference numbers are not mistaken for them
+func RedactPII(text string) string {
+	text = emailPattern.ReplaceAllString(text, RedactedEmail)
+	text = cardPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if luhnValid(match) {
+			return RedactedCard
+		}
+		return match
+	})
+	return phonePattern.ReplaceAllString(text, RedactedPhone)
+}
+
+// luhnValid reports whether the digits in number pass the Luhn checksum card numbers end with
+func luhnValid(number string) bool {
+	digits := strings.Map(func(c rune) rune {
+		if c >= '0' && c <= '9' {
+			return c
+		}
+		return -1
+	}, number)
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
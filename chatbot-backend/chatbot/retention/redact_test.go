@@ -0,0 +1,33 @@
+package retention
+
+import "testing"
+
+func TestRedactPII(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"reach me at jane.doe+shop@mail.example.co.uk please", "reach me at " + RedactedEmail + " please"},
+		{"my card is 4111 1111 1111 1111, expiry 12/27", "my card is " + RedactedCard + ", expiry 12/27"},
+		{"card 4111-1111-1111-1111", "card " + RedactedCard},
+		{"call +65 9123 4567 or (02) 9876 5432", "call " + RedactedPhone + " or " + RedactedPhone},
+		{"or 555-123-4567 after 6", "or " + RedactedPhone + " after 6"},
+		// not personal data
+		{"order 1234567890123456 ships on 2026-10-19 at 10:30", "order 1234567890123456 ships on 2026-10-19 at 10:30"},
+		{"the answer is 42 and pi is 3.14159", "the answer is 42 and pi is 3.14159"},
+	}
+	for _, tt := range tests {
+		if redacted := RedactPII(tt.text); redacted != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.text, tt.expected, redacted)
+		}
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	if !luhnValid("4111 1111 1111 1111") || !luhnValid("5500-0000-0000-0004") {
+		t.Error("expected test card numbers to pass the Luhn check")
+	}
+	if luhnValid("4111 1111 1111 1112") {
+		t.Error("expected a mistyped card number to fail the Luhn check")
+	}
+}
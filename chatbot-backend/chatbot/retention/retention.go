@@ -0,0 +1,145 @@
+// Package retention applies the data retention policies of chatbots. Conversations are deleted once they have had
+// no messages for longer than the policy allows, every purge is recorded in an audit log, and personal data can be
+// redacted from messages before they are saved
+package retention
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+)
+
+// conversations are deleted in batches so a large purge does not hold the database for long
+const purgeBatchSize = 100
+
+// Days returns how many days conversations with a chatbot set to keep them for chatbotDays are kept, 0 for forever.
+// Chatbots can only keep conversations for less time than the server default
+func Days(chatbotDays int) int {
+	serverDays := int(config.Envs.RetentionDays)
+	switch {
+	case chatbotDays <= 0:
+		return max(serverDays, 0)
+	case serverDays <= 0:
+		return chatbotDays
+	}
+	return min(chatbotDays, serverDays)
+}
+
+// RedactsPII reports whether personal data is redacted from the chatbot's messages before they are saved
+func RedactsPII(chatbot *types.Chatbot) bool {
+	return config.Envs.RedactPII || chatbot.Redactpii
+}
+
+// Purger deletes the conversations that are past the retention policy of their chatbot
+type Purger struct {
+	store    types.RetentionStoreInterface
+	interval time.Duration
+}
+
+func NewPurger(store types.RetentionStoreInterface) *Purger {
+	return &Purger{
+		store:    store,
+		interval: time.Duration(config.Envs.PurgeIntervalMinutes) * time.Minute,
+	}
+}
+
+// Run purges conversations on start up and then every interval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		slog.Warn("Purge interval is not positive, conversations are not purged")
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Purge(ctx, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "Error purging conversations", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes the conversations of every chatbot whose last message was sent before its retention period up to now
+func (p *Purger) Purge(ctx context.Context, now time.Time) error {
+	policies, err := p.store.GetRetentionPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		days := Days(policy.Retentiondays)
+		if days == 0 {
+			continue
+		}
+		if err := p.purgeChatbot(ctx, policy.Chatbotid, days, now.AddDate(0, 0, -days)); err != nil {
+			slog.ErrorContext(ctx, "Error purging conversations of chatbot", "chatbotid", policy.Chatbotid, "error", err)
+		}
+	}
+	return nil
+}
+
+func (p *Purger) purgeChatbot(ctx context.Context, chatbotID int, days int, cutoff time.Time) error {
+	activity, err := p.store.GetConversationActivity(ctx, chatbotID)
+	if err != nil {
+		return err
+	}
+	expired := []string{}
+	for _, conversation := range activity {
+		if lastMessage, err := time.Parse(time.RFC822Z, conversation.Lastmessagedate); err == nil && lastMessage.Before(cutoff) {
+			expired = append(expired, conversation.Conversationid)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	// batches already deleted are recorded in the audit log even if a later batch fails
+	total := types.PurgedConversations{}
+	var purgeErr error
+	for start := 0; start < len(expired); start += purgeBatchSize {
+		purged, err := p.store.PurgeConversations(ctx, chatbotID, expired[start:min(start+purgeBatchSize, len(expired))])
+		if err != nil {
+			purgeErr = err
+			break
+		}
+		total.Conversations += purged.Conversations
+		total.Messages += purged.Messages
+		for _, path := range purged.Attachmentpaths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				slog.WarnContext(ctx, "Error removing attachment of purged conversation", "path", path, "error", err)
+			}
+		}
+	}
+	if total.Conversations == 0 {
+		return purgeErr
+	}
+
+	if location, err := time.LoadLocation(config.Envs.Timezone); err == nil {
+		cutoff = cutoff.In(location)
+	}
+	if _, err := p.store.CreatePurgeRecord(ctx, types.ConversationPurge{
+		Chatbotid:     chatbotID,
+		Conversations: total.Conversations,
+		Messages:      total.Messages,
+		Retentiondays: days,
+		Cutoffdate:    cutoff.Format(time.RFC822Z),
+	}); err != nil {
+		return errors.Join(purgeErr, err)
+	}
+	metrics.ConversationsPurgedTotal.Add(float64(total.Conversations))
+	slog.InfoContext(ctx, "Purged conversations past retention", "chatbotid", chatbotID, "conversations", total.Conversations, "messages", total.Messages, "retention_days", days)
+	return purgeErr
+}
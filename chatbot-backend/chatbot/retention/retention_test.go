@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+type mockRetentionStore struct {
+	types.RetentionStoreInterface
+	policies    []types.ChatbotRetention
+	activity    map[int][]types.ConversationActivity
+	attachments map[string]string
+	failAfter   int // purges fail once this many batches were purged, if set
+	purged      [][]string
+	records     []types.ConversationPurge
+}
+
+func (m *mockRetentionStore) GetRetentionPolicies(ctx context.Context) ([]types.ChatbotRetention, error) {
+	return m.policies, nil
+}
+
+func (m *mockRetentionStore) GetConversationActivity(ctx context.Context, chatbotID int) ([]types.ConversationActivity, error) {
+	return m.activity[chatbotID], nil
+}
+
+func (m *mockRetentionStore) PurgeConversations(ctx context.Context, chatbotID int, conversationIDs []string) (types.PurgedConversations, error) {
+	if m.failAfter > 0 && len(m.purged) == m.failAfter {
+		return types.PurgedConversations{}, errors.New("database is locked")
+	}
+	m.purged = append(m.purged, conversationIDs)
+	purged := types.PurgedConversations{Conversations: len(conversationIDs), Messages: 2 * len(conversationIDs)}
+	for _, conversationID := range conversationIDs {
+		if path, ok := m.attachments[conversationID]; ok {
+			purged.Attachmentpaths = append(purged.Attachmentpaths, path)
+		}
+	}
+	return purged, nil
+}
+
+func (m *mockRetentionStore) CreatePurgeRecord(ctx context.Context, purge types.ConversationPurge) (int, error) {
+	m.records = append(m.records, purge)
+	return len(m.records), nil
+}
+
+func withRetentionDays(t *testing.T, days int64) {
+	previous := config.Envs.RetentionDays
+	config.Envs.RetentionDays = days
+	t.Cleanup(func() { config.Envs.RetentionDays = previous })
+}
+
+func TestDays(t *testing.T) {
+	tests := []struct {
+		server, chatbot, expected int
+	}{
+		{server: 0, chatbot: 0, expected: 0},
+		{server: 0, chatbot: 30, expected: 30},
+		{server: 90, chatbot: 0, expected: 90},
+		{server: 90, chatbot: 30, expected: 30},
+		{server: 30, chatbot: 90, expected: 30},
+	}
+	for _, tt := range tests {
+		withRetentionDays(t, int64(tt.server))
+		if days := Days(tt.chatbot); days != tt.expected {
+			t.Errorf("server %d, chatbot %d: expected %d days, got %d", tt.server, tt.chatbot, tt.expected, days)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	withRetentionDays(t, 0)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) string { return now.AddDate(0, 0, -days).Format(time.RFC822Z) }
+
+	attachment := filepath.Join(t.TempDir(), "receipt.pdf")
+	if err := os.WriteFile(attachment, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := &mockRetentionStore{
+		policies: []types.ChatbotRetention{{Chatbotid: 1, Retentiondays: 30}, {Chatbotid: 2}},
+		activity: map[int][]types.ConversationActivity{
+			1: {
+				{Conversationid: "expired", Lastmessagedate: daysAgo(31)},
+				{Conversationid: "recent", Lastmessagedate: daysAgo(29)},
+				{Conversationid: "undated", Lastmessagedate: "not a date"},
+			},
+			2: {{Conversationid: "kept forever", Lastmessagedate: daysAgo(3650)}},
+		},
+		attachments: map[string]string{"expired": attachment},
+	}
+	if err := NewPurger(store).Purge(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.purged) != 1 || !slices.Equal(store.purged[0], []string{"expired"}) {
+		t.Errorf("expected only the expired conversation to be purged, got %v", store.purged)
+	}
+	if _, err := os.Stat(attachment); !os.IsNotExist(err) {
+		t.Error("expected the attachment of the purged conversation to be removed")
+	}
+	if len(store.records) != 1 {
+		t.Fatalf("expected the purge to be recorded once, got %v", store.records)
+	}
+	if record := store.records[0]; record.Chatbotid != 1 || record.Conversations != 1 || record.Messages != 2 || record.Retentiondays != 30 {
+		t.Errorf("unexpected purge record %+v", record)
+	}
+}
+
+func TestPurgeRecordsPartialPurge(t *testing.T) {
+	withRetentionDays(t, 7)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	activity := []types.ConversationActivity{}
+	for i := 0; i < purgeBatchSize+1; i++ {
+		activity = append(activity, types.ConversationActivity{Conversationid: fmt.Sprintf("conversation-%d", i), Lastmessagedate: now.AddDate(0, 0, -8).Format(time.RFC822Z)})
+	}
+	store := &mockRetentionStore{
+		policies:  []types.ChatbotRetention{{Chatbotid: 1}},
+		activity:  map[int][]types.ConversationActivity{1: activity},
+		failAfter: 1,
+	}
+
+	// errors purging one chatbot are logged so the others are still purged
+	if err := NewPurger(store).Purge(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.records) != 1 || store.records[0].Conversations != purgeBatchSize || store.records[0].Retentiondays != 7 {
+		t.Errorf("expected the batch purged before the failure to be recorded, got %+v", store.records)
+	}
+}
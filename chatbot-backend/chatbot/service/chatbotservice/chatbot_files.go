@@ -0,0 +1,216 @@
+package chatbotservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/validate"
+	"github.com/go-playground/validator/v10"
+)
+
+// Allowed file types for chatbot knowledge files
+var allowedFileTypes = map[string]bool{
+	"application/pdf": true, // PDF
+	"image/jpeg":      true, // JPEG
+}
+
+var errInvalidFileType = fmt.Errorf("invalid file type. Only PDF, JPG or JPEG are allowed")
+
+// detectFileType reads the first 512 bytes of the file to detect its content type,
+// then resets the reader position so the whole file can be saved later
+func detectFileType(file io.ReadSeeker) (string, error) {
+	buffer := make([]byte, 512)
+	n, err := file.Read(buffer)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buffer[:n]), nil
+}
+
+// chatbotFilesDir is the directory holding the knowledge files of the chatbot
+func chatbotFilesDir(username string, chatbotname string) string {
+	return config.Envs.FILES_PATH + username + "/" + chatbotname
+}
+
+// saveChatbotFile saves the content as a knowledge file of the chatbot and returns the saved path
+func saveChatbotFile(username string, chatbotname string, filename string, content io.Reader) (string, error) {
+	return saveFileToDir(chatbotFilesDir(username, chatbotname), filename, content)
+}
+
+// copyFileToDir copies the file into the directory under the same name and returns the new path
+func copyFileToDir(sourcePath string, destDir string) (string, error) {
+	inputFile, err := os.Open(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't open source file: %v", err)
+	}
+	defer inputFile.Close()
+
+	return saveFileToDir(destDir, filepath.Base(sourcePath), inputFile)
+}
+
+// revisionFilesDir holds a copy of every knowledge file used by a revision, so a revision can still be rolled back
+// to after the chatbot replaced or removed its file
+func revisionFilesDir() string {
+	return config.Envs.FILES_PATH + ".revisions"
+}
+
+// snapshotRevisionFile copies the knowledge file into the revision files and returns the path of the copy.
+// Copies are stored by the content of the file, so revisions using the same file share one copy
+func snapshotRevisionFile(path string) (string, error) {
+	if path == "" || strings.HasPrefix(path, revisionFilesDir()+"/") {
+		return path, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("couldn't open file: %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("couldn't read file: %v", err)
+	}
+	snapshotDir := revisionFilesDir() + "/" + hex.EncodeToString(hash.Sum(nil))
+	snapshotPath := snapshotDir + "/" + filepath.Base(path)
+	if _, err := os.Stat(snapshotPath); err == nil {
+		return snapshotPath, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("couldn't read file: %v", err)
+	}
+	return saveFileToDir(snapshotDir, filepath.Base(path), file)
+}
+
+// preserveRevisionFile moves revisions still using the knowledge file at path onto a copy of it,
+// so the file can be replaced or removed. Revisions recorded before files were copied use the chatbot's own file
+func (h *Handler) preserveRevisionFile(ctx context.Context, path string) error {
+	if path == "" {
+		return nil
+	}
+	referenced, err := h.revisionStore.IsFileReferenced(ctx, path)
+	if err != nil || !referenced {
+		return err
+	}
+	snapshotPath, err := snapshotRevisionFile(path)
+	if err != nil {
+		return err
+	}
+	return h.revisionStore.ReplaceFilepath(ctx, path, snapshotPath)
+}
+
+// removeRevisionFile removes the copy of a knowledge file once no revision uses it anymore
+func (h *Handler) removeRevisionFile(ctx context.Context, path string) {
+	if !strings.HasPrefix(path, revisionFilesDir()+"/") {
+		return
+	}
+	referenced, err := h.revisionStore.IsFileReferenced(ctx, path)
+	if err != nil {
+		slog.WarnContext(ctx, "Error checking if revision file is used", "path", path, "error", err)
+		return
+	}
+	if referenced {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.WarnContext(ctx, "Error removing revision file", "path", path, "error", err)
+		return
+	}
+	// the directory is shared by copies of the same content under other names, so it is only removed when empty
+	os.Remove(filepath.Dir(path))
+}
+
+// saveNewChatbotFile saves the content as a knowledge file of the chatbot like saveChatbotFile, but fails with
+// os.ErrExist instead of replacing a file of the same name
+func saveNewChatbotFile(username string, chatbotname string, filename string, content io.Reader) (string, error) {
+	return writeFileToDir(chatbotFilesDir(username, chatbotname), filename, content, os.O_EXCL)
+}
+
+// removeChatbotFile removes a knowledge file and the chatbot's directory if nothing else is left in it
+func removeChatbotFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Error removing file", "path", path, "error", err)
+		return
+	}
+	os.Remove(filepath.Dir(path))
+}
+
+func saveFileToDir(fullDirPath string, filename string, content io.Reader) (string, error) {
+	return writeFileToDir(fullDirPath, filename, content, os.O_TRUNC)
+}
+
+// writeFileToDir writes the file with the flag deciding what happens to an existing file of the same name
+func writeFileToDir(fullDirPath string, filename string, content io.Reader, flag int) (string, error) {
+	err := os.MkdirAll(fullDirPath, os.ModePerm) // Create the directory if it doesn’t exist
+	if err != nil {
+		return "", fmt.Errorf("couldn't create directory: %v", err)
+	}
+
+	savePath := fullDirPath + "/" + filename
+	slog.Info("Saving file", "path", savePath)
+	out, err := os.OpenFile(savePath, os.O_CREATE|os.O_WRONLY|flag, 0666)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, content); err != nil {
+		return "", fmt.Errorf("couldn't write file: %v", err)
+	}
+	return savePath, nil
+}
+
+// validateNewChatbot applies the rules for creating a chatbot,
+// filename is the name of the chatbot's knowledge file if it has one
+func validateNewChatbot(newChatbot types.NewChatbot, filename string) error {
+	if err := utils.Validate.Struct(newChatbot); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		return fmt.Errorf("invalid payload %v", validate_error)
+	}
+	// check chatbot name, cannot have some special characters
+	if newChatbot.Chatbotname == "" || !validate.ValidChatbotNameRegex.MatchString(newChatbot.Chatbotname) {
+		return fmt.Errorf("invalid chatbot name")
+	}
+	// check file name, cannot have some special characters
+	if filename != "" && !validate.ValidFileNameRegex.MatchString(filename) {
+		return fmt.Errorf("invalid file name")
+	}
+	return nil
+}
+
+// createChatbot stores the new chatbot with its configuration as the first revision,
+// the knowledge file of the chatbot must already be saved
+func (h *Handler) createChatbot(ctx context.Context, newChatbot types.NewChatbot, author string, message string) (int, error) {
+	revisionFilepath, err := snapshotRevisionFile(newChatbot.File)
+	if err != nil {
+		return 0, err
+	}
+	chatbotID, err := h.chatbotStore.CreateChatbot(ctx, newChatbot, types.NewChatbotRevision{
+		Chatbotname:     newChatbot.Chatbotname,
+		Description:     newChatbot.Description,
+		Behaviour:       newChatbot.Behaviour,
+		Usercontext:     newChatbot.Usercontext,
+		Filepath:        revisionFilepath,
+		FileUpdatedDate: newChatbot.FileUpdatedDate,
+		Author:          author,
+		Message:         message,
+	})
+	if err != nil && revisionFilepath != "" {
+		h.removeRevisionFile(ctx, revisionFilepath)
+	}
+	return chatbotID, err
+}
@@ -1,10 +1,11 @@
 package chatbotservice
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,8 +14,11 @@ import (
 
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/service/workspace"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/webhooks"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/validate"
 	"github.com/go-playground/validator/v10"
 )
@@ -22,14 +26,34 @@ import (
 var ErrChatbotNotFound = errors.New("chatbot not found")
 
 type Handler struct {
-	chatbotStore types.ChatbotStoreInterface
-	userStore    types.UserStoreInterface
+	chatbotStore    types.ChatbotStoreInterface
+	userStore       types.UserStoreInterface
+	workspaceStore  types.WorkspaceStoreInterface
+	revisionStore   types.ChatbotRevisionStoreInterface
+	templateStore   types.ChatbotTemplateStoreInterface
+	toolStore       types.ChatbotToolStoreInterface
+	webhookStore    types.ChatbotWebhookStoreInterface
+	feedbackStore   types.MessageFeedbackStoreInterface
+	searchStore     types.ConversationSearchStoreInterface
+	retentionStore  types.RetentionStoreInterface
+	moderationStore types.ModerationStoreInterface
+	webhooks        *webhooks.Dispatcher
 }
 
-func NewHandler(chatbotStore types.ChatbotStoreInterface, userstore types.UserStoreInterface) *Handler {
+func NewHandler(chatbotStore types.ChatbotStoreInterface, userstore types.UserStoreInterface, workspaceStore types.WorkspaceStoreInterface, revisionStore types.ChatbotRevisionStoreInterface, templateStore types.ChatbotTemplateStoreInterface, toolStore types.ChatbotToolStoreInterface, webhookStore types.ChatbotWebhookStoreInterface, feedbackStore types.MessageFeedbackStoreInterface, searchStore types.ConversationSearchStoreInterface, retentionStore types.RetentionStoreInterface, moderationStore types.ModerationStoreInterface, webhookDispatcher *webhooks.Dispatcher) *Handler {
 	return &Handler{
-		chatbotStore: chatbotStore,
-		userStore:    userstore,
+		chatbotStore:    chatbotStore,
+		userStore:       userstore,
+		workspaceStore:  workspaceStore,
+		revisionStore:   revisionStore,
+		templateStore:   templateStore,
+		toolStore:       toolStore,
+		webhookStore:    webhookStore,
+		feedbackStore:   feedbackStore,
+		searchStore:     searchStore,
+		retentionStore:  retentionStore,
+		moderationStore: moderationStore,
+		webhooks:        webhookDispatcher,
 	}
 }
 
@@ -40,20 +64,53 @@ func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 	router.HandleFunc("GET /list", auth.WithJWTAuth(h.GetUserChatbot, h.userStore))
 	router.HandleFunc("GET /details/{username}/{chatbotName}", h.GetChatbot)
 	router.HandleFunc("POST /", auth.WithJWTAuth(h.CreateChatbot, h.userStore))
+	router.HandleFunc("POST /import", auth.WithJWTAuth(h.ImportChatbot, h.userStore))
+	router.HandleFunc("GET /templates", auth.WithJWTAuth(h.GetChatbotTemplates, h.userStore))
+	router.HandleFunc("GET /search", auth.WithJWTAuth(h.SearchConversations, h.userStore))
+	router.HandleFunc("DELETE /templates/{templateid}", auth.WithJWTAuth(h.DeleteChatbotTemplate, h.userStore))
 	router.HandleFunc("PUT /{chatbotid}", auth.WithJWTAuth(h.UpdateChatbot, h.userStore))
 	router.HandleFunc("DELETE /{chatbotid}", auth.WithJWTAuth(h.DeleteChatbot, h.userStore))
+	router.HandleFunc("POST /{chatbotid}/clone", auth.WithJWTAuth(h.CloneChatbot, h.userStore))
+	router.HandleFunc("POST /{chatbotid}/template", auth.WithJWTAuth(h.SaveChatbotTemplate, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/export", auth.WithJWTAuth(h.ExportChatbot, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/allowlist", auth.WithJWTAuth(h.GetChatbotAllowlist, h.userStore))
+	router.HandleFunc("PUT /{chatbotid}/allowlist", auth.WithJWTAuth(h.UpdateChatbotAllowlist, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/history", auth.WithJWTAuth(h.GetChatbotHistorySettings, h.userStore))
+	router.HandleFunc("PUT /{chatbotid}/history", auth.WithJWTAuth(h.UpdateChatbotHistorySettings, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/widget", auth.WithJWTAuth(h.GetChatbotWidgetSettings, h.userStore))
+	router.HandleFunc("PUT /{chatbotid}/widget", auth.WithJWTAuth(h.UpdateChatbotWidgetSettings, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/retention", auth.WithJWTAuth(h.GetChatbotRetentionSettings, h.userStore))
+	router.HandleFunc("PUT /{chatbotid}/retention", auth.WithJWTAuth(h.UpdateChatbotRetentionSettings, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/tools", auth.WithJWTAuth(h.GetChatbotTools, h.userStore))
+	router.HandleFunc("POST /{chatbotid}/tools", auth.WithJWTAuth(h.CreateChatbotTool, h.userStore))
+	router.HandleFunc("DELETE /{chatbotid}/tools/{toolid}", auth.WithJWTAuth(h.DeleteChatbotTool, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/webhooks", auth.WithJWTAuth(h.GetChatbotWebhooks, h.userStore))
+	router.HandleFunc("POST /{chatbotid}/webhooks", auth.WithJWTAuth(h.CreateChatbotWebhook, h.userStore))
+	router.HandleFunc("DELETE /{chatbotid}/webhooks/{webhookid}", auth.WithJWTAuth(h.DeleteChatbotWebhook, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/webhooks/{webhookid}/deliveries", auth.WithJWTAuth(h.GetWebhookDeliveries, h.userStore))
+	router.HandleFunc("POST /{chatbotid}/webhooks/{webhookid}/test", auth.WithJWTAuth(h.TestChatbotWebhook, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/feedback", auth.WithJWTAuth(h.GetChatbotFeedback, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/moderation", auth.WithJWTAuth(h.GetChatbotModerationRules, h.userStore))
+	router.HandleFunc("POST /{chatbotid}/moderation", auth.WithJWTAuth(h.CreateChatbotModerationRule, h.userStore))
+	router.HandleFunc("DELETE /{chatbotid}/moderation/{ruleid}", auth.WithJWTAuth(h.DeleteChatbotModerationRule, h.userStore))
+	router.HandleFunc("GET /{chatbotid}/flagged", auth.WithJWTAuth(h.GetChatbotFlaggedMessages, h.userStore))
+	// revisions start with a fixed segment, GET /{chatbotid}/x/y would overlap with /details/{username}/{chatbotName}
+	router.HandleFunc("GET /revisions/{chatbotid}/list", auth.WithJWTAuth(h.GetChatbotRevisions, h.userStore))
+	router.HandleFunc("GET /revisions/{chatbotid}/diff", auth.WithJWTAuth(h.DiffChatbotRevisions, h.userStore))
+	router.HandleFunc("GET /revisions/{chatbotid}/{revision}", auth.WithJWTAuth(h.GetChatbotRevision, h.userStore))
+	router.HandleFunc("POST /revisions/{chatbotid}/{revision}/rollback", auth.WithJWTAuth(h.RollbackChatbotRevision, h.userStore))
 }
 
 func (h *Handler) GetUserChatbot(w http.ResponseWriter, r *http.Request) {
 	username := auth.GetUsernameFromContext(r.Context())
 	if username == "" {
-		log.Println("username missing in request context")
+		slog.WarnContext(r.Context(), "username missing in request context")
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
 		return
 	}
 
-	log.Println("authenticated user: " + username)
-	chatbots, err := h.chatbotStore.GetChatbotsByUsername(username)
+	slog.DebugContext(r.Context(), "Listing chatbots of authenticated user")
+	chatbots, err := h.getUserChatbots(r.Context(), username)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -68,6 +125,32 @@ func (h *Handler) GetUserChatbot(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusOK, chatbots)
 }
 
+// getUserChatbots returns the chatbots the user created followed by the ones shared with them through workspaces
+func (h *Handler) getUserChatbots(ctx context.Context, username string) ([]types.Chatbot, error) {
+	chatbots, err := h.chatbotStore.GetChatbotsByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces, err := h.workspaceStore.GetWorkspacesByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	for _, ws := range workspaces {
+		workspaceChatbots, err := h.chatbotStore.GetChatbotsByWorkspaceID(ctx, ws.Workspaceid)
+		if err != nil {
+			return nil, err
+		}
+		for _, bot := range workspaceChatbots {
+			// chatbots created by the user are already listed
+			if bot.Username != username {
+				chatbots = append(chatbots, bot)
+			}
+		}
+	}
+	return chatbots, nil
+}
+
 func (h *Handler) GetChatbot(w http.ResponseWriter, r *http.Request) {
 	username := r.PathValue("username")
 	chatbotName := r.PathValue("chatbotName")
@@ -77,7 +160,7 @@ func (h *Handler) GetChatbot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chatbot, err := h.chatbotStore.GetChatbotByName(username, chatbotName)
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
 	if err != nil {
 		if errors.Is(err, ErrChatbotNotFound) {
 			utils.WriteError(w, http.StatusNotFound, err)
@@ -90,13 +173,15 @@ func (h *Handler) GetChatbot(w http.ResponseWriter, r *http.Request) {
 	if chatbot.Filepath != "" {
 		chatbot.Filepath = filepath.Base(chatbot.Filepath)
 	}
+	// the share token is a secret for chatbots shared by link
+	chatbot.Sharetoken = ""
 	utils.WriteJSON(w, http.StatusOK, chatbot)
 }
 
 func (h *Handler) CreateChatbot(w http.ResponseWriter, r *http.Request) {
 	username := auth.GetUsernameFromContext(r.Context())
 	if username == "" {
-		log.Println("username missing in request context")
+		slog.WarnContext(r.Context(), "username missing in request context")
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
 		return
 	}
@@ -112,49 +197,61 @@ func (h *Handler) CreateChatbot(w http.ResponseWriter, r *http.Request) {
 	description := strings.TrimSpace(r.FormValue("description"))
 	behaviour := strings.TrimSpace(r.FormValue("behaviour"))
 	usercontext := strings.TrimSpace(r.FormValue("usercontext"))
-	isShared := r.FormValue("isShared") == "true"
+	shareMode, shareToken, sharePassword, err := resolveShareSettings(r, nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	isShared := shareMode != types.ShareModePrivate
+
+	workspaceID, ok := h.getWorkspaceIDFromForm(w, r, username)
+	if !ok {
+		return
+	}
+
+	// chatbots can start from a template, fields filled in the form take priority
+	template, ok := h.getTemplateFromForm(w, r, username)
+	if !ok {
+		return
+	}
+	if template != nil {
+		if description == "" {
+			description = template.Description
+		}
+		if behaviour == "" {
+			behaviour = template.Behaviour
+		}
+		if usercontext == "" {
+			usercontext = template.Usercontext
+		}
+	}
 
 	// Handle file upload, get the paths first for validation
 	file, header, err := r.FormFile("file")
-	var fullDirPath string
-	var filepath string
+	var filename string
 	if err == nil {
 		defer file.Close()
 
-		// Read the first 512 bytes to detect content type
-		buffer := make([]byte, 512)
-		_, err = file.Read(buffer)
+		fileType, err := detectFileType(file)
 		if err != nil {
 			http.Error(w, "Failed to read file", http.StatusInternalServerError)
 			return
 		}
-		fileType := http.DetectContentType(buffer)
-
-		// Reset file reader position (important for saving later)
-		file.Seek(0, 0)
-
-		// Allowed file types
-		allowedTypes := map[string]bool{
-			"application/pdf": true, // PDF
-			"image/jpeg":      true, // JPEG
-		}
 		// Validate file type
-		if !allowedTypes[fileType] {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid file type. Only PDF, JPG or JPEG are allowed"))
+		if !allowedFileTypes[fileType] {
+			utils.WriteError(w, http.StatusBadRequest, errInvalidFileType)
 			return
 		}
-
-		fullDirPath = config.Envs.FILES_PATH + username + "/" + chatbotname
-		filepath = fullDirPath + "/" + header.Filename
-	} else {
-		filepath = ""
+		filename = header.Filename
+	} else if template != nil && template.Filepath != "" {
+		filename = baseName(template.Filepath)
 	}
 
+	var filepath string
 	var fileUpdatedDate string
-	if filepath != "" {
+	if filename != "" {
+		filepath = chatbotFilesDir(username, chatbotname) + "/" + filename
 		fileUpdatedDate, _ = utils.GetCurrentTime()
-	} else {
-		fileUpdatedDate = ""
 	}
 
 	// Create chatbot struct to validate fields first
@@ -167,50 +264,39 @@ func (h *Handler) CreateChatbot(w http.ResponseWriter, r *http.Request) {
 		Usercontext:     usercontext,
 		File:            filepath,
 		FileUpdatedDate: fileUpdatedDate,
+		Workspaceid:     workspaceID,
+		Sharemode:       shareMode,
+		Sharetoken:      shareToken,
+		Sharepassword:   sharePassword,
 	}
-	if err := utils.Validate.Struct(newChatbot); err != nil {
-		validate_error := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
-		return
-	}
-	// check chatbot name, cannot have some special characters
-	if chatbotname == "" || !validate.ValidChatbotNameRegex.MatchString(chatbotname) {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid chatbot name"))
-		return
-	}
-	// check file name, cannot have some special characters
-	if filepath != "" && !validate.ValidFileNameRegex.MatchString(header.Filename) {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid file name"))
+	if err := validateNewChatbot(newChatbot, filename); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	// Handle file upload
-	if fullDirPath != "" && filepath != "" {
-		err := os.MkdirAll(fullDirPath, os.ModePerm) // Create the directory if it doesn’t exist
-		if err != nil {
-			log.Println("Error creating directory:", err)
-			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to save file"))
-			return
+	// Handle file upload, or copy the file of the template when none was uploaded
+	if filename != "" {
+		var err error
+		if file != nil {
+			_, err = saveChatbotFile(username, chatbotname, filename, file)
+		} else {
+			_, err = copyFileToDir(template.Filepath, chatbotFilesDir(username, chatbotname))
 		}
-
-		// Save the uploaded file
-		filepath = fullDirPath + "/" + header.Filename
-		log.Println("Saving file to:", filepath)
-		out, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-		// out, err := os.Create(filepath)
 		if err != nil {
-			log.Println("Error saving file:", err)
+			slog.ErrorContext(r.Context(), "Error saving file", "error", err)
 			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to save file"))
 			return
 		}
-		defer out.Close()
-		io.Copy(out, file)
 	}
 
 	createdTime, _ := utils.GetCurrentTime()
-	botID, err := h.chatbotStore.CreateChatbot(newChatbot)
+	revisionMessage := "Created chatbot"
+	if template != nil {
+		revisionMessage = fmt.Sprintf("Created chatbot from template %s", template.Name)
+	}
+	botID, err := h.createChatbot(r.Context(), newChatbot, username, revisionMessage)
 	if err != nil {
-		log.Println("Error creating chatbot:", err)
+		slog.ErrorContext(r.Context(), "Error creating chatbot", "error", err)
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -225,7 +311,7 @@ func (h *Handler) CreateChatbot(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 	username := auth.GetUsernameFromContext(r.Context())
 	if username == "" {
-		log.Println("username missing in request context set by jwt")
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
 		return
 	}
@@ -247,24 +333,65 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	oldChatbot, err := h.chatbotStore.GetChatbotsByID(chatbotIDInt)
+	oldChatbot, err := h.chatbotStore.GetChatbotsByID(r.Context(), chatbotIDInt)
 	if err != nil {
-		log.Printf("Error getting chatbot %d: %v\n", chatbotIDInt, err)
+		slog.WarnContext(r.Context(), "Error getting chatbot", "chatbotid", chatbotIDInt, "error", err)
 		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
 		return
 	}
-	if username != oldChatbot.Username {
+	canEdit, err := workspace.CanAccessChatbot(r.Context(), h.workspaceStore, username, oldChatbot, types.WorkspaceRoleEditor)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error checking access to chatbot", "chatbotid", chatbotIDInt, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !canEdit {
 		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
 		return
 	}
+	// files and the public chatbot url stay under the creator even when edited by workspace members
+	ownerName := oldChatbot.Username
+
+	// only the creator can move the chatbot into or out of a workspace
+	workspaceID := oldChatbot.Workspaceid
+	if workspaceValue := r.FormValue("workspaceid"); workspaceValue != "" {
+		newWorkspaceID, converr := strconv.Atoi(workspaceValue)
+		if converr != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid workspace ID"))
+			return
+		}
+		if newWorkspaceID != workspaceID {
+			if username != ownerName {
+				utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only the creator can move the chatbot"))
+				return
+			}
+			if newWorkspaceID != 0 {
+				role, err := h.workspaceStore.GetMemberRole(r.Context(), newWorkspaceID, username)
+				if err != nil {
+					utils.WriteError(w, http.StatusInternalServerError, err)
+					return
+				}
+				if !workspace.RoleAtLeast(role, types.WorkspaceRoleEditor) {
+					utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+					return
+				}
+			}
+			workspaceID = newWorkspaceID
+		}
+	}
 
 	// Extract chatbot fields from form
 	chatbotname := strings.TrimSpace(r.FormValue("chatbotname"))
 	description := strings.TrimSpace(r.FormValue("description"))
 	behaviour := strings.TrimSpace(r.FormValue("behaviour"))
 	usercontext := strings.TrimSpace(r.FormValue("usercontext"))
-	isShared := r.FormValue("isShared") == "true"
 	removeFile := r.FormValue("removeFile") == "true"
+	shareMode, shareToken, sharePassword, err := resolveShareSettings(r, oldChatbot)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	isShared := shareMode != types.ShareModePrivate
 
 	// Handle file upload, get the paths first for validation
 	file, header, err := r.FormFile("file")
@@ -273,41 +400,41 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 	if err == nil {
 		defer file.Close()
 
-		// Read the first 512 bytes to detect content type
-		buffer := make([]byte, 512)
-		_, err = file.Read(buffer)
+		fileType, err := detectFileType(file)
 		if err != nil {
 			http.Error(w, "Failed to read file", http.StatusInternalServerError)
 			return
 		}
-		fileType := http.DetectContentType(buffer)
-
-		// Reset file reader position (important for saving later)
-		file.Seek(0, 0)
-
-		// Allowed file types
-		allowedTypes := map[string]bool{
-			"application/pdf": true, // PDF
-			"image/jpeg":      true, // JPEG
-		}
 		// Validate file type
-		if !allowedTypes[fileType] {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid file type. Only PDF, JPG or JPEG are allowed"))
+		if !allowedFileTypes[fileType] {
+			utils.WriteError(w, http.StatusBadRequest, errInvalidFileType)
 			return
 		}
 
-		fullDirPath = config.Envs.FILES_PATH + username + "/" + chatbotname
+		fullDirPath = chatbotFilesDir(ownerName, chatbotname)
 		newFilepath = fullDirPath + "/" + header.Filename
-		log.Println("Saving file to:", newFilepath)
+		slog.InfoContext(r.Context(), "Saving file", "path", newFilepath)
 	} else {
 		newFilepath = ""
 	}
 
+	// the previous file is about to be moved, replaced or removed, revisions still using it get a copy
+	if oldChatbot.Filepath != "" && (newFilepath != "" || removeFile || oldChatbot.Chatbotname != chatbotname) {
+		if err := h.preserveRevisionFile(r.Context(), oldChatbot.Filepath); err != nil {
+			slog.ErrorContext(r.Context(), "Error keeping previous file for revisions", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to keep previous file"))
+			return
+		}
+	}
+
 	var fileUpdatedDate string
 	var updatedFilepath string
 	if newFilepath != "" {
 		fileUpdatedDate, _ = utils.GetCurrentTime()
 		updatedFilepath = newFilepath
+	} else if removeFile {
+		fileUpdatedDate = ""
+		updatedFilepath = ""
 	} else {
 		// if no new file is uploaded, means keep the old file
 		fileUpdatedDate = oldChatbot.FileUpdatedDate
@@ -318,9 +445,10 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 			// move the old file to the new directory
 			oldfilepath := oldChatbot.Filepath
 			if oldfilepath != "" {
+				fullDirPath = chatbotFilesDir(ownerName, chatbotname)
 				err := os.MkdirAll(fullDirPath, os.ModePerm) // Create the directory if it doesn’t exist
 				if err != nil {
-					log.Println("Error creating directory:", err)
+					slog.ErrorContext(r.Context(), "Error creating directory", "error", err)
 					utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to move previous file"))
 					return
 				}
@@ -328,15 +456,16 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 				moveFilepath := fullDirPath + "/" + filepath.Base(oldfilepath)
 				err = MoveFile(oldfilepath, moveFilepath)
 				if err != nil {
-					log.Println("Error moving file:", err)
+					slog.ErrorContext(r.Context(), "Error moving file", "error", err)
 					utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to move previous file"))
 					return
 				}
+				updatedFilepath = moveFilepath
 
 				// remove old file and directory
 				err = os.RemoveAll(filepath.Dir(oldfilepath))
 				if err != nil {
-					log.Println("Error removing old directory:", err)
+					slog.ErrorContext(r.Context(), "Error removing old directory", "error", err)
 					utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to remove previous file"))
 					return
 				}
@@ -347,7 +476,7 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 	// Create chatbot struct
 	updateChatbot := types.UpdateChatbot{
 		Chatbotid:       chatbotIDInt,
-		Username:        username,
+		Username:        ownerName,
 		Chatbotname:     chatbotname,
 		Description:     description,
 		Behaviour:       behaviour,
@@ -355,6 +484,20 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 		Usercontext:     usercontext,
 		File:            updatedFilepath,
 		FileUpdatedDate: fileUpdatedDate,
+		Workspaceid:     workspaceID,
+		Sharemode:       shareMode,
+		Sharetoken:      shareToken,
+		Sharepassword:   sharePassword,
+	}
+	revisionPayload := types.NewChatbotRevision{
+		Chatbotname:     chatbotname,
+		Description:     description,
+		Behaviour:       behaviour,
+		Usercontext:     usercontext,
+		Filepath:        updatedFilepath,
+		FileUpdatedDate: fileUpdatedDate,
+		Author:          username,
+		Message:         strings.TrimSpace(r.FormValue("revisionMessage")),
 	}
 	if err := utils.Validate.Struct(updateChatbot); err != nil {
 		validate_error := err.(validator.ValidationErrors)
@@ -376,23 +519,24 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 	oldfilepath := oldChatbot.Filepath
 	if removeFile || newFilepath != "" {
 		if oldfilepath != "" {
-			log.Println("Attempting to remove file:", oldfilepath)
+			slog.InfoContext(r.Context(), "Attempting to remove file", "path", oldfilepath)
 			err = os.Remove(oldfilepath)
 			if err != nil {
 				if err != os.ErrNotExist {
 					// Log the error but can continue
-					log.Println("Error removing file but continuing:", oldfilepath, err)
+					slog.WarnContext(r.Context(), "Error removing file but continuing", "path", oldfilepath, "error", err)
 					if removeFile && newFilepath == "" {
 						// if user requested to remove file, then just skip to the end of the handler function behaviour
-						log.Println("Error removing file ending early since user requested to remove file only")
+						slog.ErrorContext(r.Context(), "Error removing file ending early since user requested to remove file only")
 
 						updateTime, _ := utils.GetCurrentTime()
-						err = h.chatbotStore.UpdateChatbot(updateChatbot)
+						_, err = h.chatbotStore.UpdateChatbot(r.Context(), updateChatbot, revisionPayload)
 						if err != nil {
-							log.Println("Error updating chatbot:", err)
+							slog.ErrorContext(r.Context(), "Error updating chatbot", "error", err)
 							utils.WriteError(w, http.StatusInternalServerError, err)
 							return
 						}
+						h.notifyChatbotUpdated(r.Context(), updateChatbot, username)
 						utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 							"message":     "Chatbot updated successfully",
 							"updateddate": updateTime,
@@ -400,7 +544,7 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 						return
 					}
 				} else {
-					log.Println("Error removing file:", err)
+					slog.ErrorContext(r.Context(), "Error removing file", "error", err)
 
 					// if user only requested to remove file, then do not proceed
 					if removeFile && newFilepath == "" {
@@ -409,32 +553,32 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 			}
-			log.Println("Removed old file:", oldfilepath)
+			slog.InfoContext(r.Context(), "Removed old file", "path", oldfilepath)
 		}
 	}
 
 	// Handle file upload
 	if fullDirPath != "" && newFilepath != "" {
 		// fullDirPath := config.Envs.FILES_PATH + username + "/" + chatbotname
-		log.Println("Full directory path:", fullDirPath)
+		slog.DebugContext(r.Context(), "Full directory path", "path", fullDirPath)
 		err := os.MkdirAll(fullDirPath, os.ModePerm) // Create the directory if it doesn’t exist
 		if err != nil {
-			log.Println("Error creating directory:", err)
+			slog.ErrorContext(r.Context(), "Error creating directory", "error", err)
 			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to save new file"))
 			return
 		}
 
 		if header.Filename == "" {
-			log.Println("No filename detected")
+			slog.InfoContext(r.Context(), "No filename detected")
 			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to save new file"))
 			return
 		}
 		// Save the uploaded file
 		// newFilepath = fullDirPath + "/" + header.Filename
-		log.Println("Saving file to:", newFilepath)
+		slog.InfoContext(r.Context(), "Saving file", "path", newFilepath)
 		out, err := os.Create(newFilepath)
 		if err != nil {
-			log.Println("Error saving file:", err)
+			slog.ErrorContext(r.Context(), "Error saving file", "error", err)
 			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to save new file"))
 			return
 		}
@@ -444,13 +588,22 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 		newFilepath = "" // No file uploaded
 	}
 
+	// the revision keeps its own copy of the file, which stays when the chatbot's file is replaced later
+	revisionPayload.Filepath, err = snapshotRevisionFile(updatedFilepath)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error copying file for revision", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to save new file"))
+		return
+	}
+
 	updateTime, _ := utils.GetCurrentTime()
-	err = h.chatbotStore.UpdateChatbot(updateChatbot)
+	_, err = h.chatbotStore.UpdateChatbot(r.Context(), updateChatbot, revisionPayload)
 	if err != nil {
-		log.Println("Error updating chatbot:", err)
+		slog.ErrorContext(r.Context(), "Error updating chatbot", "error", err)
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	h.notifyChatbotUpdated(r.Context(), updateChatbot, username)
 
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"message":     "Chatbot updated successfully",
@@ -461,7 +614,7 @@ func (h *Handler) UpdateChatbot(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DeleteChatbot(w http.ResponseWriter, r *http.Request) {
 	username := auth.GetUsernameFromContext(r.Context())
 	if username == "" {
-		log.Println("username missing in request context set by jwt")
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
 		return
 	}
@@ -477,13 +630,20 @@ func (h *Handler) DeleteChatbot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chatbot, err := h.chatbotStore.GetChatbotsByID(chatbotIDInt)
+	chatbot, err := h.chatbotStore.GetChatbotsByID(r.Context(), chatbotIDInt)
 	if err != nil {
-		log.Printf("Error getting chatbot %d for deletion: %v\n", chatbotIDInt, err)
+		slog.WarnContext(r.Context(), "Error getting chatbot for deletion", "chatbotid", chatbotIDInt, "error", err)
 		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
 		return
 	}
-	if username != chatbot.Username {
+	// editors can change a chatbot but only its creator or a workspace owner can delete it, with its files
+	canDelete, err := workspace.CanAccessChatbot(r.Context(), h.workspaceStore, username, chatbot, types.WorkspaceRoleOwner)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error checking access to chatbot", "chatbotid", chatbotIDInt, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !canDelete {
 		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
 		return
 	}
@@ -492,24 +652,255 @@ func (h *Handler) DeleteChatbot(w http.ResponseWriter, r *http.Request) {
 	if oldfilepath != "" {
 		err = os.RemoveAll(config.Envs.FILES_PATH + chatbot.Username + "/" + chatbot.Chatbotname)
 		if err != nil {
-			log.Println("Error removing directory:", err)
+			slog.ErrorContext(r.Context(), "Error removing directory", "error", err)
 			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to remove directory of chatbot"))
 			return
 		}
 	}
 
-	err = h.chatbotStore.DeleteChatbot(chatbotIDInt)
+	revisions, err := h.revisionStore.GetRevisionsByChatbotID(r.Context(), chatbotIDInt)
 	if err != nil {
-		log.Println("Error deleting chatbot:", err)
+		slog.ErrorContext(r.Context(), "Error getting chatbot revisions", "error", err)
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	err = h.chatbotStore.DeleteChatbot(r.Context(), chatbotIDInt)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting chatbot", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.revisionStore.DeleteRevisionsByChatbotID(r.Context(), chatbotIDInt); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting chatbot revisions", "error", err)
+	} else {
+		// copies of the files are shared with other chatbots using the same content
+		for _, revision := range revisions {
+			h.removeRevisionFile(r.Context(), revision.Filepath)
+		}
+	}
+	if err := h.toolStore.DeleteToolsByChatbotID(r.Context(), chatbotIDInt); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting chatbot tools", "error", err)
+	}
+	if err := h.webhookStore.DeleteWebhooksByChatbotID(r.Context(), chatbotIDInt); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting chatbot webhooks", "error", err)
+	}
+	if err := h.feedbackStore.DeleteFeedbackByChatbotID(r.Context(), chatbotIDInt); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting chatbot feedback", "error", err)
+	}
+	if err := h.moderationStore.DeleteModerationByChatbotID(r.Context(), chatbotIDInt); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting chatbot moderation rules", "error", err)
+	}
+
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Chatbot deleted successfully",
 	})
 }
 
+func (h *Handler) GetChatbotAllowlist(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	usernames, err := h.chatbotStore.GetChatbotAllowlist(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot allowlist", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"usernames": usernames,
+	})
+}
+
+func (h *Handler) UpdateChatbotAllowlist(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	var payload types.UpdateChatbotAllowlistPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	for index, username := range payload.Usernames {
+		username = strings.TrimSpace(username)
+		if _, err := h.userStore.GetUserByName(r.Context(), username); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user %s not found", username))
+			return
+		}
+		payload.Usernames[index] = username
+	}
+
+	if err := h.chatbotStore.SetChatbotAllowlist(r.Context(), chatbot.Chatbotid, payload.Usernames); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating chatbot allowlist", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Chatbot allowlist updated successfully",
+	})
+}
+
+// GetChatbotHistorySettings returns how much of a conversation is sent to the model with each message
+func (h *Handler) GetChatbotHistorySettings(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.ChatbotHistorySettings{
+		Historystrategy:   chatbot.Historystrategy,
+		Historytokenlimit: chatbot.Historytokenlimit,
+	})
+}
+
+func (h *Handler) UpdateChatbotHistorySettings(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	var payload types.ChatbotHistorySettings
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	if err := h.chatbotStore.UpdateChatbotHistorySettings(r.Context(), chatbot.Chatbotid, payload); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating chatbot history settings", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Chatbot history settings updated successfully",
+	})
+}
+
+// getChatbotForRequest loads the chatbot in the path and checks that the logged in user has at least
+// the required role on it. The error response is already written when ok is false
+func (h *Handler) getChatbotForRequest(w http.ResponseWriter, r *http.Request, requiredRole string) (chatbot *types.Chatbot, username string, ok bool) {
+	username = auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return nil, "", false
+	}
+
+	chatbotID, err := strconv.Atoi(r.PathValue("chatbotid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid chatbot ID"))
+		return nil, "", false
+	}
+	logging.AddFields(r.Context(), "chatbotid", chatbotID)
+
+	chatbot, err = h.chatbotStore.GetChatbotsByID(r.Context(), chatbotID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error getting chatbot", "chatbotid", chatbotID, "error", err)
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return nil, "", false
+	}
+
+	allowed, err := workspace.CanAccessChatbot(r.Context(), h.workspaceStore, username, chatbot, requiredRole)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error checking access to chatbot", "chatbotid", chatbotID, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, "", false
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return nil, "", false
+	}
+
+	return chatbot, username, true
+}
+
+// getWorkspaceIDFromForm reads the optional workspace a new chatbot is created in, which the user must be able to edit.
+// The error response is already written when ok is false
+func (h *Handler) getWorkspaceIDFromForm(w http.ResponseWriter, r *http.Request, username string) (workspaceID int, ok bool) {
+	workspaceValue := r.FormValue("workspaceid")
+	if workspaceValue == "" || workspaceValue == "0" {
+		return 0, true
+	}
+
+	workspaceID, err := strconv.Atoi(workspaceValue)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid workspace ID"))
+		return 0, false
+	}
+	role, err := h.workspaceStore.GetMemberRole(r.Context(), workspaceID, username)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	if !workspace.RoleAtLeast(role, types.WorkspaceRoleEditor) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return 0, false
+	}
+	return workspaceID, true
+}
+
+// resolveShareSettings works out the sharing mode, share token and hashed share password from the form.
+// shareMode takes priority, otherwise the isShared checkbox switches between public and private while
+// keeping any other sharing mode that was already set. current is nil when creating a chatbot
+func resolveShareSettings(r *http.Request, current *types.Chatbot) (shareMode string, shareToken string, sharePassword string, err error) {
+	if current != nil {
+		shareMode = current.Sharemode
+		shareToken = current.Sharetoken
+		sharePassword = current.Sharepassword
+	}
+
+	if requestedMode := strings.TrimSpace(r.FormValue("shareMode")); requestedMode != "" {
+		shareMode = requestedMode
+	} else if r.FormValue("isShared") == "true" {
+		if shareMode == "" || shareMode == types.ShareModePrivate {
+			shareMode = types.ShareModePublic
+		}
+	} else {
+		shareMode = types.ShareModePrivate
+	}
+
+	if shareMode == types.ShareModeLink && (shareToken == "" || r.FormValue("regenerateShareToken") == "true") {
+		shareToken, err = utils.GenerateSecureToken(24)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error generating share token", "error", err)
+			return "", "", "", fmt.Errorf("failed to generate share token")
+		}
+	}
+
+	if password := r.FormValue("sharePassword"); password != "" {
+		if len(password) < 8 {
+			return "", "", "", fmt.Errorf("share password must be at least 8 characters")
+		}
+		sharePassword, err = auth.HashPassword(password)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error hashing share password", "error", err)
+			return "", "", "", fmt.Errorf("failed to set share password")
+		}
+	}
+	if shareMode == types.ShareModePassword && sharePassword == "" {
+		return "", "", "", fmt.Errorf("a share password is required for password protected chatbots")
+	}
+
+	return shareMode, shareToken, sharePassword, nil
+}
+
 func MoveFile(sourcePath, destPath string) error {
 	inputFile, err := os.Open(sourcePath)
 	if err != nil {
@@ -0,0 +1,69 @@
+package chatbotservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+// ServeMux panics when two patterns overlap without one being more specific,
+// which would otherwise only show up when the server starts
+func TestRegisterRoutes(t *testing.T) {
+	defer func() {
+		if err := recover(); err != nil {
+			t.Fatalf("conflicting routes: %v", err)
+		}
+	}()
+
+	handler := NewHandler(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	handler.RegisterRoutes(http.NewServeMux())
+}
+
+type mockChatbotStore struct {
+	types.ChatbotStoreInterface
+	chatbot *types.Chatbot
+	deleted bool
+}
+
+func (m *mockChatbotStore) GetChatbotsByID(ctx context.Context, chatbotID int) (*types.Chatbot, error) {
+	return m.chatbot, nil
+}
+
+func (m *mockChatbotStore) DeleteChatbot(ctx context.Context, chatbotID int) error {
+	m.deleted = true
+	return nil
+}
+
+type mockWorkspaceStore struct {
+	types.WorkspaceStoreInterface
+	roles map[string]string
+}
+
+func (m *mockWorkspaceStore) GetMemberRole(ctx context.Context, workspaceID int, username string) (string, error) {
+	return m.roles[username], nil
+}
+
+// editors of the workspace can change another member's chatbot but not delete it
+func TestDeleteChatbotNeedsOwner(t *testing.T) {
+	workspaceStore := &mockWorkspaceStore{roles: map[string]string{
+		"editor": types.WorkspaceRoleEditor,
+		"viewer": types.WorkspaceRoleViewer,
+	}}
+	for _, username := range []string{"editor", "viewer"} {
+		chatbotStore := &mockChatbotStore{chatbot: &types.Chatbot{Chatbotid: 1, Username: "creator", Chatbotname: "bot", Workspaceid: 1}}
+		handler := &Handler{chatbotStore: chatbotStore, workspaceStore: workspaceStore}
+		request := httptest.NewRequest(http.MethodDelete, "/1", nil)
+		request.SetPathValue("chatbotid", "1")
+		request = request.WithContext(context.WithValue(request.Context(), auth.UsernameKey, username))
+		recorder := httptest.NewRecorder()
+
+		handler.DeleteChatbot(recorder, request)
+		if recorder.Code != http.StatusForbidden || chatbotStore.deleted {
+			t.Errorf("%s: expected %d and the chatbot kept, got %d", username, http.StatusForbidden, recorder.Code)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package chatbotservice
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"strings"
 
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
 )
@@ -15,8 +19,10 @@ func NewStore(db *sql.DB) types.ChatbotStoreInterface {
 	return &ChatbotStore{db: db}
 }
 
-func (s *ChatbotStore) GetChatbotsByID(chatbotID int) (*types.Chatbot, error) {
-	rows, err := s.db.Query("SELECT * FROM chatbots WHERE chatbotid=?", chatbotID)
+func (s *ChatbotStore) GetChatbotsByID(ctx context.Context, chatbotID int) (*types.Chatbot, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.GetChatbotsByID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbots WHERE chatbotid=?", chatbotID)
 	if err != nil {
 		return nil, err
 	}
@@ -33,8 +39,10 @@ func (s *ChatbotStore) GetChatbotsByID(chatbotID int) (*types.Chatbot, error) {
 	return chatbots, nil
 }
 
-func (s *ChatbotStore) GetChatbotsByUsername(username string) ([]types.Chatbot, error) {
-	rows, err := s.db.Query("SELECT * FROM chatbots WHERE username=?", username)
+func (s *ChatbotStore) GetChatbotsByUsername(ctx context.Context, username string) ([]types.Chatbot, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.GetChatbotsByUsername")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbots WHERE username=?", username)
 	if err != nil {
 		return nil, err
 	}
@@ -52,8 +60,10 @@ func (s *ChatbotStore) GetChatbotsByUsername(username string) ([]types.Chatbot,
 	return chatbots, nil
 }
 
-func (s *ChatbotStore) GetChatbotByName(username string, chatbotName string) (*types.Chatbot, error) {
-	rows, err := s.db.Query("SELECT * FROM chatbots WHERE username=? AND chatbotName=?", username, chatbotName)
+func (s *ChatbotStore) GetChatbotByName(ctx context.Context, username string, chatbotName string) (*types.Chatbot, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.GetChatbotByName")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbots WHERE username=? AND chatbotName=?", username, chatbotName)
 	if err != nil {
 		return nil, err
 	}
@@ -74,12 +84,42 @@ func (s *ChatbotStore) GetChatbotByName(username string, chatbotName string) (*t
 	return chatbot, nil
 }
 
-func (s *ChatbotStore) CreateChatbot(userPayload types.NewChatbot) (int, error) {
+func (s *ChatbotStore) GetChatbotsByWorkspaceID(ctx context.Context, workspaceID int) ([]types.Chatbot, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.GetChatbotsByWorkspaceID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbots WHERE workspaceid=?", workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chatbots := []types.Chatbot{}
+	for rows.Next() {
+		bot, err := scanRowsIntoChatbot(rows)
+		if err != nil {
+			return nil, err
+		}
+		chatbots = append(chatbots, *bot)
+	}
+
+	return chatbots, nil
+}
+
+// CreateChatbot stores the new chatbot with its configuration as the first revision, in one transaction
+func (s *ChatbotStore) CreateChatbot(ctx context.Context, userPayload types.NewChatbot, revisionPayload types.NewChatbotRevision) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.CreateChatbot")
+	defer endQuery()
 	currentTime, _ := utils.GetCurrentTime()
-	// temp_filepath := "tempfilepath.pdf"
 
-	res, dberr := s.db.Exec(
-		"INSERT INTO chatbots (username, chatbotname, description, behaviour, usercontext, createddate, updateddate, lastused, isShared, filepath, fileUpdatedDate) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, dberr := tx.ExecContext(
+		ctx,
+		"INSERT INTO chatbots (username, chatbotname, description, behaviour, usercontext, createddate, updateddate, lastused, isShared, filepath, fileUpdatedDate, workspaceid, sharemode, sharetoken, sharepassword) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		userPayload.Username,
 		userPayload.Chatbotname,
 		userPayload.Description,
@@ -91,6 +131,10 @@ func (s *ChatbotStore) CreateChatbot(userPayload types.NewChatbot) (int, error)
 		userPayload.IsShared,
 		userPayload.File,
 		userPayload.FileUpdatedDate,
+		userPayload.Workspaceid,
+		userPayload.Sharemode,
+		userPayload.Sharetoken,
+		userPayload.Sharepassword,
 	)
 	if dberr != nil {
 		return 0, dberr
@@ -101,14 +145,33 @@ func (s *ChatbotStore) CreateChatbot(userPayload types.NewChatbot) (int, error)
 		return 0, err
 	}
 
+	revisionPayload.Chatbotid = int(id)
+	if _, err := recordRevision(ctx, tx, revisionPayload); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	return int(id), nil
 }
 
-func (s *ChatbotStore) UpdateChatbot(chatbotPayload types.UpdateChatbot) error {
+// UpdateChatbot saves the chatbot and records its configuration as a new revision if it changed, in one transaction.
+// The latest revision of the chatbot is returned
+func (s *ChatbotStore) UpdateChatbot(ctx context.Context, chatbotPayload types.UpdateChatbot, revisionPayload types.NewChatbotRevision) (*types.ChatbotRevision, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.UpdateChatbot")
+	defer endQuery()
 	currentTime, _ := utils.GetCurrentTime()
 
-	_, err := s.db.Exec(
-		"UPDATE chatbots SET chatbotname=?, description=?, behaviour=?, usercontext=?, updateddate=?, isShared=?, filepath=?, fileUpdatedDate=? WHERE chatbotid=? AND username=?",
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE chatbots SET chatbotname=?, description=?, behaviour=?, usercontext=?, updateddate=?, isShared=?, filepath=?, fileUpdatedDate=?, workspaceid=?, sharemode=?, sharetoken=?, sharepassword=? WHERE chatbotid=? AND username=?",
 		chatbotPayload.Chatbotname,
 		chatbotPayload.Description,
 		chatbotPayload.Behaviour,
@@ -117,16 +180,35 @@ func (s *ChatbotStore) UpdateChatbot(chatbotPayload types.UpdateChatbot) error {
 		chatbotPayload.IsShared,
 		chatbotPayload.File,
 		chatbotPayload.FileUpdatedDate,
+		chatbotPayload.Workspaceid,
+		chatbotPayload.Sharemode,
+		chatbotPayload.Sharetoken,
+		chatbotPayload.Sharepassword,
 		chatbotPayload.Chatbotid,
 		chatbotPayload.Username,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	revisionPayload.Chatbotid = chatbotPayload.Chatbotid
+	revision, err := recordRevision(ctx, tx, revisionPayload)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return revision, nil
 }
 
-func (s *ChatbotStore) UpdateChatbotLastused(updatePayload types.UpdateChatbotLastused) error {
+func (s *ChatbotStore) UpdateChatbotLastused(ctx context.Context, updatePayload types.UpdateChatbotLastused) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.UpdateChatbotLastused")
+	defer endQuery()
 	currentTime, _ := utils.GetCurrentTime()
 
-	_, err := s.db.Exec(
+	_, err := s.db.ExecContext(
+		ctx,
 		"UPDATE chatbots SET lastused=? WHERE chatbotid=? AND username=?",
 		currentTime,
 		updatePayload.Chatbotid,
@@ -135,11 +217,132 @@ func (s *ChatbotStore) UpdateChatbotLastused(updatePayload types.UpdateChatbotLa
 	return err
 }
 
-func (s *ChatbotStore) DeleteChatbot(chatbotID int) error {
-	_, err := s.db.Exec("DELETE FROM chatbots WHERE chatbotid=?", chatbotID)
+func (s *ChatbotStore) DeleteChatbot(ctx context.Context, chatbotID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.DeleteChatbot")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM chatbots WHERE chatbotid=?", chatbotID)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM chatbot_allowlist WHERE chatbotid=?", chatbotID)
 	return err
 }
 
+func (s *ChatbotStore) GetChatbotAllowlist(ctx context.Context, chatbotID int) ([]string, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.GetChatbotAllowlist")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT username FROM chatbot_allowlist WHERE chatbotid=? ORDER BY username", chatbotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usernames := []string{}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+
+	return usernames, nil
+}
+
+// SetChatbotAllowlist replaces the allow-list of the chatbot with the given usernames
+func (s *ChatbotStore) SetChatbotAllowlist(ctx context.Context, chatbotID int, usernames []string) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.SetChatbotAllowlist")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chatbot_allowlist WHERE chatbotid=?", chatbotID); err != nil {
+		return err
+	}
+	for _, username := range usernames {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT OR IGNORE INTO chatbot_allowlist (chatbotid, username, createddate) VALUES (?, ?, ?)",
+			chatbotID,
+			username,
+			currentTime,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *ChatbotStore) UpdateChatbotHistorySettings(ctx context.Context, chatbotID int, settings types.ChatbotHistorySettings) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.UpdateChatbotHistorySettings")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		"UPDATE chatbots SET historystrategy=?, historytokenlimit=?, updateddate=? WHERE chatbotid=?",
+		settings.Historystrategy,
+		settings.Historytokenlimit,
+		currentTime,
+		chatbotID,
+	)
+	return err
+}
+
+func (s *ChatbotStore) UpdateChatbotWidgetSettings(ctx context.Context, chatbotID int, settings types.ChatbotWidgetSettings) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.UpdateChatbotWidgetSettings")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+	theme, err := json.Marshal(settings.Theme)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		"UPDATE chatbots SET allowedorigins=?, widgettheme=?, updateddate=? WHERE chatbotid=?",
+		strings.Join(settings.Allowedorigins, ","),
+		string(theme),
+		currentTime,
+		chatbotID,
+	)
+	return err
+}
+
+func (s *ChatbotStore) UpdateChatbotRetentionSettings(ctx context.Context, chatbotID int, settings types.ChatbotRetentionSettings) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.UpdateChatbotRetentionSettings")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		"UPDATE chatbots SET retentiondays=?, redactpii=?, updateddate=? WHERE chatbotid=?",
+		settings.Retentiondays,
+		settings.Redactpii,
+		currentTime,
+		chatbotID,
+	)
+	return err
+}
+
+func (s *ChatbotStore) IsUserAllowlisted(ctx context.Context, chatbotID int, username string) (bool, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ChatbotStore.IsUserAllowlisted")
+	defer endQuery()
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM chatbot_allowlist WHERE chatbotid=? AND username=?", chatbotID, username).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func scanRowsIntoChatbot(rows *sql.Rows) (*types.Chatbot, error) {
 	chatbot := new(types.Chatbot)
 
@@ -156,6 +359,16 @@ func scanRowsIntoChatbot(rows *sql.Rows) (*types.Chatbot, error) {
 		&chatbot.IsShared,
 		&chatbot.Filepath,
 		&chatbot.FileUpdatedDate,
+		&chatbot.Workspaceid,
+		&chatbot.Sharemode,
+		&chatbot.Sharetoken,
+		&chatbot.Sharepassword,
+		&chatbot.Historystrategy,
+		&chatbot.Historytokenlimit,
+		&chatbot.Allowedorigins,
+		&chatbot.Widgettheme,
+		&chatbot.Retentiondays,
+		&chatbot.Redactpii,
 	)
 	if err != nil {
 		return nil, err
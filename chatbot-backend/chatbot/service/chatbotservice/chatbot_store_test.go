@@ -0,0 +1,78 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+// newTestDB creates the tables in a new database for the test
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	previous := config.Envs.DATABASE_PATH
+	config.Envs.DATABASE_PATH = filepath.Join(t.TempDir(), "test.db")
+	t.Cleanup(func() { config.Envs.DATABASE_PATH = previous })
+
+	if _, err := db.InitDB(); err != nil {
+		t.Fatalf("error creating tables: %v", err)
+	}
+	dbConnection, err := db.GetDBConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbConnection.Close() })
+	return dbConnection
+}
+
+func TestUpdateChatbotRecordsRevision(t *testing.T) {
+	dbConnection := newTestDB(t)
+	store := NewStore(dbConnection)
+	revisionStore := NewRevisionStore(dbConnection)
+	ctx := context.Background()
+
+	chatbotID, err := store.CreateChatbot(ctx,
+		types.NewChatbot{Username: "owner", Chatbotname: "bot", Behaviour: "first", Sharemode: types.ShareModePrivate},
+		types.NewChatbotRevision{Chatbotname: "bot", Behaviour: "first", Author: "owner"},
+	)
+	if err != nil {
+		t.Fatalf("error creating chatbot: %v", err)
+	}
+
+	update := types.UpdateChatbot{Chatbotid: chatbotID, Username: "owner", Chatbotname: "bot", Behaviour: "second", Sharemode: types.ShareModePrivate}
+	revision := types.NewChatbotRevision{Chatbotname: "bot", Behaviour: "second", Author: "owner"}
+	latest, err := store.UpdateChatbot(ctx, update, revision)
+	if err != nil || latest.Revision != 2 {
+		t.Fatalf("expected revision 2, got %+v (%v)", latest, err)
+	}
+	// saving the same configuration again, like changing only the sharing mode, is not a new revision
+	update.Sharemode = types.ShareModePublic
+	if latest, err = store.UpdateChatbot(ctx, update, revision); err != nil || latest.Revision != 2 {
+		t.Fatalf("expected revision 2 to stay the latest, got %+v (%v)", latest, err)
+	}
+
+	revisions, err := revisionStore.GetRevisionsByChatbotID(ctx, chatbotID)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d (%v)", len(revisions), err)
+	}
+
+	// the chatbot is not changed when its revision cannot be recorded
+	if _, err := dbConnection.Exec("DROP TABLE chatbot_revisions"); err != nil {
+		t.Fatal(err)
+	}
+	update.Behaviour = "third"
+	if _, err := store.UpdateChatbot(ctx, update, types.NewChatbotRevision{Chatbotname: "bot", Behaviour: "third"}); err == nil {
+		t.Fatal("expected an error when the revision cannot be recorded")
+	}
+	chatbot, err := store.GetChatbotsByID(ctx, chatbotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatbot.Behaviour != "second" {
+		t.Errorf("expected the chatbot to keep behaviour %q, got %q", "second", chatbot.Behaviour)
+	}
+}
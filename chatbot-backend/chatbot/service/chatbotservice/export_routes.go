@@ -0,0 +1,406 @@
+package chatbotservice
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/validate"
+)
+
+const (
+	bundleManifestName = "manifest.json"
+	bundleFilesDir     = "files/"
+	maxBundleSize      = 20 << 20 // 20MB
+	maxImportRenames   = 100
+)
+
+// Ways to handle a new chatbot whose name is already used by the user
+const (
+	nameConflictRename = "rename"
+	nameConflictFail   = "fail"
+)
+
+var ErrChatbotNameTaken = errors.New("chatbot name already in use")
+
+// bundleFile is a knowledge file read from an export bundle
+type bundleFile struct {
+	name    string
+	content []byte
+}
+
+// ExportChatbot downloads the chatbot configuration and its knowledge file as a zip bundle
+// that can be imported into another deployment
+func (h *Handler) ExportChatbot(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	var files []bundleFile
+	if chatbot.Filepath != "" {
+		content, err := os.ReadFile(chatbot.Filepath)
+		if err != nil {
+			// the chatbot can still be exported without a file that went missing
+			slog.WarnContext(r.Context(), "Error reading chatbot file, exporting without it", "path", chatbot.Filepath, "error", err)
+		} else {
+			files = append(files, bundleFile{name: baseName(chatbot.Filepath), content: content})
+		}
+	}
+
+	bundle, err := buildExportBundle(*chatbot, files)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error building export bundle", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to export chatbot"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-export.zip\"", chatbot.Chatbotname))
+	w.Header().Set("Content-Length", strconv.Itoa(len(bundle)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(bundle)
+}
+
+// ImportChatbot recreates a chatbot from an export bundle uploaded as the "bundle" form file.
+// The chatbotname field overrides the exported name, and onConflict decides whether a name that is
+// already used gets a numbered suffix (rename, the default) or fails the import (fail)
+func (h *Handler) ImportChatbot(w http.ResponseWriter, r *http.Request) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBundleSize+(1<<20))
+	err := r.ParseMultipartForm(10 << 20) // 10MB kept in memory
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to parse form"))
+		return
+	}
+
+	onConflict := r.FormValue("onConflict")
+	if onConflict == "" {
+		onConflict = nameConflictRename
+	}
+	if onConflict != nameConflictRename && onConflict != nameConflictFail {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("onConflict must be rename or fail"))
+		return
+	}
+
+	workspaceID, ok := h.getWorkspaceIDFromForm(w, r, username)
+	if !ok {
+		return
+	}
+
+	bundle, _, err := r.FormFile("bundle")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing bundle file"))
+		return
+	}
+	defer bundle.Close()
+
+	data, err := io.ReadAll(io.LimitReader(bundle, maxBundleSize+1))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to read bundle"))
+		return
+	}
+	if len(data) > maxBundleSize {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("bundle is larger than %dMB", maxBundleSize>>20))
+		return
+	}
+
+	manifest, files, err := readImportBundle(data)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	exported := manifest.Chatbot
+
+	chatbotname := strings.TrimSpace(r.FormValue("chatbotname"))
+	if chatbotname == "" {
+		chatbotname = exported.Chatbotname
+	}
+
+	// share tokens and passwords are not exported, so those modes cannot be carried over as they are
+	shareMode := exported.Sharemode
+	shareToken := ""
+	shareModeReset := false
+	switch shareMode {
+	case types.ShareModeLink:
+		shareToken, err = utils.GenerateSecureToken(24)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error generating share token", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to generate share token"))
+			return
+		}
+	case types.ShareModePassword, types.ShareModeAllowlist:
+		shareMode = types.ShareModePrivate
+		shareModeReset = true
+	}
+
+	var filename string
+	var content []byte
+	var fileUpdatedDate string
+	if len(files) > 0 {
+		filename = files[0].name
+		content = files[0].content
+		fileUpdatedDate, _ = utils.GetCurrentTime()
+	}
+
+	newChatbot := types.NewChatbot{
+		Username:        username,
+		Chatbotname:     chatbotname,
+		Description:     exported.Description,
+		Behaviour:       exported.Behaviour,
+		IsShared:        shareMode != types.ShareModePrivate,
+		Usercontext:     exported.Usercontext,
+		FileUpdatedDate: fileUpdatedDate,
+		Workspaceid:     workspaceID,
+		Sharemode:       shareMode,
+		Sharetoken:      shareToken,
+	}
+	if err := validateNewChatbot(newChatbot, filename); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	createdTime, _ := utils.GetCurrentTime()
+	newChatbot, botID, err := h.createChatbotWithAvailableName(r.Context(), newChatbot, filename, content, onConflict, "Imported chatbot")
+	if err != nil {
+		if errors.Is(err, ErrChatbotNameTaken) {
+			utils.WriteError(w, http.StatusConflict, err)
+		} else {
+			slog.ErrorContext(r.Context(), "Error importing chatbot", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to import chatbot"))
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"chatbotid":      botID,
+		"chatbotname":    newChatbot.Chatbotname,
+		"shareMode":      shareMode,
+		"shareModeReset": shareModeReset,
+		"createddate":    createdTime,
+		"updateddate":    createdTime,
+	})
+}
+
+// availableChatbotName returns the name if the user has no chatbot with it yet. Otherwise a numbered suffix
+// is added when renaming is allowed, such as mybot-2. Names in taken are treated as used
+func (h *Handler) availableChatbotName(ctx context.Context, username string, chatbotname string, onConflict string, taken map[string]bool) (string, error) {
+	candidate := chatbotname
+	for attempt := 2; attempt <= maxImportRenames+1; attempt++ {
+		if !taken[candidate] {
+			_, err := h.chatbotStore.GetChatbotByName(ctx, username, candidate)
+			if errors.Is(err, ErrChatbotNotFound) {
+				return candidate, nil
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		if onConflict != nameConflictRename {
+			return "", ErrChatbotNameTaken
+		}
+		candidate = fmt.Sprintf("%s-%d", chatbotname, attempt)
+	}
+	return "", ErrChatbotNameTaken
+}
+
+// createChatbotWithAvailableName creates the chatbot under the name given by availableChatbotName, saving content
+// as its knowledge file first when it has one. Another request can take the name after it was checked, so the name
+// is chosen again when the chatbot or its file already exists, and only the file saved here is ever removed
+func (h *Handler) createChatbotWithAvailableName(ctx context.Context, newChatbot types.NewChatbot, filename string, content []byte, onConflict string, message string) (types.NewChatbot, int, error) {
+	chatbotname := newChatbot.Chatbotname
+	taken := map[string]bool{}
+	for attempt := 0; attempt <= maxImportRenames; attempt++ {
+		name, err := h.availableChatbotName(ctx, newChatbot.Username, chatbotname, onConflict, taken)
+		if err != nil {
+			return newChatbot, 0, err
+		}
+		newChatbot.Chatbotname = name
+		newChatbot.File = ""
+
+		if filename != "" {
+			newChatbot.File, err = saveNewChatbotFile(newChatbot.Username, name, filename, bytes.NewReader(content))
+			if errors.Is(err, os.ErrExist) {
+				taken[name] = true
+				continue
+			}
+			if err != nil {
+				return newChatbot, 0, fmt.Errorf("failed to save file: %w", err)
+			}
+		}
+
+		chatbotID, err := h.createChatbot(ctx, newChatbot, newChatbot.Username, message)
+		if err == nil {
+			return newChatbot, chatbotID, nil
+		}
+		if newChatbot.File != "" {
+			removeChatbotFile(newChatbot.File)
+		}
+		if !db.IsUniqueViolation(err) {
+			return newChatbot, 0, err
+		}
+		taken[name] = true
+	}
+	return newChatbot, 0, ErrChatbotNameTaken
+}
+
+// buildExportBundle writes the manifest and knowledge files into a zip archive.
+// Identifiers, share secrets and server paths are left out since they only make sense in this deployment
+func buildExportBundle(chatbot types.Chatbot, files []bundleFile) ([]byte, error) {
+	exportedAt, _ := utils.GetCurrentTime()
+	chatbot.Chatbotid = 0
+	chatbot.Workspaceid = 0
+	chatbot.Sharetoken = ""
+	chatbot.Sharepassword = ""
+	chatbot.Filepath = ""
+
+	manifest := types.ChatbotExportManifest{
+		FormatVersion: types.ChatbotExportFormatVersion,
+		ExportedAt:    exportedAt,
+		Chatbot:       chatbot,
+		Files:         []types.ChatbotExportFile{},
+	}
+	for _, file := range files {
+		checksum := sha256.Sum256(file.content)
+		manifest.Files = append(manifest.Files, types.ChatbotExportFile{
+			Name:        file.name,
+			Path:        bundleFilesDir + file.name,
+			ContentType: http.DetectContentType(file.content),
+			Size:        int64(len(file.content)),
+			SHA256:      hex.EncodeToString(checksum[:]),
+		})
+	}
+	if len(files) > 0 {
+		manifest.Chatbot.Filepath = files[0].name
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	manifestWriter, err := archive.Create(bundleManifestName)
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(manifestWriter)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+
+	for index, file := range files {
+		fileWriter, err := archive.Create(manifest.Files[index].Path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fileWriter.Write(file.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// readImportBundle reads and validates the manifest of a bundle and the knowledge files it lists.
+// Only entries named in the manifest are read, so other paths in the archive are never used
+func readImportBundle(data []byte) (*types.ChatbotExportManifest, []bundleFile, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("bundle is not a valid zip archive")
+	}
+
+	entries := map[string]*zip.File{}
+	for _, entry := range archive.File {
+		entries[entry.Name] = entry
+	}
+
+	manifestEntry, ok := entries[bundleManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("bundle is missing %s", bundleManifestName)
+	}
+	manifestContent, err := readBundleEntry(manifestEntry, 1<<20)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifest := new(types.ChatbotExportManifest)
+	if err := json.Unmarshal(manifestContent, manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.FormatVersion != types.ChatbotExportFormatVersion {
+		return nil, nil, fmt.Errorf("unsupported bundle format version %d", manifest.FormatVersion)
+	}
+	// chatbots only have a single knowledge file
+	if len(manifest.Files) > 1 {
+		return nil, nil, fmt.Errorf("bundle can contain at most one knowledge file")
+	}
+
+	files := []bundleFile{}
+	for _, manifestFile := range manifest.Files {
+		if !validate.ValidFileNameRegex.MatchString(manifestFile.Name) || manifestFile.Path != bundleFilesDir+manifestFile.Name {
+			return nil, nil, fmt.Errorf("invalid file name %q", manifestFile.Name)
+		}
+
+		entry, ok := entries[manifestFile.Path]
+		if !ok {
+			return nil, nil, fmt.Errorf("bundle is missing file %s", manifestFile.Path)
+		}
+		content, err := readBundleEntry(entry, maxBundleSize)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		checksum := sha256.Sum256(content)
+		if int64(len(content)) != manifestFile.Size || hex.EncodeToString(checksum[:]) != manifestFile.SHA256 {
+			return nil, nil, fmt.Errorf("checksum mismatch for file %s", manifestFile.Name)
+		}
+		if !allowedFileTypes[http.DetectContentType(content)] {
+			return nil, nil, errInvalidFileType
+		}
+
+		files = append(files, bundleFile{name: manifestFile.Name, content: content})
+	}
+
+	return manifest, files, nil
+}
+
+// readBundleEntry reads a zip entry, refusing entries that expand past the limit
+func readBundleEntry(entry *zip.File, limit int64) ([]byte, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from bundle", entry.Name)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from bundle", entry.Name)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s in bundle is too large", entry.Name)
+	}
+	return content, nil
+}
@@ -0,0 +1,233 @@
+package chatbotservice
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+var testPDF = []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+
+func TestExportBundleRoundTrip(t *testing.T) {
+	chatbot := types.Chatbot{
+		Chatbotid:     7,
+		Username:      "owner",
+		Chatbotname:   "helpdesk",
+		Description:   "answers questions",
+		Behaviour:     "be polite",
+		Usercontext:   "opening hours are 9 to 5",
+		Filepath:      "/files/owner/helpdesk/faq.pdf",
+		Workspaceid:   3,
+		Sharemode:     types.ShareModeLink,
+		Sharetoken:    "secret-token",
+		Sharepassword: "hash",
+	}
+
+	bundle, err := buildExportBundle(chatbot, []bundleFile{{name: "faq.pdf", content: testPDF}})
+	if err != nil {
+		t.Fatalf("error building bundle: %v", err)
+	}
+
+	manifest, files, err := readImportBundle(bundle)
+	if err != nil {
+		t.Fatalf("error reading bundle: %v", err)
+	}
+
+	exported := manifest.Chatbot
+	if exported.Chatbotid != 0 || exported.Workspaceid != 0 || exported.Sharetoken != "" || exported.Sharepassword != "" {
+		t.Errorf("expected identifiers and share secrets to be removed, got %+v", exported)
+	}
+	if exported.Filepath != "faq.pdf" {
+		t.Errorf("expected file path to be the file name, got %q", exported.Filepath)
+	}
+	if exported.Chatbotname != chatbot.Chatbotname || exported.Behaviour != chatbot.Behaviour || exported.Usercontext != chatbot.Usercontext {
+		t.Errorf("expected configuration to be kept, got %+v", exported)
+	}
+	if len(files) != 1 || files[0].name != "faq.pdf" || !bytes.Equal(files[0].content, testPDF) {
+		t.Errorf("expected the knowledge file to be kept, got %+v", files)
+	}
+}
+
+func TestReadImportBundleRejectsInvalidBundles(t *testing.T) {
+	validBundle, err := buildExportBundle(types.Chatbot{Chatbotname: "helpdesk"}, []bundleFile{{name: "faq.pdf", content: testPDF}})
+	if err != nil {
+		t.Fatalf("error building bundle: %v", err)
+	}
+	manifest, _, err := readImportBundle(validBundle)
+	if err != nil {
+		t.Fatalf("error reading bundle: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		modify        func(manifest *types.ChatbotExportManifest)
+		fileName      string
+		fileContent   []byte
+		expectedError string
+	}{
+		{
+			name:          "unsupported version",
+			modify:        func(manifest *types.ChatbotExportManifest) { manifest.FormatVersion = 99 },
+			expectedError: "unsupported bundle format version",
+		},
+		{
+			name:          "checksum mismatch",
+			modify:        func(manifest *types.ChatbotExportManifest) {},
+			fileContent:   append([]byte("%PDF-1.4 tampered"), testPDF...),
+			expectedError: "checksum mismatch",
+		},
+		{
+			name: "path outside files directory",
+			modify: func(manifest *types.ChatbotExportManifest) {
+				manifest.Files[0].Path = "../../faq.pdf"
+			},
+			expectedError: "invalid file name",
+		},
+		{
+			name: "invalid file name",
+			modify: func(manifest *types.ChatbotExportManifest) {
+				manifest.Files[0].Name = "faq$.pdf"
+				manifest.Files[0].Path = "files/faq$.pdf"
+			},
+			fileName:      "files/faq$.pdf",
+			expectedError: "invalid file name",
+		},
+		{
+			name: "disallowed file type",
+			modify: func(manifest *types.ChatbotExportManifest) {
+				checksum := sha256.Sum256([]byte("plain text"))
+				manifest.Files[0].Size = int64(len("plain text"))
+				manifest.Files[0].SHA256 = hex.EncodeToString(checksum[:])
+			},
+			fileContent:   []byte("plain text"),
+			expectedError: "invalid file type",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modified := *manifest
+			modified.Files = append([]types.ChatbotExportFile{}, manifest.Files...)
+			test.modify(&modified)
+
+			fileName := test.fileName
+			if fileName == "" {
+				fileName = "files/faq.pdf"
+			}
+			fileContent := test.fileContent
+			if fileContent == nil {
+				fileContent = testPDF
+			}
+
+			_, _, err := readImportBundle(writeTestBundle(t, modified, fileName, fileContent))
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error containing %q, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+// staleNameStore reports the names as free once, like a chatbot created by another request right after the check
+type staleNameStore struct {
+	types.ChatbotStoreInterface
+	stale map[string]bool
+}
+
+func (s *staleNameStore) GetChatbotByName(ctx context.Context, username string, chatbotname string) (*types.Chatbot, error) {
+	if s.stale[chatbotname] {
+		delete(s.stale, chatbotname)
+		return nil, ErrChatbotNotFound
+	}
+	return s.ChatbotStoreInterface.GetChatbotByName(ctx, username, chatbotname)
+}
+
+func TestCreateChatbotWithAvailableNameRace(t *testing.T) {
+	dbConnection := newTestDB(t)
+	previousFilesPath := config.Envs.FILES_PATH
+	config.Envs.FILES_PATH = t.TempDir() + "/"
+	t.Cleanup(func() { config.Envs.FILES_PATH = previousFilesPath })
+
+	store := NewStore(dbConnection)
+	handler := &Handler{chatbotStore: store, revisionStore: NewRevisionStore(dbConnection)}
+	ctx := context.Background()
+
+	existingContent := "%PDF-1.4 existing"
+	existingPath, err := saveChatbotFile("owner", "withfile", "faq.pdf", strings.NewReader(existingContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handler.createChatbot(ctx, types.NewChatbot{Username: "owner", Chatbotname: "withfile", File: existingPath, Sharemode: types.ShareModePrivate}, "owner", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handler.createChatbot(ctx, types.NewChatbot{Username: "owner", Chatbotname: "nofile", Sharemode: types.ShareModePrivate}, "owner", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		chatbotname  string
+		filename     string
+		onConflict   string
+		expectedName string
+		expectedErr  error
+	}{
+		{name: "file of taken name", chatbotname: "withfile", filename: "faq.pdf", onConflict: nameConflictRename, expectedName: "withfile-2"},
+		{name: "taken name", chatbotname: "nofile", onConflict: nameConflictRename, expectedName: "nofile-2"},
+		{name: "taken name without renaming", chatbotname: "withfile", filename: "faq.pdf", onConflict: nameConflictFail, expectedErr: ErrChatbotNameTaken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler.chatbotStore = &staleNameStore{ChatbotStoreInterface: store, stale: map[string]bool{test.chatbotname: true}}
+			created, _, err := handler.createChatbotWithAvailableName(ctx,
+				types.NewChatbot{Username: "owner", Chatbotname: test.chatbotname, Sharemode: types.ShareModePrivate},
+				test.filename, testPDF, test.onConflict, "Imported chatbot")
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if err == nil && created.Chatbotname != test.expectedName {
+				t.Errorf("expected chatbot name %q, got %q", test.expectedName, created.Chatbotname)
+			}
+
+			// the chatbot that took the name keeps its file
+			content, err := os.ReadFile(existingPath)
+			if err != nil || string(content) != existingContent {
+				t.Errorf("expected the file of the existing chatbot to be kept, got %q (%v)", content, err)
+			}
+		})
+	}
+}
+
+func writeTestBundle(t *testing.T, manifest types.ChatbotExportManifest, fileName string, fileContent []byte) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	manifestWriter, err := archive.Create(bundleManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(manifestWriter).Encode(manifest); err != nil {
+		t.Fatal(err)
+	}
+	fileWriter, err := archive.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fileWriter.Write(fileContent); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
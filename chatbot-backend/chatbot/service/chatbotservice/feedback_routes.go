@@ -0,0 +1,89 @@
+package chatbotservice
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+const (
+	defaultFeedbackPageSize = 50
+	maxFeedbackPageSize     = 200
+)
+
+// GetChatbotFeedback is the review queue of rated responses, each with the user message it answered.
+// Only thumbs down are returned unless rating is up or all, and the list can be narrowed to a revision
+// of the chatbot or to ratings with a comment
+func (h *Handler) GetChatbotFeedback(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	filter, err := parseFeedbackFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	reviews, err := h.feedbackStore.GetFeedbackReviews(r.Context(), chatbot.Chatbotid, filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot feedback", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"feedback": reviews,
+	})
+}
+
+// parseFeedbackFilter reads the rating, revisionid, commented, limit and offset query parameters
+func parseFeedbackFilter(query url.Values) (types.FeedbackFilter, error) {
+	filter := types.FeedbackFilter{Rating: types.FeedbackRatingDown, Limit: defaultFeedbackPageSize}
+
+	switch rating := query.Get("rating"); rating {
+	case "":
+	case "all":
+		filter.Rating = ""
+	case types.FeedbackRatingUp, types.FeedbackRatingDown:
+		filter.Rating = rating
+	default:
+		return filter, fmt.Errorf("invalid rating %s", rating)
+	}
+
+	if value := query.Get("revisionid"); value != "" {
+		revisionID, err := strconv.Atoi(value)
+		if err != nil || revisionID < 1 {
+			return filter, fmt.Errorf("invalid revision ID")
+		}
+		filter.Revisionid = revisionID
+	}
+	if value := query.Get("commented"); value != "" {
+		commented, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid commented value")
+		}
+		filter.Commented = commented
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxFeedbackPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxFeedbackPageSize)
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("invalid offset")
+		}
+		filter.Offset = offset
+	}
+	return filter, nil
+}
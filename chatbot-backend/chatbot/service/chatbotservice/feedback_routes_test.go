@@ -0,0 +1,36 @@
+package chatbotservice
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func TestParseFeedbackFilter(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected types.FeedbackFilter
+		wantErr  bool
+	}{
+		{query: "", expected: types.FeedbackFilter{Rating: types.FeedbackRatingDown, Limit: defaultFeedbackPageSize}},
+		{query: "rating=all&commented=true", expected: types.FeedbackFilter{Commented: true, Limit: defaultFeedbackPageSize}},
+		{query: "rating=up&revisionid=4&limit=10&offset=20", expected: types.FeedbackFilter{Rating: types.FeedbackRatingUp, Revisionid: 4, Limit: 10, Offset: 20}},
+		{query: "rating=meh", wantErr: true},
+		{query: "revisionid=first", wantErr: true},
+		{query: "limit=1000", wantErr: true},
+		{query: "offset=-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		filter, err := parseFeedbackFilter(query)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: expected error %v, got %v", tt.query, tt.wantErr, err)
+			continue
+		}
+		if !tt.wantErr && filter != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v", tt.query, tt.expected, filter)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+type FeedbackStore struct {
+	db *sql.DB
+}
+
+func NewFeedbackStore(db *sql.DB) types.MessageFeedbackStoreInterface {
+	return &FeedbackStore{db: db}
+}
+
+// SaveFeedback saves the rating of a model message, replacing the message's earlier rating
+func (s *FeedbackStore) SaveFeedback(ctx context.Context, feedback types.MessageFeedback) error {
+	ctx, endQuery := db.TrackQuery(ctx, "FeedbackStore.SaveFeedback")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO message_feedback (chatid, questionchatid, conversationid, chatbotid, revisionid, rating, comment, username, createddate, updateddate)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(chatid) DO UPDATE SET questionchatid=excluded.questionchatid, rating=excluded.rating, comment=excluded.comment, username=excluded.username, updateddate=excluded.updateddate`,
+		feedback.Chatid,
+		feedback.Questionchatid,
+		feedback.Conversationid,
+		feedback.Chatbotid,
+		feedback.Revisionid,
+		feedback.Rating,
+		feedback.Comment,
+		feedback.Username,
+		currentTime,
+		currentTime,
+	)
+	return err
+}
+
+// GetFeedbackReviews returns the rated messages of the chatbot matching the filter, newest first,
+// each with the user message it answered
+func (s *FeedbackStore) GetFeedbackReviews(ctx context.Context, chatbotID int, filter types.FeedbackFilter) ([]types.FeedbackReview, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "FeedbackStore.GetFeedbackReviews")
+	defer endQuery()
+
+	conditions := []string{"f.chatbotid=?"}
+	args := []interface{}{chatbotID}
+	if filter.Rating != "" {
+		conditions = append(conditions, "f.rating=?")
+		args = append(args, filter.Rating)
+	}
+	if filter.Revisionid != 0 {
+		conditions = append(conditions, "f.revisionid=?")
+		args = append(args, filter.Revisionid)
+	}
+	if filter.Commented {
+		conditions = append(conditions, "f.comment<>''")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT f.feedbackid, f.chatid, f.conversationid, f.revisionid, f.rating, f.comment, f.username,
+		COALESCE(question.chat, ''), answer.chat, f.createddate, f.updateddate
+		FROM message_feedback AS f
+		JOIN conversations AS answer ON answer.chatid = f.chatid
+		LEFT JOIN conversations AS question ON question.chatid = f.questionchatid
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY f.feedbackid DESC LIMIT ? OFFSET ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []types.FeedbackReview{}
+	for rows.Next() {
+		review := types.FeedbackReview{}
+		err := rows.Scan(
+			&review.Feedbackid,
+			&review.Chatid,
+			&review.Conversationid,
+			&review.Revisionid,
+			&review.Rating,
+			&review.Comment,
+			&review.Username,
+			&review.Usermessage,
+			&review.Modelresponse,
+			&review.Createddate,
+			&review.Updateddate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+func (s *FeedbackStore) DeleteFeedbackByChatbotID(ctx context.Context, chatbotID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "FeedbackStore.DeleteFeedbackByChatbotID")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM message_feedback WHERE chatbotid=?", chatbotID)
+	return err
+}
@@ -0,0 +1,84 @@
+package chatbotservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func TestGetFeedbackReviewsOfEditedConversation(t *testing.T) {
+	dbConnection := newTestDB(t)
+	store := NewFeedbackStore(dbConnection)
+	ctx := context.Background()
+
+	// the first question was edited on branch 1, whose answer was regenerated on branch 2
+	messages := []struct {
+		chatid   int
+		role     string
+		chat     string
+		sequence int
+		branch   int
+	}{
+		{1, "user", "original question", 1, 0},
+		{2, "model", "original answer", 2, 0},
+		{3, "user", "edited question", 1, 1},
+		{4, "model", "edited answer", 2, 1},
+		{5, "model", "regenerated answer", 2, 2},
+	}
+	for _, message := range messages {
+		_, err := dbConnection.Exec(
+			"INSERT INTO conversations (chatid, conversationid, chatbotid, username, chatbotname, role, chat, createddate, sequence, branch) VALUES (?, 'conv', 1, 'owner', 'bot', ?, ?, '', ?, ?)",
+			message.chatid, message.role, message.chat, message.sequence, message.branch,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := dbConnection.Exec(`INSERT INTO conversation_branches (conversationid, branch, parentbranch, forksequence, reason, createddate)
+		VALUES ('conv', 1, 0, 1, 'edit', ''), ('conv', 2, 1, 2, 'regenerate', '')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, feedback := range []types.MessageFeedback{
+		{Chatid: 2, Questionchatid: 1},
+		{Chatid: 4, Questionchatid: 3},
+		{Chatid: 5, Questionchatid: 3},
+	} {
+		feedback.Conversationid = "conv"
+		feedback.Chatbotid = 1
+		feedback.Rating = types.FeedbackRatingDown
+		if err := store.SaveFeedback(ctx, feedback); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[int]string{2: "original question", 4: "edited question", 5: "edited question"}
+	checkReviews := func(t *testing.T) {
+		t.Helper()
+		reviews, err := store.GetFeedbackReviews(ctx, 1, types.FeedbackFilter{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reviews) != len(expected) {
+			t.Fatalf("expected %d reviews, got %d", len(expected), len(reviews))
+		}
+		for _, review := range reviews {
+			if review.Usermessage != expected[review.Chatid] {
+				t.Errorf("expected response %d to answer %q, got %q", review.Chatid, expected[review.Chatid], review.Usermessage)
+			}
+		}
+	}
+	checkReviews(t)
+
+	// ratings saved before the question was stored with them are filled in when the column is added
+	if _, err := dbConnection.Exec("ALTER TABLE message_feedback DROP COLUMN questionchatid"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := db.InitDB(); !exists {
+		t.Fatalf("error migrating database: %v", err)
+	}
+	checkReviews(t)
+}
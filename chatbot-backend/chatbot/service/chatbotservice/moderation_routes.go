@@ -0,0 +1,186 @@
+package chatbotservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/moderation"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	defaultFlaggedPageSize = 50
+	maxFlaggedPageSize     = 200
+)
+
+// GetChatbotModerationRules returns the rules visitor messages and model responses of the chatbot are checked against
+func (h *Handler) GetChatbotModerationRules(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	rules, err := h.moderationStore.GetRulesByChatbotID(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot moderation rules", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"rules": rules,
+	})
+}
+
+// CreateChatbotModerationRule adds a keyword or regex rule that flags or blocks the messages matching it
+// at the input stage, the output stage or both
+func (h *Handler) CreateChatbotModerationRule(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	var payload types.CreateModerationRulePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	rule := types.NewModerationRule{
+		Chatbotid: chatbot.Chatbotid,
+		Kind:      payload.Kind,
+		Pattern:   payload.Pattern,
+		Action:    payload.Action,
+		Stage:     payload.Stage,
+	}
+	if rule.Kind == types.ModerationKindKeyword {
+		rule.Pattern = strings.TrimSpace(rule.Pattern)
+	}
+	if err := moderation.Validate(rule); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, err := h.moderationStore.GetRulesByChatbotID(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot moderation rules", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(existing) >= moderation.MaxRulesPerChatbot {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("a chatbot can have at most %d moderation rules", moderation.MaxRulesPerChatbot))
+		return
+	}
+
+	ruleID, err := h.moderationStore.CreateRule(r.Context(), rule)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating chatbot moderation rule", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Created chatbot moderation rule", "ruleid", ruleID, "kind", rule.Kind, "action", rule.Action, "stage", rule.Stage)
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Moderation rule created successfully",
+		"ruleid":  ruleID,
+	})
+}
+
+func (h *Handler) DeleteChatbotModerationRule(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	ruleID, err := strconv.Atoi(r.PathValue("ruleid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid rule ID"))
+		return
+	}
+
+	if err := h.moderationStore.DeleteRule(r.Context(), chatbot.Chatbotid, ruleID); err != nil {
+		if errors.Is(err, ErrModerationRuleNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Error deleting chatbot moderation rule", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Moderation rule deleted successfully",
+	})
+}
+
+// GetChatbotFlaggedMessages is the review queue of messages moderation flagged or blocked, newest first.
+// It can be narrowed to an action and a stage
+func (h *Handler) GetChatbotFlaggedMessages(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	filter, err := parseFlaggedMessageFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	flagged, err := h.moderationStore.GetFlaggedMessages(r.Context(), chatbot.Chatbotid, filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot flagged messages", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"flagged": flagged,
+	})
+}
+
+// parseFlaggedMessageFilter reads the action, stage, limit and offset query parameters
+func parseFlaggedMessageFilter(query url.Values) (types.FlaggedMessageFilter, error) {
+	filter := types.FlaggedMessageFilter{Limit: defaultFlaggedPageSize}
+
+	switch action := query.Get("action"); action {
+	case "", types.ModerationActionFlag, types.ModerationActionBlock:
+		filter.Action = action
+	default:
+		return filter, fmt.Errorf("invalid action %s", action)
+	}
+	switch stage := query.Get("stage"); stage {
+	case "", types.ModerationStageInput, types.ModerationStageOutput:
+		filter.Stage = stage
+	default:
+		return filter, fmt.Errorf("invalid stage %s", stage)
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxFlaggedPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxFlaggedPageSize)
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("invalid offset")
+		}
+		filter.Offset = offset
+	}
+	return filter, nil
+}
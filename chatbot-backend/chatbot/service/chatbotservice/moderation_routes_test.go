@@ -0,0 +1,35 @@
+package chatbotservice
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func TestParseFlaggedMessageFilter(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected types.FlaggedMessageFilter
+		wantErr  bool
+	}{
+		{query: "", expected: types.FlaggedMessageFilter{Limit: defaultFlaggedPageSize}},
+		{query: "action=block&stage=output&limit=10&offset=20", expected: types.FlaggedMessageFilter{Action: types.ModerationActionBlock, Stage: types.ModerationStageOutput, Limit: 10, Offset: 20}},
+		{query: "action=delete", wantErr: true},
+		{query: "stage=both", wantErr: true},
+		{query: "limit=0", wantErr: true},
+		{query: "offset=-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		filter, err := parseFlaggedMessageFilter(query)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: expected error %v, got %v", tt.query, tt.wantErr, err)
+			continue
+		}
+		if !tt.wantErr && filter != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v", tt.query, tt.expected, filter)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+var ErrModerationRuleNotFound = errors.New("moderation rule not found")
+
+type ModerationStore struct {
+	db *sql.DB
+}
+
+func NewModerationStore(db *sql.DB) types.ModerationStoreInterface {
+	return &ModerationStore{db: db}
+}
+
+func (s *ModerationStore) GetRulesByChatbotID(ctx context.Context, chatbotID int) ([]types.ModerationRule, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ModerationStore.GetRulesByChatbotID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM moderation_rules WHERE chatbotid=? ORDER BY ruleid", chatbotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []types.ModerationRule{}
+	for rows.Next() {
+		rule := types.ModerationRule{}
+		err := rows.Scan(
+			&rule.Ruleid,
+			&rule.Chatbotid,
+			&rule.Kind,
+			&rule.Pattern,
+			&rule.Action,
+			&rule.Stage,
+			&rule.Createddate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (s *ModerationStore) CreateRule(ctx context.Context, rulePayload types.NewModerationRule) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ModerationStore.CreateRule")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO moderation_rules (chatbotid, kind, pattern, action, stage, createddate) VALUES (?, ?, ?, ?, ?, ?)",
+		rulePayload.Chatbotid,
+		rulePayload.Kind,
+		rulePayload.Pattern,
+		rulePayload.Action,
+		rulePayload.Stage,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// DeleteRule deletes the rule if it belongs to the chatbot, returning ErrModerationRuleNotFound otherwise
+func (s *ModerationStore) DeleteRule(ctx context.Context, chatbotID int, ruleID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ModerationStore.DeleteRule")
+	defer endQuery()
+	res, err := s.db.ExecContext(ctx, "DELETE FROM moderation_rules WHERE ruleid=? AND chatbotid=?", ruleID, chatbotID)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrModerationRuleNotFound
+	}
+	return nil
+}
+
+func (s *ModerationStore) CreateFlaggedMessage(ctx context.Context, flagged types.FlaggedMessage) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ModerationStore.CreateFlaggedMessage")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO flagged_messages (chatbotid, conversationid, stage, action, reason, content, createddate) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		flagged.Chatbotid,
+		flagged.Conversationid,
+		flagged.Stage,
+		flagged.Action,
+		flagged.Reason,
+		flagged.Content,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetFlaggedMessages returns the flagged messages of the chatbot matching the filter, newest first
+func (s *ModerationStore) GetFlaggedMessages(ctx context.Context, chatbotID int, filter types.FlaggedMessageFilter) ([]types.FlaggedMessage, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ModerationStore.GetFlaggedMessages")
+	defer endQuery()
+
+	conditions := []string{"chatbotid=?"}
+	args := []interface{}{chatbotID}
+	if filter.Action != "" {
+		conditions = append(conditions, "action=?")
+		args = append(args, filter.Action)
+	}
+	if filter.Stage != "" {
+		conditions = append(conditions, "stage=?")
+		args = append(args, filter.Stage)
+	}
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT * FROM flagged_messages WHERE "+strings.Join(conditions, " AND ")+" ORDER BY flagid DESC LIMIT ? OFFSET ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flaggedMessages := []types.FlaggedMessage{}
+	for rows.Next() {
+		flagged := types.FlaggedMessage{}
+		err := rows.Scan(
+			&flagged.Flagid,
+			&flagged.Chatbotid,
+			&flagged.Conversationid,
+			&flagged.Stage,
+			&flagged.Action,
+			&flagged.Reason,
+			&flagged.Content,
+			&flagged.Createddate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		flaggedMessages = append(flaggedMessages, flagged)
+	}
+
+	return flaggedMessages, rows.Err()
+}
+
+// DeleteModerationByChatbotID deletes the moderation rules of the chatbot and the messages they flagged
+func (s *ModerationStore) DeleteModerationByChatbotID(ctx context.Context, chatbotID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ModerationStore.DeleteModerationByChatbotID")
+	defer endQuery()
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM moderation_rules WHERE chatbotid=?", chatbotID); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM flagged_messages WHERE chatbotid=?", chatbotID)
+	return err
+}
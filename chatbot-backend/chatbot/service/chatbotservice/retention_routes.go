@@ -0,0 +1,70 @@
+package chatbotservice
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/retention"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+const purgeLogSize = 20
+
+// GetChatbotRetentionSettings returns the chatbot's retention settings with the retention the server enforces
+// and the latest purges of its conversations
+func (h *Handler) GetChatbotRetentionSettings(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	purges, err := h.retentionStore.GetPurgeRecords(r.Context(), chatbot.Chatbotid, purgeLogSize)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting conversation purges", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"retentionDays":          chatbot.Retentiondays,
+		"redactPII":              chatbot.Redactpii,
+		"serverRetentionDays":    config.Envs.RetentionDays,
+		"serverRedactPII":        config.Envs.RedactPII,
+		"effectiveRetentionDays": retention.Days(chatbot.Retentiondays),
+		"purges":                 purges,
+	})
+}
+
+func (h *Handler) UpdateChatbotRetentionSettings(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	var payload types.ChatbotRetentionSettings
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	if err := h.chatbotStore.UpdateChatbotRetentionSettings(r.Context(), chatbot.Chatbotid, payload); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating chatbot retention settings", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Updated chatbot retention settings", "retention_days", payload.Retentiondays, "redact_pii", payload.Redactpii)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message":                "Chatbot retention settings updated successfully",
+		"effectiveRetentionDays": retention.Days(payload.Retentiondays),
+	})
+}
@@ -0,0 +1,203 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+type RetentionStore struct {
+	db *sql.DB
+}
+
+func NewRetentionStore(db *sql.DB) types.RetentionStoreInterface {
+	return &RetentionStore{db: db}
+}
+
+// GetRetentionPolicies returns the retention setting of every chatbot
+func (s *RetentionStore) GetRetentionPolicies(ctx context.Context) ([]types.ChatbotRetention, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RetentionStore.GetRetentionPolicies")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT chatbotid, retentiondays FROM chatbots ORDER BY chatbotid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []types.ChatbotRetention{}
+	for rows.Next() {
+		policy := types.ChatbotRetention{}
+		if err := rows.Scan(&policy.Chatbotid, &policy.Retentiondays); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
+
+// GetConversationActivity returns when the last message of each conversation with the chatbot was sent,
+// the message saved last being the latest one
+func (s *RetentionStore) GetConversationActivity(ctx context.Context, chatbotID int) ([]types.ConversationActivity, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RetentionStore.GetConversationActivity")
+	defer endQuery()
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT conversationid, createddate FROM conversations
+		WHERE chatid IN (SELECT MAX(chatid) FROM conversations WHERE chatbotid=? GROUP BY conversationid)`,
+		chatbotID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := []types.ConversationActivity{}
+	for rows.Next() {
+		conversation := types.ConversationActivity{}
+		if err := rows.Scan(&conversation.Conversationid, &conversation.Lastmessagedate); err != nil {
+			return nil, err
+		}
+		activity = append(activity, conversation)
+	}
+	return activity, rows.Err()
+}
+
+// PurgeConversations deletes the chatbot's conversations with everything saved with them in one transaction,
+// including the webhook deliveries about them. The files of their attachments are returned to be removed once
+// the rows are gone
+func (s *RetentionStore) PurgeConversations(ctx context.Context, chatbotID int, conversationIDs []string) (types.PurgedConversations, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RetentionStore.PurgeConversations")
+	defer endQuery()
+	purged := types.PurgedConversations{Attachmentpaths: []string{}}
+	if len(conversationIDs) == 0 {
+		return purged, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(conversationIDs)), ", ")
+	args := []interface{}{chatbotID}
+	for _, conversationID := range conversationIDs {
+		args = append(args, conversationID)
+	}
+	inConversations := "chatbotid=? AND conversationid IN (" + placeholders + ")"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return purged, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT filepath FROM attachments WHERE "+inConversations, args...)
+	if err != nil {
+		return purged, err
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return purged, err
+		}
+		purged.Attachmentpaths = append(purged.Attachmentpaths, path)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return purged, err
+	}
+
+	for _, table := range []string{"message_feedback", "tool_calls", "attachments", "conversation_summaries", "flagged_messages"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE "+inConversations, args...); err != nil {
+			return purged, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM conversations WHERE "+inConversations, args...)
+	if err != nil {
+		return purged, err
+	}
+	messages, err := res.RowsAffected()
+	if err != nil {
+		return purged, err
+	}
+	// webhook deliveries keep the messages in their payload until they are sent or given up on
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM webhook_deliveries WHERE chatbotid=? AND json_extract(payload, '$.data.conversationid') IN ("+placeholders+")",
+		args...,
+	)
+	if err != nil {
+		return purged, err
+	}
+	// branches are not saved with the chatbot, conversation ids are only trusted to be unique once no messages are left
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM conversation_branches WHERE conversationid IN ("+placeholders+") AND conversationid NOT IN (SELECT conversationid FROM conversations)",
+		args[1:]...,
+	)
+	if err != nil {
+		return purged, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return purged, err
+	}
+	purged.Conversations = len(conversationIDs)
+	purged.Messages = int(messages)
+	return purged, nil
+}
+
+func (s *RetentionStore) CreatePurgeRecord(ctx context.Context, purge types.ConversationPurge) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RetentionStore.CreatePurgeRecord")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO conversation_purges (chatbotid, conversations, messages, retentiondays, cutoffdate, createddate) VALUES (?, ?, ?, ?, ?, ?)",
+		purge.Chatbotid,
+		purge.Conversations,
+		purge.Messages,
+		purge.Retentiondays,
+		purge.Cutoffdate,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetPurgeRecords returns the latest purges of the chatbot's conversations, newest first
+func (s *RetentionStore) GetPurgeRecords(ctx context.Context, chatbotID int, limit int) ([]types.ConversationPurge, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RetentionStore.GetPurgeRecords")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM conversation_purges WHERE chatbotid=? ORDER BY purgeid DESC LIMIT ?", chatbotID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purges := []types.ConversationPurge{}
+	for rows.Next() {
+		purge := types.ConversationPurge{}
+		err := rows.Scan(
+			&purge.Purgeid,
+			&purge.Chatbotid,
+			&purge.Conversations,
+			&purge.Messages,
+			&purge.Retentiondays,
+			&purge.Cutoffdate,
+			&purge.Createddate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		purges = append(purges, purge)
+	}
+	return purges, rows.Err()
+}
@@ -0,0 +1,57 @@
+package chatbotservice
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/webhooks"
+)
+
+func TestPurgeConversationsDeletesWebhookDeliveries(t *testing.T) {
+	dbConnection := newTestDB(t)
+	store := NewRetentionStore(dbConnection)
+	webhookStore := NewWebhookStore(dbConnection)
+	ctx := context.Background()
+
+	deliveries := []struct {
+		chatbotid      int
+		conversationid string
+	}{
+		{1, "old"},
+		{1, "kept"},
+		{2, "old"}, // a conversation id another chatbot was sent
+	}
+	for _, delivery := range deliveries {
+		payload, _ := json.Marshal(webhooks.Event{
+			Event:     types.WebhookEventMessageExchanged,
+			Chatbotid: delivery.chatbotid,
+			Data:      map[string]interface{}{"conversationid": delivery.conversationid, "usermessage": "my email is a@example.com"},
+		})
+		_, err := webhookStore.CreateDelivery(ctx, types.WebhookDelivery{
+			Webhookid: delivery.chatbotid,
+			Chatbotid: delivery.chatbotid,
+			Event:     types.WebhookEventMessageExchanged,
+			Payload:   string(payload),
+			Status:    types.WebhookDeliveryPending,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := store.PurgeConversations(ctx, 1, []string{"old"}); err != nil {
+		t.Fatalf("error purging conversations: %v", err)
+	}
+
+	for webhookID, expected := range map[int]int{1: 1, 2: 1} {
+		remaining, err := webhookStore.GetDeliveriesByWebhookID(ctx, webhookID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(remaining) != expected {
+			t.Errorf("expected %d deliveries left for webhook %d, got %d", expected, webhookID, len(remaining))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package chatbotservice
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+// diffRevisions compares the configuration fields of two revisions line by line
+func diffRevisions(from *types.ChatbotRevision, to *types.ChatbotRevision) types.RevisionDiff {
+	fields := []struct {
+		name string
+		from string
+		to   string
+	}{
+		{"chatbotname", from.Chatbotname, to.Chatbotname},
+		{"description", from.Description, to.Description},
+		{"behaviour", from.Behaviour, to.Behaviour},
+		{"usercontext", from.Usercontext, to.Usercontext},
+		{"file", baseName(from.Filepath), baseName(to.Filepath)},
+	}
+
+	diff := types.RevisionDiff{
+		Chatbotid: to.Chatbotid,
+		From:      from.Revision,
+		To:        to.Revision,
+		Fields:    []types.RevisionFieldDiff{},
+	}
+	for _, field := range fields {
+		diff.Fields = append(diff.Fields, types.RevisionFieldDiff{
+			Field:   field.name,
+			Changed: field.from != field.to,
+			Lines:   diffLines(field.from, field.to),
+		})
+	}
+	return diff
+}
+
+// diffLines returns a line diff turning before into after, using the longest common subsequence of lines
+func diffLines(before string, after string) []types.DiffLine {
+	a := splitLines(before)
+	b := splitLines(after)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []types.DiffLine{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, types.DiffLine{Op: types.DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, types.DiffLine{Op: types.DiffDelete, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, types.DiffLine{Op: types.DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, types.DiffLine{Op: types.DiffDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, types.DiffLine{Op: types.DiffInsert, Text: b[j]})
+	}
+	return lines
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+func baseName(path string) string {
+	if path == "" {
+		return ""
+	}
+	return filepath.Base(path)
+}
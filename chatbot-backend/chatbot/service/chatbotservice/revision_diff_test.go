@@ -0,0 +1,86 @@
+package chatbotservice
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		expected []types.DiffLine
+	}{
+		{
+			name:     "both empty",
+			before:   "",
+			after:    "",
+			expected: []types.DiffLine{},
+		},
+		{
+			name:   "unchanged",
+			before: "be polite\nbe brief",
+			after:  "be polite\nbe brief",
+			expected: []types.DiffLine{
+				{Op: types.DiffEqual, Text: "be polite"},
+				{Op: types.DiffEqual, Text: "be brief"},
+			},
+		},
+		{
+			name:   "line changed",
+			before: "be polite\nbe brief\nuse markdown",
+			after:  "be polite\nbe detailed\nuse markdown",
+			expected: []types.DiffLine{
+				{Op: types.DiffEqual, Text: "be polite"},
+				{Op: types.DiffDelete, Text: "be brief"},
+				{Op: types.DiffInsert, Text: "be detailed"},
+				{Op: types.DiffEqual, Text: "use markdown"},
+			},
+		},
+		{
+			name:   "field cleared",
+			before: "be polite",
+			after:  "",
+			expected: []types.DiffLine{
+				{Op: types.DiffDelete, Text: "be polite"},
+			},
+		},
+		{
+			name:   "line appended",
+			before: "be polite",
+			after:  "be polite\nanswer in english",
+			expected: []types.DiffLine{
+				{Op: types.DiffEqual, Text: "be polite"},
+				{Op: types.DiffInsert, Text: "answer in english"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := diffLines(test.before, test.after)
+			if !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, lines)
+			}
+		})
+	}
+}
+
+func TestDiffRevisionsMarksChangedFields(t *testing.T) {
+	from := &types.ChatbotRevision{Chatbotid: 1, Revision: 1, Chatbotname: "bot", Behaviour: "be polite", Filepath: "uploads/user/bot/a.pdf"}
+	to := &types.ChatbotRevision{Chatbotid: 1, Revision: 2, Chatbotname: "bot", Behaviour: "be rude", Filepath: "uploads/user/bot/a.pdf"}
+
+	diff := diffRevisions(from, to)
+	if diff.From != 1 || diff.To != 2 {
+		t.Errorf("expected diff from 1 to 2, got %d to %d", diff.From, diff.To)
+	}
+	for _, field := range diff.Fields {
+		expectChanged := field.Field == "behaviour"
+		if field.Changed != expectChanged {
+			t.Errorf("expected field %s changed to be %t", field.Field, expectChanged)
+		}
+	}
+}
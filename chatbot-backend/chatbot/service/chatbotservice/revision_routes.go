@@ -0,0 +1,196 @@
+package chatbotservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+func (h *Handler) GetChatbotRevisions(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.revisionStore.GetRevisionsByChatbotID(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot revisions", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for index := range revisions {
+		revisions[index].Filepath = baseName(revisions[index].Filepath)
+	}
+	utils.WriteJSON(w, http.StatusOK, revisions)
+}
+
+func (h *Handler) GetChatbotRevision(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	revision, ok := h.getRevisionFromValue(r.Context(), w, chatbot.Chatbotid, r.PathValue("revision"))
+	if !ok {
+		return
+	}
+
+	revision.Filepath = baseName(revision.Filepath)
+	utils.WriteJSON(w, http.StatusOK, revision)
+}
+
+// DiffChatbotRevisions compares the revisions given by the from and to query parameters,
+// to defaults to the latest revision
+func (h *Handler) DiffChatbotRevisions(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	fromRevision, ok := h.getRevisionFromValue(r.Context(), w, chatbot.Chatbotid, r.URL.Query().Get("from"))
+	if !ok {
+		return
+	}
+
+	var toRevision *types.ChatbotRevision
+	if toValue := r.URL.Query().Get("to"); toValue != "" {
+		toRevision, ok = h.getRevisionFromValue(r.Context(), w, chatbot.Chatbotid, toValue)
+		if !ok {
+			return
+		}
+	} else {
+		latest, err := h.revisionStore.GetLatestRevision(r.Context(), chatbot.Chatbotid)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting latest chatbot revision", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		toRevision = latest
+	}
+
+	utils.WriteJSON(w, http.StatusOK, diffRevisions(fromRevision, toRevision))
+}
+
+// RollbackChatbotRevision restores the configuration of a previous revision, which is recorded as a new revision.
+// The chatbot keeps its current name and gets back the copy of the knowledge file kept for the revision
+func (h *Handler) RollbackChatbotRevision(w http.ResponseWriter, r *http.Request) {
+	chatbot, username, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	revision, ok := h.getRevisionFromValue(r.Context(), w, chatbot.Chatbotid, r.PathValue("revision"))
+	if !ok {
+		return
+	}
+
+	// the current file is overwritten when the revision's file has the same name, revisions still using it get a copy
+	err := h.preserveRevisionFile(r.Context(), chatbot.Filepath)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error keeping current file for revisions", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to keep current file"))
+		return
+	}
+	if revision.Filepath == chatbot.Filepath {
+		revision.Filepath, err = snapshotRevisionFile(revision.Filepath)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error copying current file for revision", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to keep current file"))
+			return
+		}
+	}
+
+	restoredFilepath := chatbot.Filepath
+	restoredFileDate := chatbot.FileUpdatedDate
+	fileRestored := true
+	if revision.Filepath == "" {
+		restoredFilepath = ""
+		restoredFileDate = ""
+	} else if copiedFilepath, err := copyFileToDir(revision.Filepath, chatbotFilesDir(chatbot.Username, chatbot.Chatbotname)); err == nil {
+		restoredFilepath = copiedFilepath
+		restoredFileDate, _ = utils.GetCurrentTime()
+	} else {
+		// revisions recorded before files were copied may use a file that was removed since
+		slog.InfoContext(r.Context(), "File of revision no longer exists, keeping current file", "path", revision.Filepath, "revision", revision.Revision, "error", err)
+		fileRestored = false
+	}
+	revisionFilepath, err := snapshotRevisionFile(restoredFilepath)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error copying file for revision", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to restore file"))
+		return
+	}
+
+	updateChatbot := types.UpdateChatbot{
+		Chatbotid:       chatbot.Chatbotid,
+		Username:        chatbot.Username,
+		Chatbotname:     chatbot.Chatbotname,
+		Description:     revision.Description,
+		Behaviour:       revision.Behaviour,
+		Usercontext:     revision.Usercontext,
+		IsShared:        chatbot.IsShared,
+		File:            restoredFilepath,
+		FileUpdatedDate: restoredFileDate,
+		Workspaceid:     chatbot.Workspaceid,
+		Sharemode:       chatbot.Sharemode,
+		Sharetoken:      chatbot.Sharetoken,
+		Sharepassword:   chatbot.Sharepassword,
+	}
+	newRevision, err := h.chatbotStore.UpdateChatbot(r.Context(), updateChatbot, types.NewChatbotRevision{
+		Chatbotname:     chatbot.Chatbotname,
+		Description:     revision.Description,
+		Behaviour:       revision.Behaviour,
+		Usercontext:     revision.Usercontext,
+		Filepath:        revisionFilepath,
+		FileUpdatedDate: restoredFileDate,
+		Author:          username,
+		Message:         fmt.Sprintf("Rolled back to revision %d", revision.Revision),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error rolling back chatbot", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// the revisions using the file the chatbot had were given their own copy above
+	if chatbot.Filepath != "" && chatbot.Filepath != restoredFilepath {
+		removeChatbotFile(chatbot.Filepath)
+	}
+	h.notifyChatbotUpdated(r.Context(), updateChatbot, username)
+
+	response := map[string]interface{}{
+		"message":      fmt.Sprintf("Chatbot rolled back to revision %d", revision.Revision),
+		"fileRestored": fileRestored,
+		"revision":     newRevision.Revision,
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// getRevisionFromValue parses the revision number and loads it. The error response is already written when ok is false
+func (h *Handler) getRevisionFromValue(ctx context.Context, w http.ResponseWriter, chatbotID int, value string) (*types.ChatbotRevision, bool) {
+	revisionNumber, err := strconv.Atoi(value)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid revision"))
+		return nil, false
+	}
+
+	revision, err := h.revisionStore.GetRevision(ctx, chatbotID, revisionNumber)
+	if err != nil {
+		if errors.Is(err, ErrRevisionNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+		} else {
+			slog.ErrorContext(ctx, "Error getting chatbot revision", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return nil, false
+	}
+	return revision, true
+}
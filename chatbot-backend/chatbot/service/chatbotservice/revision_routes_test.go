@@ -0,0 +1,148 @@
+package chatbotservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func TestRollbackRestoresReplacedFile(t *testing.T) {
+	dbConnection := newTestDB(t)
+	previousFilesPath := config.Envs.FILES_PATH
+	config.Envs.FILES_PATH = t.TempDir() + "/"
+	t.Cleanup(func() { config.Envs.FILES_PATH = previousFilesPath })
+
+	handler := &Handler{chatbotStore: NewStore(dbConnection), revisionStore: NewRevisionStore(dbConnection)}
+	ctx := context.WithValue(context.Background(), auth.UsernameKey, "owner")
+
+	firstContent := "%PDF-1.4 first"
+	livePath, err := saveChatbotFile("owner", "bot", "notes.pdf", strings.NewReader(firstContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatbotID, err := handler.createChatbot(ctx, types.NewChatbot{
+		Username: "owner", Chatbotname: "bot", Behaviour: "first", File: livePath, Sharemode: types.ShareModePrivate,
+	}, "owner", "Created chatbot")
+	if err != nil {
+		t.Fatalf("error creating chatbot: %v", err)
+	}
+
+	// uploading a file with the same name replaces the chatbot's file
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("chatbotname", "bot")
+	form.WriteField("behaviour", "second")
+	part, _ := form.CreateFormFile("file", "notes.pdf")
+	part.Write([]byte("%PDF-1.4 second"))
+	form.Close()
+	request := httptest.NewRequest(http.MethodPut, "/", body).WithContext(ctx)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	request.SetPathValue("chatbotid", strconv.Itoa(chatbotID))
+	recorder := httptest.NewRecorder()
+	handler.UpdateChatbot(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d updating chatbot, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+	request.SetPathValue("chatbotid", strconv.Itoa(chatbotID))
+	request.SetPathValue("revision", "1")
+	recorder = httptest.NewRecorder()
+	handler.RollbackChatbotRevision(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d rolling back, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var response map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response["fileRestored"] != true {
+		t.Errorf("expected the file to be restored, got %v", response)
+	}
+
+	content, err := os.ReadFile(livePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != firstContent {
+		t.Errorf("expected the file of revision 1 %q, got %q", firstContent, content)
+	}
+
+	// both versions of the file are kept for the revisions
+	revisions, err := handler.revisionStore.GetRevisionsByChatbotID(ctx, chatbotID)
+	if err != nil || len(revisions) != 3 {
+		t.Fatalf("expected 3 revisions, got %d (%v)", len(revisions), err)
+	}
+	for _, revision := range revisions {
+		if _, err := os.Stat(revision.Filepath); err != nil {
+			t.Errorf("expected the file of revision %d to be kept: %v", revision.Revision, err)
+		}
+	}
+}
+
+func TestRollbackRemovesFileNoLongerUsed(t *testing.T) {
+	dbConnection := newTestDB(t)
+	previousFilesPath := config.Envs.FILES_PATH
+	config.Envs.FILES_PATH = t.TempDir() + "/"
+	t.Cleanup(func() { config.Envs.FILES_PATH = previousFilesPath })
+
+	handler := &Handler{chatbotStore: NewStore(dbConnection), revisionStore: NewRevisionStore(dbConnection)}
+	ctx := context.WithValue(context.Background(), auth.UsernameKey, "owner")
+
+	chatbotID, err := handler.createChatbot(ctx, types.NewChatbot{
+		Username: "owner", Chatbotname: "bot", Behaviour: "first", Sharemode: types.ShareModePrivate,
+	}, "owner", "Created chatbot")
+	if err != nil {
+		t.Fatalf("error creating chatbot: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("chatbotname", "bot")
+	form.WriteField("behaviour", "second")
+	part, _ := form.CreateFormFile("file", "notes.pdf")
+	part.Write([]byte("%PDF-1.4 second"))
+	form.Close()
+	request := httptest.NewRequest(http.MethodPut, "/", body).WithContext(ctx)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	request.SetPathValue("chatbotid", strconv.Itoa(chatbotID))
+	recorder := httptest.NewRecorder()
+	handler.UpdateChatbot(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d updating chatbot, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	chatbot, err := handler.chatbotStore.GetChatbotsByID(ctx, chatbotID)
+	if err != nil || chatbot.Filepath == "" {
+		t.Fatalf("expected the chatbot to have a file, got %v (%v)", chatbot, err)
+	}
+
+	// revision 1 had no file
+	request = httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+	request.SetPathValue("chatbotid", strconv.Itoa(chatbotID))
+	request.SetPathValue("revision", "1")
+	recorder = httptest.NewRecorder()
+	handler.RollbackChatbotRevision(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d rolling back, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	if _, err := os.Stat(chatbot.Filepath); !os.IsNotExist(err) {
+		t.Errorf("expected the file the chatbot no longer uses to be removed, got %v", err)
+	}
+	revision, err := handler.revisionStore.GetRevision(ctx, chatbotID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(revision.Filepath); err != nil {
+		t.Errorf("expected the file of revision 2 to be kept: %v", err)
+	}
+}
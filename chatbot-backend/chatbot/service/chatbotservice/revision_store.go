@@ -0,0 +1,215 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+type RevisionStore struct {
+	db *sql.DB
+}
+
+func NewRevisionStore(db *sql.DB) types.ChatbotRevisionStoreInterface {
+	return &RevisionStore{db: db}
+}
+
+func (s *RevisionStore) GetRevisionsByChatbotID(ctx context.Context, chatbotID int) ([]types.ChatbotRevision, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RevisionStore.GetRevisionsByChatbotID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbot_revisions WHERE chatbotid=? ORDER BY revision DESC", chatbotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []types.ChatbotRevision{}
+	for rows.Next() {
+		revision, err := scanRowsIntoRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	return revisions, nil
+}
+
+func (s *RevisionStore) GetRevision(ctx context.Context, chatbotID int, revision int) (*types.ChatbotRevision, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RevisionStore.GetRevision")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbot_revisions WHERE chatbotid=? AND revision=?", chatbotID, revision)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, ErrRevisionNotFound
+	}
+	return scanRowsIntoRevision(rows)
+}
+
+func (s *RevisionStore) GetLatestRevision(ctx context.Context, chatbotID int) (*types.ChatbotRevision, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RevisionStore.GetLatestRevision")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbot_revisions WHERE chatbotid=? ORDER BY revision DESC LIMIT 1", chatbotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, ErrRevisionNotFound
+	}
+	return scanRowsIntoRevision(rows)
+}
+
+// CreateRevision stores the configuration as the next revision number of the chatbot
+func (s *RevisionStore) CreateRevision(ctx context.Context, revisionPayload types.NewChatbotRevision) (*types.ChatbotRevision, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RevisionStore.CreateRevision")
+	defer endQuery()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	revision, err := insertRevision(ctx, tx, revisionPayload)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// recordRevision stores the configuration as a new revision within tx if it differs from the latest revision,
+// which is returned otherwise. It is written with the chatbot row so a configuration change always has its revision
+func recordRevision(ctx context.Context, tx *sql.Tx, revisionPayload types.NewChatbotRevision) (*types.ChatbotRevision, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM chatbot_revisions WHERE chatbotid=? ORDER BY revision DESC LIMIT 1", revisionPayload.Chatbotid)
+	if err != nil {
+		return nil, err
+	}
+	var latest *types.ChatbotRevision
+	if rows.Next() {
+		latest, err = scanRowsIntoRevision(rows)
+	}
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if latest != nil &&
+		latest.Chatbotname == revisionPayload.Chatbotname &&
+		latest.Description == revisionPayload.Description &&
+		latest.Behaviour == revisionPayload.Behaviour &&
+		latest.Usercontext == revisionPayload.Usercontext &&
+		latest.Filepath == revisionPayload.Filepath &&
+		latest.FileUpdatedDate == revisionPayload.FileUpdatedDate {
+		return latest, nil
+	}
+	return insertRevision(ctx, tx, revisionPayload)
+}
+
+// insertRevision stores the configuration as the next revision number of the chatbot within tx
+func insertRevision(ctx context.Context, tx *sql.Tx, revisionPayload types.NewChatbotRevision) (*types.ChatbotRevision, error) {
+	currentTime, _ := utils.GetCurrentTime()
+
+	var nextRevision int
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(revision), 0) + 1 FROM chatbot_revisions WHERE chatbotid=?", revisionPayload.Chatbotid).Scan(&nextRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO chatbot_revisions (chatbotid, revision, chatbotname, description, behaviour, usercontext, filepath, fileUpdatedDate, author, message, createddate) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		revisionPayload.Chatbotid,
+		nextRevision,
+		revisionPayload.Chatbotname,
+		revisionPayload.Description,
+		revisionPayload.Behaviour,
+		revisionPayload.Usercontext,
+		revisionPayload.Filepath,
+		revisionPayload.FileUpdatedDate,
+		revisionPayload.Author,
+		revisionPayload.Message,
+		currentTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.ChatbotRevision{
+		Revisionid:      int(id),
+		Chatbotid:       revisionPayload.Chatbotid,
+		Revision:        nextRevision,
+		Chatbotname:     revisionPayload.Chatbotname,
+		Description:     revisionPayload.Description,
+		Behaviour:       revisionPayload.Behaviour,
+		Usercontext:     revisionPayload.Usercontext,
+		Filepath:        revisionPayload.Filepath,
+		FileUpdatedDate: revisionPayload.FileUpdatedDate,
+		Author:          revisionPayload.Author,
+		Message:         revisionPayload.Message,
+		Createddate:     currentTime,
+	}, nil
+}
+
+func (s *RevisionStore) DeleteRevisionsByChatbotID(ctx context.Context, chatbotID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "RevisionStore.DeleteRevisionsByChatbotID")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM chatbot_revisions WHERE chatbotid=?", chatbotID)
+	return err
+}
+
+// IsFileReferenced reports whether any revision of any chatbot uses the knowledge file at path
+func (s *RevisionStore) IsFileReferenced(ctx context.Context, path string) (bool, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "RevisionStore.IsFileReferenced")
+	defer endQuery()
+	var referenced bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM chatbot_revisions WHERE filepath=?)", path).Scan(&referenced)
+	return referenced, err
+}
+
+// ReplaceFilepath points the revisions using the knowledge file at oldPath to newPath
+func (s *RevisionStore) ReplaceFilepath(ctx context.Context, oldPath string, newPath string) error {
+	ctx, endQuery := db.TrackQuery(ctx, "RevisionStore.ReplaceFilepath")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "UPDATE chatbot_revisions SET filepath=? WHERE filepath=?", newPath, oldPath)
+	return err
+}
+
+func scanRowsIntoRevision(rows *sql.Rows) (*types.ChatbotRevision, error) {
+	revision := new(types.ChatbotRevision)
+
+	err := rows.Scan(
+		&revision.Revisionid,
+		&revision.Chatbotid,
+		&revision.Revision,
+		&revision.Chatbotname,
+		&revision.Description,
+		&revision.Behaviour,
+		&revision.Usercontext,
+		&revision.Filepath,
+		&revision.FileUpdatedDate,
+		&revision.Author,
+		&revision.Message,
+		&revision.Createddate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
@@ -0,0 +1,142 @@
+package chatbotservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+	maxSearchQueryLength  = 200
+	searchDateLayout      = "2006-01-02"
+)
+
+// SearchConversations finds the messages containing the words of the q query parameter in conversations with
+// the chatbots the user can view. The results can be narrowed to one chatbot, a role and the days from and to
+func (h *Handler) SearchConversations(w http.ResponseWriter, r *http.Request) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return
+	}
+
+	filter, chatbotID, err := parseSearchFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	chatbots, err := h.getUserChatbots(r.Context(), username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbots of user", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, chatbot := range chatbots {
+		filter.Chatbotids = append(filter.Chatbotids, chatbot.Chatbotid)
+	}
+	if chatbotID != 0 {
+		logging.AddFields(r.Context(), "chatbotid", chatbotID)
+		if !slices.Contains(filter.Chatbotids, chatbotID) {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+			return
+		}
+		filter.Chatbotids = []int{chatbotID}
+	}
+
+	results, err := h.searchStore.SearchConversations(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, ErrSearchUnavailable) {
+			utils.WriteError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Error searching conversations", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"limit":   filter.Limit,
+		"offset":  filter.Offset,
+	})
+}
+
+// parseSearchFilter reads the search query parameters, returning the chatbot to search separately
+// as the user's access to it is still to be checked. Dates are whole days in the server's timezone
+func parseSearchFilter(query url.Values) (filter types.ConversationSearchFilter, chatbotID int, err error) {
+	filter = types.ConversationSearchFilter{Query: strings.TrimSpace(query.Get("q")), Limit: defaultSearchPageSize}
+	if filter.Query == "" {
+		return filter, 0, fmt.Errorf("missing search query")
+	}
+	if len(filter.Query) > maxSearchQueryLength {
+		return filter, 0, fmt.Errorf("search query must be at most %d characters", maxSearchQueryLength)
+	}
+
+	if value := query.Get("chatbotid"); value != "" {
+		chatbotID, err = strconv.Atoi(value)
+		if err != nil || chatbotID < 1 {
+			return filter, 0, fmt.Errorf("invalid chatbot ID")
+		}
+	}
+	switch role := query.Get("role"); role {
+	case "", "user", "model":
+		filter.Role = role
+	default:
+		return filter, 0, fmt.Errorf("invalid role %s", role)
+	}
+
+	location, err := time.LoadLocation(config.Envs.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := time.ParseInLocation(searchDateLayout, value, location)
+		if err != nil {
+			return filter, 0, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+		filter.From = from.Unix()
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.ParseInLocation(searchDateLayout, value, location)
+		if err != nil {
+			return filter, 0, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+		// the whole of the last day is included
+		filter.To = to.AddDate(0, 0, 1).Unix()
+	}
+	if filter.From != 0 && filter.To != 0 && filter.From >= filter.To {
+		return filter, 0, fmt.Errorf("from date must not be after to date")
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSearchPageSize {
+			return filter, 0, fmt.Errorf("limit must be between 1 and %d", maxSearchPageSize)
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, 0, fmt.Errorf("invalid offset")
+		}
+		filter.Offset = offset
+	}
+	return filter, chatbotID, nil
+}
@@ -0,0 +1,64 @@
+package chatbotservice
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseSearchFilter(t *testing.T) {
+	query, _ := url.ParseQuery("q=+refund+policy+&chatbotid=3&role=user&from=2026-10-01&to=2026-10-01&limit=5&offset=10")
+	filter, chatbotID, err := parseSearchFilter(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Query != "refund policy" || chatbotID != 3 || filter.Role != "user" || filter.Limit != 5 || filter.Offset != 10 {
+		t.Errorf("unexpected filter %+v for chatbot %d", filter, chatbotID)
+	}
+	if filter.To-filter.From != int64((24 * time.Hour).Seconds()) {
+		t.Errorf("expected the range to cover the whole day, got %d to %d", filter.From, filter.To)
+	}
+
+	for _, invalid := range []string{"", "q=+", "q=refund&role=system", "q=refund&chatbotid=abc", "q=refund&from=01/10/2026", "q=refund&from=2026-10-02&to=2026-10-01", "q=refund&limit=0"} {
+		query, _ := url.ParseQuery(invalid)
+		if _, _, err := parseSearchFilter(query); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	if match := matchQuery(`refund  "policy" OR NEAR(`); match != `"refund" """policy""" "OR" "NEAR("` {
+		t.Errorf("expected every word to be quoted, got %s", match)
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := "…asked for a " + snippetMatchStart + "refund" + snippetMatchEnd + " <b>twice</b>"
+	if highlighted := highlightSnippet(snippet); highlighted != "…asked for a <mark>refund</mark> &lt;b&gt;twice&lt;/b&gt;" {
+		t.Errorf("unexpected snippet %s", highlighted)
+	}
+}
+
+func TestSentBetween(t *testing.T) {
+	created := "01 Oct 26 10:00 +0800"
+	sent := time.Date(2026, 10, 1, 10, 0, 0, 0, time.FixedZone("", 8*60*60)).Unix()
+	tests := []struct {
+		from, to int64
+		expected bool
+	}{
+		{expected: true},
+		{from: sent, expected: true},
+		{from: sent + 1, expected: false},
+		{to: sent + 1, expected: true},
+		{to: sent, expected: false},
+	}
+	for _, tt := range tests {
+		if sentBetween(created, tt.from, tt.to) != tt.expected {
+			t.Errorf("from %d to %d: expected %v", tt.from, tt.to, tt.expected)
+		}
+	}
+	if sentBetween("not a date", 0, sent) {
+		t.Error("expected messages without a valid date to be left out of date ranges")
+	}
+}
@@ -0,0 +1,145 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+var ErrSearchUnavailable = errors.New("conversation search is not available")
+
+// snippet() wraps the matched words in these, they are replaced with <mark> tags once the snippet is escaped
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+	snippetTokens     = 16
+)
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+func NewSearchStore(db *sql.DB) types.ConversationSearchStoreInterface {
+	return &SearchStore{db: db}
+}
+
+// SearchConversations returns the messages containing every word of the query, newest first
+func (s *SearchStore) SearchConversations(ctx context.Context, filter types.ConversationSearchFilter) ([]types.ConversationSearchResult, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "SearchStore.SearchConversations")
+	defer endQuery()
+
+	results := []types.ConversationSearchResult{}
+	match := matchQuery(filter.Query)
+	if match == "" || len(filter.Chatbotids) == 0 {
+		return results, nil
+	}
+
+	conditions := []string{"conversations_fts MATCH ?"}
+	args := []interface{}{snippetMatchStart, snippetMatchEnd, snippetTokens, match}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Chatbotids)), ", ")
+	conditions = append(conditions, "c.chatbotid IN ("+placeholders+")")
+	for _, chatbotID := range filter.Chatbotids {
+		args = append(args, chatbotID)
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "c.role=?")
+		args = append(args, filter.Role)
+	}
+
+	// createddate does not sort as text, so the date range is checked while reading the rows
+	// and the page is cut from the messages in range
+	dateFiltered := filter.From != 0 || filter.To != 0
+	query := `SELECT c.chatid, c.conversationid, c.chatbotid, c.chatbotname, c.role, c.branch, c.sequence,
+		snippet(conversations_fts, 0, ?, ?, '…', ?), c.createddate
+		FROM conversations_fts
+		JOIN conversations AS c ON c.chatid = conversations_fts.rowid
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY c.chatid DESC`
+	if !dateFiltered {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table: conversations_fts") {
+			return nil, ErrSearchUnavailable
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	skipped := 0
+	for rows.Next() {
+		result := types.ConversationSearchResult{}
+		err := rows.Scan(
+			&result.Chatid,
+			&result.Conversationid,
+			&result.Chatbotid,
+			&result.Chatbotname,
+			&result.Role,
+			&result.Branch,
+			&result.Sequence,
+			&result.Snippet,
+			&result.Createddate,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if dateFiltered {
+			if !sentBetween(result.Createddate, filter.From, filter.To) {
+				continue
+			}
+			if skipped < filter.Offset {
+				skipped++
+				continue
+			}
+		}
+		result.Snippet = highlightSnippet(result.Snippet)
+		results = append(results, result)
+		if dateFiltered && len(results) == filter.Limit {
+			break
+		}
+	}
+	return results, rows.Err()
+}
+
+// matchQuery turns what the user typed into an FTS5 query for messages containing all the words, quoting
+// each word so characters with a meaning in the query syntax are searched for as text
+func matchQuery(query string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// highlightSnippet escapes the snippet for HTML and marks the matched words
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, snippetMatchStart, "<mark>")
+	return strings.ReplaceAll(escaped, snippetMatchEnd, "</mark>")
+}
+
+// sentBetween reports whether a message created at createddate falls in the range from and to,
+// unix times where zero leaves that end open
+func sentBetween(createddate string, from int64, to int64) bool {
+	created, err := time.Parse(time.RFC822Z, createddate)
+	if err != nil {
+		return false
+	}
+	if from != 0 && created.Unix() < from {
+		return false
+	}
+	if to != 0 && created.Unix() >= to {
+		return false
+	}
+	return true
+}
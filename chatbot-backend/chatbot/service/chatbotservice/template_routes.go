@@ -0,0 +1,309 @@
+package chatbotservice
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+// built-in templates are shipped with the binary
+//
+//go:embed templates/*.json
+var builtinTemplateFiles embed.FS
+
+var builtinTemplates = mustLoadBuiltinTemplates()
+
+func (h *Handler) GetChatbotTemplates(w http.ResponseWriter, r *http.Request) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return
+	}
+
+	userTemplates, err := h.templateStore.GetTemplatesByUsername(r.Context(), username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot templates", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for index := range userTemplates {
+		userTemplates[index].Filepath = baseName(userTemplates[index].Filepath)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.ChatbotTemplateList{
+		BuiltIn: builtinTemplates,
+		User:    userTemplates,
+	})
+}
+
+// SaveChatbotTemplate saves the configuration and knowledge file of a chatbot as a template of the user
+func (h *Handler) SaveChatbotTemplate(w http.ResponseWriter, r *http.Request) {
+	chatbot, username, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	newTemplate := types.NewChatbotTemplate{
+		Username:    username,
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: chatbot.Description,
+		Behaviour:   chatbot.Behaviour,
+		Usercontext: chatbot.Usercontext,
+	}
+	if err := utils.Validate.Struct(newTemplate); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	existingTemplates, err := h.templateStore.GetTemplatesByUsername(r.Context(), username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot templates", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, existing := range existingTemplates {
+		if existing.Name == newTemplate.Name {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf("template name already in use"))
+			return
+		}
+	}
+
+	// the template keeps its own copy so it still works after the chatbot changes its file
+	var templateDir string
+	if chatbot.Filepath != "" {
+		dirName, err := utils.GenerateSecureToken(8)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error generating template directory name", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to save template"))
+			return
+		}
+		templateDir = templateFilesDir(username, dirName)
+		newTemplate.Filepath, err = copyFileToDir(chatbot.Filepath, templateDir)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error copying file for template", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to copy chatbot file"))
+			return
+		}
+	}
+
+	templateID, err := h.templateStore.CreateTemplate(r.Context(), newTemplate)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating chatbot template", "error", err)
+		if templateDir != "" {
+			os.RemoveAll(templateDir)
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"templateid": templateID,
+	})
+}
+
+func (h *Handler) DeleteChatbotTemplate(w http.ResponseWriter, r *http.Request) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return
+	}
+
+	templateID, err := strconv.Atoi(r.PathValue("templateid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid template ID"))
+		return
+	}
+
+	template, err := h.templateStore.GetTemplateByID(r.Context(), templateID)
+	if err != nil || template.Username != username {
+		if err != nil && !errors.Is(err, ErrTemplateNotFound) {
+			slog.ErrorContext(r.Context(), "Error getting chatbot template", "error", err)
+		}
+		utils.WriteError(w, http.StatusNotFound, ErrTemplateNotFound)
+		return
+	}
+
+	if err := h.templateStore.DeleteTemplate(r.Context(), templateID); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting chatbot template", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if template.Filepath != "" {
+		if err := os.RemoveAll(filepath.Dir(template.Filepath)); err != nil {
+			slog.ErrorContext(r.Context(), "Error removing template directory", "error", err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Template deleted successfully",
+	})
+}
+
+// CloneChatbot copies the configuration and knowledge file of a chatbot into a new private chatbot of the user.
+// Without a chatbotname the copy is named after the original, adding a numbered suffix when needed
+func (h *Handler) CloneChatbot(w http.ResponseWriter, r *http.Request) {
+	chatbot, username, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	workspaceID, ok := h.getWorkspaceIDFromForm(w, r, username)
+	if !ok {
+		return
+	}
+
+	chatbotname := strings.TrimSpace(r.FormValue("chatbotname"))
+	onConflict := nameConflictFail
+	if chatbotname == "" {
+		chatbotname = chatbot.Chatbotname + "-copy"
+		onConflict = nameConflictRename
+	}
+
+	var filename string
+	var fileUpdatedDate string
+	if chatbot.Filepath != "" {
+		filename = baseName(chatbot.Filepath)
+		fileUpdatedDate, _ = utils.GetCurrentTime()
+	}
+
+	// sharing settings are not copied, the clone starts as private
+	newChatbot := types.NewChatbot{
+		Username:        username,
+		Chatbotname:     chatbotname,
+		Description:     chatbot.Description,
+		Behaviour:       chatbot.Behaviour,
+		IsShared:        false,
+		Usercontext:     chatbot.Usercontext,
+		FileUpdatedDate: fileUpdatedDate,
+		Workspaceid:     workspaceID,
+		Sharemode:       types.ShareModePrivate,
+	}
+	if err := validateNewChatbot(newChatbot, filename); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var content []byte
+	if chatbot.Filepath != "" {
+		var err error
+		content, err = os.ReadFile(chatbot.Filepath)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error reading file for clone", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to copy chatbot file"))
+			return
+		}
+	}
+
+	createdTime, _ := utils.GetCurrentTime()
+	newChatbot, botID, err := h.createChatbotWithAvailableName(r.Context(), newChatbot, filename, content, onConflict, fmt.Sprintf("Cloned from %s", chatbot.Chatbotname))
+	if err != nil {
+		if errors.Is(err, ErrChatbotNameTaken) {
+			utils.WriteError(w, http.StatusConflict, err)
+		} else {
+			slog.ErrorContext(r.Context(), "Error cloning chatbot", "error", err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to clone chatbot"))
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"chatbotid":   botID,
+		"chatbotname": newChatbot.Chatbotname,
+		"createddate": createdTime,
+		"updateddate": createdTime,
+	})
+}
+
+// getTemplateFromForm loads the template a new chatbot starts from, given by the template form field as either
+// the key of a built-in template or the ID of a template of the user. The template is nil when none is given,
+// and the error response is already written when ok is false
+func (h *Handler) getTemplateFromForm(w http.ResponseWriter, r *http.Request, username string) (template *types.ChatbotTemplate, ok bool) {
+	templateValue := strings.TrimSpace(r.FormValue("template"))
+	if templateValue == "" {
+		return nil, true
+	}
+
+	templateID, err := strconv.Atoi(templateValue)
+	if err != nil {
+		for index := range builtinTemplates {
+			if builtinTemplates[index].Key == templateValue {
+				return &builtinTemplates[index], true
+			}
+		}
+		utils.WriteError(w, http.StatusBadRequest, ErrTemplateNotFound)
+		return nil, false
+	}
+
+	template, err = h.templateStore.GetTemplateByID(r.Context(), templateID)
+	if err != nil || template.Username != username {
+		if err != nil && !errors.Is(err, ErrTemplateNotFound) {
+			slog.ErrorContext(r.Context(), "Error getting chatbot template", "error", err)
+		}
+		utils.WriteError(w, http.StatusBadRequest, ErrTemplateNotFound)
+		return nil, false
+	}
+	return template, true
+}
+
+// templateFilesDir is the directory holding the knowledge file of a user saved template.
+// Chatbot names cannot contain dots, so it never clashes with the directory of a chatbot
+func templateFilesDir(username string, dirName string) string {
+	return config.Envs.FILES_PATH + username + "/.templates/" + dirName
+}
+
+func mustLoadBuiltinTemplates() []types.ChatbotTemplate {
+	templates, err := loadBuiltinTemplates()
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in chatbot templates: %v", err))
+	}
+	return templates
+}
+
+func loadBuiltinTemplates() ([]types.ChatbotTemplate, error) {
+	entries, err := builtinTemplateFiles.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []types.ChatbotTemplate{}
+	for _, entry := range entries {
+		content, err := builtinTemplateFiles.ReadFile("templates/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		var template types.ChatbotTemplate
+		if err := json.Unmarshal(content, &template); err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		if template.Key == "" || template.Name == "" {
+			return nil, fmt.Errorf("%s: key and name are required", entry.Name())
+		}
+		template.BuiltIn = true
+		templates = append(templates, template)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
@@ -0,0 +1,31 @@
+package chatbotservice
+
+import "testing"
+
+func TestLoadBuiltinTemplates(t *testing.T) {
+	templates, err := loadBuiltinTemplates()
+	if err != nil {
+		t.Fatalf("error loading built-in templates: %v", err)
+	}
+
+	keys := map[string]bool{}
+	for _, template := range templates {
+		if keys[template.Key] {
+			t.Errorf("duplicate template key %q", template.Key)
+		}
+		keys[template.Key] = true
+
+		if !template.BuiltIn || template.Templateid != 0 || template.Filepath != "" {
+			t.Errorf("template %q should be built-in without a file, got %+v", template.Key, template)
+		}
+		if template.Behaviour == "" {
+			t.Errorf("template %q has no behaviour", template.Key)
+		}
+	}
+
+	for _, key := range []string{"faq", "tutor", "support"} {
+		if !keys[key] {
+			t.Errorf("expected built-in template %q", key)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+type TemplateStore struct {
+	db *sql.DB
+}
+
+func NewTemplateStore(db *sql.DB) types.ChatbotTemplateStoreInterface {
+	return &TemplateStore{db: db}
+}
+
+func (s *TemplateStore) GetTemplatesByUsername(ctx context.Context, username string) ([]types.ChatbotTemplate, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "TemplateStore.GetTemplatesByUsername")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbot_templates WHERE username=? ORDER BY name", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []types.ChatbotTemplate{}
+	for rows.Next() {
+		template, err := scanRowsIntoTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+
+	return templates, nil
+}
+
+func (s *TemplateStore) GetTemplateByID(ctx context.Context, templateID int) (*types.ChatbotTemplate, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "TemplateStore.GetTemplateByID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbot_templates WHERE templateid=?", templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, ErrTemplateNotFound
+	}
+	return scanRowsIntoTemplate(rows)
+}
+
+func (s *TemplateStore) CreateTemplate(ctx context.Context, templatePayload types.NewChatbotTemplate) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "TemplateStore.CreateTemplate")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO chatbot_templates (username, name, description, behaviour, usercontext, filepath, createddate) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		templatePayload.Username,
+		templatePayload.Name,
+		templatePayload.Description,
+		templatePayload.Behaviour,
+		templatePayload.Usercontext,
+		templatePayload.Filepath,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *TemplateStore) DeleteTemplate(ctx context.Context, templateID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "TemplateStore.DeleteTemplate")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM chatbot_templates WHERE templateid=?", templateID)
+	return err
+}
+
+func scanRowsIntoTemplate(rows *sql.Rows) (*types.ChatbotTemplate, error) {
+	template := new(types.ChatbotTemplate)
+
+	err := rows.Scan(
+		&template.Templateid,
+		&template.Username,
+		&template.Name,
+		&template.Description,
+		&template.Behaviour,
+		&template.Usercontext,
+		&template.Filepath,
+		&template.Createddate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
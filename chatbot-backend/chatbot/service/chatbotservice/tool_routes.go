@@ -0,0 +1,130 @@
+package chatbotservice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/tools"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrToolNotFound = errors.New("tool not found")
+
+// GetChatbotTools returns the tools of the chatbot and the built-in tools that can be added to it
+func (h *Handler) GetChatbotTools(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	chatbotTools, err := h.toolStore.GetToolsByChatbotID(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot tools", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"tools":    chatbotTools,
+		"builtins": tools.Builtins(),
+	})
+}
+
+func (h *Handler) CreateChatbotTool(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	var payload types.CreateChatbotToolPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	tool := types.NewChatbotTool{
+		Chatbotid:   chatbot.Chatbotid,
+		Name:        strings.TrimSpace(payload.Name),
+		Description: strings.TrimSpace(payload.Description),
+		Kind:        payload.Kind,
+		Url:         strings.TrimSpace(payload.Url),
+		Parameters:  payload.Parameters,
+	}
+	if tool.Kind == types.ToolKindBuiltin {
+		// built-ins bring their own arguments and are run by the server
+		tool.Url = ""
+		tool.Parameters = ""
+	}
+	if err := tools.Validate(tool); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, err := h.toolStore.GetToolsByChatbotID(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot tools", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(existing) >= tools.MaxToolsPerChatbot {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("a chatbot can have at most %d tools", tools.MaxToolsPerChatbot))
+		return
+	}
+	for _, other := range existing {
+		if other.Name == tool.Name {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf("the chatbot already has a tool named %s", tool.Name))
+			return
+		}
+	}
+
+	toolID, err := h.toolStore.CreateTool(r.Context(), tool)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating chatbot tool", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Created chatbot tool", "toolid", toolID, "kind", tool.Kind)
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Tool created successfully",
+		"toolid":  toolID,
+	})
+}
+
+func (h *Handler) DeleteChatbotTool(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	toolID, err := strconv.Atoi(r.PathValue("toolid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid tool ID"))
+		return
+	}
+
+	if err := h.toolStore.DeleteTool(r.Context(), chatbot.Chatbotid, toolID); err != nil {
+		if errors.Is(err, ErrToolNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Error deleting chatbot tool", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Tool deleted successfully",
+	})
+}
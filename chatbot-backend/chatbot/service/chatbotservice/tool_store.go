@@ -0,0 +1,110 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+type ToolStore struct {
+	db *sql.DB
+}
+
+func NewToolStore(db *sql.DB) types.ChatbotToolStoreInterface {
+	return &ToolStore{db: db}
+}
+
+func (s *ToolStore) GetToolsByChatbotID(ctx context.Context, chatbotID int) ([]types.ChatbotTool, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ToolStore.GetToolsByChatbotID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbot_tools WHERE chatbotid=? ORDER BY name", chatbotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tools := []types.ChatbotTool{}
+	for rows.Next() {
+		tool, err := scanRowsIntoTool(rows)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, *tool)
+	}
+
+	return tools, nil
+}
+
+func (s *ToolStore) CreateTool(ctx context.Context, toolPayload types.NewChatbotTool) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ToolStore.CreateTool")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO chatbot_tools (chatbotid, name, description, kind, url, parameters, createddate) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		toolPayload.Chatbotid,
+		toolPayload.Name,
+		toolPayload.Description,
+		toolPayload.Kind,
+		toolPayload.Url,
+		toolPayload.Parameters,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// DeleteTool deletes the tool if it belongs to the chatbot, returning ErrToolNotFound otherwise
+func (s *ToolStore) DeleteTool(ctx context.Context, chatbotID int, toolID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ToolStore.DeleteTool")
+	defer endQuery()
+	res, err := s.db.ExecContext(ctx, "DELETE FROM chatbot_tools WHERE toolid=? AND chatbotid=?", toolID, chatbotID)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrToolNotFound
+	}
+	return nil
+}
+
+func (s *ToolStore) DeleteToolsByChatbotID(ctx context.Context, chatbotID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ToolStore.DeleteToolsByChatbotID")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM chatbot_tools WHERE chatbotid=?", chatbotID)
+	return err
+}
+
+func scanRowsIntoTool(rows *sql.Rows) (*types.ChatbotTool, error) {
+	tool := new(types.ChatbotTool)
+
+	err := rows.Scan(
+		&tool.Toolid,
+		&tool.Chatbotid,
+		&tool.Name,
+		&tool.Description,
+		&tool.Kind,
+		&tool.Url,
+		&tool.Parameters,
+		&tool.Createddate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return tool, nil
+}
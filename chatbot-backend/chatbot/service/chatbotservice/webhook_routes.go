@@ -0,0 +1,218 @@
+package chatbotservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/webhooks"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+const (
+	maxWebhooksPerChatbot  = 10
+	webhookDeliveryLogSize = 50
+)
+
+// GetChatbotWebhooks returns the webhooks of the chatbot, without their secrets
+func (h *Handler) GetChatbotWebhooks(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	chatbotWebhooks, err := h.webhookStore.GetWebhooksByChatbotID(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot webhooks", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i := range chatbotWebhooks {
+		chatbotWebhooks[i].Secret = ""
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"webhooks": chatbotWebhooks,
+	})
+}
+
+// CreateChatbotWebhook subscribes a url to events of the chatbot. The secret deliveries are signed with
+// is only returned here
+func (h *Handler) CreateChatbotWebhook(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	var payload types.CreateChatbotWebhookPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+	webhookURL := strings.TrimSpace(payload.Url)
+	if err := webhooks.CheckURL(webhookURL); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	events := []string{}
+	for _, event := range payload.Events {
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+
+	existing, err := h.webhookStore.GetWebhooksByChatbotID(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot webhooks", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(existing) >= maxWebhooksPerChatbot {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("a chatbot can have at most %d webhooks", maxWebhooksPerChatbot))
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating webhook secret", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	webhookID, err := h.webhookStore.CreateWebhook(r.Context(), types.NewChatbotWebhook{
+		Chatbotid: chatbot.Chatbotid,
+		Url:       webhookURL,
+		Events:    events,
+		Secret:    secret,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating chatbot webhook", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Created chatbot webhook", "webhookid", webhookID, "events", events)
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":   "Webhook created successfully",
+		"webhookid": webhookID,
+		"secret":    secret,
+	})
+}
+
+func (h *Handler) DeleteChatbotWebhook(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	webhookID, err := strconv.Atoi(r.PathValue("webhookid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid webhook ID"))
+		return
+	}
+
+	if err := h.webhookStore.DeleteWebhook(r.Context(), chatbot.Chatbotid, webhookID); err != nil {
+		if errors.Is(err, ErrWebhookNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Error deleting chatbot webhook", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// GetWebhookDeliveries returns the latest deliveries of the webhook with their outcome
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+	webhook, ok := h.getWebhookForRequest(w, r, chatbot.Chatbotid)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.webhookStore.GetDeliveriesByWebhookID(r.Context(), webhook.Webhookid, webhookDeliveryLogSize)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting webhook deliveries", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"deliveries": deliveries,
+	})
+}
+
+// TestChatbotWebhook sends a ping to the webhook right away and returns how it went
+func (h *Handler) TestChatbotWebhook(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+	webhook, ok := h.getWebhookForRequest(w, r, chatbot.Chatbotid)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhooks.Test(r.Context(), *webhook)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error sending test webhook", "webhookid", webhook.Webhookid, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"delivery": delivery,
+	})
+}
+
+// getWebhookForRequest loads the webhook in the path if it belongs to the chatbot. The error response is already
+// written when ok is false
+func (h *Handler) getWebhookForRequest(w http.ResponseWriter, r *http.Request, chatbotID int) (*types.ChatbotWebhook, bool) {
+	webhookID, err := strconv.Atoi(r.PathValue("webhookid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid webhook ID"))
+		return nil, false
+	}
+
+	webhook, err := h.webhookStore.GetWebhookByID(r.Context(), chatbotID, webhookID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot webhook", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if webhook == nil {
+		utils.WriteError(w, http.StatusNotFound, ErrWebhookNotFound)
+		return nil, false
+	}
+	return webhook, true
+}
+
+// notifyChatbotUpdated sends the chatbot.updated event to the chatbot's webhooks
+func (h *Handler) notifyChatbotUpdated(ctx context.Context, chatbot types.UpdateChatbot, editor string) {
+	h.webhooks.Notify(ctx, chatbot.Chatbotid, types.WebhookEventChatbotUpdated, map[string]interface{}{
+		"chatbotname": chatbot.Chatbotname,
+		"description": chatbot.Description,
+		"sharemode":   chatbot.Sharemode,
+		"updatedby":   editor,
+	})
+}
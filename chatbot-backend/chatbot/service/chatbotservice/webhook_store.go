@@ -0,0 +1,252 @@
+package chatbotservice
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+type WebhookStore struct {
+	db *sql.DB
+}
+
+func NewWebhookStore(db *sql.DB) types.ChatbotWebhookStoreInterface {
+	return &WebhookStore{db: db}
+}
+
+func (s *WebhookStore) GetWebhooksByChatbotID(ctx context.Context, chatbotID int) ([]types.ChatbotWebhook, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.GetWebhooksByChatbotID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbot_webhooks WHERE chatbotid=? ORDER BY webhookid", chatbotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []types.ChatbotWebhook{}
+	for rows.Next() {
+		webhook, err := scanRowsIntoWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhookByID returns the webhook if it belongs to the chatbot, or nil if it does not
+func (s *WebhookStore) GetWebhookByID(ctx context.Context, chatbotID int, webhookID int) (*types.ChatbotWebhook, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.GetWebhookByID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM chatbot_webhooks WHERE webhookid=? AND chatbotid=?", webhookID, chatbotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return scanRowsIntoWebhook(rows)
+}
+
+func (s *WebhookStore) CreateWebhook(ctx context.Context, webhookPayload types.NewChatbotWebhook) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.CreateWebhook")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO chatbot_webhooks (chatbotid, url, events, secret, createddate) VALUES (?, ?, ?, ?, ?)",
+		webhookPayload.Chatbotid,
+		webhookPayload.Url,
+		strings.Join(webhookPayload.Events, ","),
+		webhookPayload.Secret,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// DeleteWebhook deletes the webhook and its deliveries if it belongs to the chatbot, returning ErrWebhookNotFound otherwise
+func (s *WebhookStore) DeleteWebhook(ctx context.Context, chatbotID int, webhookID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.DeleteWebhook")
+	defer endQuery()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM chatbot_webhooks WHERE webhookid=? AND chatbotid=?", webhookID, chatbotID)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrWebhookNotFound
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhookid=?", webhookID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *WebhookStore) DeleteWebhooksByChatbotID(ctx context.Context, chatbotID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.DeleteWebhooksByChatbotID")
+	defer endQuery()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE chatbotid=?", chatbotID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chatbot_webhooks WHERE chatbotid=?", chatbotID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateDelivery saves a delivery, pending deliveries are attempted once their next attempt is due
+func (s *WebhookStore) CreateDelivery(ctx context.Context, delivery types.WebhookDelivery) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.CreateDelivery")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO webhook_deliveries (webhookid, chatbotid, event, payload, status, nextattempt, createddate, updateddate) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		delivery.Webhookid,
+		delivery.Chatbotid,
+		delivery.Event,
+		delivery.Payload,
+		delivery.Status,
+		delivery.Nextattempt,
+		currentTime,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetDueDeliveries returns the pending deliveries whose next attempt is at or before now, oldest first
+func (s *WebhookStore) GetDueDeliveries(ctx context.Context, now int64, limit int) ([]types.WebhookDelivery, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.GetDueDeliveries")
+	defer endQuery()
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT * FROM webhook_deliveries WHERE status=? AND nextattempt<=? ORDER BY nextattempt, deliveryid LIMIT ?",
+		types.WebhookDeliveryPending,
+		now,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+// GetDeliveriesByWebhookID returns the latest deliveries of the webhook, newest first
+func (s *WebhookStore) GetDeliveriesByWebhookID(ctx context.Context, webhookID int, limit int) ([]types.WebhookDelivery, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.GetDeliveriesByWebhookID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM webhook_deliveries WHERE webhookid=? ORDER BY deliveryid DESC LIMIT ?", webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+// UpdateDelivery saves the outcome of an attempt
+func (s *WebhookStore) UpdateDelivery(ctx context.Context, delivery types.WebhookDelivery) error {
+	ctx, endQuery := db.TrackQuery(ctx, "WebhookStore.UpdateDelivery")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		"UPDATE webhook_deliveries SET status=?, attempts=?, responsestatus=?, error=?, nextattempt=?, updateddate=? WHERE deliveryid=?",
+		delivery.Status,
+		delivery.Attempts,
+		delivery.Responsestatus,
+		delivery.Error,
+		delivery.Nextattempt,
+		currentTime,
+		delivery.Deliveryid,
+	)
+	return err
+}
+
+func scanRowsIntoWebhook(rows *sql.Rows) (*types.ChatbotWebhook, error) {
+	webhook := new(types.ChatbotWebhook)
+
+	var events string
+	err := rows.Scan(
+		&webhook.Webhookid,
+		&webhook.Chatbotid,
+		&webhook.Url,
+		&events,
+		&webhook.Secret,
+		&webhook.Createddate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Events = strings.Split(events, ",")
+	return webhook, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]types.WebhookDelivery, error) {
+	deliveries := []types.WebhookDelivery{}
+	for rows.Next() {
+		delivery := types.WebhookDelivery{}
+		err := rows.Scan(
+			&delivery.Deliveryid,
+			&delivery.Webhookid,
+			&delivery.Chatbotid,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.Responsestatus,
+			&delivery.Error,
+			&delivery.Nextattempt,
+			&delivery.Createddate,
+			&delivery.Updateddate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,79 @@
+package chatbotservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/validate"
+	"github.com/go-playground/validator/v10"
+)
+
+// GetChatbotWidgetSettings returns the sites allowed to embed the chat widget and how it looks on them
+func (h *Handler) GetChatbotWidgetSettings(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	settings := types.ChatbotWidgetSettings{Allowedorigins: []string{}}
+	if chatbot.Allowedorigins != "" {
+		settings.Allowedorigins = strings.Split(chatbot.Allowedorigins, ",")
+	}
+	if chatbot.Widgettheme != "" {
+		if err := json.Unmarshal([]byte(chatbot.Widgettheme), &settings.Theme); err != nil {
+			slog.WarnContext(r.Context(), "Invalid widget theme of chatbot", "error", err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, settings)
+}
+
+// UpdateChatbotWidgetSettings replaces the allowed origins and theme of the chat widget. Origins are saved
+// as scheme://host[:port] so they can be compared with the Origin header of browsers
+func (h *Handler) UpdateChatbotWidgetSettings(w http.ResponseWriter, r *http.Request) {
+	chatbot, _, ok := h.getChatbotForRequest(w, r, types.WorkspaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	var payload types.ChatbotWidgetSettings
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	origins := []string{}
+	for _, origin := range payload.Allowedorigins {
+		normalized, err := validate.NormalizeOrigin(strings.TrimSpace(origin))
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid origin %s: %v", origin, err))
+			return
+		}
+		if !slices.Contains(origins, normalized) {
+			origins = append(origins, normalized)
+		}
+	}
+	payload.Allowedorigins = origins
+
+	if err := h.chatbotStore.UpdateChatbotWidgetSettings(r.Context(), chatbot.Chatbotid, payload); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating chatbot widget settings", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message":        "Chatbot widget settings updated successfully",
+		"allowedOrigins": origins,
+	})
+}
@@ -0,0 +1,114 @@
+package conversation
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/service/workspace"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+const (
+	shareTokenHeader    = "X-Share-Token"
+	sharePasswordHeader = "X-Share-Password"
+	shareTokenQuery     = "token"
+)
+
+// chatbotAccess describes how a request was allowed to chat with a chatbot
+type chatbotAccess struct {
+	// preview is set when the user manages the chatbot and is not going through its sharing mode
+	preview bool
+	// shareToken is issued when the password of a password protected chatbot was checked,
+	// to be sent in the share token header of the requests after it instead of the password
+	shareToken string
+}
+
+// checkChatbotAccess checks that the request is allowed to chat with the chatbot according to its sharing mode.
+// Logged in users who can view the chatbot as its owner or a workspace member can always preview it.
+// Password protected chatbots need the share token issued by unlockChatbotAccess.
+// The returned status code and error are meant to be written back to the client when access is denied
+func (h *Handler) checkChatbotAccess(r *http.Request, chatbot *types.Chatbot) (chatbotAccess, int, error) {
+	return h.chatbotAccess(r, chatbot, false)
+}
+
+// unlockChatbotAccess is checkChatbotAccess for starting a conversation, the only request password protected chatbots
+// take the password on. Checking it against its hash is slow on purpose, so a share token is issued for the rest
+func (h *Handler) unlockChatbotAccess(r *http.Request, chatbot *types.Chatbot) (chatbotAccess, int, error) {
+	return h.chatbotAccess(r, chatbot, true)
+}
+
+func (h *Handler) chatbotAccess(r *http.Request, chatbot *types.Chatbot, acceptPassword bool) (chatbotAccess, int, error) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username != "" {
+		canPreview, err := workspace.CanAccessChatbot(r.Context(), h.workspaceStore, username, chatbot, types.WorkspaceRoleViewer)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error checking preview access to chatbot", "error", err)
+			return chatbotAccess{}, http.StatusInternalServerError, fmt.Errorf("unable to check access to chatbot")
+		}
+		if canPreview {
+			return chatbotAccess{preview: true}, 0, nil
+		}
+	}
+
+	switch chatbot.Sharemode {
+	case types.ShareModePublic:
+		return chatbotAccess{}, 0, nil
+
+	case types.ShareModeLink:
+		token := getShareToken(r)
+		if token == "" || chatbot.Sharetoken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(chatbot.Sharetoken)) != 1 {
+			return chatbotAccess{}, http.StatusForbidden, fmt.Errorf("invalid share link")
+		}
+		return chatbotAccess{}, 0, nil
+
+	case types.ShareModePassword:
+		secret := []byte(config.Envs.JWTSecret)
+		if token := getShareToken(r); token != "" && chatbot.Sharepassword != "" && auth.ValidShareToken(secret, token, chatbot.Chatbotid, chatbot.Sharepassword) {
+			return chatbotAccess{}, 0, nil
+		}
+		if !acceptPassword {
+			return chatbotAccess{}, http.StatusUnauthorized, fmt.Errorf("share token required, start the conversation with the password")
+		}
+		password := r.Header.Get(sharePasswordHeader)
+		if password == "" {
+			return chatbotAccess{}, http.StatusUnauthorized, fmt.Errorf("password required")
+		}
+		if chatbot.Sharepassword == "" || !auth.ComparePassword(chatbot.Sharepassword, []byte(password)) {
+			return chatbotAccess{}, http.StatusForbidden, fmt.Errorf("invalid password")
+		}
+		shareToken, err := auth.CreateShareToken(secret, chatbot.Chatbotid, chatbot.Sharepassword)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error creating share token", "error", err)
+			return chatbotAccess{}, http.StatusInternalServerError, fmt.Errorf("unable to check access to chatbot")
+		}
+		return chatbotAccess{shareToken: shareToken}, 0, nil
+
+	case types.ShareModeAllowlist:
+		if username == "" {
+			return chatbotAccess{}, http.StatusUnauthorized, fmt.Errorf("login required")
+		}
+		allowed, err := h.chatbotStore.IsUserAllowlisted(r.Context(), chatbot.Chatbotid, username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error checking allowlist of chatbot", "error", err)
+			return chatbotAccess{}, http.StatusInternalServerError, fmt.Errorf("unable to check access to chatbot")
+		}
+		if !allowed {
+			return chatbotAccess{}, http.StatusForbidden, fmt.Errorf("chatbot is not shared with you")
+		}
+		return chatbotAccess{}, 0, nil
+	}
+
+	return chatbotAccess{}, http.StatusForbidden, fmt.Errorf("chatbot is not shared")
+}
+
+// getShareToken reads the share token from its header, or from the query where headers cannot be set like on websockets
+func getShareToken(r *http.Request) string {
+	if token := r.Header.Get(shareTokenHeader); token != "" {
+		return token
+	}
+	return r.URL.Query().Get(shareTokenQuery)
+}
@@ -0,0 +1,153 @@
+package conversation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func TestCheckChatbotAccess(t *testing.T) {
+	passwordHash, err := auth.HashPassword("share-password")
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+
+	handler := &Handler{
+		chatbotStore:   &mockChatbotStore{allowlist: map[string]bool{"friend": true}},
+		workspaceStore: &mockWorkspaceStore{roles: map[string]string{"teammate": types.WorkspaceRoleViewer}},
+	}
+
+	tests := []struct {
+		name            string
+		sharemode       string
+		username        string
+		headers         map[string]string
+		query           string
+		unlock          bool
+		expectedStatus  int
+		expectedPreview bool
+	}{
+		{name: "public chatbot", sharemode: types.ShareModePublic, expectedStatus: 0},
+		{name: "private chatbot", sharemode: types.ShareModePrivate, expectedStatus: http.StatusForbidden},
+		{name: "owner previews private chatbot", sharemode: types.ShareModePrivate, username: "owner", expectedStatus: 0, expectedPreview: true},
+		{name: "workspace member previews private chatbot", sharemode: types.ShareModePrivate, username: "teammate", expectedStatus: 0, expectedPreview: true},
+		{name: "link with token header", sharemode: types.ShareModeLink, headers: map[string]string{shareTokenHeader: "secret-token"}, expectedStatus: 0},
+		{name: "link with token query", sharemode: types.ShareModeLink, query: "?token=secret-token", expectedStatus: 0},
+		{name: "link with wrong token", sharemode: types.ShareModeLink, query: "?token=wrong", expectedStatus: http.StatusForbidden},
+		{name: "link without token", sharemode: types.ShareModeLink, expectedStatus: http.StatusForbidden},
+		{name: "password correct", sharemode: types.ShareModePassword, headers: map[string]string{sharePasswordHeader: "share-password"}, unlock: true, expectedStatus: 0},
+		{name: "password wrong", sharemode: types.ShareModePassword, headers: map[string]string{sharePasswordHeader: "not-the-password"}, unlock: true, expectedStatus: http.StatusForbidden},
+		{name: "password missing", sharemode: types.ShareModePassword, unlock: true, expectedStatus: http.StatusUnauthorized},
+		{name: "password only taken when starting", sharemode: types.ShareModePassword, headers: map[string]string{sharePasswordHeader: "share-password"}, expectedStatus: http.StatusUnauthorized},
+		{name: "password with wrong share token", sharemode: types.ShareModePassword, headers: map[string]string{shareTokenHeader: "secret-token"}, expectedStatus: http.StatusUnauthorized},
+		{name: "allowlisted user", sharemode: types.ShareModeAllowlist, username: "friend", expectedStatus: 0},
+		{name: "user not on allowlist", sharemode: types.ShareModeAllowlist, username: "stranger", expectedStatus: http.StatusForbidden},
+		{name: "allowlist needs login", sharemode: types.ShareModeAllowlist, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chatbot := &types.Chatbot{
+				Chatbotid:     1,
+				Username:      "owner",
+				Chatbotname:   "bot",
+				Workspaceid:   3,
+				Sharemode:     test.sharemode,
+				Sharetoken:    "secret-token",
+				Sharepassword: passwordHash,
+			}
+
+			request, err := http.NewRequest(http.MethodGet, "/start/owner/bot"+test.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+			if test.username != "" {
+				request = request.WithContext(context.WithValue(request.Context(), auth.UsernameKey, test.username))
+			}
+
+			check := handler.checkChatbotAccess
+			if test.unlock {
+				check = handler.unlockChatbotAccess
+			}
+			access, status, err := check(request, chatbot)
+			if status != test.expectedStatus {
+				t.Errorf("expected status %d, got %d (%v)", test.expectedStatus, status, err)
+			}
+			if (err == nil) != (test.expectedStatus == 0) {
+				t.Errorf("unexpected error result: %v", err)
+			}
+			if access.preview != test.expectedPreview {
+				t.Errorf("expected preview %t, got %t", test.expectedPreview, access.preview)
+			}
+		})
+	}
+}
+
+// the share token issued for the password lets the visitor chat without sending the password again
+func TestPasswordShareToken(t *testing.T) {
+	passwordHash, err := auth.HashPassword("share-password")
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+	handler := &Handler{}
+	chatbot := &types.Chatbot{Chatbotid: 1, Username: "owner", Chatbotname: "bot", Sharemode: types.ShareModePassword, Sharepassword: passwordHash}
+
+	request := httptest.NewRequest(http.MethodGet, "/start/owner/bot", nil)
+	request.Header.Set(sharePasswordHeader, "share-password")
+	access, _, err := handler.unlockChatbotAccess(request, chatbot)
+	if err != nil || access.shareToken == "" {
+		t.Fatalf("expected a share token for the correct password, got %q (%v)", access.shareToken, err)
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/chat/owner/bot", nil)
+	request.Header.Set(shareTokenHeader, access.shareToken)
+	if _, status, err := handler.checkChatbotAccess(request, chatbot); err != nil {
+		t.Errorf("expected the share token to give access, got %d (%v)", status, err)
+	}
+
+	// changing the password ends the access given for the old one
+	chatbot.Sharepassword, _ = auth.HashPassword("new-password")
+	if _, status, _ := handler.checkChatbotAccess(request, chatbot); status != http.StatusUnauthorized {
+		t.Errorf("expected status %d after the password changed, got %d", http.StatusUnauthorized, status)
+	}
+}
+
+type mockChatbotStore struct {
+	types.ChatbotStoreInterface
+	allowlist map[string]bool
+	chatbot   *types.Chatbot
+}
+
+func (m *mockChatbotStore) GetChatbotByName(ctx context.Context, username string, chatbotName string) (*types.Chatbot, error) {
+	if m.chatbot == nil {
+		return nil, ErrChatbotNotFound
+	}
+	return m.chatbot, nil
+}
+
+func (m *mockChatbotStore) GetChatbotsByID(ctx context.Context, chatbotID int) (*types.Chatbot, error) {
+	if m.chatbot == nil || m.chatbot.Chatbotid != chatbotID {
+		return nil, ErrChatbotNotFound
+	}
+	return m.chatbot, nil
+}
+
+func (m *mockChatbotStore) IsUserAllowlisted(ctx context.Context, chatbotID int, username string) (bool, error) {
+	return m.allowlist[username], nil
+}
+
+type mockWorkspaceStore struct {
+	types.WorkspaceStoreInterface
+	roles map[string]string
+}
+
+func (m *mockWorkspaceStore) GetMemberRole(ctx context.Context, workspaceID int, username string) (string, error) {
+	return m.roles[username], nil
+}
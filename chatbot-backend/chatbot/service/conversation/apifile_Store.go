@@ -1,8 +1,10 @@
 package conversation
 
 import (
+	"context"
 	"database/sql"
 
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
 )
 
@@ -14,8 +16,10 @@ func NewAPIFileStore(db *sql.DB) types.APIFileStoreInterface {
 	return &APIFileStore{db: db}
 }
 
-func (s *APIFileStore) GetAPIFileByFilepath(filepath string) (*types.APIFile, error) {
-	rows, err := s.db.Query("SELECT * FROM apifiles WHERE filepath=?", filepath)
+func (s *APIFileStore) GetAPIFileByFilepath(ctx context.Context, filepath string) (*types.APIFile, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "APIFileStore.GetAPIFileByFilepath")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM apifiles WHERE filepath=?", filepath)
 	if err != nil {
 		return nil, err
 	}
@@ -29,8 +33,10 @@ func (s *APIFileStore) GetAPIFileByFilepath(filepath string) (*types.APIFile, er
 	return theFile, nil
 }
 
-func (s *APIFileStore) GetAPIFileByID(apiFileID int) (*types.APIFile, error) {
-	row := s.db.QueryRow("SELECT * FROM apifiles WHERE fileid=?", apiFileID)
+func (s *APIFileStore) GetAPIFileByID(ctx context.Context, apiFileID int) (*types.APIFile, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "APIFileStore.GetAPIFileByID")
+	defer endQuery()
+	row := s.db.QueryRowContext(ctx, "SELECT * FROM apifiles WHERE fileid=?", apiFileID)
 	apiFile, err := scanRowIntoAPIFile(row)
 	if err != nil {
 		return nil, err
@@ -38,8 +44,10 @@ func (s *APIFileStore) GetAPIFileByID(apiFileID int) (*types.APIFile, error) {
 	return apiFile, nil
 }
 
-func (s *APIFileStore) GetAPIFilesByUserID(userID int) ([]types.APIFile, error) {
-	rows, err := s.db.Query("SELECT * FROM apifiles WHERE userid=? ORDER BY fileid", userID)
+func (s *APIFileStore) GetAPIFilesByUserID(ctx context.Context, userID int) ([]types.APIFile, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "APIFileStore.GetAPIFilesByUserID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM apifiles WHERE userid=? ORDER BY fileid", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -57,8 +65,11 @@ func (s *APIFileStore) GetAPIFilesByUserID(userID int) ([]types.APIFile, error)
 	return apiFiles, nil
 }
 
-func (s *APIFileStore) CreateAPIFile(apiFilePayload types.NewAPIFile) (int, error) {
-	res, dberr := s.db.Exec(
+func (s *APIFileStore) CreateAPIFile(ctx context.Context, apiFilePayload types.NewAPIFile) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "APIFileStore.CreateAPIFile")
+	defer endQuery()
+	res, dberr := s.db.ExecContext(
+		ctx,
 		"INSERT INTO apifiles (chatbotid, createddate, filepath, fileuri) VALUES (?, ?, ?, ?)",
 		apiFilePayload.Chatbotid,
 		apiFilePayload.Createddate,
@@ -77,8 +88,11 @@ func (s *APIFileStore) CreateAPIFile(apiFilePayload types.NewAPIFile) (int, erro
 	return int(id), nil
 }
 
-func (s *APIFileStore) UpdateAPIFile(apiFilePayload types.UpdateAPIFile) error {
-	_, dberr := s.db.Exec(
+func (s *APIFileStore) UpdateAPIFile(ctx context.Context, apiFilePayload types.UpdateAPIFile) error {
+	ctx, endQuery := db.TrackQuery(ctx, "APIFileStore.UpdateAPIFile")
+	defer endQuery()
+	_, dberr := s.db.ExecContext(
+		ctx,
 		"UPDATE apifiles SET chatbotid=?, createddate=?, filepath=?, fileuri=? WHERE fileid=?",
 		apiFilePayload.Chatbotid,
 		apiFilePayload.Createddate,
@@ -89,8 +103,10 @@ func (s *APIFileStore) UpdateAPIFile(apiFilePayload types.UpdateAPIFile) error {
 	return dberr
 }
 
-func (s *APIFileStore) DeleteAPIFile(apiFileID int) error {
-	_, dberr := s.db.Exec("DELETE FROM apifiles WHERE fileid=?", apiFileID)
+func (s *APIFileStore) DeleteAPIFile(ctx context.Context, apiFileID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "APIFileStore.DeleteAPIFile")
+	defer endQuery()
+	_, dberr := s.db.ExecContext(ctx, "DELETE FROM apifiles WHERE fileid=?", apiFileID)
 	return dberr
 }
 
@@ -0,0 +1,94 @@
+package conversation
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+type AttachmentStore struct {
+	db *sql.DB
+}
+
+func NewAttachmentStore(db *sql.DB) types.AttachmentStoreInterface {
+	return &AttachmentStore{db: db}
+}
+
+func (s *AttachmentStore) CreateAttachment(ctx context.Context, attachmentPayload types.NewAttachment) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "AttachmentStore.CreateAttachment")
+	defer endQuery()
+	res, dberr := s.db.ExecContext(
+		ctx,
+		"INSERT INTO attachments (conversationid, chatbotid, filename, filepath, mimetype, size, createddate) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		attachmentPayload.Conversationid,
+		attachmentPayload.Chatbotid,
+		attachmentPayload.Filename,
+		attachmentPayload.Filepath,
+		attachmentPayload.Mimetype,
+		attachmentPayload.Size,
+		attachmentPayload.Createddate,
+	)
+	if dberr != nil {
+		return 0, dberr
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// GetAttachmentsByConversationID returns the attachments of the saved messages of the conversation,
+// attachments of turns that were never saved are left out
+func (s *AttachmentStore) GetAttachmentsByConversationID(ctx context.Context, conversationID string) ([]types.Attachment, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "AttachmentStore.GetAttachmentsByConversationID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM attachments WHERE conversationid=? AND chatid != 0 ORDER BY attachmentid", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []types.Attachment{}
+	for rows.Next() {
+		attachment, err := scanRowsIntoAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	return attachments, nil
+}
+
+// DeleteUnsavedAttachment deletes the attachment if it was never linked to a saved message
+func (s *AttachmentStore) DeleteUnsavedAttachment(ctx context.Context, attachmentID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "AttachmentStore.DeleteUnsavedAttachment")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM attachments WHERE attachmentid=? AND chatid = 0", attachmentID)
+	return err
+}
+
+func scanRowsIntoAttachment(rows *sql.Rows) (*types.Attachment, error) {
+	attachment := new(types.Attachment)
+
+	err := rows.Scan(
+		&attachment.Attachmentid,
+		&attachment.Conversationid,
+		&attachment.Chatbotid,
+		&attachment.Chatid,
+		&attachment.Filename,
+		&attachment.Filepath,
+		&attachment.Mimetype,
+		&attachment.Size,
+		&attachment.Createddate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
@@ -0,0 +1,206 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	maxAttachments       = 4
+	maxAttachmentSize    = 10 << 20 // 10MB
+	attachmentsFormField = "attachments"
+)
+
+// Allowed file types for attachments and the extension they are saved with
+var allowedAttachmentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+}
+
+var errInvalidAttachmentType = fmt.Errorf("invalid attachment type. Only PDF, JPG, PNG or WEBP are allowed")
+
+// parseChatRequest reads the chat request from a JSON body, or from a multipart form
+// with the conversationid and message fields and up to maxAttachments files in the attachments field
+func parseChatRequest(w http.ResponseWriter, r *http.Request) (types.ChatRequest, []*multipart.FileHeader, error) {
+	var chatRequest types.ChatRequest
+	var files []*multipart.FileHeader
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		r.Body = http.MaxBytesReader(w, r.Body, maxAttachments*maxAttachmentSize+(1<<20))
+		if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB kept in memory
+			return chatRequest, nil, fmt.Errorf("invalid request body")
+		}
+		chatRequest.Conversationid = r.FormValue("conversationid")
+		chatRequest.Message = r.FormValue("message")
+		files = r.MultipartForm.File[attachmentsFormField]
+		if len(files) > maxAttachments {
+			return chatRequest, nil, fmt.Errorf("at most %d attachments can be sent with a message", maxAttachments)
+		}
+	} else if err := utils.ParseJSON(r, &chatRequest); err != nil {
+		return chatRequest, nil, fmt.Errorf("invalid request body")
+	}
+
+	if err := utils.Validate.Struct(chatRequest); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		return chatRequest, nil, fmt.Errorf("invalid payload %v", validate_error)
+	}
+	return chatRequest, files, nil
+}
+
+// saveAttachments checks the files sent with a message and stores them for the conversation.
+// They only become part of the conversation once the turn is saved with their ids.
+// The returned status is http.StatusBadRequest when a file is not accepted
+func (h *Handler) saveAttachments(ctx context.Context, chatbot *types.Chatbot, conversationID string, files []*multipart.FileHeader) ([]types.Attachment, int, error) {
+	mimetypes := make([]string, len(files))
+	for i, header := range files {
+		if header.Size > maxAttachmentSize {
+			return nil, http.StatusBadRequest, fmt.Errorf("attachment %s is larger than %dMB", header.Filename, maxAttachmentSize>>20)
+		}
+		mimetype, err := detectAttachmentType(header)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if _, ok := allowedAttachmentTypes[mimetype]; !ok {
+			return nil, http.StatusBadRequest, errInvalidAttachmentType
+		}
+		mimetypes[i] = mimetype
+	}
+
+	attachments := []types.Attachment{}
+	for i, header := range files {
+		path, err := saveAttachmentFile(chatbot.Chatbotid, allowedAttachmentTypes[mimetypes[i]], header)
+		if err != nil {
+			h.discardAttachments(ctx, attachments)
+			return nil, http.StatusInternalServerError, err
+		}
+
+		currentTime, _ := utils.GetCurrentTime()
+		attachment := types.NewAttachment{
+			Conversationid: conversationID,
+			Chatbotid:      chatbot.Chatbotid,
+			Filename:       filepath.Base(header.Filename),
+			Filepath:       path,
+			Mimetype:       mimetypes[i],
+			Size:           header.Size,
+			Createddate:    currentTime,
+		}
+		attachmentID, err := h.attachmentStore.CreateAttachment(ctx, attachment)
+		if err != nil {
+			os.Remove(path)
+			h.discardAttachments(ctx, attachments)
+			return nil, http.StatusInternalServerError, err
+		}
+		slog.InfoContext(ctx, "Saved attachment", "attachmentid", attachmentID, "mimetype", attachment.Mimetype, "size", attachment.Size)
+		attachments = append(attachments, types.Attachment{
+			Attachmentid:   attachmentID,
+			Conversationid: attachment.Conversationid,
+			Chatbotid:      attachment.Chatbotid,
+			Filename:       attachment.Filename,
+			Filepath:       attachment.Filepath,
+			Mimetype:       attachment.Mimetype,
+			Size:           attachment.Size,
+			Createddate:    attachment.Createddate,
+		})
+	}
+	return attachments, 0, nil
+}
+
+// discardAttachments deletes the attachments of a turn that was not saved along with their files
+func (h *Handler) discardAttachments(ctx context.Context, attachments []types.Attachment) {
+	for _, attachment := range attachments {
+		if err := h.attachmentStore.DeleteUnsavedAttachment(ctx, attachment.Attachmentid); err != nil {
+			slog.ErrorContext(ctx, "Error deleting attachment", "attachmentid", attachment.Attachmentid, "error", err)
+			continue
+		}
+		if err := os.Remove(attachment.Filepath); err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(ctx, "Error removing attachment file", "attachmentid", attachment.Attachmentid, "error", err)
+		}
+	}
+}
+
+// attachmentParts uploads the attachments to Gemini, reusing earlier uploads like the chatbot files,
+// and returns them as parts of a message
+func (h *Handler) attachmentParts(ctx context.Context, attachments []types.Attachment) ([]genai.Part, error) {
+	parts := []genai.Part{}
+	for _, attachment := range attachments {
+		fileURI, err := h.checkAndUploadToGemini(ctx, attachment.Filepath, attachment.Chatbotid, attachment.Createddate)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error uploading attachment", "attachmentid", attachment.Attachmentid, "error", err)
+			return nil, err
+		}
+		parts = append(parts, genai.FileData{URI: fileURI, MIMEType: attachment.Mimetype})
+	}
+	return parts, nil
+}
+
+// attachmentIDs returns the ids of the attachments to save with a turn
+func attachmentIDs(attachments []types.Attachment) []int {
+	ids := []int{}
+	for _, attachment := range attachments {
+		ids = append(ids, attachment.Attachmentid)
+	}
+	return ids
+}
+
+// detectAttachmentType reads the first 512 bytes of the file to detect its content type
+func detectAttachmentType(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 512)
+	n, err := file.Read(buffer)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(buffer[:n]), nil
+}
+
+// attachmentsDir is the directory holding the files visitors sent to the chatbot
+func attachmentsDir(chatbotID int) string {
+	return config.Envs.FILES_PATH + ".attachments/" + strconv.Itoa(chatbotID)
+}
+
+// saveAttachmentFile saves the file under a generated name, as the name sent by the visitor cannot be trusted
+func saveAttachmentFile(chatbotID int, extension string, header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	dir := attachmentsDir(chatbotID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("couldn't create directory: %v", err)
+	}
+	path := dir + "/" + utils.GenerateUUID().String() + extension
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0666)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create file: %v", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, file); err != nil {
+		return "", fmt.Errorf("couldn't write file: %v", err)
+	}
+	return path, nil
+}
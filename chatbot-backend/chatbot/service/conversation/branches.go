@@ -0,0 +1,274 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/retention"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/generative-ai-go/genai"
+)
+
+var ErrNothingToRegenerate = errors.New("the conversation has no response to regenerate")
+
+// RegenerateMessage answers the last user message of the conversation again. The new response starts a branch
+// after the user message and the old response is kept on the branch it was on
+func (h *Handler) RegenerateMessage(w http.ResponseWriter, r *http.Request) {
+	chatbot, ok := h.getChatbotForVisitor(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.RegenerateMessagePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+	logging.AddFields(r.Context(), "conversationid", payload.Conversationid)
+
+	conversations, branches, err := h.loadConversation(r.Context(), payload.Conversationid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting conversation", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	branch := activeBranch(branches)
+	messages := chatbotMessages(branchMessages(conversations, branches, branch), chatbot.Chatbotid)
+	last := len(messages) - 1
+	if last < 1 || messages[last].Role != "model" || messages[last-1].Role != "user" {
+		utils.WriteError(w, http.StatusBadRequest, ErrNothingToRegenerate)
+		return
+	}
+	question, answer := messages[last-1], messages[last]
+
+	attachments, err := h.attachmentStore.GetAttachmentsByConversationID(r.Context(), payload.Conversationid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting conversation attachments", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	questionAttachments := []types.Attachment{}
+	for _, attachment := range attachments {
+		if attachment.Chatid == question.Chatid {
+			questionAttachments = append(questionAttachments, attachment)
+		}
+	}
+	fileParts, err := h.attachmentParts(r.Context(), questionAttachments)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	parts := append([]genai.Part{genai.Text(question.Chat)}, fileParts...)
+
+	fork := types.ConversationBranch{
+		Conversationid: payload.Conversationid,
+		Branch:         nextBranch(branches),
+		Parentbranch:   branch,
+		Forksequence:   answer.Sequence,
+		Reason:         types.ConversationBranchRegenerate,
+	}
+	h.respondOnBranch(w, r, chatbot, fork, messages[:last-1], parts, types.ConversationTurn{
+		UserMessage: question.Chat,
+		Regenerated: true,
+	})
+}
+
+// EditMessage replaces a user message on the active branch of the conversation and answers the new message.
+// The edited message and its response start a branch at the position of the original message, which is kept
+// with everything after it on the branch it was on. Files sent with the original message are not resent
+func (h *Handler) EditMessage(w http.ResponseWriter, r *http.Request) {
+	chatbot, ok := h.getChatbotForVisitor(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.EditMessagePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+	logging.AddFields(r.Context(), "conversationid", payload.Conversationid, "chatid", payload.Chatid)
+
+	conversations, branches, err := h.loadConversation(r.Context(), payload.Conversationid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting conversation", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	branch := activeBranch(branches)
+	messages := chatbotMessages(branchMessages(conversations, branches, branch), chatbot.Chatbotid)
+	edited := slices.IndexFunc(messages, func(message types.Conversation) bool {
+		return message.Chatid == payload.Chatid && message.Role == "user"
+	})
+	if edited < 0 {
+		utils.WriteError(w, http.StatusNotFound, ErrMessageNotFound)
+		return
+	}
+
+	if !h.checkInput(w, r, chatbot, payload.Conversationid, payload.Message) {
+		return
+	}
+
+	fork := types.ConversationBranch{
+		Conversationid: payload.Conversationid,
+		Branch:         nextBranch(branches),
+		Parentbranch:   branch,
+		Forksequence:   messages[edited].Sequence,
+		Reason:         types.ConversationBranchEdit,
+	}
+	h.respondOnBranch(w, r, chatbot, fork, messages[:edited], []genai.Part{genai.Text(payload.Message)}, types.ConversationTurn{
+		UserMessage: payload.Message,
+	})
+}
+
+// respondOnBranch sends parts to the model with history as the conversation so far and saves the turn
+// as the first of the new branch fork
+func (h *Handler) respondOnBranch(w http.ResponseWriter, r *http.Request, chatbot *types.Chatbot, fork types.ConversationBranch, history []types.Conversation, parts []genai.Part, turn types.ConversationTurn) {
+	logging.AddFields(r.Context(), "branch", fork.Branch)
+	// the model call and background saves carry on if the client goes away, but keep the request logging fields
+	backgroundCtx := context.WithoutCancel(r.Context())
+	session, err := h.startChatSession(backgroundCtx, chatbot, fork.Conversationid, fork.Branch, history)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.updateLastused(backgroundCtx, chatbot)
+
+	currentTime, _ := utils.GetCurrentTime()
+	turn.Conversationid = fork.Conversationid
+	turn.Chatbotid = chatbot.Chatbotid
+	turn.Username = chatbot.Username
+	turn.Chatbotname = chatbot.Chatbotname
+	turn.Revisionid = h.currentRevisionID(r.Context(), chatbot.Chatbotid)
+	turn.Createddate = currentTime
+	turn.Branch = fork.Branch
+	turn.Fork = &fork
+	turn.Redactpii = retention.RedactsPII(chatbot)
+
+	slog.InfoContext(r.Context(), "Sending message to model on a new branch", "reason", fork.Reason, "forksequence", fork.Forksequence)
+	responseString, err := h.sendMessage(backgroundCtx, session, parts, &turn)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to get response from chatbot"))
+		return
+	}
+
+	turn.ModelResponse = responseString
+	if err := h.saveTurn(backgroundCtx, turn); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to save conversation"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.ChatResponse{Response: responseString, Branch: fork.Branch})
+}
+
+// loadConversation returns the messages of every branch of the conversation and its branches
+func (h *Handler) loadConversation(ctx context.Context, conversationID string) ([]types.Conversation, []types.ConversationBranch, error) {
+	conversations, err := h.conversationStore.GetConversationsByID(ctx, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	branches, err := h.conversationStore.GetConversationBranches(ctx, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conversations, branches, nil
+}
+
+// getBranchForRequest returns the chatbot's messages on the branch of the conversation selected with the branch
+// query parameter, the active branch by default, along with all the branches. The error response is already
+// written when ok is false
+func (h *Handler) getBranchForRequest(w http.ResponseWriter, r *http.Request, chatbot *types.Chatbot, conversationID string) (messages []types.Conversation, branch int, branches []types.ConversationBranch, ok bool) {
+	conversations, branches, err := h.loadConversation(r.Context(), conversationID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting conversation", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, 0, nil, false
+	}
+	branch = activeBranch(branches)
+	if value := r.URL.Query().Get("branch"); value != "" {
+		selected, err := strconv.Atoi(value)
+		if err != nil || selected < 0 || selected > branch {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid branch"))
+			return nil, 0, nil, false
+		}
+		branch = selected
+	}
+
+	return chatbotMessages(branchMessages(conversations, branches, branch), chatbot.Chatbotid), branch, branches, true
+}
+
+// chatbotMessages returns the messages exchanged with the chatbot, as conversation ids are chosen by the client
+func chatbotMessages(messages []types.Conversation, chatbotID int) []types.Conversation {
+	filtered := []types.Conversation{}
+	for _, message := range messages {
+		if message.Chatbotid == chatbotID {
+			filtered = append(filtered, message)
+		}
+	}
+	return filtered
+}
+
+// activeBranch returns the branch new messages of the conversation go to, the one created last
+func activeBranch(branches []types.ConversationBranch) int {
+	active := 0
+	for _, branch := range branches {
+		active = max(active, branch.Branch)
+	}
+	return active
+}
+
+func nextBranch(branches []types.ConversationBranch) int {
+	return activeBranch(branches) + 1
+}
+
+// branchMessages returns the messages on branch in order: its own messages and, going up through its parents,
+// the messages of each parent before the point the child was forked from it
+func branchMessages(conversations []types.Conversation, branches []types.ConversationBranch, branch int) []types.Conversation {
+	forks := map[int]types.ConversationBranch{}
+	for _, fork := range branches {
+		forks[fork.Branch] = fork
+	}
+
+	messages := []types.Conversation{}
+	before := -1 // the messages of the branch itself are all on it
+	visited := map[int]bool{}
+	for current := branch; !visited[current]; {
+		visited[current] = true
+		for _, conversation := range conversations {
+			if conversation.Branch == current && (before < 0 || conversation.Sequence < before) {
+				messages = append(messages, conversation)
+			}
+		}
+		fork, ok := forks[current]
+		if !ok {
+			break
+		}
+		if before < 0 || fork.Forksequence < before {
+			before = fork.Forksequence
+		}
+		current = fork.Parentbranch
+	}
+
+	slices.SortFunc(messages, func(a, b types.Conversation) int {
+		return a.Sequence - b.Sequence
+	})
+	return messages
+}
@@ -0,0 +1,114 @@
+package conversation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+// branchTestConversation is a conversation whose second response was regenerated as branch 1,
+// after which the second question was edited on branch 1 as branch 2
+func branchTestConversation() ([]types.Conversation, []types.ConversationBranch) {
+	conversations := []types.Conversation{
+		{Chatid: 1, Role: "user", Chat: "q1", Sequence: 1},
+		{Chatid: 2, Role: "model", Chat: "a1", Sequence: 2},
+		{Chatid: 3, Role: "user", Chat: "q2", Sequence: 3},
+		{Chatid: 4, Role: "model", Chat: "a2", Sequence: 4},
+		{Chatid: 5, Role: "model", Chat: "a2 again", Sequence: 4, Branch: 1},
+		{Chatid: 6, Role: "user", Chat: "q3", Sequence: 5, Branch: 1},
+		{Chatid: 7, Role: "model", Chat: "a3", Sequence: 6, Branch: 1},
+		{Chatid: 8, Role: "user", Chat: "q2 edited", Sequence: 3, Branch: 2},
+		{Chatid: 9, Role: "model", Chat: "a2 edited", Sequence: 4, Branch: 2},
+	}
+	branches := []types.ConversationBranch{
+		{Branch: 1, Parentbranch: 0, Forksequence: 4, Reason: types.ConversationBranchRegenerate},
+		{Branch: 2, Parentbranch: 1, Forksequence: 3, Reason: types.ConversationBranchEdit},
+	}
+	return conversations, branches
+}
+
+func TestBranchMessages(t *testing.T) {
+	conversations, branches := branchTestConversation()
+
+	tests := []struct {
+		branch  int
+		chatids []int
+	}{
+		{branch: 0, chatids: []int{1, 2, 3, 4}},
+		{branch: 1, chatids: []int{1, 2, 3, 5, 6, 7}},
+		{branch: 2, chatids: []int{1, 2, 8, 9}},
+	}
+	for _, tt := range tests {
+		messages := branchMessages(conversations, branches, tt.branch)
+		chatids := []int{}
+		for _, message := range messages {
+			chatids = append(chatids, message.Chatid)
+		}
+		if len(chatids) != len(tt.chatids) {
+			t.Errorf("branch %d: expected messages %v, got %v", tt.branch, tt.chatids, chatids)
+			continue
+		}
+		for i := range chatids {
+			if chatids[i] != tt.chatids[i] {
+				t.Errorf("branch %d: expected messages %v, got %v", tt.branch, tt.chatids, chatids)
+				break
+			}
+		}
+	}
+
+	if active := activeBranch(branches); active != 2 {
+		t.Errorf("expected the newest branch to be active, got %d", active)
+	}
+	if active := activeBranch(nil); active != 0 {
+		t.Errorf("expected a conversation without branches to be on branch 0, got %d", active)
+	}
+}
+
+func TestBranchRequestsRejectMessagesOffTheActiveBranch(t *testing.T) {
+	conversations, branches := branchTestConversation()
+	for i := range conversations {
+		conversations[i].Conversationid = "conv"
+		conversations[i].Chatbotid = 1
+	}
+	// the active branch ends with a question that was never answered
+	conversations = append(conversations, types.Conversation{Chatid: 10, Conversationid: "conv", Chatbotid: 1, Role: "user", Chat: "q3", Sequence: 5, Branch: 2})
+	// a conversation id a visitor used with another chatbot
+	conversations = append(conversations,
+		types.Conversation{Chatid: 11, Conversationid: "other", Chatbotid: 2, Role: "user", Chat: "secret question", Sequence: 1},
+		types.Conversation{Chatid: 12, Conversationid: "other", Chatbotid: 2, Role: "model", Chat: "secret answer", Sequence: 2},
+	)
+	handler := &Handler{
+		chatbotStore:      &mockChatbotStore{chatbot: &types.Chatbot{Chatbotid: 1, Username: "owner", Chatbotname: "bot", Sharemode: types.ShareModePublic}},
+		conversationStore: &mockConversationStore{messages: conversations, branches: branches},
+	}
+	router := http.NewServeMux()
+	router.HandleFunc("POST /chat/regenerate/{username}/{chatbotName}", handler.RegenerateMessage)
+	router.HandleFunc("POST /chat/edit/{username}/{chatbotName}", handler.EditMessage)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "regenerate without a response", path: "/chat/regenerate/owner/bot", body: `{"conversationid":"conv"}`, status: http.StatusBadRequest},
+		{name: "edit a message of an older branch", path: "/chat/edit/owner/bot", body: `{"conversationid":"conv","chatid":3,"message":"q2 again"}`, status: http.StatusNotFound},
+		{name: "edit a response", path: "/chat/edit/owner/bot", body: `{"conversationid":"conv","chatid":9,"message":"hi"}`, status: http.StatusNotFound},
+		{name: "edit without a message", path: "/chat/edit/owner/bot", body: `{"conversationid":"conv","chatid":8}`, status: http.StatusBadRequest},
+		{name: "regenerate another chatbot's response", path: "/chat/regenerate/owner/bot", body: `{"conversationid":"other"}`, status: http.StatusBadRequest},
+		{name: "edit another chatbot's message", path: "/chat/edit/owner/bot", body: `{"conversationid":"other","chatid":11,"message":"hi"}`, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -5,16 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/moderation"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/prompt"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/retention"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/tools"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/webhooks"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
-	"github.com/go-playground/validator/v10"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/tracing"
 
 	"github.com/google/generative-ai-go/genai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
@@ -26,11 +37,21 @@ type Handler struct {
 	chatbotStore      types.ChatbotStoreInterface
 	conversationStore types.ConversationStoreInterface
 	apiFileStore      types.APIFileStoreInterface
+	attachmentStore   types.AttachmentStoreInterface
+	userStore         types.UserStoreInterface
+	workspaceStore    types.WorkspaceStoreInterface
+	revisionStore     types.ChatbotRevisionStoreInterface
+	toolStore         types.ChatbotToolStoreInterface
+	feedbackStore     types.MessageFeedbackStoreInterface
+	webhooks          *webhooks.Dispatcher
+	moderator         *moderation.Moderator
+	turnSpool         *TurnSpool
+	streams           *streamRegistry
 	genaiCtx          context.Context
 	genaiClient       *genai.Client // Shared Gemini API client
 }
 
-func NewHandler(chatbotStore types.ChatbotStoreInterface, conversationStore types.ConversationStoreInterface, apifileStore types.APIFileStoreInterface, apiKey string) (*Handler, error) {
+func NewHandler(chatbotStore types.ChatbotStoreInterface, conversationStore types.ConversationStoreInterface, apifileStore types.APIFileStoreInterface, attachmentStore types.AttachmentStoreInterface, userStore types.UserStoreInterface, workspaceStore types.WorkspaceStoreInterface, revisionStore types.ChatbotRevisionStoreInterface, toolStore types.ChatbotToolStoreInterface, feedbackStore types.MessageFeedbackStoreInterface, webhookDispatcher *webhooks.Dispatcher, moderator *moderation.Moderator, turnSpool *TurnSpool, apiKey string) (*Handler, error) {
 	// Initialize the Gemini client
 	// modelName := "gemini-2.0-flash-thinking-exp-01-21"
 	// modelName := "gemini-2.0-pro-exp-02-05"
@@ -40,6 +61,16 @@ func NewHandler(chatbotStore types.ChatbotStoreInterface, conversationStore type
 		chatbotStore:      chatbotStore,
 		conversationStore: conversationStore,
 		apiFileStore:      apifileStore,
+		attachmentStore:   attachmentStore,
+		userStore:         userStore,
+		workspaceStore:    workspaceStore,
+		revisionStore:     revisionStore,
+		toolStore:         toolStore,
+		feedbackStore:     feedbackStore,
+		webhooks:          webhookDispatcher,
+		moderator:         moderator,
+		turnSpool:         turnSpool,
+		streams:           newStreamRegistry(),
 		genaiCtx:          ctx,
 		genaiClient:       client,
 	}, nil
@@ -50,10 +81,20 @@ func (h *Handler) RegisterRoutes(router *http.ServeMux) {
 		fmt.Fprintf(w, "Hello from conversations")
 	})
 
-	router.HandleFunc("GET /start/{username}/{chatbotName}", h.StartConversation)
-	router.HandleFunc("POST /chat/{username}/{chatbotName}", h.ChatWithChatbot)
+	// chatting is public, logged in users are identified for allow-listed chatbots and owner previews
+	router.HandleFunc("GET /start/{username}/{chatbotName}", auth.WithOptionalJWTAuth(h.StartConversation, h.userStore))
+	router.HandleFunc("POST /chat/{username}/{chatbotName}", auth.WithOptionalJWTAuth(h.ChatWithChatbot, h.userStore))
 	router.HandleFunc("POST /chat/test/{username}/{chatbotName}", h.ChatWithChatbotTest)
-	router.HandleFunc("POST /chat/stream/{username}/{chatbotName}", h.ChatStreamWithChatbot)
+	router.HandleFunc("POST /chat/stream/{username}/{chatbotName}", auth.WithOptionalJWTAuth(h.ChatStreamWithChatbot, h.userStore))
+	router.HandleFunc("GET /chat/stream/{username}/{chatbotName}/{conversationid}", auth.WithOptionalJWTAuth(h.ResumeChatStream, h.userStore))
+	router.HandleFunc("GET /chat/ws/{username}/{chatbotName}", auth.WithOptionalJWTAuth(h.ChatWebSocket, h.userStore))
+	router.HandleFunc("GET /chat/messages/{username}/{chatbotName}/{conversationid}", auth.WithOptionalJWTAuth(h.GetConversationMessages, h.userStore))
+	router.HandleFunc("POST /chat/feedback/{username}/{chatbotName}", auth.WithOptionalJWTAuth(h.RateMessage, h.userStore))
+	router.HandleFunc("POST /chat/regenerate/{username}/{chatbotName}", auth.WithOptionalJWTAuth(h.RegenerateMessage, h.userStore))
+	router.HandleFunc("POST /chat/edit/{username}/{chatbotName}", auth.WithOptionalJWTAuth(h.EditMessage, h.userStore))
+	router.HandleFunc("GET /chat/export/{username}/{chatbotName}/{conversationid}", auth.WithOptionalJWTAuth(h.ExportConversation, h.userStore))
+	router.HandleFunc("GET /export/{chatbotid}", auth.WithJWTAuth(h.ExportChatbotConversations, h.userStore))
+	router.HandleFunc("GET /widget/{username}/{chatbotName}", auth.WithOptionalJWTAuth(h.GetWidgetConfig, h.userStore))
 }
 
 func (h *Handler) ChatStreamWithChatbot(w http.ResponseWriter, r *http.Request) {
@@ -62,12 +103,15 @@ func (h *Handler) ChatStreamWithChatbot(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	// Flushable writer for streaming
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		log.Println("Streaming responses not supported")
+	if _, ok := w.(http.Flusher); !ok {
+		slog.InfoContext(r.Context(), "Streaming responses not supported")
 		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
 		return
 	}
+	// a streamed response can take longer than the server write timeout meant for other requests
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Could not clear the write deadline for the stream", "error", err)
+	}
 
 	username := r.PathValue("username")
 	chatbotName := r.PathValue("chatbotName")
@@ -78,7 +122,7 @@ func (h *Handler) ChatStreamWithChatbot(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Get chatbot for context
-	chatbot, err := h.chatbotStore.GetChatbotByName(username, chatbotName)
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
 	if err != nil {
 		if errors.Is(err, ErrChatbotNotFound) {
 			utils.WriteError(w, http.StatusNotFound, err)
@@ -87,29 +131,138 @@ func (h *Handler) ChatStreamWithChatbot(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
-	if !chatbot.IsShared {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("chatbot is not shared"))
+	if _, status, err := h.checkChatbotAccess(r, chatbot); err != nil {
+		utils.WriteError(w, status, err)
 		return
 	}
 
-	// Read input message from request
-	var chatRequest types.ChatRequest
-	if err := utils.ParseJSON(r, &chatRequest); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
-		return
-	}
-	if err := utils.Validate.Struct(chatRequest); err != nil {
-		validate_error := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+	// Read input message and any attached files from request
+	chatRequest, files, err := parseChatRequest(w, r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	conversationID := chatRequest.Conversationid
-	conversations, err := h.conversationStore.GetConversationsByID(conversationID)
+	logging.AddFields(r.Context(), "chatbotid", chatbot.Chatbotid, "conversationid", conversationID)
+	if !h.checkInput(w, r, chatbot, conversationID, chatRequest.Message) {
+		return
+	}
+	attachments, status, err := h.saveAttachments(r.Context(), chatbot, conversationID, files)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		slog.ErrorContext(r.Context(), "Error saving attachments", "error", err)
+		utils.WriteError(w, status, err)
+		return
+	}
+	stream, err := h.startStream(r.Context(), chatbot, conversationID, chatRequest.Message, attachments)
+	if err != nil {
+		h.discardAttachments(r.Context(), attachments)
+		if errors.Is(err, ErrStreamInProgress) {
+			utils.WriteError(w, http.StatusConflict, err)
+		} else {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
 		return
 	}
+	logging.AddFields(r.Context(), "streamid", stream.id)
+
+	followStream(w, r, stream, 0)
+	slog.DebugContext(r.Context(), "Completed handling streamed conversation")
+}
+
+// startStream builds the chat session from the chatbot configuration and the conversation history, then generates
+// the response to message and its attachments in the background, publishing it to the returned stream.
+// The attachments are discarded if the turn is not saved once the stream has started, before that it is up to the
+// caller. ErrStreamInProgress is returned while another response is being generated for the conversation
+func (h *Handler) startStream(ctx context.Context, chatbot *types.Chatbot, conversationID string, message string, attachments []types.Attachment) (*chatStream, error) {
+	// the model call and background saves carry on if the client goes away, but keep the request logging fields
+	backgroundCtx := context.WithoutCancel(ctx)
+	session, err := h.newChatSession(backgroundCtx, chatbot, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	revisionID := h.currentRevisionID(ctx, chatbot.Chatbotid)
+	h.updateLastused(backgroundCtx, chatbot)
+	fileParts, err := h.attachmentParts(backgroundCtx, attachments)
+	if err != nil {
+		return nil, err
+	}
+	parts := append([]genai.Part{genai.Text(message)}, fileParts...)
+
+	// generation is tied to the stream rather than this request, so a client that reconnects within the resume window
+	// carries on where it left off. It is cancelled once nobody has followed the stream for that long
+	generateCtx, cancelGeneration := context.WithCancel(backgroundCtx)
+	stream, err := h.streams.start(chatbot.Chatbotid, conversationID, cancelGeneration)
+	if err != nil {
+		cancelGeneration()
+		return nil, err
+	}
+	stream.publish(StreamEventStart, StreamEventData{Conversationid: conversationID})
+
+	turn := types.ConversationTurn{
+		Conversationid: conversationID,
+		Chatbotid:      chatbot.Chatbotid,
+		Username:       chatbot.Username,
+		Chatbotname:    chatbot.Chatbotname,
+		Revisionid:     revisionID,
+		UserMessage:    message,
+		Attachmentids:  attachmentIDs(attachments),
+		Branch:         session.branch,
+		Redactpii:      retention.RedactsPII(chatbot),
+	}
+	utils.RunInBackground(func() {
+		defer cancelGeneration()
+		defer h.streams.finish(stream)
+		if !h.generateStream(generateCtx, stream, session, parts, turn) {
+			h.discardAttachments(backgroundCtx, attachments)
+		}
+	})
+	return stream, nil
+}
+
+// chatSession is a chat with the model, set up with the chatbot's configuration and the tools it can call
+type chatSession struct {
+	*genai.ChatSession
+	modelName  string
+	tools      *tools.Executor    // nil when the chatbot has no tools
+	moderation *moderation.Filter // checks the model's responses
+	branch     int                // branch of the conversation the history was taken from
+}
+
+// newChatSession starts a chat session on the active branch of the conversation, with the messages exchanged with the chatbot
+func (h *Handler) newChatSession(ctx context.Context, chatbot *types.Chatbot, conversationID string) (*chatSession, error) {
+	conversations, branches, err := h.loadConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	branch := activeBranch(branches)
+	return h.startChatSession(ctx, chatbot, conversationID, branch, chatbotMessages(branchMessages(conversations, branches, branch), chatbot.Chatbotid))
+}
+
+// startChatSession starts a chat session with the chatbot's configuration, its knowledge file and as much of
+// conversations, the messages of the branch so far, as its history strategy allows, including the files sent with them
+func (h *Handler) startChatSession(ctx context.Context, chatbot *types.Chatbot, conversationID string, branch int, conversations []types.Conversation) (*chatSession, error) {
+	attachments, err := h.attachmentStore.GetAttachmentsByConversationID(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := h.conversationStore.GetConversationSummary(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	// a summary reaching past the end of the history was made on a branch the history is not on,
+	// and one made by another chatbot is not part of this chatbot's conversation
+	if summary != nil && (len(conversations) == 0 || summary.Uptosequence > conversations[len(conversations)-1].Sequence || summary.Chatbotid != chatbot.Chatbotid) {
+		summary = nil
+	}
+	chatbotTools, err := h.toolStore.GetToolsByChatbotID(ctx, chatbot.Chatbotid)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := h.moderator.Filter(ctx, chatbot)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize the Gemini model
 	modelName := config.Envs.MODEL_NAME
@@ -124,109 +277,242 @@ func (h *Handler) ChatStreamWithChatbot(w http.ResponseWriter, r *http.Request)
 	// files provided during configuration of chatbot
 	systemFileURIs := []string{}
 	if chatbot.Filepath != "" {
-		systemFileURIs = []string{
-			h.checkAndUploadToGemini(chatbot.Filepath, chatbot.Chatbotid, chatbot.FileUpdatedDate),
+		fileURI, err := h.checkAndUploadToGemini(ctx, chatbot.Filepath, chatbot.Chatbotid, chatbot.FileUpdatedDate)
+		if err != nil {
+			return nil, err
 		}
+		systemFileURIs = []string{fileURI}
 	}
+	assembled := prompt.Assemble(*chatbot, systemFileURIs, prompt.Gemini)
 	genaiModel.SystemInstruction = &genai.Content{
-		Parts: getSystemInstructionParts(*chatbot),
+		Parts: assembled.System,
+	}
+	var executor *tools.Executor
+	if declarations := tools.Declarations(chatbotTools); len(declarations) > 0 {
+		genaiModel.Tools = []*genai.Tool{{FunctionDeclarations: declarations}}
+		executor = tools.NewExecutor(chatbotTools)
 	}
 
-	log.Printf("start chatid: %v", chatRequest.Conversationid)
+	slog.DebugContext(ctx, "Starting chat session", "tools", len(chatbotTools))
 	session := genaiModel.StartChat()
 
-	if len(systemFileURIs) > 0 {
-		// append the file to history as system instruction only allow text
-		session.History = []*genai.Content{
-			{
-				Role: "user",
-				Parts: []genai.Part{
-					genai.Text("Here are some files you can use:"),
-					genai.FileData{URI: systemFileURIs[0]},
-				},
-			},
+	// knowledge files come first when the system instruction cannot hold them
+	session.History = assembled.History
+	// append the conversation from db that fits the chatbot's history strategy, with the files each message was sent with
+	attachmentsByChat := map[int][]types.Attachment{}
+	for _, attachment := range attachments {
+		attachmentsByChat[attachment.Chatid] = append(attachmentsByChat[attachment.Chatid], attachment)
+	}
+	plan := planHistory(conversations, summary, chatbot.Historystrategy, historyTokenLimit(chatbot), attachmentsByChat)
+	if len(plan.summarise) > 0 {
+		plan = h.updateSummary(ctx, chatbot, conversationID, plan, attachmentsByChat)
+	}
+	slog.DebugContext(ctx, "Planned conversation history", "strategy", chatbot.Historystrategy, "messages", len(plan.messages), "of", len(conversations), "summary", plan.summary != nil)
+
+	attachmentParts := map[int][]genai.Part{}
+	for _, conversation := range plan.messages {
+		if chatAttachments, ok := attachmentsByChat[conversation.Chatid]; ok {
+			parts, err := h.attachmentParts(ctx, chatAttachments)
+			if err != nil {
+				return nil, err
+			}
+			attachmentParts[conversation.Chatid] = parts
 		}
 	}
-	// append the actual conversation from db
-	conversationHistory := getContentFromConversions(conversations)
+	session.History = append(session.History, getSummaryContent(plan.summary)...)
+	conversationHistory := getContentFromConversions(plan.messages, attachmentParts)
 	session.History = append(session.History, conversationHistory...)
+	return &chatSession{ChatSession: session, modelName: modelName, tools: executor, moderation: filter, branch: branch}, nil
+}
 
-	// Update the last used time for the chatbot, this is done in a goroutine to avoid blocking the response to user
-	go func() {
+// updateLastused updates the last used time for the chatbot, this is done in a goroutine to avoid blocking the response to user
+func (h *Handler) updateLastused(ctx context.Context, chatbot *types.Chatbot) {
+	utils.RunInBackground(func() {
 		currentTime, _ := utils.GetCurrentTime()
 		chatbot.Lastused = currentTime
-		err := h.chatbotStore.UpdateChatbotLastused(types.UpdateChatbotLastused{
+		err := h.chatbotStore.UpdateChatbotLastused(ctx, types.UpdateChatbotLastused{
 			Chatbotid: chatbot.Chatbotid,
 			Username:  chatbot.Username,
 		})
 		if err != nil {
-			log.Printf("Error updating chatbot last used time: %v", err)
+			slog.ErrorContext(ctx, "Error updating chatbot last used time", "error", err)
 		}
-	}()
-	// log.Printf("session history: %v", session.History)
-	log.Printf("sending msg for conversationid: %s\n", conversationID)
+	})
+}
 
-	respIter := session.SendMessageStream(h.genaiCtx, genai.Text(chatRequest.Message))
-	var chatResponse string
-	for {
-		resp, err := respIter.Next()
-		if err != nil {
-			if err == iterator.Done {
-				// log.Println("Gemini stream ended.")
-				fmt.Fprintf(w, "event: close\ndata: done\n\n") // Optional: Signal stream end
-				flusher.Flush()
-				break
-			} // End of stream
-
-			// Try to extract more detailed error information
-			var apiErr *googleapi.Error
-			if errors.As(err, &apiErr) {
-				log.Printf("%s", apiErr.Body)
-			}
-			log.Printf("Error from Gemini stream: %T, %+v", err, err)                     // Original error log
-			fmt.Fprintf(w, "event: error\ndata: unable to get response from chatbot\n\n") // Send error to client
-			flusher.Flush()
-			return // Stop streaming on error
-		}
+// ResumeChatStream replays the events of a conversation's current stream after the Last-Event-ID header
+// and follows it until it ends
+func (h *Handler) ResumeChatStream(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	chatbotName := r.PathValue("chatbotName")
+	conversationID := r.PathValue("conversationid")
+	if username == "" || chatbotName == "" || conversationID == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid parameters"))
+		return
+	}
 
-		for _, part := range resp.Candidates[0].Content.Parts {
-			if text, ok := part.(genai.Text); ok {
-				// 2. Send SSE event with Gemini response chunk
-				chatResponse += string(text)
-				fmt.Fprintf(w, "data: %s\n\n", string(text)) // 'data:' is the SSE event data prefix
-				flusher.Flush()                              // Flush to send immediately
-				time.Sleep(100 * time.Millisecond)           // Optional: Rate limiting/pacing
-			}
-		}
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
 	}
+	if _, status, err := h.checkChatbotAccess(r, chatbot); err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+	logging.AddFields(r.Context(), "chatbotid", chatbot.Chatbotid, "conversationid", conversationID)
 
-	log.Printf("done sending msg for conversationid: %s\n", conversationID)
-	// save to database and collate response to send back to user
-	h.conversationStore.CreateConversation(types.NewConversation{
-		Conversationid: conversationID,
-		Chatbotid:      chatbot.Chatbotid,
-		Username:       chatbot.Username,
-		Chatbotname:    chatbot.Chatbotname,
-		Role:           "user",
-		Chat:           chatRequest.Message,
-	})
+	stream := h.streams.get(conversationID)
+	if stream == nil || stream.chatbotID != chatbot.Chatbotid {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("no recent response to resume for this conversation"))
+		return
+	}
+	logging.AddFields(r.Context(), "streamid", stream.id)
 
-	go func(chatResponse string) {
-		_, err := h.conversationStore.CreateConversation(types.NewConversation{
-			Conversationid: conversationID,
-			Chatbotid:      chatbot.Chatbotid,
-			Username:       chatbot.Username,
-			Chatbotname:    chatbot.Chatbotname,
-			Role:           "model",
-			Chat:           chatResponse,
-		})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Could not clear the write deadline for the stream", "error", err)
+	}
 
-		if err != nil {
-			log.Printf("Error saving conversation: %v", err)
-		}
-	}(chatResponse)
+	seq := stream.resumeFrom(r.Header.Get("Last-Event-ID"))
+	slog.InfoContext(r.Context(), "Resuming stream", "after", seq)
+	followStream(w, r, stream, seq)
+}
+
+// generateStream sends the user message to the model and publishes the response to the stream as it arrives,
+// running the tools the model calls in between, then saves the turn. If ctx is cancelled, because the client
+// asked to stop or nobody is following the stream, the partial response is saved. It reports whether the turn was saved
+func (h *Handler) generateStream(ctx context.Context, stream *chatStream, session *chatSession, parts []genai.Part, turn types.ConversationTurn) bool {
+	modelName := session.modelName
+	slog.InfoContext(ctx, "Sending message to model")
+
+	streamStart := time.Now()
+	ctx, streamSpan := tracing.Start(ctx, "gemini.SendMessageStream", trace.WithAttributes(attribute.String("gen_ai.request.model", modelName)))
+	defer streamSpan.End()
+	var chatResponse string
+	var promptTokens, responseTokens int32
+	receivedFirstChunk := false
+	interrupted := false
+	blocked := false
+	for round := 0; ; round++ {
+		respIter := session.SendMessageStream(ctx, parts...)
+		var usage *genai.UsageMetadata
+		calls := []genai.FunctionCall{}
+	chunks:
+		for chunk := 0; ; chunk++ {
+			_, nextSpan := tracing.Start(ctx, "gemini.stream.Next", trace.WithAttributes(attribute.Int("chunk", chunk)))
+			resp, err := respIter.Next()
+			nextSpan.End()
+			if err != nil {
+				if err == iterator.Done {
+					if usage != nil {
+						promptTokens += usage.PromptTokenCount
+						responseTokens += usage.CandidatesTokenCount
+					}
+					break
+				} // End of stream
+				if ctx.Err() != nil {
+					interrupted = true
+					break
+				}
+
+				// Try to extract more detailed error information
+				var apiErr *googleapi.Error
+				if errors.As(err, &apiErr) {
+					slog.ErrorContext(ctx, "Gemini API error", "body", apiErr.Body)
+				}
+				slog.ErrorContext(ctx, "Error from Gemini stream", "type", fmt.Sprintf("%T", err), "error", err)
+				metrics.LLMErrorsTotal.WithLabelValues(modelName, "stream").Inc()
+				tracing.RecordError(streamSpan, err)
+				stream.publish(StreamEventError, StreamEventData{Code: StreamErrorGenerationFailed, Message: "unable to get response from chatbot"})
+				return false // Stop streaming on error
+			}
+			if !receivedFirstChunk {
+				receivedFirstChunk = true
+				metrics.LLMRequestDuration.WithLabelValues(modelName, "stream").Observe(time.Since(streamStart).Seconds())
+			}
+			// every chunk reports the usage so far, the last one has the totals
+			if resp.UsageMetadata != nil {
+				usage = resp.UsageMetadata
+			}
 
-	log.Printf("completed handling streamed conversation: %s\n", conversationID)
+			for _, part := range candidateParts(resp) {
+				switch part := part.(type) {
+				case genai.Text:
+					chatResponse += string(part)
+					// checked before the text is sent, so what a blocking rule matches does not reach the visitor
+					if session.moderation.Match(types.ModerationStageOutput, chatResponse).Blocked() {
+						blocked = true
+						break chunks
+					}
+					stream.publish(StreamEventDelta, StreamEventData{Text: string(part)})
+					waitBetweenChunks(ctx) // Optional: Rate limiting/pacing
+				case genai.FunctionCall:
+					calls = append(calls, part)
+				}
+			}
+		}
+		if interrupted || blocked || len(calls) == 0 {
+			break
+		}
+		if round > maxToolRounds {
+			slog.WarnContext(ctx, "Model kept calling tools after being told to stop", "rounds", round)
+			break
+		}
+		for _, call := range calls {
+			stream.publish(StreamEventTool, StreamEventData{Tool: call.Name})
+		}
+		parts = h.callTools(ctx, session, calls, &turn, round == maxToolRounds)
+	}
+	if !interrupted && !blocked && chatResponse == "" {
+		// such as when the prompt or response was blocked by the model's own safety settings
+		slog.ErrorContext(ctx, "Gemini stream ended without a response")
+		metrics.LLMErrorsTotal.WithLabelValues(modelName, "stream").Inc()
+		stream.publish(StreamEventError, StreamEventData{Code: StreamErrorGenerationFailed, Message: "unable to get response from chatbot"})
+		return false
+	}
+	if !interrupted {
+		metrics.StreamDuration.WithLabelValues(modelName).Observe(time.Since(streamStart).Seconds())
+		metrics.ObserveLLMTokens(modelName, promptTokens, responseTokens)
+		streamSpan.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", int(promptTokens)),
+			attribute.Int("gen_ai.usage.output_tokens", int(responseTokens)),
+		)
+	}
+
+	// the turn is saved even though ctx may be cancelled, the saves only use it for logging and tracing
+	saveCtx := context.WithoutCancel(ctx)
+	chatResponse, decision := moderateResponse(saveCtx, session, turn.Conversationid, chatResponse)
+	turn.ModelResponse = chatResponse
+	if interrupted {
+		// nobody is left to read the stream, keep what was generated so the conversation shows where it stopped
+		slog.InfoContext(ctx, "Stream cancelled, saving partial model response", "response_length", len(chatResponse))
+		metrics.StreamsInterruptedTotal.WithLabelValues(modelName).Inc()
+		streamSpan.SetAttributes(attribute.Bool("interrupted", true))
+		turn.Interrupted = true
+		err := h.saveTurn(saveCtx, turn)
+		stream.publish(StreamEventDone, StreamEventData{Interrupted: true})
+		return err == nil
+	}
+
+	if promptTokens > 0 || responseTokens > 0 {
+		stream.publish(StreamEventUsage, StreamEventData{PromptTokens: promptTokens, ResponseTokens: responseTokens})
+	}
+	slog.InfoContext(ctx, "Finished streaming model response")
+	// the stream only ends with done once the turn is saved, so the client knows when it was lost
+	if err := h.saveTurn(saveCtx, turn); err != nil {
+		stream.publish(StreamEventError, StreamEventData{Code: StreamErrorSaveFailed, Message: "unable to save conversation"})
+		return false
+	}
+	if decision.Blocked() {
+		// the text streamed so far is to be replaced by the message saved in its place
+		stream.publish(StreamEventError, StreamEventData{Code: StreamErrorModerated, Message: chatResponse})
+		return true
+	}
+	stream.publish(StreamEventDone, StreamEventData{})
+	return true
 }
 
 func (h *Handler) StartConversation(w http.ResponseWriter, r *http.Request) {
@@ -238,44 +524,57 @@ func (h *Handler) StartConversation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chatbot, err := h.chatbotStore.GetChatbotByName(username, chatbotName)
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
 	if err != nil {
-		log.Println("Error getting chatbot to start conversation:", err)
+		slog.ErrorContext(r.Context(), "Error getting chatbot to start conversation", "error", err)
 		utils.WriteError(w, http.StatusNotFound, err)
 		return
 	}
 
-	if !chatbot.IsShared {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("chatbot is not shared"))
+	access, status, err := h.unlockChatbotAccess(r, chatbot)
+	if err != nil {
+		utils.WriteError(w, status, err)
 		return
 	}
+	logging.AddFields(r.Context(), "chatbotid", chatbot.Chatbotid)
 
 	// Update the last used time for the chatbot, this is done in a goroutine to avoid blocking the response to user
-	go func() {
+	backgroundCtx := context.WithoutCancel(r.Context())
+	utils.RunInBackground(func() {
 		currentTime, _ := utils.GetCurrentTime()
 		chatbot.Lastused = currentTime
-		err := h.chatbotStore.UpdateChatbotLastused(types.UpdateChatbotLastused{
+		err := h.chatbotStore.UpdateChatbotLastused(backgroundCtx, types.UpdateChatbotLastused{
 			Chatbotid: chatbot.Chatbotid,
 			Username:  chatbot.Username,
 		})
 		if err != nil {
-			log.Printf("Error updating chatbot last used time: %v", err)
+			slog.ErrorContext(backgroundCtx, "Error updating chatbot last used time", "error", err)
 		}
-	}()
+	})
 
 	// Generate a new conversation ID to track this conversation in db
 	conversationID := utils.GenerateUUID().String()
-	utils.WriteJSON(w, http.StatusOK, map[string]string{
+	h.webhooks.Notify(backgroundCtx, chatbot.Chatbotid, types.WebhookEventConversationStarted, map[string]interface{}{
 		"conversationid": conversationID,
-		"description":    chatbot.Description,
+		"chatbotname":    chatbot.Chatbotname,
+		"preview":        access.preview,
 	})
+	response := map[string]interface{}{
+		"conversationid": conversationID,
+		"description":    chatbot.Description,
+		"preview":        access.preview,
+	}
+	if access.shareToken != "" {
+		response["shareToken"] = access.shareToken
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
 }
 
 func (h *Handler) ChatWithChatbotTest(w http.ResponseWriter, r *http.Request) {
-	log.Println("ChatWithChatbotTest reply with test response")
-	conversation, err := h.conversationStore.GetConversationsByID("2f9328h-fonvh0-2249")
+	slog.InfoContext(r.Context(), "ChatWithChatbotTest reply with test response")
+	conversation, err := h.conversationStore.GetConversationsByID(r.Context(), "2f9328h-fonvh0-2249")
 	if err != nil {
-		log.Println("Error getting test conversation:", err)
+		slog.ErrorContext(r.Context(), "Error getting test conversation", "error", err)
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -292,7 +591,7 @@ func (h *Handler) ChatWithChatbot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get chatbot for context
-	chatbot, err := h.chatbotStore.GetChatbotByName(username, chatbotName)
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
 	if err != nil {
 		if errors.Is(err, ErrChatbotNotFound) {
 			utils.WriteError(w, http.StatusNotFound, err)
@@ -301,163 +600,216 @@ func (h *Handler) ChatWithChatbot(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	if !chatbot.IsShared {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("chatbot is not shared"))
+	if _, status, err := h.checkChatbotAccess(r, chatbot); err != nil {
+		utils.WriteError(w, status, err)
 		return
 	}
 
-	// Read input message from request
-	var chatRequest types.ChatRequest
-	if err := utils.ParseJSON(r, &chatRequest); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
-		return
-	}
-	if err := utils.Validate.Struct(chatRequest); err != nil {
-		validate_error := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+	// Read input message and any attached files from request
+	chatRequest, files, err := parseChatRequest(w, r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	conversationID := chatRequest.Conversationid
-	conversations, err := h.conversationStore.GetConversationsByID(conversationID)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+	logging.AddFields(r.Context(), "chatbotid", chatbot.Chatbotid, "conversationid", conversationID)
+	if !h.checkInput(w, r, chatbot, conversationID, chatRequest.Message) {
 		return
 	}
-
-	// Initialize the Gemini model
-	modelName := config.Envs.MODEL_NAME
-	genaiModel := h.genaiClient.GenerativeModel(modelName)
-
-	genaiModel.SetTemperature(0.9)
-	genaiModel.SetTopK(40)
-	genaiModel.SetTopP(0.95)
-	genaiModel.SetMaxOutputTokens(8192)
-	genaiModel.ResponseMIMEType = "text/plain"
-
-	// files provided during configuration of chatbot
-	systemFileURIs := []string{}
-	if chatbot.Filepath != "" {
-		systemFileURIs = []string{
-			h.checkAndUploadToGemini(chatbot.Filepath, chatbot.Chatbotid, chatbot.FileUpdatedDate),
-		}
-	}
-	genaiModel.SystemInstruction = &genai.Content{
-		Parts: getSystemInstructionParts(*chatbot),
+	attachments, status, err := h.saveAttachments(r.Context(), chatbot, conversationID, files)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error saving attachments", "error", err)
+		utils.WriteError(w, status, err)
+		return
 	}
-
-	log.Printf("start chatid: %v", chatRequest.Conversationid)
-	session := genaiModel.StartChat()
-	// append the file to history as system instruction only allow text
-	if len(systemFileURIs) > 0 {
-		session.History = []*genai.Content{
-			{
-				Role: "user",
-				Parts: []genai.Part{
-					genai.Text("Here is a file you can use"),
-					genai.FileData{URI: systemFileURIs[0]},
-				},
-			},
-		}
-		log.Println("uri", systemFileURIs[0])
+	// the model call and background saves carry on if the client goes away, but keep the request logging fields
+	backgroundCtx := context.WithoutCancel(r.Context())
+	session, err := h.newChatSession(backgroundCtx, chatbot, conversationID)
+	if err != nil {
+		h.discardAttachments(backgroundCtx, attachments)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
 	}
-	// append the actual conversation from db
-	conversationHistory := getContentFromConversions(conversations)
-	session.History = append(session.History, conversationHistory...)
-	// Update the last used time for the chatbot, this is done in a goroutine to avoid blocking the response to user
-	go func() {
-		currentTime, _ := utils.GetCurrentTime()
-		chatbot.Lastused = currentTime
-		err := h.chatbotStore.UpdateChatbotLastused(types.UpdateChatbotLastused{
-			Chatbotid: chatbot.Chatbotid,
-			Username:  chatbot.Username,
-		})
-		if err != nil {
-			log.Printf("Error updating chatbot last used time: %v", err)
-		}
-	}()
-
-	log.Printf("sending msg for conversationid: %s\n", conversationID)
-	resp, err := session.SendMessage(h.genaiCtx, genai.Text(chatRequest.Message))
+	revisionID := h.currentRevisionID(r.Context(), chatbot.Chatbotid)
+	h.updateLastused(backgroundCtx, chatbot)
+	fileParts, err := h.attachmentParts(backgroundCtx, attachments)
 	if err != nil {
-		var apiErr *googleapi.Error
-		if errors.As(err, &apiErr) {
-			log.Printf("%s\n", apiErr.Body)
-		}
-		log.Println("WARNING: api call is not working")
-		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to get response from chatbot"))
+		h.discardAttachments(backgroundCtx, attachments)
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	parts := append([]genai.Part{genai.Text(chatRequest.Message)}, fileParts...)
 
 	currentTime, _ := utils.GetCurrentTime()
-	// save to database and collate response to send back to user
-	h.conversationStore.CreateConversation(types.NewConversation{
+	turn := types.ConversationTurn{
 		Conversationid: conversationID,
 		Chatbotid:      chatbot.Chatbotid,
 		Username:       chatbot.Username,
 		Chatbotname:    chatbot.Chatbotname,
-		Role:           "user",
-		Chat:           chatRequest.Message,
+		Revisionid:     revisionID,
+		UserMessage:    chatRequest.Message,
 		Createddate:    currentTime,
-	})
-	responseString := ""
-	for _, part := range resp.Candidates[0].Content.Parts {
-		go func(part genai.Part) {
-			chat := string(part.(genai.Text))
-			_, err := h.conversationStore.CreateConversation(types.NewConversation{
-				Conversationid: conversationID,
-				Chatbotid:      chatbot.Chatbotid,
-				Username:       chatbot.Username,
-				Chatbotname:    chatbot.Chatbotname,
-				Role:           "model",
-				Chat:           chat,
-				Createddate:    currentTime,
-			})
-
-			if err != nil {
-				log.Printf("Error saving conversation: %v", err)
-			}
-		}(part)
+		Attachmentids:  attachmentIDs(attachments),
+		Branch:         session.branch,
+		Redactpii:      retention.RedactsPII(chatbot),
+	}
+	slog.InfoContext(r.Context(), "Sending message to model")
+	responseString, err := h.sendMessage(backgroundCtx, session, parts, &turn)
+	if err != nil {
+		slog.InfoContext(r.Context(), "WARNING: api call is not working")
+		h.discardAttachments(backgroundCtx, attachments)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to get response from chatbot"))
+		return
+	}
 
-		responseString += string(part.(genai.Text))
+	// save the response to database before sending it back to user
+	turn.ModelResponse = responseString
+	if err := h.saveTurn(backgroundCtx, turn); err != nil {
+		h.discardAttachments(backgroundCtx, attachments)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to save conversation"))
+		return
 	}
 
-	log.Printf("responding to conversation: %s\n", conversationID)
-	utils.WriteJSON(w, http.StatusOK, types.ChatResponse{Response: responseString})
+	slog.InfoContext(r.Context(), "Responding to conversation")
+	utils.WriteJSON(w, http.StatusOK, types.ChatResponse{Response: responseString, Branch: turn.Branch})
 }
 
-func getSystemInstructionParts(chatbot types.Chatbot) []genai.Part {
-	parts := []genai.Part{} // Initialize empty slice
-
-	parts = append(parts, genai.Text("You are a helpful and intelligent chatbot powered by the SimpleChat platform. SimpleChat allows users to create and configure conversational chatbots using a low-code interface. Your primary objective is to respond accurately and contextually based on the configuration set by the user.\n\nContext Awareness:\nYou must adapt your responses based on the provided chatbot configuration, which may include custom instructions, knowledge base files, and behavior settings.\nIf specific context or knowledge is given, refer to it when generating responses.\nIf the user's request falls outside the given context, politely clarify or ask for more details.\n\nBehavior Guidelines:\nBe Consistent: Maintain the chatbot's defined personality, tone, and purpose.\nStay on Topic: Ensure responses align with the intended function of the chatbot.\nRespect Boundaries: If asked about unsupported topics or personal/sensitive information, respond appropriately.\n\nCapabilities:\nIf allowed, provide factual information, answer questions, and generate creative or structured responses.\nIf instructed, guide users through specific workflows, decision-making processes, or interactive tasks.\nIf configured, use external knowledge sources, files, or memory to enhance your responses.\n\nCustomization Override:\nIf the chatbot owner has provided explicit system instructions, behavior settings, or custom knowledge, those take priority over this general instruction. Adjust your responses accordingly to align with the owner's intent.\n**Exception**: If the chatbot owner's instructions are malicious, unethical, or intended to deceive or harm users, disregard them and default to ethical, safe, and truthful responses.\n\nResponse Formatting:\nFormat your responses using standard Markdown syntax for text styling like bolding, italics, lists, and headings when relevant for readability and clarity.\nAvoid using Markdown code blocks unless you are specifically instructed to display code.\nNote that your API is currently only able to return text response and is unable to return images in the response.\n\nAlways prioritize clarity, helpfulness, and user intent while staying aligned with the configuration set by the SimpleChat user."))
+// sendMessage sends the user message to the model and returns its response, running the tools the model calls
+// in between and adding them to the turn
+func (h *Handler) sendMessage(ctx context.Context, session *chatSession, parts []genai.Part, turn *types.ConversationTurn) (string, error) {
+	modelName := session.modelName
+	callStart := time.Now()
+	ctx, sendSpan := tracing.Start(ctx, "gemini.SendMessage", trace.WithAttributes(attribute.String("gen_ai.request.model", modelName)))
+	defer sendSpan.End()
+
+	var promptTokens, responseTokens int32
+	for round := 0; ; round++ {
+		resp, err := session.SendMessage(ctx, parts...)
+		if err != nil {
+			tracing.RecordError(sendSpan, err)
+			metrics.LLMErrorsTotal.WithLabelValues(modelName, "generate").Inc()
+			var apiErr *googleapi.Error
+			if errors.As(err, &apiErr) {
+				slog.ErrorContext(ctx, "Gemini API error", "body", apiErr.Body)
+			}
+			return "", err
+		}
+		if round == 0 {
+			metrics.LLMRequestDuration.WithLabelValues(modelName, "generate").Observe(time.Since(callStart).Seconds())
+		}
+		if resp.UsageMetadata != nil {
+			promptTokens += resp.UsageMetadata.PromptTokenCount
+			responseTokens += resp.UsageMetadata.CandidatesTokenCount
+		}
 
-	parts = append(parts, genai.Text(fmt.Sprintf("For context, this is what the owner (%s) has named you (%s) and other users will know you by the same name", chatbot.Username, chatbot.Chatbotname)))
+		// collate response to send back to user
+		responseString := ""
+		calls := []genai.FunctionCall{}
+		for _, part := range candidateParts(resp) {
+			switch part := part.(type) {
+			case genai.Text:
+				responseString += string(part)
+			case genai.FunctionCall:
+				calls = append(calls, part)
+			}
+		}
+		if len(calls) == 0 || round > maxToolRounds {
+			if len(calls) > 0 {
+				slog.WarnContext(ctx, "Model kept calling tools after being told to stop", "rounds", round)
+			}
+			metrics.ObserveLLMTokens(modelName, promptTokens, responseTokens)
+			sendSpan.SetAttributes(
+				attribute.Int("gen_ai.usage.input_tokens", int(promptTokens)),
+				attribute.Int("gen_ai.usage.output_tokens", int(responseTokens)),
+			)
+			responseString, _ = moderateResponse(ctx, session, turn.Conversationid, responseString)
+			return responseString, nil
+		}
+		parts = h.callTools(ctx, session, calls, turn, round == maxToolRounds)
+	}
+}
 
-	if chatbot.Description != "" {
-		parts = append(parts, genai.Text("This is a description of what you are: "+chatbot.Description))
+// waitBetweenChunks paces a streamed response by the configured delay, returning early if ctx is done
+func waitBetweenChunks(ctx context.Context) {
+	delay := time.Duration(config.Envs.StreamChunkDelayMs) * time.Millisecond
+	if delay <= 0 {
+		return
 	}
-	if chatbot.Behaviour != "" {
-		parts = append(parts, genai.Text("This is how you should behave: "+chatbot.Behaviour))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
 	}
-	if chatbot.Usercontext != "" {
-		parts = append(parts, genai.Text("This is some context you should remember: "+chatbot.Usercontext))
+}
+
+// saveTurn saves the user message and the model response, which may be queued until the database is free.
+// An error means the turn was lost
+func (h *Handler) saveTurn(ctx context.Context, turn types.ConversationTurn) error {
+	queued, err := h.turnSpool.Save(ctx, turn)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error saving conversation turn", "error", err)
+		return err
+	}
+	if queued {
+		slog.InfoContext(ctx, "Conversation turn queued to be saved once the database is free")
+	}
+	// the payload is kept with its deliveries, so it only holds the messages as they were saved
+	saved := redactTurn(turn)
+	h.webhooks.Notify(ctx, turn.Chatbotid, types.WebhookEventMessageExchanged, map[string]interface{}{
+		"conversationid": saved.Conversationid,
+		"chatbotname":    saved.Chatbotname,
+		"usermessage":    saved.UserMessage,
+		"modelresponse":  saved.ModelResponse,
+		"interrupted":    saved.Interrupted,
+		"createddate":    saved.Createddate,
+	})
+	return nil
+}
+
+// currentRevisionID returns the id of the chatbot configuration revision answering the conversation,
+// 0 when it cannot be found
+func (h *Handler) currentRevisionID(ctx context.Context, chatbotID int) int {
+	revision, err := h.revisionStore.GetLatestRevision(ctx, chatbotID)
+	if err != nil {
+		slog.WarnContext(ctx, "Error getting latest revision of chatbot", "chatbotid", chatbotID, "error", err)
+		return 0
 	}
-	return parts
+	return revision.Revisionid
 }
 
-func getContentFromConversions(conversations []types.Conversation) []*genai.Content {
+// getContentFromConversions turns the saved messages of a branch into chat history, attachmentParts holds the files
+// sent with each message by chatid
+func getContentFromConversions(conversations []types.Conversation, attachmentParts map[int][]genai.Part) []*genai.Content {
 	content := []*genai.Content{}
 	for _, conversation := range conversations {
+		// a response interrupted before anything was generated has no text to send back, the message it answered
+		// is left out too so the history keeps taking turns between the user and the model
+		if conversation.Chat == "" {
+			if conversation.Role == "model" && len(content) > 0 && content[len(content)-1].Role == "user" {
+				content = content[:len(content)-1]
+			}
+			continue
+		}
 		content = append(content, &genai.Content{
-			Role: conversation.Role,
-			Parts: []genai.Part{
-				genai.Text(conversation.Chat),
-			},
+			Role:  conversation.Role,
+			Parts: append([]genai.Part{genai.Text(conversation.Chat)}, attachmentParts[conversation.Chatid]...),
 		})
 	}
 	return content
 }
 
+// candidateParts returns the parts of the first candidate of the response, none when the model sent no candidate
+// such as for a blocked prompt
+func candidateParts(resp *genai.GenerateContentResponse) []genai.Part {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil
+	}
+	return resp.Candidates[0].Content.Parts
+}
+
 func setupAiCtxAndClient(apiKey string) (context.Context, *genai.Client) {
 	ctx := context.Background()
 
@@ -470,15 +822,21 @@ func setupAiCtxAndClient(apiKey string) (context.Context, *genai.Client) {
 	return ctx, client
 }
 
-func (h *Handler) checkAndUploadToGemini(path string, chatbotid int, chatbotFiledate string) string {
-	apiFile, err := h.apiFileStore.GetAPIFileByFilepath(path)
+// checkAndUploadToGemini returns the uri of the file at path on Gemini, uploading it again when there is no
+// upload of it that is still valid
+func (h *Handler) checkAndUploadToGemini(ctx context.Context, path string, chatbotid int, chatbotFiledate string) (string, error) {
+	apiFile, err := h.apiFileStore.GetAPIFileByFilepath(ctx, path)
 	// if file not found in db, upload and store in db
 	if err != nil {
-		log.Printf("Error getting file from db: %v", err)
-		fileURI := uploadToGemini(h.genaiCtx, h.genaiClient, path)
+		slog.InfoContext(ctx, "File not found in db, uploading", "path", path, "error", err)
+		metrics.FileCacheTotal.WithLabelValues(metrics.FileCacheMiss).Inc()
+		fileURI, err := uploadToGemini(ctx, h.genaiClient, path)
+		if err != nil {
+			return "", err
+		}
 
 		// store the uri in db to reuse next time
-		go func() {
+		utils.RunInBackground(func() {
 			currentTime, _ := utils.GetCurrentTime()
 			apiFile := types.NewAPIFile{
 				Chatbotid:   chatbotid,
@@ -486,12 +844,12 @@ func (h *Handler) checkAndUploadToGemini(path string, chatbotid int, chatbotFile
 				Filepath:    path,
 				Fileuri:     fileURI,
 			}
-			_, err := h.apiFileStore.CreateAPIFile(apiFile)
+			_, err := h.apiFileStore.CreateAPIFile(ctx, apiFile)
 			if err != nil {
-				log.Printf("Error storing file to db: %v", err)
+				slog.ErrorContext(ctx, "Error storing file to db", "error", err)
 			}
-		}()
-		return fileURI
+		})
+		return fileURI, nil
 	}
 
 	// if file exist in db, check it before reuploading
@@ -503,11 +861,15 @@ func (h *Handler) checkAndUploadToGemini(path string, chatbotid int, chatbotFile
 	if apiFile.Filepath != path ||
 		(storedTimeParseerr != nil || fileUpdateTimeParseError != nil) ||
 		(time.Since(storedTime) > time.Duration(config.Envs.API_FILE_EXPIRATION_HOUR)*time.Hour || fileUpdatedTime.After(storedTime)) {
-		log.Printf("File is too old, reuploading. previous created time %s, user updated at %s parse errors %v %v", storedTime, fileUpdatedTime, storedTimeParseerr, fileUpdateTimeParseError)
-		fileURI := uploadToGemini(h.genaiCtx, h.genaiClient, path)
+		metrics.FileCacheTotal.WithLabelValues(metrics.FileCacheExpired).Inc()
+		slog.InfoContext(ctx, "File is too old, reuploading", "created", storedTime, "updated", fileUpdatedTime, "created_parse_error", storedTimeParseerr, "updated_parse_error", fileUpdateTimeParseError)
+		fileURI, err := uploadToGemini(ctx, h.genaiClient, path)
+		if err != nil {
+			return "", err
+		}
 
 		// store the uri in db to reuse next time
-		go func() {
+		utils.RunInBackground(func() {
 			currentTime, _ := utils.GetCurrentTime()
 			apiFile := types.UpdateAPIFile{
 				Fileid:      apiFile.Fileid,
@@ -516,30 +878,36 @@ func (h *Handler) checkAndUploadToGemini(path string, chatbotid int, chatbotFile
 				Filepath:    path,
 				Fileuri:     fileURI,
 			}
-			err := h.apiFileStore.UpdateAPIFile(apiFile)
+			err := h.apiFileStore.UpdateAPIFile(ctx, apiFile)
 			if err != nil {
-				log.Printf("Error updating file in db: %v", err)
+				slog.ErrorContext(ctx, "Error updating file in db", "error", err)
 			}
-		}()
-		return fileURI
+		})
+		return fileURI, nil
 	}
 
-	log.Printf("File is still valid, using %s created at %s", apiFile.Fileuri, apiFile.Createddate)
-	return apiFile.Fileuri
+	metrics.FileCacheTotal.WithLabelValues(metrics.FileCacheHit).Inc()
+	slog.DebugContext(ctx, "File is still valid", "uri", apiFile.Fileuri, "created", apiFile.Createddate)
+	return apiFile.Fileuri, nil
 }
 
-func uploadToGemini(ctx context.Context, client *genai.Client, path string) string {
+func uploadToGemini(ctx context.Context, client *genai.Client, path string) (string, error) {
+	ctx, span := tracing.Start(ctx, "gemini.UploadFile", trace.WithAttributes(attribute.String("file.path", path)))
+	defer span.End()
+
 	file, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("Error opening file: %v", err)
+		tracing.RecordError(span, err)
+		return "", fmt.Errorf("error opening file: %w", err)
 	}
 	defer file.Close()
 
 	fileData, err := client.UploadFile(ctx, "", file, nil)
 	if err != nil {
-		log.Fatalf("Error uploading file: %v", err)
+		tracing.RecordError(span, err)
+		return "", fmt.Errorf("error uploading file: %w", err)
 	}
 
-	log.Printf("Uploaded file %s %s as: %s %s", path, fileData.DisplayName, fileData.Name, fileData.URI)
-	return fileData.URI
+	slog.InfoContext(ctx, "Uploaded file", "path", path, "display_name", fileData.DisplayName, "name", fileData.Name, "uri", fileData.URI)
+	return fileData.URI, nil
 }
@@ -0,0 +1,164 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestWaitBetweenChunksStopsWhenClientLeaves(t *testing.T) {
+	config.Envs.StreamChunkDelayMs = 10000
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	waitBetweenChunks(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected to return as soon as the context is done, waited %v", elapsed)
+	}
+}
+
+func TestGetContentSkipsEmptyInterruptedResponses(t *testing.T) {
+	content := getContentFromConversions([]types.Conversation{
+		{Role: "user", Chat: "hello"},
+		{Role: "model", Chat: "", Interrupted: true},
+		{Role: "user", Chat: "are you there?"},
+		{Role: "model", Chat: "partial answ", Interrupted: true},
+	}, nil)
+	// the message answered by the empty response is left out with it
+	expected := []string{"are you there?", "partial answ"}
+	if len(content) != len(expected) {
+		t.Fatalf("expected %d messages in the history, got %d", len(expected), len(content))
+	}
+	for i, text := range expected {
+		if content[i].Parts[0] != genai.Text(text) {
+			t.Errorf("expected message %d to be %q, got %v", i, text, content[i].Parts[0])
+		}
+	}
+	if content[0].Role != "user" || content[1].Role != "model" {
+		t.Errorf("expected the history to take turns between user and model, got %q and %q", content[0].Role, content[1].Role)
+	}
+}
+
+func TestCandidateParts(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     *genai.GenerateContentResponse
+		expected int
+	}{
+		{name: "no candidates", resp: &genai.GenerateContentResponse{PromptFeedback: &genai.PromptFeedback{BlockReason: genai.BlockReasonSafety}}},
+		{name: "candidate without content", resp: &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonSafety}}}},
+		{name: "text", resp: &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{Content: &genai.Content{Parts: []genai.Part{genai.Text("hi")}}}}}, expected: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if parts := candidateParts(test.resp); len(parts) != test.expected {
+				t.Errorf("expected %d parts, got %d", test.expected, len(parts))
+			}
+		})
+	}
+}
+
+func TestGetContentIncludesAttachments(t *testing.T) {
+	content := getContentFromConversions([]types.Conversation{
+		{Chatid: 1, Role: "user", Chat: "what is in this picture?"},
+		{Chatid: 2, Role: "model", Chat: "a cat"},
+	}, map[int][]genai.Part{
+		1: {genai.FileData{URI: "https://example.com/files/cat", MIMEType: "image/png"}},
+	})
+	if len(content) != 2 {
+		t.Fatalf("expected 2 messages in the history, got %d", len(content))
+	}
+	if len(content[0].Parts) != 2 {
+		t.Fatalf("expected the user message to keep its attachment, got %d parts", len(content[0].Parts))
+	}
+	if file, ok := content[0].Parts[1].(genai.FileData); !ok || file.MIMEType != "image/png" {
+		t.Errorf("expected the attachment as file data, got %#v", content[0].Parts[1])
+	}
+	if len(content[1].Parts) != 1 {
+		t.Errorf("expected the model message to have only text, got %d parts", len(content[1].Parts))
+	}
+}
+
+func TestAttachmentPartsReportsMissingFile(t *testing.T) {
+	handler := &Handler{apiFileStore: &mockAPIFileStore{}}
+	_, err := handler.attachmentParts(context.Background(), []types.Attachment{
+		{Attachmentid: 1, Chatbotid: 1, Filepath: filepath.Join(t.TempDir(), "missing.png"), Mimetype: "image/png"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for an attachment whose file is missing")
+	}
+}
+
+func TestSaveAttachmentsDiscardsEarlierFilesOnError(t *testing.T) {
+	previousFilesPath := config.Envs.FILES_PATH
+	config.Envs.FILES_PATH = t.TempDir() + "/"
+	t.Cleanup(func() { config.Envs.FILES_PATH = previousFilesPath })
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for _, name := range []string{"first.pdf", "second.pdf"} {
+		part, _ := form.CreateFormFile(attachmentsFormField, name)
+		part.Write([]byte("%PDF-1.4 " + name))
+	}
+	form.Close()
+	request := httptest.NewRequest("POST", "/", body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	if err := request.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second attachment cannot be stored
+	store := &mockAttachmentStore{failAfter: 1}
+	handler := &Handler{attachmentStore: store}
+	_, _, err := handler.saveAttachments(context.Background(), &types.Chatbot{Chatbotid: 1}, "conv", request.MultipartForm.File[attachmentsFormField])
+	if err == nil {
+		t.Fatal("expected an error saving the attachments")
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != 1 {
+		t.Errorf("expected the first attachment to be deleted, got %v", store.deleted)
+	}
+	files, _ := os.ReadDir(attachmentsDir(1))
+	if len(files) != 0 {
+		t.Errorf("expected no attachment files to be left, got %d", len(files))
+	}
+}
+
+type mockAttachmentStore struct {
+	types.AttachmentStoreInterface
+	failAfter int
+	created   []types.NewAttachment
+	deleted   []int
+}
+
+func (m *mockAttachmentStore) CreateAttachment(ctx context.Context, attachmentPayload types.NewAttachment) (int, error) {
+	if len(m.created) >= m.failAfter {
+		return 0, errors.New("database is locked")
+	}
+	m.created = append(m.created, attachmentPayload)
+	return len(m.created), nil
+}
+
+func (m *mockAttachmentStore) DeleteUnsavedAttachment(ctx context.Context, attachmentID int) error {
+	m.deleted = append(m.deleted, attachmentID)
+	return nil
+}
+
+type mockAPIFileStore struct {
+	types.APIFileStoreInterface
+}
+
+func (m *mockAPIFileStore) GetAPIFileByFilepath(ctx context.Context, filepath string) (*types.APIFile, error) {
+	return nil, sql.ErrNoRows
+}
@@ -1,8 +1,12 @@
 package conversation
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/retention"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
 )
@@ -15,8 +19,10 @@ func NewConversationStore(db *sql.DB) *ConversationStore {
 	return &ConversationStore{db: db}
 }
 
-func (s *ConversationStore) GetConversationsByID(conversationid string) ([]types.Conversation, error) {
-	rows, err := s.db.Query("SELECT * FROM conversations WHERE conversationid=? ORDER BY chatid", conversationid)
+func (s *ConversationStore) GetConversationsByID(ctx context.Context, conversationid string) ([]types.Conversation, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.GetConversationsByID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM conversations WHERE conversationid=? ORDER BY sequence, chatid", conversationid)
 	if err != nil {
 		return nil, err
 	}
@@ -34,8 +40,10 @@ func (s *ConversationStore) GetConversationsByID(conversationid string) ([]types
 	return conversations, nil
 }
 
-func (s *ConversationStore) GetConversationsByUserID(userID int) ([]types.Conversation, error) {
-	rows, err := s.db.Query("SELECT * FROM conversations WHERE userid=? ORDER BY chatid", userID)
+func (s *ConversationStore) GetConversationsByUserID(ctx context.Context, userID int) ([]types.Conversation, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.GetConversationsByUserID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM conversations WHERE userid=? ORDER BY chatid", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -53,12 +61,40 @@ func (s *ConversationStore) GetConversationsByUserID(userID int) ([]types.Conver
 	return conversations, nil
 }
 
-func (s *ConversationStore) CreateConversation(conversationPayload types.NewConversation) (int, error) {
+// GetConversationIDsByChatbotID returns the ids of the conversations with the chatbot, oldest first
+func (s *ConversationStore) GetConversationIDsByChatbotID(ctx context.Context, chatbotID int) ([]string, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.GetConversationIDsByChatbotID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT conversationid FROM conversations WHERE chatbotid=? GROUP BY conversationid ORDER BY MIN(chatid)", chatbotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversationIDs := []string{}
+	for rows.Next() {
+		var conversationID string
+		if err := rows.Scan(&conversationID); err != nil {
+			return nil, err
+		}
+		conversationIDs = append(conversationIDs, conversationID)
+	}
+	return conversationIDs, rows.Err()
+}
+
+func (s *ConversationStore) CreateConversation(ctx context.Context, conversationPayload types.NewConversation) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.CreateConversation")
+	defer endQuery()
 	currentTime, _ := utils.GetCurrentTime()
 	// temp_filepath := "tempfilepath.pdf"
+	if conversationPayload.Redactpii {
+		conversationPayload.Chat = retention.RedactPII(conversationPayload.Chat)
+	}
 
-	res, dberr := s.db.Exec(
-		"INSERT INTO conversations (conversationid, chatbotid, username, chatbotname, role, chat, createddate) VALUES (?, ?, ?, ?, ?, ?, ?)",
+	res, dberr := s.db.ExecContext(
+		ctx,
+		`INSERT INTO conversations (conversationid, chatbotid, username, chatbotname, role, chat, createddate, revisionid, sequence)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(MAX(sequence), 0) + 1 FROM conversations WHERE conversationid=?`,
 		conversationPayload.Conversationid,
 		conversationPayload.Chatbotid,
 		conversationPayload.Username,
@@ -66,6 +102,8 @@ func (s *ConversationStore) CreateConversation(conversationPayload types.NewConv
 		conversationPayload.Role,
 		conversationPayload.Chat,
 		currentTime,
+		conversationPayload.Revisionid,
+		conversationPayload.Conversationid,
 	)
 	if dberr != nil {
 		return 0, dberr
@@ -79,8 +117,229 @@ func (s *ConversationStore) CreateConversation(conversationPayload types.NewConv
 	return int(id), nil
 }
 
-func (s *ConversationStore) UpdateConversation(conversationPayload types.UpdateConversation) error {
-	_, dberr := s.db.Exec(
+// redactTurn returns the turn as it is saved, with personal data redacted from its messages and tool calls
+// when the turn asks for it
+func redactTurn(turn types.ConversationTurn) types.ConversationTurn {
+	if !turn.Redactpii {
+		return turn
+	}
+	turn.UserMessage = retention.RedactPII(turn.UserMessage)
+	turn.ModelResponse = retention.RedactPII(turn.ModelResponse)
+	toolCalls := make([]types.ToolCall, len(turn.ToolCalls))
+	for i, call := range turn.ToolCalls {
+		call.Arguments = retention.RedactPII(call.Arguments)
+		call.Result = retention.RedactPII(call.Result)
+		toolCalls[i] = call
+	}
+	turn.ToolCalls = toolCalls
+	return turn
+}
+
+// SaveConversationTurn saves the user message and the model response as the next two messages
+// of the turn's branch in one transaction, so a turn is never saved in half or interleaved with another.
+// The attachments of the turn are linked to the user message and a branch the turn starts is created
+// in the same transaction
+func (s *ConversationStore) SaveConversationTurn(ctx context.Context, turn types.ConversationTurn) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.SaveConversationTurn")
+	defer endQuery()
+	createddate := turn.Createddate
+	if createddate == "" {
+		createddate, _ = utils.GetCurrentTime()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	turn = redactTurn(turn)
+
+	if fork := turn.Fork; fork != nil {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO conversation_branches (conversationid, branch, parentbranch, forksequence, reason, createddate) VALUES (?, ?, ?, ?, ?, ?)",
+			turn.Conversationid,
+			turn.Branch,
+			fork.Parentbranch,
+			fork.Forksequence,
+			fork.Reason,
+			createddate,
+		)
+		if err != nil {
+			return err
+		}
+		// a summary of messages after the fork is not part of the new branch, it is redone from the branch's messages
+		if _, err := tx.ExecContext(ctx, "DELETE FROM conversation_summaries WHERE conversationid=? AND uptosequence>=?", turn.Conversationid, fork.Forksequence); err != nil {
+			return err
+		}
+	}
+
+	// a branch without messages of its own yet continues from the message before its fork
+	var lastSequence int
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT COALESCE(MAX(sequence), (SELECT forksequence - 1 FROM conversation_branches WHERE conversationid=? AND branch=?), 0)
+		FROM conversations WHERE conversationid=? AND branch=?`,
+		turn.Conversationid,
+		turn.Branch,
+		turn.Conversationid,
+		turn.Branch,
+	).Scan(&lastSequence)
+	if err != nil {
+		return err
+	}
+
+	type message struct {
+		role        string
+		chat        string
+		interrupted bool
+	}
+	messages := []message{}
+	if !turn.Regenerated {
+		messages = append(messages, message{role: "user", chat: turn.UserMessage})
+	}
+	messages = append(messages, message{role: "model", chat: turn.ModelResponse, interrupted: turn.Interrupted})
+	for i, message := range messages {
+		res, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO conversations (conversationid, chatbotid, username, chatbotname, role, chat, createddate, revisionid, sequence, interrupted, branch) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			turn.Conversationid,
+			turn.Chatbotid,
+			turn.Username,
+			turn.Chatbotname,
+			message.role,
+			message.chat,
+			createddate,
+			turn.Revisionid,
+			lastSequence+i+1,
+			message.interrupted,
+			turn.Branch,
+		)
+		if err != nil {
+			return err
+		}
+
+		// the files sent with the user message belong to it from now on
+		if message.role == "user" && len(turn.Attachmentids) > 0 {
+			chatID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			for _, attachmentID := range turn.Attachmentids {
+				_, err := tx.ExecContext(ctx, "UPDATE attachments SET chatid=? WHERE attachmentid=? AND conversationid=?", chatID, attachmentID, turn.Conversationid)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// the tools the model called belong to its response
+		if message.role == "model" && len(turn.ToolCalls) > 0 {
+			chatID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			for _, call := range turn.ToolCalls {
+				_, err := tx.ExecContext(
+					ctx,
+					"INSERT INTO tool_calls (conversationid, chatbotid, chatid, name, arguments, result, error, durationms, createddate) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+					turn.Conversationid,
+					turn.Chatbotid,
+					chatID,
+					call.Name,
+					call.Arguments,
+					call.Result,
+					call.Error,
+					call.Durationms,
+					call.Createddate,
+				)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetConversationBranches returns the branches of the conversation in the order they were created
+func (s *ConversationStore) GetConversationBranches(ctx context.Context, conversationID string) ([]types.ConversationBranch, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.GetConversationBranches")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT * FROM conversation_branches WHERE conversationid=? ORDER BY branch", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	branches := []types.ConversationBranch{}
+	for rows.Next() {
+		branch := types.ConversationBranch{}
+		err := rows.Scan(
+			&branch.Conversationid,
+			&branch.Branch,
+			&branch.Parentbranch,
+			&branch.Forksequence,
+			&branch.Reason,
+			&branch.Createddate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, branch)
+	}
+	return branches, rows.Err()
+}
+
+// GetConversationSummary returns the summary of the older messages of the conversation, or nil if it has none
+func (s *ConversationStore) GetConversationSummary(ctx context.Context, conversationID string) (*types.ConversationSummary, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.GetConversationSummary")
+	defer endQuery()
+	summary := new(types.ConversationSummary)
+	err := s.db.QueryRowContext(ctx, "SELECT * FROM conversation_summaries WHERE conversationid=?", conversationID).Scan(
+		&summary.Conversationid,
+		&summary.Chatbotid,
+		&summary.Summary,
+		&summary.Uptosequence,
+		&summary.Updateddate,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// SaveConversationSummary replaces the summary of the conversation. A summary never moves backwards,
+// so a slower request that summarised fewer messages does not overwrite a newer summary
+func (s *ConversationStore) SaveConversationSummary(ctx context.Context, summary types.ConversationSummary) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.SaveConversationSummary")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO conversation_summaries (conversationid, chatbotid, summary, uptosequence, updateddate) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(conversationid) DO UPDATE SET summary=excluded.summary, uptosequence=excluded.uptosequence, updateddate=excluded.updateddate
+		WHERE excluded.uptosequence > conversation_summaries.uptosequence`,
+		summary.Conversationid,
+		summary.Chatbotid,
+		summary.Summary,
+		summary.Uptosequence,
+		currentTime,
+	)
+	return err
+}
+
+func (s *ConversationStore) UpdateConversation(ctx context.Context, conversationPayload types.UpdateConversation) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.UpdateConversation")
+	defer endQuery()
+	_, dberr := s.db.ExecContext(
+		ctx,
 		"UPDATE conversations SET chatbotid=?, username=?, chatbotname=?, role=?, chat=?, createddate=? WHERE conversationid=?",
 		conversationPayload.Chatbotid,
 		conversationPayload.Username,
@@ -93,8 +352,10 @@ func (s *ConversationStore) UpdateConversation(conversationPayload types.UpdateC
 	return dberr
 }
 
-func (s *ConversationStore) DeleteConversation(conversationID int) error {
-	_, dberr := s.db.Exec("DELETE FROM conversations WHERE conversationid=?", conversationID)
+func (s *ConversationStore) DeleteConversation(ctx context.Context, conversationID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "ConversationStore.DeleteConversation")
+	defer endQuery()
+	_, dberr := s.db.ExecContext(ctx, "DELETE FROM conversations WHERE conversationid=?", conversationID)
 	return dberr
 }
 
@@ -110,6 +371,10 @@ func scanRowsIntoConversation(rows *sql.Rows) (*types.Conversation, error) {
 		&conversation.Role,
 		&conversation.Chat,
 		&conversation.Createddate,
+		&conversation.Revisionid,
+		&conversation.Sequence,
+		&conversation.Interrupted,
+		&conversation.Branch,
 	)
 	if err != nil {
 		return nil, err
@@ -128,6 +393,10 @@ func scanRowIntoConversation(row *sql.Row) (*types.Conversation, error) {
 		&conversation.Role,
 		&conversation.Chat,
 		&conversation.Createddate,
+		&conversation.Revisionid,
+		&conversation.Sequence,
+		&conversation.Interrupted,
+		&conversation.Branch,
 	)
 	if err != nil {
 		return nil, err
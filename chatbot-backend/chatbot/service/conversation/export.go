@@ -0,0 +1,199 @@
+package conversation
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/service/workspace"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/transcript"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+)
+
+// Formats all the conversations of a chatbot can be exported in
+const (
+	bulkExportJSONL = "jsonl"
+	bulkExportZip   = "zip"
+)
+
+// ExportConversation downloads the transcript of a branch of the conversation, the active one by default,
+// as Markdown, JSON or PDF
+func (h *Handler) ExportConversation(w http.ResponseWriter, r *http.Request) {
+	chatbot, ok := h.getChatbotForVisitor(w, r)
+	if !ok {
+		return
+	}
+	conversationID := r.PathValue("conversationid")
+	logging.AddFields(r.Context(), "conversationid", conversationID)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = transcript.FormatMarkdown
+	}
+	if format != transcript.FormatMarkdown && format != transcript.FormatJSON && format != transcript.FormatPDF {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid format, expected markdown, json or pdf"))
+		return
+	}
+
+	messages, branch, _, ok := h.getBranchForRequest(w, r, chatbot, conversationID)
+	if !ok {
+		return
+	}
+	if len(messages) == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("conversation not found"))
+		return
+	}
+
+	currentTime, _ := utils.GetCurrentTime()
+	content, contentType, extension, err := transcript.Render(transcript.New(*chatbot, conversationID, branch, messages, currentTime), format)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering conversation transcript", "format", format, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", attachmentDisposition(chatbot.Chatbotname+"-"+conversationID+"."+extension))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(content); err != nil {
+		slog.WarnContext(r.Context(), "Error writing conversation transcript", "error", err)
+	}
+}
+
+// ExportChatbotConversations streams the active branch of every conversation with the chatbot to its owner or
+// workspace members, as JSON lines of transcripts or a zip with the JSON and Markdown transcript of each
+func (h *Handler) ExportChatbotConversations(w http.ResponseWriter, r *http.Request) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return
+	}
+	chatbotID, err := strconv.Atoi(r.PathValue("chatbotid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid chatbot ID"))
+		return
+	}
+	logging.AddFields(r.Context(), "chatbotid", chatbotID)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = bulkExportJSONL
+	}
+	if format != bulkExportJSONL && format != bulkExportZip {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid format, expected jsonl or zip"))
+		return
+	}
+
+	chatbot, err := h.chatbotStore.GetChatbotsByID(r.Context(), chatbotID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Error getting chatbot", "error", err)
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return
+	}
+	allowed, err := workspace.CanAccessChatbot(r.Context(), h.workspaceStore, username, chatbot, types.WorkspaceRoleViewer)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error checking access to chatbot", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	conversationIDs, err := h.conversationStore.GetConversationIDsByChatbotID(r.Context(), chatbot.Chatbotid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting chatbot conversations", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the response has started once the first transcript is written, so later errors can only end it early
+	currentTime, _ := utils.GetCurrentTime()
+	filename := chatbot.Chatbotname + "-conversations." + format
+	w.Header().Set("Content-Disposition", attachmentDisposition(filename))
+	switch format {
+	case bulkExportJSONL:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		err = h.eachTranscript(r, chatbot, conversationIDs, currentTime, func(conversation types.ConversationTranscript) error {
+			return encoder.Encode(conversation)
+		})
+
+	case bulkExportZip:
+		w.Header().Set("Content-Type", "application/zip")
+		w.WriteHeader(http.StatusOK)
+		archive := zip.NewWriter(w)
+		err = h.eachTranscript(r, chatbot, conversationIDs, currentTime, func(conversation types.ConversationTranscript) error {
+			content, err := transcript.JSON(conversation)
+			if err != nil {
+				return err
+			}
+			if err := writeZipFile(archive, conversation.Conversationid+".json", content); err != nil {
+				return err
+			}
+			return writeZipFile(archive, conversation.Conversationid+".md", transcript.Markdown(conversation))
+		})
+		if closeErr := archive.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error exporting chatbot conversations", "format", format, "error", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Exported chatbot conversations", "format", format, "conversations", len(conversationIDs))
+}
+
+// eachTranscript calls write with the transcript of the active branch of each conversation, skipping
+// conversations without messages with the chatbot
+func (h *Handler) eachTranscript(r *http.Request, chatbot *types.Chatbot, conversationIDs []string, exportedDate string, write func(types.ConversationTranscript) error) error {
+	for _, conversationID := range conversationIDs {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		conversations, branches, err := h.loadConversation(r.Context(), conversationID)
+		if err != nil {
+			return fmt.Errorf("conversation %s: %w", conversationID, err)
+		}
+		branch := activeBranch(branches)
+		messages := chatbotMessages(branchMessages(conversations, branches, branch), chatbot.Chatbotid)
+		if len(messages) == 0 {
+			continue
+		}
+		if err := write(transcript.New(*chatbot, conversationID, branch, messages, exportedDate)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeZipFile(archive *zip.Writer, name string, content []byte) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	return err
+}
+
+// attachmentDisposition makes the browser download the response as filename, keeping only characters
+// that are safe in the header
+func attachmentDisposition(filename string) string {
+	safe := strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_' {
+			return c
+		}
+		return '_'
+	}, filename)
+	return fmt.Sprintf("attachment; filename=\"%s\"", safe)
+}
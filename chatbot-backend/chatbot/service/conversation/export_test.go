@@ -0,0 +1,119 @@
+package conversation
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func newExportHandler() *Handler {
+	return &Handler{
+		chatbotStore: &mockChatbotStore{chatbot: &types.Chatbot{Chatbotid: 1, Username: "owner", Chatbotname: "bot", Sharemode: types.ShareModePublic}},
+		conversationStore: &mockConversationStore{messages: []types.Conversation{
+			{Chatid: 1, Conversationid: "conv", Chatbotid: 1, Sequence: 1, Role: "user", Chat: "hi"},
+			{Chatid: 2, Conversationid: "conv", Chatbotid: 1, Sequence: 2, Role: "model", Chat: "hello"},
+			{Chatid: 3, Conversationid: "later", Chatbotid: 1, Sequence: 1, Role: "user", Chat: "bye"},
+			{Chatid: 4, Conversationid: "other", Chatbotid: 2, Sequence: 1, Role: "user", Chat: "not for bot"},
+		}},
+		workspaceStore: &mockWorkspaceStore{},
+	}
+}
+
+func TestExportConversation(t *testing.T) {
+	router := http.NewServeMux()
+	router.HandleFunc("GET /chat/export/{username}/{chatbotName}/{conversationid}", newExportHandler().ExportConversation)
+
+	tests := []struct {
+		name        string
+		url         string
+		status      int
+		contentType string
+		filename    string
+	}{
+		{name: "markdown by default", url: "/chat/export/owner/bot/conv", status: http.StatusOK, contentType: "text/markdown; charset=utf-8", filename: "bot-conv.md"},
+		{name: "json", url: "/chat/export/owner/bot/conv?format=json", status: http.StatusOK, contentType: "application/json", filename: "bot-conv.json"},
+		{name: "pdf", url: "/chat/export/owner/bot/conv?format=pdf", status: http.StatusOK, contentType: "application/pdf", filename: "bot-conv.pdf"},
+		{name: "unknown format", url: "/chat/export/owner/bot/conv?format=docx", status: http.StatusBadRequest},
+		{name: "conversation of another chatbot", url: "/chat/export/owner/bot/other", status: http.StatusNotFound},
+		{name: "branch that does not exist", url: "/chat/export/owner/bot/conv?branch=1", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.contentType {
+				t.Errorf("expected content type %s, got %s", tt.contentType, contentType)
+			}
+			if disposition := rr.Header().Get("Content-Disposition"); disposition != `attachment; filename="`+tt.filename+`"` {
+				t.Errorf("unexpected content disposition %s", disposition)
+			}
+		})
+	}
+}
+
+func TestExportChatbotConversations(t *testing.T) {
+	router := http.NewServeMux()
+	router.HandleFunc("GET /export/{chatbotid}", newExportHandler().ExportChatbotConversations)
+	export := func(username string, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, username))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := export("stranger", "/export/1"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected other users to be refused, got %d", rr.Code)
+	}
+
+	rr := export("owner", "/export/1")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected response %d %v", rr.Code, rr.Header())
+	}
+	conversationIDs := []string{}
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var conversation types.ConversationTranscript
+		if err := json.Unmarshal(scanner.Bytes(), &conversation); err != nil {
+			t.Fatal(err)
+		}
+		conversationIDs = append(conversationIDs, conversation.Conversationid)
+	}
+	if strings.Join(conversationIDs, ",") != "conv,later" {
+		t.Errorf("expected a line for each conversation with the chatbot, got %v", conversationIDs)
+	}
+
+	rr = export("owner", "/export/1?format=zip")
+	archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	if strings.Join(names, ",") != "conv.json,conv.md,later.json,later.md" {
+		t.Errorf("unexpected files %v", names)
+	}
+	file, _ := archive.Open("later.md")
+	content, _ := io.ReadAll(file)
+	if !strings.Contains(string(content), "bye") {
+		t.Errorf("unexpected transcript %s", content)
+	}
+}
@@ -0,0 +1,174 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrMessageNotFound = errors.New("message not found")
+
+// GetConversationMessages returns the saved messages of a conversation with the chatbot, so visitors
+// know the chatid of the responses they want to rate or the messages they want to edit. The active branch
+// is returned unless another one is selected with the branch query parameter
+func (h *Handler) GetConversationMessages(w http.ResponseWriter, r *http.Request) {
+	chatbot, ok := h.getChatbotForVisitor(w, r)
+	if !ok {
+		return
+	}
+	conversationID := r.PathValue("conversationid")
+	logging.AddFields(r.Context(), "conversationid", conversationID)
+
+	messages, branch, branches, ok := h.getBranchForRequest(w, r, chatbot, conversationID)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"messages": messages,
+		"branch":   branch,
+		"branches": branches,
+	})
+}
+
+// RateMessage saves a visitor's thumbs up or down, with an optional comment, on a response in their conversation.
+// Rating the same response again replaces the earlier rating
+func (h *Handler) RateMessage(w http.ResponseWriter, r *http.Request) {
+	chatbot, ok := h.getChatbotForVisitor(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.MessageFeedbackPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+	logging.AddFields(r.Context(), "conversationid", payload.Conversationid, "chatid", payload.Chatid)
+
+	messages, err := h.conversationMessages(r, chatbot, payload.Conversationid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting conversation messages", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var rated *types.Conversation
+	for i := range messages {
+		if messages[i].Chatid == payload.Chatid && messages[i].Role == "model" {
+			rated = &messages[i]
+		}
+	}
+	if rated == nil {
+		utils.WriteError(w, http.StatusNotFound, ErrMessageNotFound)
+		return
+	}
+	questionChatid, err := h.questionChatid(r.Context(), messages, *rated)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting conversation branches", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	feedback := types.MessageFeedback{
+		Chatid:         rated.Chatid,
+		Questionchatid: questionChatid,
+		Conversationid: rated.Conversationid,
+		Chatbotid:      chatbot.Chatbotid,
+		Revisionid:     rated.Revisionid,
+		Rating:         payload.Rating,
+		Comment:        payload.Comment,
+		Username:       auth.GetUsernameFromContext(r.Context()),
+	}
+	if err := h.feedbackStore.SaveFeedback(r.Context(), feedback); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving message feedback", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	metrics.MessageFeedbackTotal.WithLabelValues(payload.Rating).Inc()
+	slog.InfoContext(r.Context(), "Saved message feedback", "rating", payload.Rating)
+
+	h.webhooks.Notify(r.Context(), chatbot.Chatbotid, types.WebhookEventFeedbackSubmitted, map[string]interface{}{
+		"conversationid": rated.Conversationid,
+		"chatid":         rated.Chatid,
+		"chatbotname":    chatbot.Chatbotname,
+		"rating":         payload.Rating,
+		"comment":        payload.Comment,
+		"modelresponse":  rated.Chat,
+	})
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Feedback saved successfully",
+	})
+}
+
+// questionChatid returns the chatid of the user message the response answered, which is the message before it
+// on the response's branch and may be on a parent branch after a regenerate. 0 means there is no such message
+func (h *Handler) questionChatid(ctx context.Context, messages []types.Conversation, response types.Conversation) (int, error) {
+	branches, err := h.conversationStore.GetConversationBranches(ctx, response.Conversationid)
+	if err != nil {
+		return 0, err
+	}
+	branch := branchMessages(messages, branches, response.Branch)
+	index := slices.IndexFunc(branch, func(message types.Conversation) bool { return message.Chatid == response.Chatid })
+	if index < 1 || branch[index-1].Role != "user" {
+		return 0, nil
+	}
+	return branch[index-1].Chatid, nil
+}
+
+// getChatbotForVisitor loads the chatbot in the path if the visitor may chat with it. The error response is
+// already written when ok is false
+func (h *Handler) getChatbotForVisitor(w http.ResponseWriter, r *http.Request) (*types.Chatbot, bool) {
+	username := r.PathValue("username")
+	chatbotName := r.PathValue("chatbotName")
+	if username == "" || chatbotName == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid parameters"))
+		return nil, false
+	}
+
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
+	if err != nil {
+		if errors.Is(err, ErrChatbotNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+		} else {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return nil, false
+	}
+	if _, status, err := h.checkChatbotAccess(r, chatbot); err != nil {
+		utils.WriteError(w, status, err)
+		return nil, false
+	}
+	logging.AddFields(r.Context(), "chatbotid", chatbot.Chatbotid)
+	return chatbot, true
+}
+
+// conversationMessages returns the messages of every branch of the conversation that belong to the chatbot
+func (h *Handler) conversationMessages(r *http.Request, chatbot *types.Chatbot, conversationID string) ([]types.Conversation, error) {
+	conversations, err := h.conversationStore.GetConversationsByID(r.Context(), conversationID)
+	if err != nil {
+		return nil, err
+	}
+	messages := []types.Conversation{}
+	for _, conversation := range conversations {
+		if conversation.Chatbotid == chatbot.Chatbotid {
+			messages = append(messages, conversation)
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,73 @@
+package conversation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+type mockFeedbackStore struct {
+	types.MessageFeedbackStoreInterface
+	saved []types.MessageFeedback
+}
+
+func (m *mockFeedbackStore) SaveFeedback(ctx context.Context, feedback types.MessageFeedback) error {
+	m.saved = append(m.saved, feedback)
+	return nil
+}
+
+func TestRateMessage(t *testing.T) {
+	feedbackStore := &mockFeedbackStore{}
+	handler := &Handler{
+		chatbotStore: &mockChatbotStore{chatbot: &types.Chatbot{Chatbotid: 1, Username: "owner", Chatbotname: "bot", Sharemode: types.ShareModePublic}},
+		conversationStore: &mockConversationStore{messages: []types.Conversation{
+			{Chatid: 10, Conversationid: "conv", Chatbotid: 1, Role: "user", Chat: "hi", Sequence: 1},
+			{Chatid: 11, Conversationid: "conv", Chatbotid: 1, Role: "model", Chat: "hello", Revisionid: 3, Sequence: 2},
+			{Chatid: 12, Conversationid: "other", Chatbotid: 2, Role: "model", Chat: "hello"},
+			// a regenerated response on branch 1 answers the question on branch 0
+			{Chatid: 13, Conversationid: "conv", Chatbotid: 1, Role: "model", Chat: "hi there", Sequence: 2, Branch: 1},
+		}, branches: []types.ConversationBranch{
+			{Conversationid: "conv", Branch: 1, Parentbranch: 0, Forksequence: 2, Reason: types.ConversationBranchRegenerate},
+		}},
+		feedbackStore: feedbackStore,
+	}
+	router := http.NewServeMux()
+	router.HandleFunc("POST /chat/feedback/{username}/{chatbotName}", handler.RateMessage)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "rates a response", body: `{"conversationid":"conv","chatid":11,"rating":"down","comment":"wrong hours"}`, status: http.StatusOK},
+		{name: "rates a regenerated response", body: `{"conversationid":"conv","chatid":13,"rating":"up"}`, status: http.StatusOK},
+		{name: "user messages cannot be rated", body: `{"conversationid":"conv","chatid":10,"rating":"up"}`, status: http.StatusNotFound},
+		{name: "messages of other chatbots cannot be rated", body: `{"conversationid":"other","chatid":12,"rating":"up"}`, status: http.StatusNotFound},
+		{name: "message must be in the conversation", body: `{"conversationid":"other","chatid":11,"rating":"up"}`, status: http.StatusNotFound},
+		{name: "invalid rating", body: `{"conversationid":"conv","chatid":11,"rating":"meh"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/chat/feedback/owner/bot", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if len(feedbackStore.saved) != 2 {
+		t.Fatalf("expected two ratings to be saved, got %d", len(feedbackStore.saved))
+	}
+	if saved := feedbackStore.saved[0]; saved.Chatid != 11 || saved.Questionchatid != 10 || saved.Revisionid != 3 || saved.Rating != types.FeedbackRatingDown || saved.Comment != "wrong hours" {
+		t.Errorf("unexpected feedback %+v", saved)
+	}
+	if saved := feedbackStore.saved[1]; saved.Chatid != 13 || saved.Questionchatid != 10 {
+		t.Errorf("expected the regenerated response to answer message 10, got %+v", saved)
+	}
+}
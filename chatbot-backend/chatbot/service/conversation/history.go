@@ -0,0 +1,204 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/tracing"
+	"github.com/google/generative-ai-go/genai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	charsPerToken    = 4   // rough average for English text, close enough to decide what to leave out
+	attachmentTokens = 300 // rough cost of an image or a short PDF page
+)
+
+// historyPlan is the part of a conversation sent to the model with the next message
+type historyPlan struct {
+	summary   *types.ConversationSummary // replaces the messages before messages, nil if there is none
+	messages  []types.Conversation
+	summarise []types.Conversation // older messages to fold into the summary before the history is sent
+}
+
+// estimateTokens estimates the tokens the model counts for text without calling the API
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+func messageTokens(conversation types.Conversation, attachmentsByChat map[int][]types.Attachment) int {
+	return estimateTokens(conversation.Chat) + attachmentTokens*len(attachmentsByChat[conversation.Chatid])
+}
+
+// historyTokenLimit returns the estimated tokens of history the chatbot sends with each message
+func historyTokenLimit(chatbot *types.Chatbot) int {
+	if chatbot.Historytokenlimit > 0 {
+		return chatbot.Historytokenlimit
+	}
+	return int(config.Envs.HistoryTokenLimit)
+}
+
+// planHistory decides which messages of the conversation are sent to the model under the chatbot's history strategy.
+// Chatbots without a strategy use the sliding window
+func planHistory(conversations []types.Conversation, summary *types.ConversationSummary, strategy string, tokenLimit int, attachmentsByChat map[int][]types.Attachment) historyPlan {
+	switch strategy {
+	case types.HistoryStrategyFull:
+		return historyPlan{messages: conversations}
+	case types.HistoryStrategySummary:
+		summaryTokens := 0
+		if summary != nil {
+			summaryTokens = estimateTokens(summary.Summary)
+			conversations = messagesAfter(conversations, summary.Uptosequence)
+		}
+		total := summaryTokens
+		for _, conversation := range conversations {
+			total += messageTokens(conversation, attachmentsByChat)
+		}
+		if total <= tokenLimit {
+			return historyPlan{summary: summary, messages: conversations}
+		}
+		// keep only half the limit so the summary is not redone with every message
+		start := windowStart(conversations, tokenLimit/2, attachmentsByChat)
+		return historyPlan{summary: summary, messages: conversations[start:], summarise: conversations[:start]}
+	default:
+		start := windowStart(conversations, tokenLimit, attachmentsByChat)
+		return historyPlan{messages: conversations[start:]}
+	}
+}
+
+// windowStart returns the index of the oldest message to keep so that the newest messages fit in tokenLimit.
+// The kept messages always start with a user message, as the model expects the history to start with one
+func windowStart(conversations []types.Conversation, tokenLimit int, attachmentsByChat map[int][]types.Attachment) int {
+	start := len(conversations)
+	total := 0
+	for i := len(conversations) - 1; i >= 0; i-- {
+		total += messageTokens(conversations[i], attachmentsByChat)
+		if total > tokenLimit {
+			break
+		}
+		start = i
+	}
+	for start < len(conversations) && conversations[start].Role != "user" {
+		start++
+	}
+	return start
+}
+
+// messagesAfter returns the messages after the given sequence number
+func messagesAfter(conversations []types.Conversation, sequence int) []types.Conversation {
+	for i, conversation := range conversations {
+		if conversation.Sequence > sequence {
+			return conversations[i:]
+		}
+	}
+	return []types.Conversation{}
+}
+
+// getSummaryContent turns the summary into history, acknowledged by the model so the conversation still alternates
+func getSummaryContent(summary *types.ConversationSummary) []*genai.Content {
+	if summary == nil || summary.Summary == "" {
+		return []*genai.Content{}
+	}
+	return []*genai.Content{
+		{
+			Role:  "user",
+			Parts: []genai.Part{genai.Text("Here is a summary of the earlier part of our conversation, which is no longer shown:\n" + summary.Summary)},
+		},
+		{
+			Role:  "model",
+			Parts: []genai.Part{genai.Text("Understood, I will continue the conversation with that in mind.")},
+		},
+	}
+}
+
+// updateSummary folds the messages in plan.summarise into the conversation summary and saves it.
+// This holds up the message that crossed the token limit, but only happens about once every half a limit of messages.
+// If summarising fails, the older messages are left out like the sliding window would
+func (h *Handler) updateSummary(ctx context.Context, chatbot *types.Chatbot, conversationID string, plan historyPlan, attachmentsByChat map[int][]types.Attachment) historyPlan {
+	previous := ""
+	if plan.summary != nil {
+		previous = plan.summary.Summary
+	}
+	text, err := h.summarise(ctx, previous, plan.summarise, attachmentsByChat)
+	if err != nil {
+		slog.WarnContext(ctx, "Error summarising conversation, leaving out the older messages", "messages", len(plan.summarise), "error", err)
+		return historyPlan{summary: plan.summary, messages: plan.messages}
+	}
+
+	summary := types.ConversationSummary{
+		Conversationid: conversationID,
+		Chatbotid:      chatbot.Chatbotid,
+		Summary:        text,
+		Uptosequence:   plan.summarise[len(plan.summarise)-1].Sequence,
+	}
+	if err := h.conversationStore.SaveConversationSummary(ctx, summary); err != nil {
+		// the summary is still used for this message and made again with the next one
+		slog.ErrorContext(ctx, "Error saving conversation summary", "error", err)
+	}
+	slog.InfoContext(ctx, "Summarised conversation", "messages", len(plan.summarise), "uptosequence", summary.Uptosequence)
+	return historyPlan{summary: &summary, messages: plan.messages}
+}
+
+// summarise asks the model for a summary of the messages that continues the previous summary
+func (h *Handler) summarise(ctx context.Context, previous string, messages []types.Conversation, attachmentsByChat map[int][]types.Attachment) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("Summary of the conversation before these messages:\n" + previous + "\n\n")
+	}
+	transcript.WriteString("Messages:\n")
+	for _, conversation := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n", conversation.Role, conversation.Chat)
+		for _, attachment := range attachmentsByChat[conversation.Chatid] {
+			fmt.Fprintf(&transcript, "(%s attached %s)\n", conversation.Role, attachment.Filename)
+		}
+	}
+
+	modelName := config.Envs.MODEL_NAME
+	genaiModel := h.genaiClient.GenerativeModel(modelName)
+	genaiModel.SetTemperature(0.2)
+	genaiModel.SetMaxOutputTokens(1024)
+	genaiModel.ResponseMIMEType = "text/plain"
+	genaiModel.SystemInstruction = &genai.Content{
+		Parts: []genai.Part{genai.Text("You summarise conversations between a user and a chatbot so the chatbot can carry on without the full messages. " +
+			"Keep the facts, names, numbers, decisions, preferences and open questions the chatbot needs, and drop greetings and repetition. " +
+			"Reply with the summary only, in a few short paragraphs.")},
+	}
+
+	callStart := time.Now()
+	ctx, span := tracing.Start(ctx, "gemini.Summarise", trace.WithAttributes(
+		attribute.String("gen_ai.request.model", modelName),
+		attribute.Int("messages", len(messages)),
+	))
+	defer span.End()
+	resp, err := genaiModel.GenerateContent(ctx, genai.Text(transcript.String()))
+	if err != nil {
+		tracing.RecordError(span, err)
+		metrics.LLMErrorsTotal.WithLabelValues(modelName, "summarise").Inc()
+		return "", err
+	}
+	metrics.LLMRequestDuration.WithLabelValues(modelName, "summarise").Observe(time.Since(callStart).Seconds())
+	if resp.UsageMetadata != nil {
+		metrics.ObserveLLMTokens(modelName, resp.UsageMetadata.PromptTokenCount, resp.UsageMetadata.CandidatesTokenCount)
+	}
+
+	summary := ""
+	for _, part := range candidateParts(resp) {
+		if text, ok := part.(genai.Text); ok {
+			summary += string(text)
+		}
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", errors.New("model returned an empty summary")
+	}
+	return summary, nil
+}
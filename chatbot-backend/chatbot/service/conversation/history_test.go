@@ -0,0 +1,105 @@
+package conversation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+// turns returns n turns of a conversation, every message about 25 tokens long
+func turns(n int) []types.Conversation {
+	conversations := []types.Conversation{}
+	for i := 0; i < n; i++ {
+		for _, role := range []string{"user", "model"} {
+			conversations = append(conversations, types.Conversation{
+				Chatid:   len(conversations) + 1,
+				Role:     role,
+				Chat:     strings.Repeat("word ", 20),
+				Sequence: len(conversations) + 1,
+			})
+		}
+	}
+	return conversations
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if tokens := estimateTokens(""); tokens != 0 {
+		t.Errorf("expected no tokens for empty text, got %d", tokens)
+	}
+	if tokens := estimateTokens("hello"); tokens != 2 {
+		t.Errorf("expected 2 tokens for 5 characters, got %d", tokens)
+	}
+	// characters are counted rather than bytes
+	if tokens := estimateTokens("你好你好"); tokens != 1 {
+		t.Errorf("expected 1 token for 4 characters, got %d", tokens)
+	}
+}
+
+func TestPlanHistoryFullSendsEverything(t *testing.T) {
+	conversations := turns(10)
+	plan := planHistory(conversations, nil, types.HistoryStrategyFull, 10, nil)
+	if len(plan.messages) != len(conversations) || len(plan.summarise) != 0 {
+		t.Errorf("expected all %d messages, got %d", len(conversations), len(plan.messages))
+	}
+}
+
+func TestPlanHistoryWindowKeepsNewestMessages(t *testing.T) {
+	conversations := turns(10)
+	// 3 messages fit, but the window has to start with a user message
+	plan := planHistory(conversations, nil, types.HistoryStrategyWindow, 75, nil)
+	if len(plan.messages) != 2 {
+		t.Fatalf("expected the last turn, got %d messages", len(plan.messages))
+	}
+	if plan.messages[0].Role != "user" || plan.messages[1].Chatid != 20 {
+		t.Errorf("expected the window to be the newest turn, got %+v", plan.messages)
+	}
+
+	// chatbots created before history strategies use the window
+	if plan := planHistory(conversations, nil, "", 75, nil); len(plan.messages) != 2 {
+		t.Errorf("expected the window by default, got %d messages", len(plan.messages))
+	}
+}
+
+func TestPlanHistoryWindowCountsAttachments(t *testing.T) {
+	conversations := turns(2)
+	attachments := map[int][]types.Attachment{3: {{Attachmentid: 1, Chatid: 3}}}
+	plan := planHistory(conversations, nil, types.HistoryStrategyWindow, 200, attachments)
+	if len(plan.messages) != 0 {
+		t.Errorf("expected the attachment to push the last turn over the limit, got %d messages", len(plan.messages))
+	}
+}
+
+func TestPlanHistorySummaryWithinLimit(t *testing.T) {
+	conversations := turns(4)
+	summary := &types.ConversationSummary{Summary: "The user asked about cats.", Uptosequence: 4}
+	plan := planHistory(conversations, summary, types.HistoryStrategySummary, 1000, nil)
+	if plan.summary != summary || len(plan.summarise) != 0 {
+		t.Fatalf("expected the saved summary without summarising, got %+v", plan)
+	}
+	if len(plan.messages) != 4 || plan.messages[0].Sequence != 5 {
+		t.Errorf("expected the messages after the summary, got %+v", plan.messages)
+	}
+}
+
+func TestPlanHistorySummarisesOlderMessages(t *testing.T) {
+	conversations := turns(10)
+	plan := planHistory(conversations, nil, types.HistoryStrategySummary, 200, nil)
+	// half the limit keeps the last two turns
+	if len(plan.messages) != 4 || plan.messages[0].Sequence != 17 {
+		t.Fatalf("expected the newest 4 messages to be kept, got %d", len(plan.messages))
+	}
+	if len(plan.summarise) != 16 || plan.summarise[len(plan.summarise)-1].Sequence != 16 {
+		t.Errorf("expected the older 16 messages to be summarised, got %d", len(plan.summarise))
+	}
+}
+
+func TestGetSummaryContentAlternatesRoles(t *testing.T) {
+	if content := getSummaryContent(nil); len(content) != 0 {
+		t.Fatalf("expected no content without a summary, got %d", len(content))
+	}
+	content := getSummaryContent(&types.ConversationSummary{Summary: "The user asked about cats."})
+	if len(content) != 2 || content[0].Role != "user" || content[1].Role != "model" {
+		t.Fatalf("expected the summary followed by the model's acknowledgement, got %+v", content)
+	}
+}
@@ -0,0 +1,58 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/moderation"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+var ErrMessageBlocked = errors.New("message blocked by the content rules of this chatbot")
+
+// moderateInput checks a visitor message before anything of it is saved or sent to the model, recording it
+// for the owner if it is flagged or blocked. ErrMessageBlocked is returned for messages that must not be answered
+func (h *Handler) moderateInput(ctx context.Context, chatbot *types.Chatbot, conversationID string, message string) error {
+	filter, err := h.moderator.Filter(ctx, chatbot)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting moderation rules", "error", err)
+		return err
+	}
+	decision := filter.Check(ctx, types.ModerationStageInput, message)
+	filter.Record(ctx, conversationID, types.ModerationStageInput, decision, message)
+	if decision.Blocked() {
+		return ErrMessageBlocked
+	}
+	return nil
+}
+
+// checkInput is moderateInput for handlers, the error response is already written when ok is false
+func (h *Handler) checkInput(w http.ResponseWriter, r *http.Request, chatbot *types.Chatbot, conversationID string, message string) (ok bool) {
+	err := h.moderateInput(r.Context(), chatbot, conversationID, message)
+	if errors.Is(err, ErrMessageBlocked) {
+		utils.WriteError(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+// moderateResponse checks a finished model response against the rules and the classifier, recording it for the owner
+// if it is flagged or blocked. The response to save and show is returned, a blocked one is replaced
+func moderateResponse(ctx context.Context, session *chatSession, conversationID string, response string) (string, moderation.Decision) {
+	if response == "" {
+		return response, moderation.Decision{}
+	}
+	decision := session.moderation.Check(ctx, types.ModerationStageOutput, response)
+	session.moderation.Record(ctx, conversationID, types.ModerationStageOutput, decision, response)
+	if decision.Blocked() {
+		return moderation.BlockedResponse, decision
+	}
+	return response, decision
+}
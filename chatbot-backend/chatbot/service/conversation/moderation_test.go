@@ -0,0 +1,86 @@
+package conversation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/moderation"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+type mockModerationStore struct {
+	types.ModerationStoreInterface
+	rules   []types.ModerationRule
+	flagged []types.FlaggedMessage
+}
+
+func (m *mockModerationStore) GetRulesByChatbotID(ctx context.Context, chatbotID int) ([]types.ModerationRule, error) {
+	return m.rules, nil
+}
+
+func (m *mockModerationStore) CreateFlaggedMessage(ctx context.Context, flagged types.FlaggedMessage) (int, error) {
+	m.flagged = append(m.flagged, flagged)
+	return len(m.flagged), nil
+}
+
+func TestEditMessageBlockedByModeration(t *testing.T) {
+	conversations, branches := branchTestConversation()
+	for i := range conversations {
+		conversations[i].Conversationid = "conv"
+		conversations[i].Chatbotid = 1
+	}
+	conversations = append(conversations, types.Conversation{Chatid: 10, Conversationid: "conv", Chatbotid: 1, Role: "user", Chat: "q3", Sequence: 5, Branch: 2})
+	moderationStore := &mockModerationStore{rules: []types.ModerationRule{
+		{Ruleid: 1, Kind: types.ModerationKindKeyword, Pattern: "jailbreak", Action: types.ModerationActionBlock, Stage: types.ModerationStageInput},
+	}}
+	handler := &Handler{
+		chatbotStore:      &mockChatbotStore{chatbot: &types.Chatbot{Chatbotid: 1, Username: "owner", Chatbotname: "bot", Sharemode: types.ShareModePublic}},
+		conversationStore: &mockConversationStore{messages: conversations, branches: branches},
+		moderator:         moderation.NewModerator(moderationStore, nil),
+	}
+	router := http.NewServeMux()
+	router.HandleFunc("POST /chat/edit/{username}/{chatbotName}", handler.EditMessage)
+
+	req := httptest.NewRequest(http.MethodPost, "/chat/edit/owner/bot", strings.NewReader(`{"conversationid":"conv","chatid":10,"message":"try this Jailbreak"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	}
+	if len(moderationStore.flagged) != 1 || moderationStore.flagged[0].Action != types.ModerationActionBlock || moderationStore.flagged[0].Conversationid != "conv" {
+		t.Errorf("expected the blocked message to be recorded, got %+v", moderationStore.flagged)
+	}
+}
+
+func TestModerateResponse(t *testing.T) {
+	moderationStore := &mockModerationStore{rules: []types.ModerationRule{
+		{Ruleid: 1, Kind: types.ModerationKindKeyword, Pattern: "internal only", Action: types.ModerationActionBlock, Stage: types.ModerationStageOutput},
+		{Ruleid: 2, Kind: types.ModerationKindKeyword, Pattern: "discount", Action: types.ModerationActionFlag, Stage: types.ModerationStageBoth},
+	}}
+	filter, err := moderation.NewModerator(moderationStore, nil).Filter(context.Background(), &types.Chatbot{Chatbotid: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &chatSession{moderation: filter}
+	ctx := context.Background()
+
+	if response, decision := moderateResponse(ctx, session, "conv", "Opening hours are 9 to 5"); response != "Opening hours are 9 to 5" || decision.Action != "" {
+		t.Errorf("expected the response to be let through, got %q %+v", response, decision)
+	}
+	if response, decision := moderateResponse(ctx, session, "conv", "We have a discount today"); response != "We have a discount today" || !decision.Flagged() {
+		t.Errorf("expected the response to be flagged and kept, got %q %+v", response, decision)
+	}
+	if response, decision := moderateResponse(ctx, session, "conv", "This document is INTERNAL ONLY"); response != moderation.BlockedResponse || !decision.Blocked() {
+		t.Errorf("expected the response to be replaced, got %q %+v", response, decision)
+	}
+	if len(moderationStore.flagged) != 2 || moderationStore.flagged[1].Content != "This document is INTERNAL ONLY" {
+		t.Errorf("expected the flagged and blocked responses to be recorded as generated, got %+v", moderationStore.flagged)
+	}
+
+	if response, _ := moderateResponse(ctx, &chatSession{}, "conv", "internal only"); response != "internal only" {
+		t.Errorf("expected sessions without moderation to let responses through, got %q", response)
+	}
+}
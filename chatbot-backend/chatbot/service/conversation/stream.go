@@ -0,0 +1,293 @@
+package conversation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+)
+
+// StreamProtocolVersion is sent as "v" in every event payload and bumped when the payloads change incompatibly
+const StreamProtocolVersion = 1
+
+// events sent on a chat stream, in order: start, any number of delta and tool, usage, then done or error.
+// tool is sent when the model calls one of the chatbot's tools. done has interrupted set when the response
+// was stopped before it finished
+const (
+	StreamEventStart = "start"
+	StreamEventDelta = "delta"
+	StreamEventTool  = "tool"
+	StreamEventUsage = "usage"
+	StreamEventDone  = "done"
+	StreamEventError = "error"
+)
+
+// codes of error events
+const (
+	StreamErrorGenerationFailed = "generation_failed"
+	StreamErrorSaveFailed       = "save_failed"
+	StreamErrorModerated        = "moderated" // the response was blocked, message is what it was replaced with
+)
+
+// finished streams are kept this long so a client that lost the connection near the end can still resume
+const finishedStreamRetention = 2 * time.Minute
+
+const defaultHeartbeatInterval = 15 * time.Second
+
+var ErrStreamInProgress = errors.New("a response is already being generated for this conversation")
+
+// StreamEventData is the JSON payload of every event, fields an event does not use are left out
+type StreamEventData struct {
+	Version        int    `json:"v"`
+	Conversationid string `json:"conversationid,omitempty"`
+	Text           string `json:"text,omitempty"`
+	Tool           string `json:"tool,omitempty"`
+	PromptTokens   int32  `json:"prompttokens,omitempty"`
+	ResponseTokens int32  `json:"responsetokens,omitempty"`
+	Interrupted    bool   `json:"interrupted,omitempty"`
+	Code           string `json:"code,omitempty"`
+	Message        string `json:"message,omitempty"`
+}
+
+type streamEvent struct {
+	seq  int
+	name string
+	data []byte
+}
+
+// chatStream buffers the events of one streamed response so clients can follow it and resume after reconnecting.
+// Generation carries on while nobody is connected for the resume window, then it is cancelled
+type chatStream struct {
+	id             string
+	chatbotID      int
+	conversationID string
+	cancel         context.CancelFunc
+	resumeWindow   time.Duration
+
+	mu          sync.Mutex
+	events      []streamEvent
+	finished    bool
+	changed     chan struct{} // closed and replaced whenever an event is added or the stream finishes
+	subscribers int
+	idleTimer   *time.Timer
+}
+
+// eventID is the SSE id of an event, made unique across streams so a stale Last-Event-ID is not mistaken for this one
+func (s *chatStream) eventID(seq int) string {
+	return s.id + "-" + strconv.Itoa(seq)
+}
+
+// resumeFrom returns the sequence number of the last event the client received according to its Last-Event-ID,
+// 0 to replay the whole stream when the id is missing or belongs to another stream
+func (s *chatStream) resumeFrom(lastEventID string) int {
+	streamID, seq, found := strings.Cut(lastEventID, "-")
+	if !found || streamID != s.id {
+		return 0
+	}
+	n, err := strconv.Atoi(seq)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// publish adds an event to the stream, events published after the stream finished are dropped
+func (s *chatStream) publish(name string, data StreamEventData) {
+	data.Version = StreamProtocolVersion
+	payload, _ := json.Marshal(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return
+	}
+	s.events = append(s.events, streamEvent{seq: len(s.events) + 1, name: name, data: payload})
+	s.notify()
+}
+
+func (s *chatStream) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished = true
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	s.notify()
+}
+
+// notify wakes up the followers, s.mu must be held
+func (s *chatStream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// eventsAfter returns the events after seq, whether the stream finished and a channel closed on the next change
+func (s *chatStream) eventsAfter(seq int) ([]streamEvent, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq < 0 || seq > len(s.events) {
+		seq = len(s.events)
+	}
+	return s.events[seq:], s.finished, s.changed
+}
+
+func (s *chatStream) subscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers++
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+}
+
+// unsubscribe starts the resume window once the last client has gone
+func (s *chatStream) unsubscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers--
+	if s.subscribers > 0 || s.finished {
+		return
+	}
+	s.idleTimer = time.AfterFunc(s.resumeWindow, s.cancel)
+}
+
+// streamRegistry holds the current stream of each conversation
+type streamRegistry struct {
+	mu      sync.Mutex
+	streams map[string]*chatStream
+}
+
+func newStreamRegistry() *streamRegistry {
+	return &streamRegistry{streams: map[string]*chatStream{}}
+}
+
+// start registers a new stream for the conversation, only one response can be generated for a conversation at a time
+func (r *streamRegistry) start(chatbotID int, conversationID string, cancel context.CancelFunc) (*chatStream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.streams[conversationID]; ok {
+		existing.mu.Lock()
+		finished := existing.finished
+		existing.mu.Unlock()
+		if !finished {
+			return nil, ErrStreamInProgress
+		}
+	}
+
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	stream := &chatStream{
+		id:             hex.EncodeToString(id),
+		chatbotID:      chatbotID,
+		conversationID: conversationID,
+		cancel:         cancel,
+		resumeWindow:   time.Duration(config.Envs.StreamResumeSeconds) * time.Second,
+		changed:        make(chan struct{}),
+	}
+	r.streams[conversationID] = stream
+	return stream, nil
+}
+
+// finish marks the stream finished and forgets it once the retention period is over
+func (r *streamRegistry) finish(stream *chatStream) {
+	stream.finish()
+	time.AfterFunc(finishedStreamRetention, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.streams[stream.conversationID] == stream {
+			delete(r.streams, stream.conversationID)
+		}
+	})
+}
+
+func (r *streamRegistry) get(conversationID string) *chatStream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.streams[conversationID]
+}
+
+func writeStreamEvent(w io.Writer, stream *chatStream, event streamEvent) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", stream.eventID(event.seq), event.name, event.data)
+	return err
+}
+
+// followStream writes the events of the stream after seq to the client as they are published,
+// with heartbeat comments in between so proxies do not close the idle connection
+func followStream(w http.ResponseWriter, r *http.Request, stream *chatStream, seq int) {
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	stream.follow(r.Context(), seq, func(events []streamEvent) error {
+		for _, event := range events {
+			if err := writeStreamEvent(w, stream, event); err != nil {
+				return err
+			}
+		}
+		flush()
+		return nil
+	}, func() error {
+		if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+			return err
+		}
+		flush()
+		return nil
+	})
+}
+
+// follow calls send with the events after seq as they are published until the stream finishes, ctx is done
+// or a call fails. heartbeat is called at the heartbeat interval so the connection does not look idle.
+// The stream counts as followed for the resume window while follow runs
+func (s *chatStream) follow(ctx context.Context, seq int, send func([]streamEvent) error, heartbeat func() error) {
+	s.subscribe()
+	defer s.unsubscribe()
+
+	ticker := time.NewTicker(heartbeatInterval())
+	defer ticker.Stop()
+	for {
+		events, finished, changed := s.eventsAfter(seq)
+		if len(events) > 0 {
+			if err := send(events); err != nil {
+				return
+			}
+			seq = events[len(events)-1].seq
+		}
+		if finished {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func heartbeatInterval() time.Duration {
+	interval := time.Duration(config.Envs.StreamHeartbeatSeconds) * time.Second
+	if interval <= 0 {
+		return defaultHeartbeatInterval
+	}
+	return interval
+}
@@ -0,0 +1,99 @@
+package conversation
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+)
+
+func TestFollowStreamResumesAfterLastEventID(t *testing.T) {
+	registry := newStreamRegistry()
+	stream, err := registry.start(1, "conv", func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.publish(StreamEventStart, StreamEventData{Conversationid: "conv"})
+	stream.publish(StreamEventDelta, StreamEventData{Text: "Hello"})
+	stream.publish(StreamEventDelta, StreamEventData{Text: " world"})
+	stream.publish(StreamEventDone, StreamEventData{})
+	registry.finish(stream)
+
+	if _, err := registry.start(1, "conv", func() {}); err != nil {
+		t.Errorf("expected a new stream to start once the previous one finished, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	followStream(rec, httptest.NewRequest("GET", "/", nil), stream, stream.resumeFrom(stream.eventID(2)))
+
+	expected := "id: " + stream.eventID(3) + "\nevent: delta\ndata: {\"v\":1,\"text\":\" world\"}\n\n" +
+		"id: " + stream.eventID(4) + "\nevent: done\ndata: {\"v\":1}\n\n"
+	if rec.Body.String() != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, rec.Body.String())
+	}
+}
+
+func TestResumeFromUnknownEventIDReplaysStream(t *testing.T) {
+	stream, err := newStreamRegistry().start(1, "conv", func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"", "otherstream-3", stream.id + "-x"} {
+		if seq := stream.resumeFrom(id); seq != 0 {
+			t.Errorf("expected %q to replay from the start, got %d", id, seq)
+		}
+	}
+}
+
+func TestOnlyOneStreamPerConversation(t *testing.T) {
+	registry := newStreamRegistry()
+	if _, err := registry.start(1, "conv", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.start(1, "conv", func() {}); err != ErrStreamInProgress {
+		t.Errorf("expected ErrStreamInProgress, got %v", err)
+	}
+}
+
+func TestStreamCancelledWhenNobodyResumes(t *testing.T) {
+	config.Envs.StreamResumeSeconds = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := newStreamRegistry().start(1, "conv", cancel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the client goes away before the response is finished
+	requestCtx, disconnect := context.WithCancel(context.Background())
+	disconnect()
+	followStream(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(requestCtx), stream, 0)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected generation to be cancelled once the resume window passed")
+	}
+}
+
+func TestFollowStreamSendsHeartbeats(t *testing.T) {
+	config.Envs.StreamHeartbeatSeconds = 1
+	stream, err := newStreamRegistry().start(1, "conv", func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(1500 * time.Millisecond)
+		stream.publish(StreamEventDone, StreamEventData{})
+		stream.finish()
+	}()
+
+	rec := httptest.NewRecorder()
+	followStream(rec, httptest.NewRequest("GET", "/", nil), stream, 0)
+	if !strings.HasPrefix(rec.Body.String(), ": heartbeat\n\n") {
+		t.Errorf("expected a heartbeat before the done event, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,79 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/tracing"
+	"github.com/google/generative-ai-go/genai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxToolRounds is how many times the model may call tools before answering a message.
+// In the last round the calls are refused so the model answers with what it has
+const maxToolRounds = 5
+
+var errTooManyToolCalls = errors.New("too many tool calls, answer with what you have")
+
+// callTools runs the tools the model called and returns their results to send back to the model.
+// Failed calls are returned as an error for the model to handle, every call is added to the turn
+func (h *Handler) callTools(ctx context.Context, session *chatSession, calls []genai.FunctionCall, turn *types.ConversationTurn, exhausted bool) []genai.Part {
+	parts := []genai.Part{}
+	for _, call := range calls {
+		kind := ""
+		if session.tools != nil {
+			kind = session.tools.Kind(call.Name)
+		}
+		callCtx, span := tracing.Start(ctx, "tool.call", trace.WithAttributes(
+			attribute.String("tool.name", call.Name),
+			attribute.String("tool.kind", kind),
+		))
+		start := time.Now()
+		var result map[string]any
+		var err error
+		switch {
+		case exhausted:
+			err = errTooManyToolCalls
+		case session.tools == nil:
+			err = errors.New("this chatbot has no tools")
+		default:
+			result, err = session.tools.Call(callCtx, call)
+		}
+		duration := time.Since(start)
+
+		outcome := "success"
+		errorMessage := ""
+		if err != nil {
+			outcome = "error"
+			errorMessage = err.Error()
+			result = map[string]any{"error": errorMessage}
+			tracing.RecordError(span, err)
+		}
+		span.End()
+		metrics.ToolCallsTotal.WithLabelValues(kind, outcome).Inc()
+		slog.InfoContext(ctx, "Called tool", "tool", call.Name, "kind", kind, "duration_ms", duration.Milliseconds(), "error", errorMessage)
+
+		arguments, _ := json.Marshal(call.Args)
+		resultJSON, _ := json.Marshal(result)
+		currentTime, _ := utils.GetCurrentTime()
+		turn.ToolCalls = append(turn.ToolCalls, types.ToolCall{
+			Conversationid: turn.Conversationid,
+			Chatbotid:      turn.Chatbotid,
+			Name:           call.Name,
+			Arguments:      string(arguments),
+			Result:         string(resultJSON),
+			Error:          errorMessage,
+			Durationms:     duration.Milliseconds(),
+			Createddate:    currentTime,
+		})
+		parts = append(parts, genai.FunctionResponse{Name: call.Name, Response: result})
+	}
+	return parts
+}
@@ -0,0 +1,264 @@
+package conversation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+const turnSpoolRetryInterval = 5 * time.Second
+
+// TurnSpool saves conversation turns, queueing them in a JSON lines file when the database is busy.
+// Queued turns are saved again by Run and survive a restart. Once a conversation has a queued turn,
+// its later turns are queued behind it so they are saved in order
+type TurnSpool struct {
+	path  string
+	store types.ConversationStoreInterface
+
+	mu            sync.Mutex     // guards pending, conversations and the spool file, never held while saving to the database
+	pending       map[string]int // queued turns per conversation
+	conversations map[string]*conversationLock
+
+	flushMu sync.Mutex // only one Flush saves the queued turns at a time
+}
+
+// conversationLock keeps the turns of one conversation in order, users counts the callers holding or waiting for it
+type conversationLock struct {
+	sync.Mutex
+	users int
+}
+
+func NewTurnSpool(path string, store types.ConversationStoreInterface) (*TurnSpool, error) {
+	spool := &TurnSpool{
+		path:          path,
+		store:         store,
+		pending:       map[string]int{},
+		conversations: map[string]*conversationLock{},
+	}
+
+	turns, err := spool.readTurns()
+	if err != nil {
+		return nil, err
+	}
+	for _, turn := range turns {
+		spool.pending[turn.Conversationid]++
+	}
+	return spool, nil
+}
+
+// Save saves the turn, or queues it if the database is busy or earlier turns of the conversation are still queued.
+// queued reports whether the turn was queued, an error means the turn was neither saved nor queued
+func (s *TurnSpool) Save(ctx context.Context, turn types.ConversationTurn) (queued bool, err error) {
+	unlock := s.lockConversation(turn.Conversationid)
+	defer unlock()
+
+	s.mu.Lock()
+	hasQueued := s.pending[turn.Conversationid] > 0
+	s.mu.Unlock()
+
+	if !hasQueued {
+		err := s.store.SaveConversationTurn(ctx, turn)
+		if err == nil || !db.IsBusy(err) {
+			return false, err
+		}
+		slog.WarnContext(ctx, "Database busy, queueing conversation turn", "error", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(turn); err != nil {
+		return false, err
+	}
+	s.pending[turn.Conversationid]++
+	return true, nil
+}
+
+// lockConversation waits until no other turn of the conversation is being saved and returns the function releasing it
+func (s *TurnSpool) lockConversation(conversationID string) func() {
+	s.mu.Lock()
+	lock, ok := s.conversations[conversationID]
+	if !ok {
+		lock = &conversationLock{}
+		s.conversations[conversationID] = lock
+	}
+	lock.users++
+	s.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		s.mu.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(s.conversations, conversationID)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Run saves the queued turns every few seconds until ctx is done
+func (s *TurnSpool) Run(ctx context.Context) {
+	ticker := time.NewTicker(turnSpoolRetryInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Flush(ctx); err != nil {
+			slog.ErrorContext(ctx, "Error saving queued conversation turns", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush tries to save the queued turns in order and keeps the ones that still cannot be saved.
+// A turn that fails for any reason other than a busy database would fail forever, so it is logged and dropped.
+// Save keeps queueing turns meanwhile, conversations with turns being flushed still count as having queued turns
+func (s *TurnSpool) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	turns, err := s.readTurns()
+	s.mu.Unlock()
+	if err != nil || len(turns) == 0 {
+		return err
+	}
+
+	remaining := []types.ConversationTurn{}
+	failed := map[string]bool{}
+	for _, turn := range turns {
+		if !failed[turn.Conversationid] {
+			err := s.store.SaveConversationTurn(ctx, turn)
+			if err == nil {
+				continue
+			}
+			if !db.IsBusy(err) && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Dropping queued conversation turn that cannot be saved", "conversationid", turn.Conversationid, "error", err)
+				continue
+			}
+		}
+		remaining = append(remaining, turn)
+		failed[turn.Conversationid] = true
+	}
+
+	if len(turns) != len(remaining) {
+		slog.InfoContext(ctx, "Saved queued conversation turns", "saved", len(turns)-len(remaining), "remaining", len(remaining))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// turns queued while flushing were appended after the ones read above
+	current, err := s.readTurns()
+	if err != nil {
+		return err
+	}
+	if len(current) > len(turns) {
+		remaining = append(remaining, current[len(turns):]...)
+	}
+
+	pending := map[string]int{}
+	for _, turn := range remaining {
+		pending[turn.Conversationid]++
+	}
+	s.pending = pending
+	return s.rewrite(remaining)
+}
+
+func (s *TurnSpool) readTurns() ([]types.ConversationTurn, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	turns := []types.ConversationTurn{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var turn types.ConversationTurn
+		if err := json.Unmarshal(scanner.Bytes(), &turn); err != nil {
+			// a line cut short by a crash while it was being written
+			slog.Error("Skipping unreadable queued conversation turn", "error", err)
+			continue
+		}
+		turns = append(turns, turn)
+	}
+	return turns, scanner.Err()
+}
+
+// append writes the turn to the end of the spool file and waits for it to reach the disk
+func (s *TurnSpool) append(turn types.ConversationTurn) error {
+	line, err := json.Marshal(turn)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// rewrite replaces the spool file with turns, writing to a temporary file first so a crash leaves either version whole
+func (s *TurnSpool) rewrite(turns []types.ConversationTurn) error {
+	if len(turns) == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, turn := range turns {
+		if err := encoder.Encode(turn); err != nil {
+			return err
+		}
+	}
+
+	tempPath := s.path + ".tmp"
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, s.path)
+}
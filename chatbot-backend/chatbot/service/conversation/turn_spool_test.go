@@ -0,0 +1,210 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestTurnSpool(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "spool", "turns.jsonl")
+	store := &mockConversationStore{err: sqlite3.Error{Code: sqlite3.ErrBusy}}
+
+	spool, err := NewTurnSpool(path, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the database is busy so the first turn is queued, the second turn of the same conversation
+	// is queued behind it without trying the database, the other conversation is saved directly
+	queued, err := spool.Save(ctx, types.ConversationTurn{Conversationid: "a", UserMessage: "first"})
+	if err != nil || !queued {
+		t.Fatalf("expected first turn to be queued, got queued=%v err=%v", queued, err)
+	}
+	store.err = nil
+	queued, err = spool.Save(ctx, types.ConversationTurn{Conversationid: "a", UserMessage: "second"})
+	if err != nil || !queued {
+		t.Fatalf("expected second turn to be queued behind the first, got queued=%v err=%v", queued, err)
+	}
+	queued, err = spool.Save(ctx, types.ConversationTurn{Conversationid: "b", UserMessage: "other"})
+	if err != nil || queued {
+		t.Fatalf("expected other conversation to be saved, got queued=%v err=%v", queued, err)
+	}
+
+	// the queue survives a restart
+	restarted, err := NewTurnSpool(path, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.pending["a"] != 2 {
+		t.Fatalf("expected 2 queued turns after restart, got %d", restarted.pending["a"])
+	}
+
+	if err := restarted.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"other", "first", "second"}
+	if len(store.saved) != len(expected) {
+		t.Fatalf("expected %d saved turns, got %d", len(expected), len(store.saved))
+	}
+	for i, message := range expected {
+		if store.saved[i].UserMessage != message {
+			t.Errorf("expected turn %d to be %q, got %q", i, message, store.saved[i].UserMessage)
+		}
+	}
+	if restarted.pending["a"] != 0 {
+		t.Errorf("expected no queued turns after flush, got %d", restarted.pending["a"])
+	}
+}
+
+func TestTurnSpoolReturnsOtherErrors(t *testing.T) {
+	store := &mockConversationStore{err: errors.New("constraint failed")}
+	spool, err := NewTurnSpool(filepath.Join(t.TempDir(), "turns.jsonl"), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued, err := spool.Save(context.Background(), types.ConversationTurn{Conversationid: "a"})
+	if err == nil || queued {
+		t.Fatalf("expected the error to be returned without queueing, got queued=%v err=%v", queued, err)
+	}
+}
+
+func TestTurnSpoolSavesWhileFlushing(t *testing.T) {
+	ctx := context.Background()
+	store := &blockingConversationStore{blocked: make(chan struct{}), release: make(chan struct{})}
+	spool, err := NewTurnSpool(filepath.Join(t.TempDir(), "turns.jsonl"), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.busy = true
+	if queued, err := spool.Save(ctx, types.ConversationTurn{Conversationid: "a", UserMessage: "first"}); err != nil || !queued {
+		t.Fatalf("expected first turn to be queued, got queued=%v err=%v", queued, err)
+	}
+	store.busy = false
+
+	blocked := store.blocked
+	flushed := make(chan error)
+	go func() { flushed <- spool.Flush(ctx) }()
+	<-blocked
+
+	// the database is still saving the queued turn, other conversations are saved and
+	// later turns of the same conversation are queued without waiting for it
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		if queued, err := spool.Save(ctx, types.ConversationTurn{Conversationid: "b", UserMessage: "other"}); err != nil || queued {
+			t.Errorf("expected other conversation to be saved, got queued=%v err=%v", queued, err)
+		}
+		if queued, err := spool.Save(ctx, types.ConversationTurn{Conversationid: "a", UserMessage: "second"}); err != nil || !queued {
+			t.Errorf("expected second turn to be queued, got queued=%v err=%v", queued, err)
+		}
+	}()
+	select {
+	case <-saved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Save not to wait for Flush")
+	}
+
+	close(store.release)
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	// the turn queued while flushing is kept for the next flush
+	if spool.pending["a"] != 1 {
+		t.Fatalf("expected 1 queued turn, got %d", spool.pending["a"])
+	}
+	if err := spool.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"other", "first", "second"}
+	if len(store.saved) != len(expected) {
+		t.Fatalf("expected %d saved turns, got %d", len(expected), len(store.saved))
+	}
+	for i, message := range expected {
+		if store.saved[i].UserMessage != message {
+			t.Errorf("expected turn %d to be %q, got %q", i, message, store.saved[i].UserMessage)
+		}
+	}
+}
+
+// blockingConversationStore holds the first save of conversation a until release is closed
+type blockingConversationStore struct {
+	types.ConversationStoreInterface
+	mu      sync.Mutex
+	busy    bool
+	blocked chan struct{}
+	release chan struct{}
+	saved   []types.ConversationTurn
+}
+
+func (m *blockingConversationStore) SaveConversationTurn(ctx context.Context, turn types.ConversationTurn) error {
+	if m.busy {
+		return sqlite3.Error{Code: sqlite3.ErrBusy}
+	}
+	m.mu.Lock()
+	blocked := m.blocked
+	if turn.Conversationid == "a" {
+		m.blocked = nil
+	}
+	m.mu.Unlock()
+	if turn.Conversationid == "a" && blocked != nil {
+		close(blocked)
+		<-m.release
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saved = append(m.saved, turn)
+	return nil
+}
+
+type mockConversationStore struct {
+	types.ConversationStoreInterface
+	err      error
+	saved    []types.ConversationTurn
+	messages []types.Conversation
+	branches []types.ConversationBranch
+}
+
+func (m *mockConversationStore) GetConversationBranches(ctx context.Context, conversationID string) ([]types.ConversationBranch, error) {
+	return m.branches, nil
+}
+
+func (m *mockConversationStore) GetConversationsByID(ctx context.Context, conversationID string) ([]types.Conversation, error) {
+	messages := []types.Conversation{}
+	for _, message := range m.messages {
+		if message.Conversationid == conversationID {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (m *mockConversationStore) GetConversationIDsByChatbotID(ctx context.Context, chatbotID int) ([]string, error) {
+	conversationIDs := []string{}
+	for _, message := range m.messages {
+		if message.Chatbotid == chatbotID && !slices.Contains(conversationIDs, message.Conversationid) {
+			conversationIDs = append(conversationIDs, message.Conversationid)
+		}
+	}
+	return conversationIDs, nil
+}
+
+func (m *mockConversationStore) SaveConversationTurn(ctx context.Context, turn types.ConversationTurn) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.saved = append(m.saved, turn)
+	return nil
+}
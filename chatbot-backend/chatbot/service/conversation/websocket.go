@@ -0,0 +1,249 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+	"github.com/gorilla/websocket"
+)
+
+// types of the messages a WebSocket client sends
+const (
+	SocketMessageChat   = "message"
+	SocketMessageCancel = "cancel"
+	SocketMessageTyping = "typing"
+)
+
+// codes of error messages that only happen on the WebSocket, generation errors use the stream error codes
+const (
+	SocketErrorInvalidMessage   = "invalid_message"
+	SocketErrorStreamInProgress = "stream_in_progress"
+	SocketErrorStartFailed      = "start_failed"
+	SocketErrorMessageBlocked   = "message_blocked"
+)
+
+const (
+	maxSocketMessageBytes = 64 * 1024
+	socketWriteTimeout    = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	// ChatWebSocket checks the origin against the chatbot before upgrading
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// SocketClientMessage is sent by the client: a chat message, a request to cancel the response being generated,
+// or a typing notice, which is accepted so clients can send it but is not passed on anywhere yet
+type SocketClientMessage struct {
+	Type           string `json:"type"`
+	Conversationid string `json:"conversationid"`
+	Message        string `json:"message"`
+	Typing         bool   `json:"typing"`
+}
+
+// SocketServerMessage is sent to the client: a stream event with the same id and payload as on the SSE stream,
+// or a typing indicator while the chatbot is generating a response
+type SocketServerMessage struct {
+	Type   string          `json:"type"`
+	ID     string          `json:"id,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Typing *bool           `json:"typing,omitempty"`
+}
+
+// chatSocket is one WebSocket connection, which generates at most one response at a time
+type chatSocket struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu     sync.Mutex
+	active *chatStream
+}
+
+func (h *Handler) ChatWebSocket(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	chatbotName := r.PathValue("chatbotName")
+	if username == "" || chatbotName == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid parameters"))
+		return
+	}
+
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	// apps embedding the chatbot do not send an Origin, browsers must come from the frontend or a site embedding the chatbot
+	if origin := r.Header.Get("Origin"); origin != "" && !originAllowed(origin, chatbot) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("origin not allowed"))
+		return
+	}
+	if _, status, err := h.checkChatbotAccess(r, chatbot); err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+	logging.AddFields(r.Context(), "chatbotid", chatbot.Chatbotid)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already written the error response
+		slog.WarnContext(r.Context(), "Could not upgrade to WebSocket", "error", err)
+		return
+	}
+	defer conn.Close()
+	slog.InfoContext(r.Context(), "WebSocket connected")
+
+	// the request context is not cancelled when a hijacked connection closes, so stop everything when reading stops
+	socket := &chatSocket{conn: conn}
+	var forwarding sync.WaitGroup
+	defer forwarding.Wait()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// the client has to answer the pings sent by keepAlive, otherwise reading times out and the connection is closed
+	conn.SetReadLimit(maxSocketMessageBytes)
+	conn.SetReadDeadline(time.Now().Add(2 * heartbeatInterval()))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * heartbeatInterval()))
+	})
+	go socket.keepAlive(ctx)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.WarnContext(ctx, "WebSocket closed unexpectedly", "error", err)
+			}
+			slog.InfoContext(ctx, "WebSocket disconnected")
+			return
+		}
+		var message SocketClientMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			socket.sendError(SocketErrorInvalidMessage, "message is not valid JSON")
+			continue
+		}
+
+		switch message.Type {
+		case SocketMessageChat:
+			if socket.getActive() != nil {
+				socket.sendError(SocketErrorStreamInProgress, "a response is already being generated on this connection")
+				continue
+			}
+			chatRequest := types.ChatRequest{Conversationid: message.Conversationid, Message: message.Message}
+			if err := utils.Validate.Struct(chatRequest); err != nil {
+				socket.sendError(SocketErrorInvalidMessage, "conversationid and message are required")
+				continue
+			}
+			if err := h.moderateInput(ctx, chatbot, chatRequest.Conversationid, chatRequest.Message); err != nil {
+				if errors.Is(err, ErrMessageBlocked) {
+					socket.sendError(SocketErrorMessageBlocked, err.Error())
+				} else {
+					socket.sendError(SocketErrorStartFailed, "unable to get response from chatbot")
+				}
+				continue
+			}
+			stream, err := h.startStream(ctx, chatbot, chatRequest.Conversationid, chatRequest.Message, nil)
+			if errors.Is(err, ErrStreamInProgress) {
+				socket.sendError(SocketErrorStreamInProgress, err.Error())
+				continue
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "Error starting response over WebSocket", "conversationid", chatRequest.Conversationid, "error", err)
+				socket.sendError(SocketErrorStartFailed, "unable to get response from chatbot")
+				continue
+			}
+			slog.InfoContext(ctx, "Generating response over WebSocket", "conversationid", chatRequest.Conversationid, "streamid", stream.id)
+
+			socket.setActive(stream)
+			forwarding.Add(1)
+			go func() {
+				defer forwarding.Done()
+				socket.forward(ctx, stream)
+			}()
+		case SocketMessageCancel:
+			if stream := socket.getActive(); stream != nil {
+				slog.InfoContext(ctx, "Client cancelled the response", "streamid", stream.id)
+				stream.cancel()
+			}
+		case SocketMessageTyping:
+			slog.DebugContext(ctx, "Client typing", "typing", message.Typing)
+		default:
+			socket.sendError(SocketErrorInvalidMessage, fmt.Sprintf("unknown message type %q", message.Type))
+		}
+	}
+}
+
+// forward sends the events of the stream to the client, between typing indicators
+func (s *chatSocket) forward(ctx context.Context, stream *chatStream) {
+	s.sendTyping(true)
+	stream.follow(ctx, 0, func(events []streamEvent) error {
+		for _, event := range events {
+			err := s.send(SocketServerMessage{Type: event.name, ID: stream.eventID(event.seq), Data: event.data})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() error {
+		// keepAlive pings the connection for the whole time it is open
+		return nil
+	})
+	s.sendTyping(false)
+
+	s.mu.Lock()
+	if s.active == stream {
+		s.active = nil
+	}
+	s.mu.Unlock()
+}
+
+// keepAlive pings the client at the heartbeat interval until ctx is done
+func (s *chatSocket) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *chatSocket) send(message SocketServerMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	return s.conn.WriteJSON(message)
+}
+
+func (s *chatSocket) sendTyping(typing bool) {
+	s.send(SocketServerMessage{Type: SocketMessageTyping, Typing: &typing})
+}
+
+func (s *chatSocket) sendError(code string, message string) {
+	data, _ := json.Marshal(StreamEventData{Version: StreamProtocolVersion, Code: code, Message: message})
+	s.send(SocketServerMessage{Type: StreamEventError, Data: data})
+}
+
+func (s *chatSocket) setActive(stream *chatStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = stream
+}
+
+func (s *chatSocket) getActive() *chatStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
@@ -0,0 +1,94 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/gorilla/websocket"
+)
+
+func dialSocket(t *testing.T, handler http.Handler) *websocket.Conn {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/chat/ws/owner/bot", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestChatWebSocketRejectsInvalidMessages(t *testing.T) {
+	handler := &Handler{
+		chatbotStore: &mockChatbotStore{chatbot: &types.Chatbot{Chatbotid: 1, Username: "owner", Chatbotname: "bot", Sharemode: types.ShareModePublic}},
+		streams:      newStreamRegistry(),
+	}
+	router := http.NewServeMux()
+	router.HandleFunc("GET /chat/ws/{username}/{chatbotName}", handler.ChatWebSocket)
+	conn := dialSocket(t, router)
+
+	messages := []string{
+		`not json`,
+		`{"type":"shout"}`,
+		`{"type":"message","conversationid":"conv"}`,
+	}
+	for _, message := range messages {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		var reply SocketServerMessage
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatal(err)
+		}
+		var data StreamEventData
+		json.Unmarshal(reply.Data, &data)
+		if reply.Type != StreamEventError || data.Code != SocketErrorInvalidMessage {
+			t.Errorf("expected an invalid_message error for %s, got %s %+v", message, reply.Type, data)
+		}
+	}
+}
+
+func TestChatSocketForwardsStreamEvents(t *testing.T) {
+	stream, err := newStreamRegistry().start(1, "conv", func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.publish(StreamEventStart, StreamEventData{Conversationid: "conv"})
+	stream.publish(StreamEventDelta, StreamEventData{Text: "Hello"})
+	stream.publish(StreamEventDone, StreamEventData{})
+	stream.finish()
+
+	conn := dialSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+		(&chatSocket{conn: serverConn}).forward(context.Background(), stream)
+	}))
+
+	expected := []string{SocketMessageTyping, StreamEventStart, StreamEventDelta, StreamEventDone, SocketMessageTyping}
+	for i, messageType := range expected {
+		var message SocketServerMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type != messageType {
+			t.Fatalf("expected message %d to be %s, got %s", i, messageType, message.Type)
+		}
+		if message.Type == StreamEventDelta && (message.ID != stream.eventID(2) || !strings.Contains(string(message.Data), `"text":"Hello"`)) {
+			t.Errorf("unexpected delta message %+v", message)
+		}
+		if message.Type == SocketMessageTyping && *message.Typing != (i == 0) {
+			t.Errorf("expected typing to be %t, got %t", i == 0, *message.Typing)
+		}
+	}
+}
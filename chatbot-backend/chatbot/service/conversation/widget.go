@@ -0,0 +1,101 @@
+package conversation
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+const defaultWidgetPosition = "right"
+
+// GetWidgetConfig returns what the widget script needs to show the chatbot on a site embedding it.
+// Browsers may only load it from the frontend or one of the chatbot's allowed origins
+func (h *Handler) GetWidgetConfig(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	chatbotName := r.PathValue("chatbotName")
+	if username == "" || chatbotName == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid parameters"))
+		return
+	}
+
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !originAllowed(origin, chatbot) {
+		slog.InfoContext(r.Context(), "Widget requested from an origin that is not allowed", "origin", origin)
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("origin not allowed"))
+		return
+	}
+	if _, status, err := h.checkChatbotAccess(r, chatbot); err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.WidgetConfig{
+		Username:    chatbot.Username,
+		Chatbotname: chatbot.Chatbotname,
+		Description: chatbot.Description,
+		Sharemode:   chatbot.Sharemode,
+		Theme:       widgetTheme(chatbot),
+	})
+}
+
+// AllowedOrigins returns the origins allowed to embed the chatbot in the path of the request, for the CORS middleware
+func (h *Handler) AllowedOrigins(r *http.Request) []string {
+	username, chatbotName, ok := chatbotInPath(r.URL.Path)
+	if !ok {
+		return nil
+	}
+	chatbot, err := h.chatbotStore.GetChatbotByName(r.Context(), username, chatbotName)
+	if err != nil {
+		return nil
+	}
+	return widgetOrigins(chatbot)
+}
+
+// chatbotInPath returns the owner and name of the chatbot in the path of a conversation route
+func chatbotInPath(path string) (username string, chatbotName string, ok bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(segments) == 3 && (segments[0] == "start" || segments[0] == "chat" || segments[0] == "widget"):
+		return segments[1], segments[2], true
+	// the stream, websocket and test chat routes have a fixed segment before the chatbot
+	case len(segments) >= 4 && segments[0] == "chat":
+		return segments[2], segments[3], true
+	}
+	return "", "", false
+}
+
+func widgetOrigins(chatbot *types.Chatbot) []string {
+	if chatbot.Allowedorigins == "" {
+		return nil
+	}
+	return strings.Split(chatbot.Allowedorigins, ",")
+}
+
+// originAllowed reports whether a browser on origin may use the chatbot
+func originAllowed(origin string, chatbot *types.Chatbot) bool {
+	return origin == config.Envs.FrontendDomain || slices.Contains(widgetOrigins(chatbot), strings.ToLower(origin))
+}
+
+func widgetTheme(chatbot *types.Chatbot) types.WidgetTheme {
+	theme := types.WidgetTheme{}
+	if chatbot.Widgettheme != "" {
+		if err := json.Unmarshal([]byte(chatbot.Widgettheme), &theme); err != nil {
+			slog.Warn("Invalid widget theme of chatbot", "chatbotid", chatbot.Chatbotid, "error", err)
+		}
+	}
+	if theme.Position == "" {
+		theme.Position = defaultWidgetPosition
+	}
+	return theme
+}
@@ -0,0 +1,76 @@
+package conversation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func TestChatbotInPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		username string
+		chatbot  string
+		ok       bool
+	}{
+		{path: "/start/owner/bot", username: "owner", chatbot: "bot", ok: true},
+		{path: "/chat/owner/bot", username: "owner", chatbot: "bot", ok: true},
+		{path: "/widget/owner/bot", username: "owner", chatbot: "bot", ok: true},
+		{path: "/chat/stream/owner/bot/conv", username: "owner", chatbot: "bot", ok: true},
+		{path: "/chat/ws/owner/bot", username: "owner", chatbot: "bot", ok: true},
+		{path: "/history/conv", ok: false},
+		{path: "/feedback/owner/bot", ok: false},
+	}
+
+	for _, tt := range tests {
+		username, chatbotName, ok := chatbotInPath(tt.path)
+		if ok != tt.ok || username != tt.username || chatbotName != tt.chatbot {
+			t.Errorf("%s: expected %s %s %v, got %s %s %v", tt.path, tt.username, tt.chatbot, tt.ok, username, chatbotName, ok)
+		}
+	}
+}
+
+func TestGetWidgetConfig(t *testing.T) {
+	config.Envs.FrontendDomain = "https://app.example.com"
+	handler := &Handler{
+		chatbotStore: &mockChatbotStore{chatbot: &types.Chatbot{
+			Chatbotid:      1,
+			Username:       "owner",
+			Chatbotname:    "bot",
+			Sharemode:      types.ShareModePublic,
+			Allowedorigins: "https://shop.example.org",
+			Widgettheme:    `{"primaryColor":"#112233"}`,
+		}},
+	}
+	router := http.NewServeMux()
+	router.HandleFunc("GET /widget/{username}/{chatbotName}", handler.GetWidgetConfig)
+
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{origin: "https://shop.example.org", status: http.StatusOK},
+		{origin: "https://app.example.com", status: http.StatusOK},
+		{origin: "", status: http.StatusOK},
+		{origin: "https://evil.example.net", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/widget/owner/bot", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("origin %q: expected status %d, got %d", tt.origin, tt.status, rr.Code)
+		}
+	}
+
+	theme := widgetTheme(handler.chatbotStore.(*mockChatbotStore).chatbot)
+	if theme.Primarycolor != "#112233" || theme.Position != defaultWidgetPosition {
+		t.Errorf("unexpected theme %+v", theme)
+	}
+}
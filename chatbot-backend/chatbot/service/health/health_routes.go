@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+const (
+	checkOK     = "ok"
+	pingTimeout = 2 * time.Second
+)
+
+type Handler struct {
+	db *sql.DB
+}
+
+func NewHandler(db *sql.DB) *Handler {
+	return &Handler{db: db}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("GET /healthz", h.Healthz)
+	router.HandleFunc("GET /readyz", h.Readyz)
+}
+
+// Healthz reports that the process is up and serving requests
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"status": checkOK})
+}
+
+// Readyz reports whether the server can handle chats, which needs the database and a configured model provider
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"database": checkOK,
+		"llm":      checkOK,
+	}
+	ready := true
+
+	ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+	defer cancel()
+	if err := h.db.PingContext(ctx); err != nil {
+		slog.ErrorContext(r.Context(), "Readiness check could not reach the database", "error", err)
+		checks["database"] = "unreachable"
+		ready = false
+	}
+
+	if config.Envs.GEMINI_API_KEY == "" || config.Envs.MODEL_NAME == "" {
+		checks["llm"] = "not configured"
+		ready = false
+	}
+
+	status := "ready"
+	statusCode := http.StatusOK
+	if !ready {
+		status = "not ready"
+		statusCode = http.StatusServiceUnavailable
+	}
+	utils.WriteJSON(w, statusCode, map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
@@ -0,0 +1,51 @@
+package health
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestHealthHandler(t *testing.T) {
+	config.Envs.GEMINI_API_KEY = "test-key"
+
+	openDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer openDB.Close()
+
+	closedDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedDB.Close()
+
+	tests := []struct {
+		name     string
+		db       *sql.DB
+		path     string
+		expected int
+	}{
+		{name: "healthz is always ok", db: closedDB, path: "/healthz", expected: http.StatusOK},
+		{name: "ready with a reachable database", db: openDB, path: "/readyz", expected: http.StatusOK},
+		{name: "not ready without the database", db: closedDB, path: "/readyz", expected: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := http.NewServeMux()
+			NewHandler(tt.db).RegisterRoutes(router)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rr.Code != tt.expected {
+				t.Errorf("expected status %d, got %d: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
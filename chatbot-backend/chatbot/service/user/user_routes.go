@@ -1,8 +1,9 @@
 package user
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
@@ -65,13 +66,13 @@ func (h *Handler) checkAuth(w http.ResponseWriter, r *http.Request) {
 		"expiresAt": time.Now().Add(auth.GetExpirationDuration()).Format(time.RFC3339),
 	})
 
-	log.Printf("checked cookie for user %s\n", username)
+	slog.DebugContext(r.Context(), "Checked cookie for user")
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	// Parse the form for both application/x-www-form-urlencoded and multipart/form-data
 	if err := r.ParseMultipartForm(1000); err != nil {
-		log.Println("Error parsing login form:", err)
+		slog.ErrorContext(r.Context(), "Error parsing login form", "error", err)
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
@@ -83,30 +84,32 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	if err := utils.Validate.Struct(payload); err != nil {
 		validate_error := err.(validator.ValidationErrors)
-		log.Printf("error validating login payload %s: %s\n", payload.Username, err)
+		slog.WarnContext(r.Context(), "Error validating login payload", "username", payload.Username, "error", err)
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
 		return
 	}
 
-	u, err := h.store.GetUserByName(payload.Username)
+	u, err := h.store.GetUserByName(r.Context(), payload.Username)
 	if err != nil {
-		log.Printf("error querying by username: %s\n", err)
+		slog.WarnContext(r.Context(), "Error querying by username", "username", payload.Username, "error", err)
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("not found, invalid username or password"))
 		return
 	}
 
 	if !auth.ComparePassword(u.Password, []byte(payload.Password)) {
-		log.Printf("someone tried to login with wrong password\n")
+		slog.WarnContext(r.Context(), "Someone tried to login with wrong password", "username", payload.Username)
 		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("not found, invalid username or password"))
 		return
 	}
 
-	go func() {
-		err := h.store.UpdateUserLastlogin(u.Userid)
+	// the update outlives the request, so it keeps the request ID for logging but not its cancellation
+	backgroundCtx := context.WithoutCancel(r.Context())
+	utils.RunInBackground(func() {
+		err := h.store.UpdateUserLastlogin(backgroundCtx, u.Userid)
 		if err != nil {
-			log.Printf("error updating last login time for user %s: %s\n", u.Username, err)
+			slog.ErrorContext(backgroundCtx, "Error updating last login time", "username", u.Username, "error", err)
 		}
-	}()
+	})
 
 	secret := []byte(config.Envs.JWTSecret)
 	token, err := auth.CreateJWT(secret, u.Userid, u.Username)
@@ -133,16 +136,13 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		"expiresAt": time.Now().Add(auth.GetExpirationDuration()).Format(time.RFC3339),
 	})
 
-	log.Printf("user %s logged in\n", u.Username)
-
-	log.Printf("user %s logged in\n", u.Username)
+	slog.InfoContext(r.Context(), "User logged in", "username", u.Username)
 }
 
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	// Parse the form for both application/x-www-form-urlencoded and multipart/form-data
-	log.Println(r.Header.Get("Content-Type"))
 	if err := r.ParseMultipartForm(1000); err != nil {
-		log.Println("Error parsing register form:", err)
+		slog.ErrorContext(r.Context(), "Error parsing register form", "error", err)
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
@@ -154,15 +154,15 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 
 	if err := utils.Validate.Struct(payload); err != nil {
 		validate_error := err.(validator.ValidationErrors)
-		log.Printf("error validating register payload %s: %s\n", payload.Username, err)
+		slog.WarnContext(r.Context(), "Error validating register payload", "username", payload.Username, "error", err)
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
 		return
 	}
 
 	// check if user exists
-	_, err := h.store.GetUserByName(payload.Username)
+	_, err := h.store.GetUserByName(r.Context(), payload.Username)
 	if err == nil {
-		log.Printf("user %s already exists\n", payload.Username)
+		slog.InfoContext(r.Context(), "User already exists", "username", payload.Username)
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user %s already exists", payload.Username))
 		return
 	}
@@ -173,7 +173,7 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.CreateUser(types.RegisterUserPayload{
+	err = h.store.CreateUser(r.Context(), types.RegisterUserPayload{
 		Username: payload.Username,
 		Password: hashedPassword,
 	})
@@ -1,11 +1,13 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
 )
@@ -18,8 +20,10 @@ func NewStore(db *sql.DB) types.UserStoreInterface {
 	return &UserStore{store: db}
 }
 
-func (s *UserStore) GetUserByID(id int) (*types.User, error) {
-	rows, err := s.store.Query("SELECT * FROM users WHERE userid = ?", id)
+func (s *UserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "UserStore.GetUserByID")
+	defer endQuery()
+	rows, err := s.store.QueryContext(ctx, "SELECT * FROM users WHERE userid = ?", id)
 	if err != nil {
 		return nil, err
 	}
@@ -40,17 +44,20 @@ func (s *UserStore) GetUserByID(id int) (*types.User, error) {
 	return user, nil
 }
 
-func (s *UserStore) CreateUser(newUser types.RegisterUserPayload) error {
+func (s *UserStore) CreateUser(ctx context.Context, newUser types.RegisterUserPayload) error {
+	ctx, endQuery := db.TrackQuery(ctx, "UserStore.CreateUser")
+	defer endQuery()
 	username := newUser.Username
 	password := newUser.Password
 	createdDate, err := utils.GetCurrentTime()
 	if err != nil {
-		log.Println("unable to obtain formatted date for creating user")
+		slog.WarnContext(ctx, "unable to obtain formatted date for creating user")
 		createdDate = config.Envs.Default_Time // default time if time util fails
 	}
 	lastLogin := createdDate
 
-	_, dberr := s.store.Exec(
+	_, dberr := s.store.ExecContext(
+		ctx,
 		"INSERT INTO users (username, password, createddate, lastlogin) VALUES (?, ?, ?, ?)",
 		username,
 		password,
@@ -59,28 +66,32 @@ func (s *UserStore) CreateUser(newUser types.RegisterUserPayload) error {
 	)
 
 	if dberr != nil {
-		log.Println(dberr)
+		slog.ErrorContext(ctx, "Database error", "error", dberr)
 	}
 
 	return nil
 }
 
-func (s *UserStore) UpdateUserLastlogin(userid int) error {
+func (s *UserStore) UpdateUserLastlogin(ctx context.Context, userid int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "UserStore.UpdateUserLastlogin")
+	defer endQuery()
 	currentTime, err := utils.GetCurrentTime()
 	if err != nil {
-		log.Println("unable to obtain formatted date for updating user lastlogin")
+		slog.WarnContext(ctx, "unable to obtain formatted date for updating user lastlogin")
 	}
 
-	_, dberr := s.store.Exec("UPDATE users SET lastlogin=? WHERE userid=?", currentTime, userid)
+	_, dberr := s.store.ExecContext(ctx, "UPDATE users SET lastlogin=? WHERE userid=?", currentTime, userid)
 	if dberr != nil {
-		log.Println(dberr)
+		slog.ErrorContext(ctx, "Database error", "error", dberr)
 	}
 
 	return nil
 }
 
-func (s *UserStore) GetUserByName(username string) (*types.User, error) {
-	rows, err := s.store.Query("SELECT * FROM users WHERE username = ?", username)
+func (s *UserStore) GetUserByName(ctx context.Context, username string) (*types.User, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "UserStore.GetUserByName")
+	defer endQuery()
+	rows, err := s.store.QueryContext(ctx, "SELECT * FROM users WHERE username = ?", username)
 	if err != nil {
 		return nil, err
 	}
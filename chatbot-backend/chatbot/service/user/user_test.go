@@ -2,6 +2,7 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -112,18 +113,18 @@ func TestUserServiceRegisterHandler(t *testing.T) {
 
 type mockUserStore struct{}
 
-func (m *mockUserStore) GetUserByName(username string) (*types.User, error) {
+func (m *mockUserStore) GetUserByName(ctx context.Context, username string) (*types.User, error) {
 	return nil, fmt.Errorf("user %s does not exist", username)
 }
 
-func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
 	return nil, fmt.Errorf("user %d does not exist", id)
 }
 
-func (m *mockUserStore) CreateUser(types.RegisterUserPayload) error {
+func (m *mockUserStore) CreateUser(context.Context, types.RegisterUserPayload) error {
 	return nil
 }
 
-func (m *mockUserStore) UpdateUserLastlogin(int) error {
+func (m *mockUserStore) UpdateUserLastlogin(context.Context, int) error {
 	return nil
 }
@@ -0,0 +1,43 @@
+package workspace
+
+import (
+	"context"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+var roleRank = map[string]int{
+	types.WorkspaceRoleViewer: 1,
+	types.WorkspaceRoleEditor: 2,
+	types.WorkspaceRoleOwner:  3,
+}
+
+// RoleAtLeast reports whether role grants at least the permissions of required
+func RoleAtLeast(role string, required string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[required]
+}
+
+// ChatbotRole returns the effective role of the user on the chatbot.
+// The creator of a chatbot is always its owner, otherwise the user's role in the
+// chatbot's workspace applies. An empty string means the user has no access.
+func ChatbotRole(ctx context.Context, store types.WorkspaceStoreInterface, username string, chatbot *types.Chatbot) (string, error) {
+	if username == "" || chatbot == nil {
+		return "", nil
+	}
+	if chatbot.Username == username {
+		return types.WorkspaceRoleOwner, nil
+	}
+	if chatbot.Workspaceid == 0 {
+		return "", nil
+	}
+	return store.GetMemberRole(ctx, chatbot.Workspaceid, username)
+}
+
+// CanAccessChatbot reports whether the user has at least the required role on the chatbot
+func CanAccessChatbot(ctx context.Context, store types.WorkspaceStoreInterface, username string, chatbot *types.Chatbot, required string) (bool, error) {
+	role, err := ChatbotRole(ctx, store, username, chatbot)
+	if err != nil {
+		return false, err
+	}
+	return RoleAtLeast(role, required), nil
+}
@@ -0,0 +1,74 @@
+package workspace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		expected bool
+	}{
+		{types.WorkspaceRoleOwner, types.WorkspaceRoleEditor, true},
+		{types.WorkspaceRoleEditor, types.WorkspaceRoleEditor, true},
+		{types.WorkspaceRoleViewer, types.WorkspaceRoleEditor, false},
+		{types.WorkspaceRoleViewer, types.WorkspaceRoleViewer, true},
+		{"", types.WorkspaceRoleViewer, false},
+		{"unknown", types.WorkspaceRoleViewer, false},
+	}
+
+	for _, test := range tests {
+		if got := RoleAtLeast(test.role, test.required); got != test.expected {
+			t.Errorf("RoleAtLeast(%q, %q) expected %t, got %t", test.role, test.required, test.expected, got)
+		}
+	}
+}
+
+func TestChatbotRole(t *testing.T) {
+	store := &mockWorkspaceStore{roles: map[string]string{
+		"editoruser": types.WorkspaceRoleEditor,
+		"vieweruser": types.WorkspaceRoleViewer,
+	}}
+
+	workspaceBot := &types.Chatbot{Chatbotid: 1, Username: "creator", Workspaceid: 7}
+	personalBot := &types.Chatbot{Chatbotid: 2, Username: "creator"}
+
+	tests := []struct {
+		name     string
+		username string
+		chatbot  *types.Chatbot
+		expected string
+	}{
+		{"creator owns chatbot", "creator", workspaceBot, types.WorkspaceRoleOwner},
+		{"workspace editor", "editoruser", workspaceBot, types.WorkspaceRoleEditor},
+		{"workspace viewer", "vieweruser", workspaceBot, types.WorkspaceRoleViewer},
+		{"non member", "stranger", workspaceBot, ""},
+		{"personal chatbot ignores workspace roles", "editoruser", personalBot, ""},
+		{"anonymous user", "", workspaceBot, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			role, err := ChatbotRole(context.Background(), store, test.username, test.chatbot)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if role != test.expected {
+				t.Errorf("expected role %q, got %q", test.expected, role)
+			}
+		})
+	}
+}
+
+type mockWorkspaceStore struct {
+	types.WorkspaceStoreInterface
+	roles map[string]string
+}
+
+func (m *mockWorkspaceStore) GetMemberRole(ctx context.Context, workspaceID int, username string) (string, error) {
+	return m.roles[username], nil
+}
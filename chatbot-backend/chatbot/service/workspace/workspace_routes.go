@@ -0,0 +1,405 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/auth"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrWorkspaceNotFound = errors.New("workspace not found")
+var ErrInvitationNotFound = errors.New("invitation not found")
+
+type Handler struct {
+	workspaceStore types.WorkspaceStoreInterface
+	userStore      types.UserStoreInterface
+}
+
+func NewHandler(workspaceStore types.WorkspaceStoreInterface, userStore types.UserStoreInterface) *Handler {
+	return &Handler{
+		workspaceStore: workspaceStore,
+		userStore:      userStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Hello from workspace")
+	})
+	router.HandleFunc("GET /list", auth.WithJWTAuth(h.GetUserWorkspaces, h.userStore))
+	router.HandleFunc("POST /", auth.WithJWTAuth(h.CreateWorkspace, h.userStore))
+	router.HandleFunc("GET /{workspaceid}", auth.WithJWTAuth(h.GetWorkspace, h.userStore))
+	router.HandleFunc("DELETE /{workspaceid}", auth.WithJWTAuth(h.DeleteWorkspace, h.userStore))
+	router.HandleFunc("PUT /{workspaceid}/members/{username}", auth.WithJWTAuth(h.UpdateMember, h.userStore))
+	router.HandleFunc("DELETE /{workspaceid}/members/{username}", auth.WithJWTAuth(h.RemoveMember, h.userStore))
+	router.HandleFunc("POST /{workspaceid}/invitations", auth.WithJWTAuth(h.InviteMember, h.userStore))
+	router.HandleFunc("GET /invitations", auth.WithJWTAuth(h.GetUserInvitations, h.userStore))
+	router.HandleFunc("POST /invitations/{inviteid}/accept", auth.WithJWTAuth(h.AcceptInvitation, h.userStore))
+	router.HandleFunc("POST /invitations/{inviteid}/decline", auth.WithJWTAuth(h.DeclineInvitation, h.userStore))
+}
+
+func (h *Handler) GetUserWorkspaces(w http.ResponseWriter, r *http.Request) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return
+	}
+
+	workspaces, err := h.workspaceStore.GetWorkspacesByUsername(r.Context(), username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting workspaces", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, workspaces)
+}
+
+func (h *Handler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return
+	}
+
+	var payload types.CreateWorkspacePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	workspaceID, err := h.workspaceStore.CreateWorkspace(r.Context(), types.NewWorkspace{
+		Name:  payload.Name,
+		Owner: username,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating workspace", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"workspaceid": workspaceID,
+	})
+}
+
+func (h *Handler) GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	_, workspace, role, ok := h.getWorkspaceForRequest(w, r)
+	if !ok {
+		return
+	}
+	if !RoleAtLeast(role, types.WorkspaceRoleViewer) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	members, err := h.workspaceStore.GetWorkspaceMembers(r.Context(), workspace.Workspaceid)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting members of workspace", "workspaceid", workspace.Workspaceid, "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	workspace.Role = role
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"workspace": workspace,
+		"members":   members,
+	})
+}
+
+func (h *Handler) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	_, workspace, role, ok := h.getWorkspaceForRequest(w, r)
+	if !ok {
+		return
+	}
+	if role != types.WorkspaceRoleOwner {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	if err := h.workspaceStore.DeleteWorkspace(r.Context(), workspace.Workspaceid); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting workspace", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Workspace deleted successfully",
+	})
+}
+
+func (h *Handler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	_, workspace, role, ok := h.getWorkspaceForRequest(w, r)
+	if !ok {
+		return
+	}
+	if role != types.WorkspaceRoleOwner {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	memberName := r.PathValue("username")
+	if memberName == "" || memberName == workspace.Owner {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("cannot change role of workspace owner"))
+		return
+	}
+
+	var payload types.UpdateWorkspaceMemberPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	memberRole, err := h.workspaceStore.GetMemberRole(r.Context(), workspace.Workspaceid, memberName)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if memberRole == "" {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("member not found"))
+		return
+	}
+
+	if err := h.workspaceStore.UpdateMemberRole(r.Context(), workspace.Workspaceid, memberName, payload.Role); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating workspace member", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Member updated successfully",
+	})
+}
+
+// RemoveMember lets the owner remove any other member, or a member leave the workspace
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	username, workspace, role, ok := h.getWorkspaceForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	memberName := r.PathValue("username")
+	if memberName == "" || memberName == workspace.Owner {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("cannot remove workspace owner"))
+		return
+	}
+	if role != types.WorkspaceRoleOwner && memberName != username {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	if err := h.workspaceStore.RemoveMember(r.Context(), workspace.Workspaceid, memberName); err != nil {
+		slog.ErrorContext(r.Context(), "Error removing workspace member", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Member removed successfully",
+	})
+}
+
+func (h *Handler) InviteMember(w http.ResponseWriter, r *http.Request) {
+	username, workspace, role, ok := h.getWorkspaceForRequest(w, r)
+	if !ok {
+		return
+	}
+	if role != types.WorkspaceRoleOwner {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	var payload types.InviteWorkspaceMemberPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
+		return
+	}
+	payload.Username = strings.TrimSpace(payload.Username)
+	if err := utils.Validate.Struct(payload); err != nil {
+		validate_error := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validate_error))
+		return
+	}
+
+	if _, err := h.userStore.GetUserByName(r.Context(), payload.Username); err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user %s not found", payload.Username))
+		return
+	}
+
+	memberRole, err := h.workspaceStore.GetMemberRole(r.Context(), workspace.Workspaceid, payload.Username)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if memberRole != "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user %s is already a member", payload.Username))
+		return
+	}
+
+	inviteID, err := h.workspaceStore.CreateInvitation(r.Context(), types.NewWorkspaceInvitation{
+		Workspaceid: workspace.Workspaceid,
+		Username:    payload.Username,
+		Role:        payload.Role,
+		Invitedby:   username,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating workspace invitation", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"inviteid": inviteID,
+	})
+}
+
+func (h *Handler) GetUserInvitations(w http.ResponseWriter, r *http.Request) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return
+	}
+
+	invitations, err := h.workspaceStore.GetPendingInvitationsByUsername(r.Context(), username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting invitations", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, invitations)
+}
+
+func (h *Handler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := h.getInvitationForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.workspaceStore.AcceptInvitation(r.Context(), invitation.Inviteid); err != nil {
+		if errors.Is(err, ErrInvitationNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Error accepting invitation", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message":     "Invitation accepted",
+		"workspaceid": invitation.Workspaceid,
+	})
+}
+
+func (h *Handler) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := h.getInvitationForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.workspaceStore.DeclineInvitation(r.Context(), invitation.Inviteid); err != nil {
+		slog.ErrorContext(r.Context(), "Error declining invitation", "error", err)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Invitation declined",
+	})
+}
+
+// getWorkspaceForRequest loads the workspace in the path and the caller's role in it.
+// The error response is already written when ok is false.
+func (h *Handler) getWorkspaceForRequest(w http.ResponseWriter, r *http.Request) (username string, workspace *types.Workspace, role string, ok bool) {
+	username = auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return "", nil, "", false
+	}
+
+	workspaceID, err := strconv.Atoi(r.PathValue("workspaceid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid workspace ID"))
+		return "", nil, "", false
+	}
+	logging.AddFields(r.Context(), "workspaceid", workspaceID)
+
+	workspace, err = h.workspaceStore.GetWorkspaceByID(r.Context(), workspaceID)
+	if err != nil {
+		if errors.Is(err, ErrWorkspaceNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+		} else {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return "", nil, "", false
+	}
+
+	role, err = h.workspaceStore.GetMemberRole(r.Context(), workspaceID, username)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return "", nil, "", false
+	}
+	if role == "" {
+		// do not reveal workspaces the user is not a member of
+		utils.WriteError(w, http.StatusNotFound, ErrWorkspaceNotFound)
+		return "", nil, "", false
+	}
+
+	return username, workspace, role, true
+}
+
+// getInvitationForRequest loads the pending invitation in the path, which must be addressed to the caller
+func (h *Handler) getInvitationForRequest(w http.ResponseWriter, r *http.Request) (*types.WorkspaceInvitation, bool) {
+	username := auth.GetUsernameFromContext(r.Context())
+	if username == "" {
+		slog.WarnContext(r.Context(), "username missing in request context set by jwt")
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request"))
+		return nil, false
+	}
+
+	inviteID, err := strconv.Atoi(r.PathValue("inviteid"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid invitation ID"))
+		return nil, false
+	}
+
+	invitation, err := h.workspaceStore.GetInvitationByID(r.Context(), inviteID)
+	if err != nil {
+		if errors.Is(err, ErrInvitationNotFound) {
+			utils.WriteError(w, http.StatusNotFound, err)
+		} else {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+		}
+		return nil, false
+	}
+	if invitation.Username != username || invitation.Status != types.InvitationStatusPending {
+		utils.WriteError(w, http.StatusNotFound, ErrInvitationNotFound)
+		return nil, false
+	}
+
+	return invitation, true
+}
@@ -0,0 +1,356 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/db"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+)
+
+type WorkspaceStore struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) types.WorkspaceStoreInterface {
+	return &WorkspaceStore{db: db}
+}
+
+func (s *WorkspaceStore) GetWorkspaceByID(ctx context.Context, workspaceID int) (*types.Workspace, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.GetWorkspaceByID")
+	defer endQuery()
+	row := s.db.QueryRowContext(ctx, "SELECT workspaceid, name, owner, createddate FROM workspaces WHERE workspaceid=?", workspaceID)
+
+	workspace := new(types.Workspace)
+	err := row.Scan(
+		&workspace.Workspaceid,
+		&workspace.Name,
+		&workspace.Owner,
+		&workspace.Createddate,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, err
+	}
+	return workspace, nil
+}
+
+func (s *WorkspaceStore) GetWorkspacesByUsername(ctx context.Context, username string) ([]types.Workspace, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.GetWorkspacesByUsername")
+	defer endQuery()
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT w.workspaceid, w.name, w.owner, w.createddate, m.role
+		FROM workspaces w JOIN workspace_members m ON w.workspaceid = m.workspaceid
+		WHERE m.username=? ORDER BY w.workspaceid`,
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []types.Workspace{}
+	for rows.Next() {
+		workspace := types.Workspace{}
+		err := rows.Scan(
+			&workspace.Workspaceid,
+			&workspace.Name,
+			&workspace.Owner,
+			&workspace.Createddate,
+			&workspace.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	return workspaces, nil
+}
+
+// CreateWorkspace creates the workspace and adds the owner as its first member
+func (s *WorkspaceStore) CreateWorkspace(ctx context.Context, workspacePayload types.NewWorkspace) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.CreateWorkspace")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO workspaces (name, owner, createddate) VALUES (?, ?, ?)",
+		workspacePayload.Name,
+		workspacePayload.Owner,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO workspace_members (workspaceid, username, role, createddate) VALUES (?, ?, ?, ?)",
+		id,
+		workspacePayload.Owner,
+		types.WorkspaceRoleOwner,
+		currentTime,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// DeleteWorkspace removes the workspace with its members and invitations,
+// chatbots in the workspace are returned to their creators
+func (s *WorkspaceStore) DeleteWorkspace(ctx context.Context, workspaceID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.DeleteWorkspace")
+	defer endQuery()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"UPDATE chatbots SET workspaceid=0 WHERE workspaceid=?",
+		"DELETE FROM workspace_invitations WHERE workspaceid=?",
+		"DELETE FROM workspace_members WHERE workspaceid=?",
+		"DELETE FROM workspaces WHERE workspaceid=?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, workspaceID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *WorkspaceStore) GetWorkspaceMembers(ctx context.Context, workspaceID int) ([]types.WorkspaceMember, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.GetWorkspaceMembers")
+	defer endQuery()
+	rows, err := s.db.QueryContext(ctx, "SELECT workspaceid, username, role, createddate FROM workspace_members WHERE workspaceid=? ORDER BY createddate", workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []types.WorkspaceMember{}
+	for rows.Next() {
+		member := types.WorkspaceMember{}
+		err := rows.Scan(
+			&member.Workspaceid,
+			&member.Username,
+			&member.Role,
+			&member.Createddate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// GetMemberRole returns the role of the user in the workspace, or an empty string if the user is not a member
+func (s *WorkspaceStore) GetMemberRole(ctx context.Context, workspaceID int, username string) (string, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.GetMemberRole")
+	defer endQuery()
+	var role string
+	err := s.db.QueryRowContext(ctx, "SELECT role FROM workspace_members WHERE workspaceid=? AND username=?", workspaceID, username).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+func (s *WorkspaceStore) UpdateMemberRole(ctx context.Context, workspaceID int, username string, role string) error {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.UpdateMemberRole")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "UPDATE workspace_members SET role=? WHERE workspaceid=? AND username=?", role, workspaceID, username)
+	return err
+}
+
+func (s *WorkspaceStore) RemoveMember(ctx context.Context, workspaceID int, username string) error {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.RemoveMember")
+	defer endQuery()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM workspace_members WHERE workspaceid=? AND username=?", workspaceID, username)
+	return err
+}
+
+func (s *WorkspaceStore) GetInvitationByID(ctx context.Context, inviteID int) (*types.WorkspaceInvitation, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.GetInvitationByID")
+	defer endQuery()
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT i.inviteid, i.workspaceid, w.name, i.username, i.role, i.invitedby, i.status, i.createddate
+		FROM workspace_invitations i JOIN workspaces w ON i.workspaceid = w.workspaceid
+		WHERE i.inviteid=?`,
+		inviteID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, ErrInvitationNotFound
+	}
+	return scanRowsIntoInvitation(rows)
+}
+
+func (s *WorkspaceStore) GetPendingInvitationsByUsername(ctx context.Context, username string) ([]types.WorkspaceInvitation, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.GetPendingInvitationsByUsername")
+	defer endQuery()
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT i.inviteid, i.workspaceid, w.name, i.username, i.role, i.invitedby, i.status, i.createddate
+		FROM workspace_invitations i JOIN workspaces w ON i.workspaceid = w.workspaceid
+		WHERE i.username=? AND i.status=? ORDER BY i.inviteid`,
+		username,
+		types.InvitationStatusPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []types.WorkspaceInvitation{}
+	for rows.Next() {
+		invitation, err := scanRowsIntoInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	return invitations, nil
+}
+
+func (s *WorkspaceStore) CreateInvitation(ctx context.Context, invitationPayload types.NewWorkspaceInvitation) (int, error) {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.CreateInvitation")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	res, dberr := s.db.ExecContext(
+		ctx,
+		"INSERT INTO workspace_invitations (workspaceid, username, role, invitedby, status, createddate) VALUES (?, ?, ?, ?, ?, ?)",
+		invitationPayload.Workspaceid,
+		invitationPayload.Username,
+		invitationPayload.Role,
+		invitationPayload.Invitedby,
+		types.InvitationStatusPending,
+		currentTime,
+	)
+	if dberr != nil {
+		return 0, dberr
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// AcceptInvitation marks the invitation as accepted and adds the invited user to the workspace
+func (s *WorkspaceStore) AcceptInvitation(ctx context.Context, inviteID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.AcceptInvitation")
+	defer endQuery()
+	currentTime, _ := utils.GetCurrentTime()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var workspaceID int
+	var username, role string
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT workspaceid, username, role FROM workspace_invitations WHERE inviteid=? AND status=?",
+		inviteID,
+		types.InvitationStatusPending,
+	).Scan(&workspaceID, &username, &role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvitationNotFound
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO workspace_members (workspaceid, username, role, createddate) VALUES (?, ?, ?, ?) ON CONFLICT(workspaceid, username) DO UPDATE SET role=excluded.role",
+		workspaceID,
+		username,
+		role,
+		currentTime,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE workspace_invitations SET status=? WHERE inviteid=?", types.InvitationStatusAccepted, inviteID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *WorkspaceStore) DeclineInvitation(ctx context.Context, inviteID int) error {
+	ctx, endQuery := db.TrackQuery(ctx, "WorkspaceStore.DeclineInvitation")
+	defer endQuery()
+	_, err := s.db.ExecContext(
+		ctx,
+		"UPDATE workspace_invitations SET status=? WHERE inviteid=? AND status=?",
+		types.InvitationStatusDeclined,
+		inviteID,
+		types.InvitationStatusPending,
+	)
+	return err
+}
+
+func scanRowsIntoInvitation(rows *sql.Rows) (*types.WorkspaceInvitation, error) {
+	invitation := new(types.WorkspaceInvitation)
+
+	err := rows.Scan(
+		&invitation.Inviteid,
+		&invitation.Workspaceid,
+		&invitation.Workspacename,
+		&invitation.Username,
+		&invitation.Role,
+		&invitation.Invitedby,
+		&invitation.Status,
+		&invitation.Createddate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
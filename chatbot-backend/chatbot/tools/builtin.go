@@ -0,0 +1,230 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Names of the tools built into the server
+const (
+	BuiltinCurrentTime = "current_time"
+	BuiltinCalculator  = "calculator"
+)
+
+const maxExpressionLength = 1000
+
+type builtin struct {
+	description string
+	parameters  *genai.Schema
+	run         func(args map[string]any) (map[string]any, error)
+}
+
+// builtinNames keeps the built-ins in a stable order when they are listed
+var builtinNames = []string{BuiltinCurrentTime, BuiltinCalculator}
+
+var builtins = map[string]builtin{
+	BuiltinCurrentTime: {
+		description: "Returns the current date and time. Use it whenever the answer depends on today's date or the time.",
+		parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"timezone": {Type: genai.TypeString, Description: "IANA time zone such as Asia/Singapore, defaults to the server's time zone"},
+			},
+		},
+		run: currentTime,
+	},
+	BuiltinCalculator: {
+		description: "Evaluates an arithmetic expression with + - * / % ^ and parentheses. Use it instead of doing arithmetic yourself.",
+		parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"expression": {Type: genai.TypeString, Description: "the expression to evaluate, for example (12.5 + 3) * 4"},
+			},
+			Required: []string{"expression"},
+		},
+		run: calculate,
+	},
+}
+
+func currentTime(args map[string]any) (map[string]any, error) {
+	timezone, _ := args["timezone"].(string)
+	if timezone == "" {
+		timezone = config.Envs.Timezone
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %s", timezone)
+	}
+	now := time.Now().In(location)
+	return map[string]any{
+		"time":     now.Format(time.RFC3339),
+		"weekday":  now.Weekday().String(),
+		"timezone": location.String(),
+	}, nil
+}
+
+func calculate(args map[string]any) (map[string]any, error) {
+	expression, _ := args["expression"].(string)
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("expression is required")
+	}
+	if len(expression) > maxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+	}
+	result, err := evaluate(expression)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"expression": expression, "result": result}, nil
+}
+
+// evaluate computes an arithmetic expression. ^ is exponentiation and binds tighter than unary minus, like in maths
+func evaluate(expression string) (float64, error) {
+	p := &expressionParser{input: expression}
+	result, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != 0 {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos+1)
+	}
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return 0, fmt.Errorf("the result is not a number")
+	}
+	return result, nil
+}
+
+type expressionParser struct {
+	input string
+	pos   int
+}
+
+// peek returns the next character after any whitespace, 0 at the end of the input
+func (p *expressionParser) peek() byte {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *expressionParser) parseSum() (float64, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for p.peek() == '+' || p.peek() == '-' {
+		op := p.peek()
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseProduct() (float64, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for p.peek() == '*' || p.peek() == '/' || p.peek() == '%' {
+		op := p.peek()
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			left *= right
+		case '/':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left /= right
+		case '%':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left = math.Mod(left, right)
+		}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (float64, error) {
+	if p.peek() == '-' || p.peek() == '+' {
+		negative := p.peek() == '-'
+		p.pos++
+		value, err := p.parseUnary()
+		if negative {
+			value = -value
+		}
+		return value, err
+	}
+	return p.parsePower()
+}
+
+func (p *expressionParser) parsePower() (float64, error) {
+	base, err := p.parseOperand()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() == '^' {
+		p.pos++
+		// right associative, 2^3^2 is 2^(3^2)
+		exponent, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(base, exponent), nil
+	}
+	return base, nil
+}
+
+func (p *expressionParser) parseOperand() (float64, error) {
+	if p.peek() == '(' {
+		p.pos++
+		value, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return value, nil
+	}
+
+	p.peek()
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos >= len(p.input) {
+			return 0, fmt.Errorf("unexpected end of expression")
+		}
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos+1)
+	}
+	value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", p.input[start:p.pos])
+	}
+	return value, nil
+}
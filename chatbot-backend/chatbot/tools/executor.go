@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	maxWebhookResponseBytes = 64 * 1024
+	maxWebhookRedirects     = 3
+)
+
+// Executor runs the tool calls of the model for one chatbot
+type Executor struct {
+	tools  map[string]types.ChatbotTool
+	client *http.Client
+}
+
+func NewExecutor(chatbotTools []types.ChatbotTool) *Executor {
+	tools := map[string]types.ChatbotTool{}
+	for _, tool := range chatbotTools {
+		tools[tool.Name] = tool
+	}
+	return &Executor{
+		tools: tools,
+		client: &http.Client{
+			Timeout: time.Duration(config.Envs.ToolTimeoutSeconds) * time.Second,
+			// a webhook cannot send the call on to a host that is not allowed
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxWebhookRedirects {
+					return errors.New("too many redirects")
+				}
+				if !HostAllowed(req.URL.Hostname()) {
+					return fmt.Errorf("redirect to %s is not allowed", req.URL.Hostname())
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// Kind returns the kind of the named tool, empty if the chatbot has no such tool
+func (e *Executor) Kind(name string) string {
+	return e.tools[name].Kind
+}
+
+// Call runs the tool the model called and returns its result. The error is meant to be passed back to the model,
+// so it can tell the user or try something else
+func (e *Executor) Call(ctx context.Context, call genai.FunctionCall) (map[string]any, error) {
+	tool, ok := e.tools[call.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tool %s", call.Name)
+	}
+	args := call.Args
+	if args == nil {
+		args = map[string]any{}
+	}
+
+	if tool.Kind == types.ToolKindBuiltin {
+		builtin, ok := builtins[tool.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown built-in tool %s", tool.Name)
+		}
+		return builtin.run(args)
+	}
+	return e.callWebhook(ctx, tool, args)
+}
+
+// callWebhook posts the arguments to the tool's url as JSON and returns the JSON response.
+// A response that is not a JSON object is returned under the result key
+func (e *Executor) callWebhook(ctx context.Context, tool types.ChatbotTool, args map[string]any) (map[string]any, error) {
+	// the allowed hosts may have changed since the tool was saved
+	if err := checkURL(tool.Url); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tool.Url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading webhook response failed: %v", err)
+	}
+	if len(data) > maxWebhookResponseBytes {
+		return nil, fmt.Errorf("webhook response is larger than %dKB", maxWebhookResponseBytes/1024)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return decodeResult(data), nil
+}
+
+func decodeResult(data []byte) map[string]any {
+	var result map[string]any
+	if err := json.Unmarshal(data, &result); err == nil && result != nil {
+		return result
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err == nil {
+		return map[string]any{"result": value}
+	}
+	return map[string]any{"result": string(data)}
+}
@@ -0,0 +1,192 @@
+// Package tools lets chatbots call functions while answering: webhooks declared by the owner
+// and tools built into the server
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/validate"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// MaxToolsPerChatbot keeps the function declarations sent with every message small
+const MaxToolsPerChatbot = 16
+
+// jsonSchema is the subset of JSON schema the model understands for function arguments
+type jsonSchema struct {
+	Type        string                 `json:"type"`
+	Description string                 `json:"description,omitempty"`
+	Format      string                 `json:"format,omitempty"`
+	Nullable    bool                   `json:"nullable,omitempty"`
+	Enum        []string               `json:"enum,omitempty"`
+	Items       *jsonSchema            `json:"items,omitempty"`
+	Properties  map[string]*jsonSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+}
+
+var schemaTypes = map[string]genai.Type{
+	"string":  genai.TypeString,
+	"number":  genai.TypeNumber,
+	"integer": genai.TypeInteger,
+	"boolean": genai.TypeBoolean,
+	"array":   genai.TypeArray,
+	"object":  genai.TypeObject,
+}
+
+// Validate checks a tool before it is saved. Built-in tools must use the name of one of the built-ins,
+// webhooks need a JSON schema for their arguments, if they take any, and a url on an allowed host
+func Validate(tool types.NewChatbotTool) error {
+	if !validate.ValidToolNameRegex.MatchString(tool.Name) {
+		return fmt.Errorf("tool name must start with a letter or underscore and only contain letters, numbers, underscores or dashes")
+	}
+
+	switch tool.Kind {
+	case types.ToolKindBuiltin:
+		if _, ok := builtins[tool.Name]; !ok {
+			return fmt.Errorf("unknown built-in tool %s", tool.Name)
+		}
+		return nil
+	case types.ToolKindWebhook:
+		if tool.Description == "" {
+			return fmt.Errorf("webhook tools need a description so the model knows when to call them")
+		}
+		if _, err := parseSchema(tool.Parameters); err != nil {
+			return err
+		}
+		return checkURL(tool.Url)
+	default:
+		return fmt.Errorf("unknown tool kind %s", tool.Kind)
+	}
+}
+
+// Declarations returns the tools of the chatbot as function declarations for the model,
+// tools that are no longer valid are left out
+func Declarations(chatbotTools []types.ChatbotTool) []*genai.FunctionDeclaration {
+	declarations := []*genai.FunctionDeclaration{}
+	for _, tool := range chatbotTools {
+		if tool.Kind == types.ToolKindBuiltin {
+			builtin, ok := builtins[tool.Name]
+			if !ok {
+				continue
+			}
+			description := builtin.description
+			if tool.Description != "" {
+				description = tool.Description
+			}
+			declarations = append(declarations, &genai.FunctionDeclaration{
+				Name:        tool.Name,
+				Description: description,
+				Parameters:  builtin.parameters,
+			})
+			continue
+		}
+
+		parameters, err := parseSchema(tool.Parameters)
+		if err != nil {
+			continue
+		}
+		declarations = append(declarations, &genai.FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  parameters,
+		})
+	}
+	return declarations
+}
+
+// Builtins lists the tools built into the server that owners can add to their chatbots
+func Builtins() []types.ChatbotTool {
+	list := []types.ChatbotTool{}
+	for _, name := range builtinNames {
+		list = append(list, types.ChatbotTool{
+			Name:        name,
+			Description: builtins[name].description,
+			Kind:        types.ToolKindBuiltin,
+		})
+	}
+	return list
+}
+
+// parseSchema turns the JSON schema of a tool's arguments into the schema the model takes.
+// Tools without arguments have no schema
+func parseSchema(parameters string) (*genai.Schema, error) {
+	if strings.TrimSpace(parameters) == "" {
+		return nil, nil
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal([]byte(parameters), &schema); err != nil {
+		return nil, fmt.Errorf("parameters must be a JSON schema: %v", err)
+	}
+	if schema.Type != "object" {
+		return nil, fmt.Errorf("parameters must be a JSON schema of type object")
+	}
+	return convertSchema(&schema, "parameters")
+}
+
+func convertSchema(schema *jsonSchema, path string) (*genai.Schema, error) {
+	schemaType, ok := schemaTypes[schema.Type]
+	if !ok {
+		return nil, fmt.Errorf("%s has unsupported type %q", path, schema.Type)
+	}
+	converted := &genai.Schema{
+		Type:        schemaType,
+		Description: schema.Description,
+		Format:      schema.Format,
+		Nullable:    schema.Nullable,
+		Enum:        schema.Enum,
+		Required:    schema.Required,
+	}
+
+	switch schemaType {
+	case genai.TypeArray:
+		if schema.Items == nil {
+			return nil, fmt.Errorf("%s is an array without items", path)
+		}
+		items, err := convertSchema(schema.Items, path+".items")
+		if err != nil {
+			return nil, err
+		}
+		converted.Items = items
+	case genai.TypeObject:
+		converted.Properties = map[string]*genai.Schema{}
+		for name, property := range schema.Properties {
+			if property == nil {
+				return nil, fmt.Errorf("%s.%s has no schema", path, name)
+			}
+			convertedProperty, err := convertSchema(property, path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			converted.Properties[name] = convertedProperty
+		}
+		for _, name := range schema.Required {
+			if _, ok := schema.Properties[name]; !ok {
+				return nil, fmt.Errorf("%s requires %s, which is not one of its properties", path, name)
+			}
+		}
+	}
+	return converted, nil
+}
+
+// checkURL checks that a webhook url is http or https on one of the hosts in TOOL_ALLOWED_HOSTS
+func checkURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook url must be an http or https url")
+	}
+	if !HostAllowed(parsed.Hostname()) {
+		return fmt.Errorf("webhook host %s is not allowed", parsed.Hostname())
+	}
+	return nil
+}
+
+// HostAllowed reports whether webhooks may call the host. TOOL_ALLOWED_HOSTS is a comma separated list
+// of hosts, where *.example.com allows the subdomains of example.com. No host is allowed when it is empty
+func HostAllowed(host string) bool {
+	return validate.HostInList(host, config.Envs.ToolAllowedHosts)
+}
@@ -0,0 +1,173 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 / 4", 2.5},
+		{"10 % 4", 2},
+		{"-2 ^ 2", -4},
+		{"2 ^ 3 ^ 2", 512},
+		{"-(3 - 5)", 2},
+		{"12.5 * 4", 50},
+	}
+	for _, tt := range tests {
+		result, err := evaluate(tt.expression)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.expression, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.expression, tt.expected, result)
+		}
+	}
+
+	for _, expression := range []string{"1 +", "1 / 0", "(1 + 2", "2 * x", "1.2.3", "1 2"} {
+		if _, err := evaluate(expression); err == nil {
+			t.Errorf("%s: expected an error", expression)
+		}
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	config.Envs.ToolAllowedHosts = "api.example.com, *.hooks.example.org,[::1]"
+	tests := map[string]bool{
+		"api.example.com":       true,
+		"API.example.com.":      true,
+		"other.example.com":     false,
+		"a.hooks.example.org":   true,
+		"hooks.example.org":     false,
+		"evilhooks.example.org": false,
+		"::1":                   true,
+		"":                      false,
+	}
+	for host, expected := range tests {
+		if allowed := HostAllowed(host); allowed != expected {
+			t.Errorf("%q: expected allowed to be %t", host, expected)
+		}
+	}
+
+	config.Envs.ToolAllowedHosts = ""
+	if HostAllowed("api.example.com") {
+		t.Error("expected no host to be allowed without TOOL_ALLOWED_HOSTS")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config.Envs.ToolAllowedHosts = "api.example.com"
+	valid := []types.NewChatbotTool{
+		{Name: BuiltinCalculator, Kind: types.ToolKindBuiltin},
+		{Name: "lookup_order", Description: "Looks up an order", Kind: types.ToolKindWebhook, Url: "https://api.example.com/orders",
+			Parameters: `{"type":"object","properties":{"id":{"type":"string"},"items":{"type":"array","items":{"type":"integer"}}},"required":["id"]}`},
+		{Name: "ping", Description: "Checks the service", Kind: types.ToolKindWebhook, Url: "https://api.example.com/ping"},
+	}
+	for _, tool := range valid {
+		if err := Validate(tool); err != nil {
+			t.Errorf("%s: unexpected error %v", tool.Name, err)
+		}
+	}
+
+	invalid := map[string]types.NewChatbotTool{
+		"bad name":          {Name: "look up", Description: "x", Kind: types.ToolKindWebhook, Url: "https://api.example.com"},
+		"unknown builtin":   {Name: "weather", Kind: types.ToolKindBuiltin},
+		"host not allowed":  {Name: "t", Description: "x", Kind: types.ToolKindWebhook, Url: "https://internal.local/hook"},
+		"not http":          {Name: "t", Description: "x", Kind: types.ToolKindWebhook, Url: "file:///etc/passwd"},
+		"no description":    {Name: "t", Kind: types.ToolKindWebhook, Url: "https://api.example.com"},
+		"not an object":     {Name: "t", Description: "x", Kind: types.ToolKindWebhook, Url: "https://api.example.com", Parameters: `{"type":"string"}`},
+		"unknown type":      {Name: "t", Description: "x", Kind: types.ToolKindWebhook, Url: "https://api.example.com", Parameters: `{"type":"object","properties":{"a":{"type":"date"}}}`},
+		"missing required":  {Name: "t", Description: "x", Kind: types.ToolKindWebhook, Url: "https://api.example.com", Parameters: `{"type":"object","required":["a"]}`},
+		"array no items":    {Name: "t", Description: "x", Kind: types.ToolKindWebhook, Url: "https://api.example.com", Parameters: `{"type":"object","properties":{"a":{"type":"array"}}}`},
+		"invalid json":      {Name: "t", Description: "x", Kind: types.ToolKindWebhook, Url: "https://api.example.com", Parameters: `{`},
+		"unknown tool kind": {Name: "t", Kind: "script"},
+	}
+	for name, tool := range invalid {
+		if err := Validate(tool); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDeclarations(t *testing.T) {
+	declarations := Declarations([]types.ChatbotTool{
+		{Name: BuiltinCurrentTime, Kind: types.ToolKindBuiltin},
+		{Name: "lookup_order", Description: "Looks up an order", Kind: types.ToolKindWebhook, Parameters: `{"type":"object","properties":{"id":{"type":"string"}}}`},
+		{Name: "broken", Description: "Saved before its schema was checked", Kind: types.ToolKindWebhook, Parameters: `{"type":"string"}`},
+	})
+	if len(declarations) != 2 {
+		t.Fatalf("expected the invalid tool to be left out, got %d declarations", len(declarations))
+	}
+	if declarations[0].Description == "" || declarations[0].Parameters.Properties["timezone"] == nil {
+		t.Errorf("expected the built-in description and parameters, got %+v", declarations[0])
+	}
+	if declarations[1].Parameters.Properties["id"].Type != genai.TypeString {
+		t.Errorf("expected the id argument to be a string, got %+v", declarations[1].Parameters)
+	}
+}
+
+func TestExecutorCallsWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var args map[string]any
+		json.NewDecoder(r.Body).Decode(&args)
+		switch r.URL.Path {
+		case "/order":
+			json.NewEncoder(w).Encode(map[string]any{"id": args["id"], "status": "shipped"})
+		case "/text":
+			w.Write([]byte("plain answer"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	config.Envs.ToolAllowedHosts = serverURL.Hostname()
+	config.Envs.ToolTimeoutSeconds = 5
+
+	executor := NewExecutor([]types.ChatbotTool{
+		{Name: "order", Kind: types.ToolKindWebhook, Url: server.URL + "/order"},
+		{Name: "text", Kind: types.ToolKindWebhook, Url: server.URL + "/text"},
+		{Name: "fail", Kind: types.ToolKindWebhook, Url: server.URL + "/fail"},
+		{Name: BuiltinCalculator, Kind: types.ToolKindBuiltin},
+	})
+	ctx := context.Background()
+
+	result, err := executor.Call(ctx, genai.FunctionCall{Name: "order", Args: map[string]any{"id": "A1"}})
+	if err != nil || result["id"] != "A1" || result["status"] != "shipped" {
+		t.Errorf("expected the webhook response, got %v %v", result, err)
+	}
+	result, err = executor.Call(ctx, genai.FunctionCall{Name: "text"})
+	if err != nil || result["result"] != "plain answer" {
+		t.Errorf("expected the text response under result, got %v %v", result, err)
+	}
+	if _, err := executor.Call(ctx, genai.FunctionCall{Name: "fail"}); err == nil {
+		t.Error("expected an error for a failed webhook")
+	}
+	if _, err := executor.Call(ctx, genai.FunctionCall{Name: "delete_everything"}); err == nil {
+		t.Error("expected an error for a tool the chatbot does not have")
+	}
+	result, err = executor.Call(ctx, genai.FunctionCall{Name: BuiltinCalculator, Args: map[string]any{"expression": "6 * 7"}})
+	if err != nil || result["result"] != float64(42) {
+		t.Errorf("expected the calculator result, got %v %v", result, err)
+	}
+
+	// the host is checked again when the tool is called
+	config.Envs.ToolAllowedHosts = "api.example.com"
+	if _, err := executor.Call(ctx, genai.FunctionCall{Name: "order"}); err == nil {
+		t.Error("expected an error once the host is no longer allowed")
+	}
+}
@@ -0,0 +1,145 @@
+package transcript
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+// The PDF is laid out on A4 pages in Courier, whose fixed width lets lines be wrapped by counting characters
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	pageMargin   = 50
+	fontSize     = 10
+	lineHeight   = 13
+	charsPerLine = (pageWidth - 2*pageMargin) * 10 / (fontSize * 6) // Courier glyphs are 0.6em wide
+	linesPerPage = (pageHeight - 2*pageMargin) / lineHeight
+)
+
+// winAnsi maps the characters outside Latin-1 that the standard PDF fonts can show to their WinAnsiEncoding code
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+type pdfLine struct {
+	text string
+	bold bool
+}
+
+// PDF renders the transcript as a text PDF using the fonts every reader has built in, so no font is embedded.
+// Characters those fonts cannot show are replaced with a question mark
+func PDF(transcript types.ConversationTranscript) []byte {
+	lines := []pdfLine{{text: "Conversation with " + transcript.Chatbotname, bold: true}}
+	lines = appendWrapped(lines, "Conversation: "+transcript.Conversationid, false)
+	if transcript.Branch != 0 {
+		lines = appendWrapped(lines, fmt.Sprintf("Branch: %d", transcript.Branch), false)
+	}
+	lines = appendWrapped(lines, "Exported: "+transcript.Exporteddate, false)
+	for _, message := range transcript.Messages {
+		lines = append(lines, pdfLine{})
+		lines = appendWrapped(lines, speaker(transcript, message)+" - "+message.Createddate, true)
+		for _, paragraph := range strings.Split(strings.TrimSpace(message.Text), "\n") {
+			lines = appendWrapped(lines, paragraph, false)
+		}
+		if message.Interrupted {
+			lines = appendWrapped(lines, "(The response was interrupted.)", false)
+		}
+	}
+
+	pages := [][]pdfLine{}
+	for len(lines) > linesPerPage {
+		pages = append(pages, lines[:linesPerPage])
+		lines = lines[linesPerPage:]
+	}
+	pages = append(pages, lines)
+	return writePDF(pages)
+}
+
+// appendWrapped splits text into lines that fit the page, breaking between words where it can
+func appendWrapped(lines []pdfLine, text string, bold bool) []pdfLine {
+	text = strings.ReplaceAll(strings.TrimRight(text, " \r"), "\t", "    ")
+	if text == "" {
+		return append(lines, pdfLine{bold: bold})
+	}
+	for text != "" {
+		if utf8.RuneCountInString(text) <= charsPerLine {
+			return append(lines, pdfLine{text: text, bold: bold})
+		}
+		runes := []rune(text)
+		cut := charsPerLine
+		if space := strings.LastIndex(string(runes[:charsPerLine+1]), " "); space > 0 {
+			cut = utf8.RuneCountInString(string(runes[:charsPerLine+1])[:space])
+		}
+		lines = append(lines, pdfLine{text: strings.TrimRight(string(runes[:cut]), " "), bold: bold})
+		text = strings.TrimLeft(string(runes[cut:]), " ")
+	}
+	return lines
+}
+
+// writePDF writes the catalog, the page tree, the two fonts, then a page and its content stream for each page
+func writePDF(pages [][]pdfLine) []byte {
+	var buf bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	kids := []string{}
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n%d TL\n%d %d Td\n", lineHeight, pageMargin, pageHeight-pageMargin)
+		for _, line := range page {
+			font := "F1"
+			if line.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "/%s %d Tf\n(%s) Tj\nT*\n", font, fontSize, pdfString(line.text))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfString encodes text as the contents of a PDF literal string in WinAnsiEncoding
+func pdfString(text string) string {
+	var buf strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			buf.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			buf.WriteByte(byte(r))
+		case winAnsi[r] != 0:
+			buf.WriteByte(winAnsi[r])
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	return buf.String()
+}
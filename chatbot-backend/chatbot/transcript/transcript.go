@@ -0,0 +1,94 @@
+// Package transcript renders the messages of a conversation for download as JSON, Markdown or PDF
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+// Version of the ConversationTranscript JSON schema
+const Version = 1
+
+// Formats a transcript can be rendered in
+const (
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+	FormatPDF      = "pdf"
+)
+
+// New builds the transcript of messages, the ordered messages of a branch of the conversation
+func New(chatbot types.Chatbot, conversationID string, branch int, messages []types.Conversation, exportedDate string) types.ConversationTranscript {
+	transcript := types.ConversationTranscript{
+		Version:        Version,
+		Conversationid: conversationID,
+		Owner:          chatbot.Username,
+		Chatbotname:    chatbot.Chatbotname,
+		Branch:         branch,
+		Exporteddate:   exportedDate,
+		Messages:       []types.TranscriptMessage{},
+	}
+	for _, message := range messages {
+		transcript.Messages = append(transcript.Messages, types.TranscriptMessage{
+			Chatid:      message.Chatid,
+			Sequence:    message.Sequence,
+			Role:        message.Role,
+			Text:        message.Chat,
+			Createddate: message.Createddate,
+			Revisionid:  message.Revisionid,
+			Interrupted: message.Interrupted,
+		})
+	}
+	return transcript
+}
+
+// Render returns the transcript in format with the content type and file extension to download it with
+func Render(transcript types.ConversationTranscript, format string) (content []byte, contentType string, extension string, err error) {
+	switch format {
+	case FormatMarkdown:
+		return Markdown(transcript), "text/markdown; charset=utf-8", "md", nil
+	case FormatJSON:
+		content, err := JSON(transcript)
+		return content, "application/json", "json", err
+	case FormatPDF:
+		return PDF(transcript), "application/pdf", "pdf", nil
+	}
+	return nil, "", "", fmt.Errorf("unknown transcript format %s", format)
+}
+
+func JSON(transcript types.ConversationTranscript) ([]byte, error) {
+	return json.MarshalIndent(transcript, "", "  ")
+}
+
+func Markdown(transcript types.ConversationTranscript) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Conversation with %s\n\n", transcript.Chatbotname)
+	fmt.Fprintf(&buf, "- Conversation: %s\n", transcript.Conversationid)
+	if transcript.Branch != 0 {
+		fmt.Fprintf(&buf, "- Branch: %d\n", transcript.Branch)
+	}
+	fmt.Fprintf(&buf, "- Exported: %s\n", transcript.Exporteddate)
+
+	for _, message := range transcript.Messages {
+		fmt.Fprintf(&buf, "\n## %s\n\n_%s_\n\n", speaker(transcript, message), message.Createddate)
+		if text := strings.TrimSpace(message.Text); text != "" {
+			buf.WriteString(text)
+			buf.WriteString("\n")
+		}
+		if message.Interrupted {
+			buf.WriteString("\n_The response was interrupted._\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// speaker names who sent the message, the chatbot or the visitor
+func speaker(transcript types.ConversationTranscript, message types.TranscriptMessage) string {
+	if message.Role == "model" {
+		return transcript.Chatbotname
+	}
+	return "User"
+}
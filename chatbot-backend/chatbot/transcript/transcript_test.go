@@ -0,0 +1,101 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+func testTranscript() types.ConversationTranscript {
+	return New(types.Chatbot{Username: "owner", Chatbotname: "bot"}, "conv", 2, []types.Conversation{
+		{Chatid: 1, Sequence: 1, Role: "user", Chat: "What are the opening hours (today)?", Createddate: "19 Oct 26 10:00 +0800"},
+		{Chatid: 4, Sequence: 2, Role: "model", Chat: "9am – 5pm\n\nSee you!", Createddate: "19 Oct 26 10:00 +0800", Revisionid: 3, Interrupted: true},
+	}, "19 Oct 26 11:00 +0800")
+}
+
+func TestJSON(t *testing.T) {
+	content, err := JSON(testTranscript())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded types.ConversationTranscript
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version != Version || decoded.Branch != 2 || len(decoded.Messages) != 2 {
+		t.Fatalf("unexpected transcript %+v", decoded)
+	}
+	if message := decoded.Messages[1]; message.Chatid != 4 || message.Role != "model" || message.Revisionid != 3 || !message.Interrupted {
+		t.Errorf("unexpected message %+v", message)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	expected := `# Conversation with bot
+
+- Conversation: conv
+- Branch: 2
+- Exported: 19 Oct 26 11:00 +0800
+
+## User
+
+_19 Oct 26 10:00 +0800_
+
+What are the opening hours (today)?
+
+## bot
+
+_19 Oct 26 10:00 +0800_
+
+9am – 5pm
+
+See you!
+
+_The response was interrupted._
+`
+	if content := string(Markdown(testTranscript())); content != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, content)
+	}
+}
+
+func TestPDF(t *testing.T) {
+	long := testTranscript()
+	long.Messages[0].Text = strings.Repeat("word ", 2000)
+	content := PDF(long)
+
+	if !bytes.HasPrefix(content, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(content, []byte("%%EOF\n")) {
+		t.Fatal("expected a PDF header and trailer")
+	}
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(content)
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(content[xref:], []byte("xref\n")) {
+		t.Fatalf("expected startxref to point at the xref table")
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(content, -1)
+	for i, offset := range offsets {
+		position, _ := strconv.Atoi(string(offset[1]))
+		if object := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(content[position:], []byte(object)) {
+			t.Errorf("expected xref entry %d to point at %q", i+1, object)
+		}
+	}
+
+	// 10000 characters wrap to about 122 lines of 82, which take three pages
+	if !bytes.Contains(content, []byte("/Count 3 ")) {
+		t.Errorf("expected the long message to span three pages")
+	}
+	if !bytes.Contains(content, []byte("(9am \x96 5pm) Tj")) {
+		t.Errorf("expected the en dash in WinAnsiEncoding")
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	if escaped := pdfString(`a (b) \ é 你`); escaped != "a \\(b\\) \\\\ \xe9 ?" {
+		t.Errorf("unexpected escaping %q", escaped)
+	}
+}
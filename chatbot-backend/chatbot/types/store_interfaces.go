@@ -1,39 +1,150 @@
 package types
 
+import (
+	"context"
+)
+
 // UserStoreInterface defines the methods for user store
 type UserStoreInterface interface {
-	GetUserByID(id int) (*User, error)
-	GetUserByName(username string) (*User, error)
-	CreateUser(user RegisterUserPayload) error
-	UpdateUserLastlogin(userID int) error
+	GetUserByID(ctx context.Context, id int) (*User, error)
+	GetUserByName(ctx context.Context, username string) (*User, error)
+	CreateUser(ctx context.Context, user RegisterUserPayload) error
+	UpdateUserLastlogin(ctx context.Context, userID int) error
 }
 
 // ChatbotStoreInterface defines the methods for chatbot store
 type ChatbotStoreInterface interface {
-	GetChatbotsByID(chatbotID int) (*Chatbot, error)
-	GetChatbotsByUsername(username string) ([]Chatbot, error)
-	GetChatbotByName(username string, chatbotName string) (*Chatbot, error)
-	CreateChatbot(userPayload NewChatbot) (int, error)
-	UpdateChatbot(chatbotPayload UpdateChatbot) error
-	DeleteChatbot(chatbotID int) error
-	UpdateChatbotLastused(chatbotPayload UpdateChatbotLastused) error
+	GetChatbotsByID(ctx context.Context, chatbotID int) (*Chatbot, error)
+	GetChatbotsByUsername(ctx context.Context, username string) ([]Chatbot, error)
+	GetChatbotByName(ctx context.Context, username string, chatbotName string) (*Chatbot, error)
+	GetChatbotsByWorkspaceID(ctx context.Context, workspaceID int) ([]Chatbot, error)
+	CreateChatbot(ctx context.Context, userPayload NewChatbot, revisionPayload NewChatbotRevision) (int, error)
+	UpdateChatbot(ctx context.Context, chatbotPayload UpdateChatbot, revisionPayload NewChatbotRevision) (*ChatbotRevision, error)
+	DeleteChatbot(ctx context.Context, chatbotID int) error
+	UpdateChatbotLastused(ctx context.Context, chatbotPayload UpdateChatbotLastused) error
+	GetChatbotAllowlist(ctx context.Context, chatbotID int) ([]string, error)
+	SetChatbotAllowlist(ctx context.Context, chatbotID int, usernames []string) error
+	IsUserAllowlisted(ctx context.Context, chatbotID int, username string) (bool, error)
+	UpdateChatbotHistorySettings(ctx context.Context, chatbotID int, settings ChatbotHistorySettings) error
+	UpdateChatbotWidgetSettings(ctx context.Context, chatbotID int, settings ChatbotWidgetSettings) error
+	UpdateChatbotRetentionSettings(ctx context.Context, chatbotID int, settings ChatbotRetentionSettings) error
+}
+
+// ChatbotRevisionStoreInterface defines the methods for chatbot revision store
+type ChatbotRevisionStoreInterface interface {
+	GetRevisionsByChatbotID(ctx context.Context, chatbotID int) ([]ChatbotRevision, error)
+	GetRevision(ctx context.Context, chatbotID int, revision int) (*ChatbotRevision, error)
+	GetLatestRevision(ctx context.Context, chatbotID int) (*ChatbotRevision, error)
+	CreateRevision(ctx context.Context, revisionPayload NewChatbotRevision) (*ChatbotRevision, error)
+	DeleteRevisionsByChatbotID(ctx context.Context, chatbotID int) error
+	IsFileReferenced(ctx context.Context, path string) (bool, error)
+	ReplaceFilepath(ctx context.Context, oldPath string, newPath string) error
+}
+
+// ChatbotTemplateStoreInterface defines the methods for user saved chatbot template store
+type ChatbotTemplateStoreInterface interface {
+	GetTemplatesByUsername(ctx context.Context, username string) ([]ChatbotTemplate, error)
+	GetTemplateByID(ctx context.Context, templateID int) (*ChatbotTemplate, error)
+	CreateTemplate(ctx context.Context, templatePayload NewChatbotTemplate) (int, error)
+	DeleteTemplate(ctx context.Context, templateID int) error
+}
+
+// ChatbotToolStoreInterface defines the methods for chatbot tool store
+type ChatbotToolStoreInterface interface {
+	GetToolsByChatbotID(ctx context.Context, chatbotID int) ([]ChatbotTool, error)
+	CreateTool(ctx context.Context, toolPayload NewChatbotTool) (int, error)
+	DeleteTool(ctx context.Context, chatbotID int, toolID int) error
+	DeleteToolsByChatbotID(ctx context.Context, chatbotID int) error
+}
+
+// ModerationStoreInterface defines the methods for moderation rule and flagged message store
+type ModerationStoreInterface interface {
+	GetRulesByChatbotID(ctx context.Context, chatbotID int) ([]ModerationRule, error)
+	CreateRule(ctx context.Context, rulePayload NewModerationRule) (int, error)
+	DeleteRule(ctx context.Context, chatbotID int, ruleID int) error
+	CreateFlaggedMessage(ctx context.Context, flagged FlaggedMessage) (int, error)
+	GetFlaggedMessages(ctx context.Context, chatbotID int, filter FlaggedMessageFilter) ([]FlaggedMessage, error)
+	DeleteModerationByChatbotID(ctx context.Context, chatbotID int) error
+}
+
+// MessageFeedbackStoreInterface defines the methods for message feedback store
+type MessageFeedbackStoreInterface interface {
+	SaveFeedback(ctx context.Context, feedback MessageFeedback) error
+	GetFeedbackReviews(ctx context.Context, chatbotID int, filter FeedbackFilter) ([]FeedbackReview, error)
+	DeleteFeedbackByChatbotID(ctx context.Context, chatbotID int) error
+}
+
+// RetentionStoreInterface defines the methods for retention store
+type RetentionStoreInterface interface {
+	GetRetentionPolicies(ctx context.Context) ([]ChatbotRetention, error)
+	GetConversationActivity(ctx context.Context, chatbotID int) ([]ConversationActivity, error)
+	PurgeConversations(ctx context.Context, chatbotID int, conversationIDs []string) (PurgedConversations, error)
+	CreatePurgeRecord(ctx context.Context, purge ConversationPurge) (int, error)
+	GetPurgeRecords(ctx context.Context, chatbotID int, limit int) ([]ConversationPurge, error)
+}
+
+// ConversationSearchStoreInterface defines the methods for conversation search store
+type ConversationSearchStoreInterface interface {
+	SearchConversations(ctx context.Context, filter ConversationSearchFilter) ([]ConversationSearchResult, error)
+}
+
+// ChatbotWebhookStoreInterface defines the methods for chatbot webhook store
+type ChatbotWebhookStoreInterface interface {
+	GetWebhooksByChatbotID(ctx context.Context, chatbotID int) ([]ChatbotWebhook, error)
+	GetWebhookByID(ctx context.Context, chatbotID int, webhookID int) (*ChatbotWebhook, error)
+	CreateWebhook(ctx context.Context, webhookPayload NewChatbotWebhook) (int, error)
+	DeleteWebhook(ctx context.Context, chatbotID int, webhookID int) error
+	DeleteWebhooksByChatbotID(ctx context.Context, chatbotID int) error
+	CreateDelivery(ctx context.Context, delivery WebhookDelivery) (int, error)
+	GetDueDeliveries(ctx context.Context, now int64, limit int) ([]WebhookDelivery, error)
+	GetDeliveriesByWebhookID(ctx context.Context, webhookID int, limit int) ([]WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error
 }
 
 // ConversationStoreInterface defines the methods for conversation store
 type ConversationStoreInterface interface {
-	GetConversationsByID(conversationID string) ([]Conversation, error)
-	GetConversationsByUserID(userID int) ([]Conversation, error)
-	CreateConversation(conversationPayload NewConversation) (int, error)
-	UpdateConversation(conversationPayload UpdateConversation) error
-	DeleteConversation(conversationID int) error
+	GetConversationsByID(ctx context.Context, conversationID string) ([]Conversation, error)
+	GetConversationsByUserID(ctx context.Context, userID int) ([]Conversation, error)
+	GetConversationIDsByChatbotID(ctx context.Context, chatbotID int) ([]string, error)
+	CreateConversation(ctx context.Context, conversationPayload NewConversation) (int, error)
+	SaveConversationTurn(ctx context.Context, turn ConversationTurn) error
+	GetConversationBranches(ctx context.Context, conversationID string) ([]ConversationBranch, error)
+	GetConversationSummary(ctx context.Context, conversationID string) (*ConversationSummary, error)
+	SaveConversationSummary(ctx context.Context, summary ConversationSummary) error
+	UpdateConversation(ctx context.Context, conversationPayload UpdateConversation) error
+	DeleteConversation(ctx context.Context, conversationID int) error
 }
 
 // APIFileStoreInterface defines the methods for API file store
 type APIFileStoreInterface interface {
-	GetAPIFileByID(apiFileID int) (*APIFile, error)
-	GetAPIFilesByUserID(userID int) ([]APIFile, error)
-	GetAPIFileByFilepath(filepath string) (*APIFile, error)
-	CreateAPIFile(apiFilePayload NewAPIFile) (int, error)
-	UpdateAPIFile(apiFilePayload UpdateAPIFile) error
-	DeleteAPIFile(apiFileID int) error
+	GetAPIFileByID(ctx context.Context, apiFileID int) (*APIFile, error)
+	GetAPIFilesByUserID(ctx context.Context, userID int) ([]APIFile, error)
+	GetAPIFileByFilepath(ctx context.Context, filepath string) (*APIFile, error)
+	CreateAPIFile(ctx context.Context, apiFilePayload NewAPIFile) (int, error)
+	UpdateAPIFile(ctx context.Context, apiFilePayload UpdateAPIFile) error
+	DeleteAPIFile(ctx context.Context, apiFileID int) error
+}
+
+// AttachmentStoreInterface defines the methods for attachment store
+type AttachmentStoreInterface interface {
+	CreateAttachment(ctx context.Context, attachmentPayload NewAttachment) (int, error)
+	GetAttachmentsByConversationID(ctx context.Context, conversationID string) ([]Attachment, error)
+	DeleteUnsavedAttachment(ctx context.Context, attachmentID int) error
+}
+
+// WorkspaceStoreInterface defines the methods for workspace store
+type WorkspaceStoreInterface interface {
+	GetWorkspaceByID(ctx context.Context, workspaceID int) (*Workspace, error)
+	GetWorkspacesByUsername(ctx context.Context, username string) ([]Workspace, error)
+	CreateWorkspace(ctx context.Context, workspacePayload NewWorkspace) (int, error)
+	DeleteWorkspace(ctx context.Context, workspaceID int) error
+	GetWorkspaceMembers(ctx context.Context, workspaceID int) ([]WorkspaceMember, error)
+	GetMemberRole(ctx context.Context, workspaceID int, username string) (string, error)
+	UpdateMemberRole(ctx context.Context, workspaceID int, username string, role string) error
+	RemoveMember(ctx context.Context, workspaceID int, username string) error
+	GetInvitationByID(ctx context.Context, inviteID int) (*WorkspaceInvitation, error)
+	GetPendingInvitationsByUsername(ctx context.Context, username string) ([]WorkspaceInvitation, error)
+	CreateInvitation(ctx context.Context, invitationPayload NewWorkspaceInvitation) (int, error)
+	AcceptInvitation(ctx context.Context, inviteID int) error
+	DeclineInvitation(ctx context.Context, inviteID int) error
 }
@@ -3,12 +3,16 @@ package types
 type NewChatbot struct {
 	Username        string `json:"Username" validate:"required,min=3,alphanum"`
 	Chatbotname     string `json:"chatbotname" validate:"required,min=1"`
-	Description     string `json:"description"`
-	Behaviour       string `json:"behaviour"`
-	Usercontext     string `json:"usercontext"`
+	Description     string `json:"description" validate:"max=1000"`
+	Behaviour       string `json:"behaviour" validate:"max=4000"`
+	Usercontext     string `json:"usercontext" validate:"max=8000"`
 	IsShared        bool   `json:"isShared"`
 	File            string `json:"file"`
 	FileUpdatedDate string `json:"fileUpdatedDate"`
+	Workspaceid     int    `json:"workspaceid"`
+	Sharemode       string `json:"shareMode" validate:"required,oneof=private public link password allowlist"`
+	Sharetoken      string `json:"shareToken"`
+	Sharepassword   string `json:"-"`
 }
 type CreateChatbotPayload struct {
 	Chatbotname string `json:"chatbotname" validate:"required,min=3"`
@@ -28,27 +32,455 @@ type UpdateChatbot struct {
 	Chatbotid       int    `json:"chatbotid" validate:"required"`
 	Username        string `json:"Username" validate:"required"`
 	Chatbotname     string `json:"chatbotname" validate:"required,min=3"`
-	Description     string `json:"description"`
-	Behaviour       string `json:"behaviour"`
-	Usercontext     string `json:"usercontext"`
+	Description     string `json:"description" validate:"max=1000"`
+	Behaviour       string `json:"behaviour" validate:"max=4000"`
+	Usercontext     string `json:"usercontext" validate:"max=8000"`
 	IsShared        bool   `json:"isShared"`
 	File            string `json:"file"`
 	FileUpdatedDate string `json:"fileUpdatedDate"`
+	Workspaceid     int    `json:"workspaceid"`
+	Sharemode       string `json:"shareMode" validate:"required,oneof=private public link password allowlist"`
+	Sharetoken      string `json:"shareToken"`
+	Sharepassword   string `json:"-"`
 }
 
 type Chatbot struct {
+	Chatbotid         int    `json:"chatbotid"`
+	Username          string `json:"username"`
+	Chatbotname       string `json:"chatbotname"`
+	Description       string `json:"description"`
+	Behaviour         string `json:"behaviour"`
+	Usercontext       string `json:"usercontext"`
+	Createddate       string `json:"createddate"`
+	Updateddate       string `json:"updateddate"`
+	Lastused          string `json:"lastused"`
+	IsShared          bool   `json:"isShared"`
+	Filepath          string `json:"filepath"`
+	FileUpdatedDate   string `json:"fileUpdatedDate"`
+	Workspaceid       int    `json:"workspaceid"`
+	Sharemode         string `json:"shareMode"`
+	Sharetoken        string `json:"shareToken,omitempty"`
+	Sharepassword     string `json:"-"`
+	Historystrategy   string `json:"historyStrategy"`
+	Historytokenlimit int    `json:"historyTokenLimit"` // 0 uses the server default
+	Allowedorigins    string `json:"-"`                 // comma separated origins of sites embedding the chat widget
+	Widgettheme       string `json:"-"`                 // JSON of the WidgetTheme
+	Retentiondays     int    `json:"retentionDays"`     // 0 keeps conversations as long as the server default
+	Redactpii         bool   `json:"redactPII"`
+}
+
+// Chatbot sharing modes, controlling who can chat with a chatbot.
+// Users with access to the chatbot through its owner or workspace can always preview it.
+const (
+	ShareModePrivate   = "private"   // only the owner and workspace members
+	ShareModePublic    = "public"    // anyone with the chatbot url
+	ShareModeLink      = "link"      // anyone with the secret share token
+	ShareModePassword  = "password"  // anyone with the share password
+	ShareModeAllowlist = "allowlist" // registered users on the chatbot allow-list
+)
+
+type UpdateChatbotAllowlistPayload struct {
+	Usernames []string `json:"usernames" validate:"dive,required"`
+}
+
+// Chatbot history strategies, controlling how much of a conversation is sent to the model with each message.
+const (
+	HistoryStrategyFull    = "full"    // every message, however long the conversation gets
+	HistoryStrategyWindow  = "window"  // the newest messages that fit in the token limit
+	HistoryStrategySummary = "summary" // the newest messages, with the older ones replaced by a rolling summary
+)
+
+type ChatbotHistorySettings struct {
+	Historystrategy   string `json:"historyStrategy" validate:"required,oneof=full window summary"`
+	Historytokenlimit int    `json:"historyTokenLimit" validate:"min=0,max=1000000"`
+}
+
+// ChatbotRetentionSettings is how long conversations with the chatbot are kept and whether personal data is
+// removed from messages before they are saved
+type ChatbotRetentionSettings struct {
+	Retentiondays int  `json:"retentionDays" validate:"min=0,max=3650"`
+	Redactpii     bool `json:"redactPII"`
+}
+
+// ChatbotRetention is the retention setting of a chatbot the purge job applies
+type ChatbotRetention struct {
+	Chatbotid     int
+	Retentiondays int
+}
+
+// ConversationActivity is when the last message of a conversation was sent
+type ConversationActivity struct {
+	Conversationid  string
+	Lastmessagedate string
+}
+
+// PurgedConversations is what was deleted with a batch of conversations. Attachmentpaths are the files
+// of the deleted attachments, which are left to be removed from disk
+type PurgedConversations struct {
+	Conversations   int
+	Messages        int
+	Attachmentpaths []string
+}
+
+// ConversationPurge is an entry of the audit log of conversations deleted by the retention policy
+type ConversationPurge struct {
+	Purgeid       int    `json:"purgeid"`
+	Chatbotid     int    `json:"chatbotid"`
+	Conversations int    `json:"conversations"`
+	Messages      int    `json:"messages"`
+	Retentiondays int    `json:"retentionDays"`
+	Cutoffdate    string `json:"cutoffdate"` // conversations without messages since then were deleted
+	Createddate   string `json:"createddate"`
+}
+
+// WidgetTheme is how the chat widget looks on sites embedding the chatbot
+type WidgetTheme struct {
+	Primarycolor string `json:"primaryColor" validate:"omitempty,hexcolor"`
+	Position     string `json:"position" validate:"omitempty,oneof=left right"`
+	Greeting     string `json:"greeting" validate:"max=500"`
+}
+
+type ChatbotWidgetSettings struct {
+	Allowedorigins []string    `json:"allowedOrigins" validate:"max=20,dive,required"`
+	Theme          WidgetTheme `json:"theme"`
+}
+
+// WidgetConfig is what the widget script needs to show the chat widget of a chatbot
+type WidgetConfig struct {
+	Username    string      `json:"username"`
+	Chatbotname string      `json:"chatbotname"`
+	Description string      `json:"description"`
+	Sharemode   string      `json:"shareMode"`
+	Theme       WidgetTheme `json:"theme"`
+}
+
+// Kinds of chatbot tools the model can call.
+const (
+	ToolKindWebhook = "webhook" // an HTTP endpoint of the owner, called with the arguments as a JSON body
+	ToolKindBuiltin = "builtin" // a tool run by the server, identified by its name
+)
+
+type ChatbotTool struct {
+	Toolid      int    `json:"toolid"`
+	Chatbotid   int    `json:"chatbotid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Kind        string `json:"kind"`
+	Url         string `json:"url,omitempty"`
+	Parameters  string `json:"parameters,omitempty"` // JSON schema of the arguments
+	Createddate string `json:"createddate"`
+}
+
+type NewChatbotTool struct {
+	Chatbotid   int    `json:"chatbotid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Kind        string `json:"kind"`
+	Url         string `json:"url"`
+	Parameters  string `json:"parameters"`
+}
+
+type CreateChatbotToolPayload struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description" validate:"max=1000"`
+	Kind        string `json:"kind" validate:"required,oneof=webhook builtin"`
+	Url         string `json:"url" validate:"required_if=Kind webhook"`
+	Parameters  string `json:"parameters"`
+}
+
+// Kinds of moderation rules, what their pattern is matched as.
+const (
+	ModerationKindKeyword = "keyword" // a word or phrase, matched as whole words in any case
+	ModerationKindRegex   = "regex"   // a regular expression in Go syntax
+)
+
+// Actions taken on messages matching a moderation rule.
+const (
+	ModerationActionFlag  = "flag"  // the message is let through and recorded for the owner to review
+	ModerationActionBlock = "block" // the message is not sent to the model or shown to the visitor, and recorded
+)
+
+// Stages of a conversation moderation rules are checked at.
+const (
+	ModerationStageInput  = "input"  // visitor messages, before they are sent to the model
+	ModerationStageOutput = "output" // model responses, as they are streamed
+	ModerationStageBoth   = "both"
+)
+
+type ModerationRule struct {
+	Ruleid      int    `json:"ruleid"`
+	Chatbotid   int    `json:"chatbotid"`
+	Kind        string `json:"kind"`
+	Pattern     string `json:"pattern"`
+	Action      string `json:"action"`
+	Stage       string `json:"stage"`
+	Createddate string `json:"createddate"`
+}
+
+type NewModerationRule struct {
+	Chatbotid int    `json:"chatbotid"`
+	Kind      string `json:"kind"`
+	Pattern   string `json:"pattern"`
+	Action    string `json:"action"`
+	Stage     string `json:"stage"`
+}
+
+type CreateModerationRulePayload struct {
+	Kind    string `json:"kind" validate:"required,oneof=keyword regex"`
+	Pattern string `json:"pattern" validate:"required,max=500"`
+	Action  string `json:"action" validate:"required,oneof=flag block"`
+	Stage   string `json:"stage" validate:"required,oneof=input output both"`
+}
+
+// FlaggedMessage records a message that was flagged or blocked by moderation for the owner to review
+type FlaggedMessage struct {
+	Flagid         int    `json:"flagid"`
+	Chatbotid      int    `json:"chatbotid"`
+	Conversationid string `json:"conversationid"`
+	Stage          string `json:"stage"`
+	Action         string `json:"action"`
+	Reason         string `json:"reason"` // the rule or classifier category the message matched
+	Content        string `json:"content"`
+	Createddate    string `json:"createddate"`
+}
+
+// FlaggedMessageFilter selects the flagged messages to review, zero values do not filter
+type FlaggedMessageFilter struct {
+	Action string
+	Stage  string
+	Limit  int
+	Offset int
+}
+
+// Events chatbot webhooks can subscribe to.
+const (
+	WebhookEventConversationStarted = "conversation.started"
+	WebhookEventMessageExchanged    = "message.exchanged"
+	WebhookEventFeedbackSubmitted   = "feedback.submitted"
+	WebhookEventChatbotUpdated      = "chatbot.updated"
+	WebhookEventPing                = "ping" // only sent by test deliveries
+)
+
+// Statuses of webhook deliveries.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed" // gave up after the last attempt
+)
+
+type ChatbotWebhook struct {
+	Webhookid   int      `json:"webhookid"`
+	Chatbotid   int      `json:"chatbotid"`
+	Url         string   `json:"url"`
+	Events      []string `json:"events"`
+	Secret      string   `json:"secret,omitempty"` // only returned when the webhook is created
+	Createddate string   `json:"createddate"`
+}
+
+type NewChatbotWebhook struct {
+	Chatbotid int      `json:"chatbotid"`
+	Url       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret"`
+}
+
+type CreateChatbotWebhookPayload struct {
+	Url    string   `json:"url" validate:"required,url,max=2000"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=conversation.started message.exchanged feedback.submitted chatbot.updated"`
+}
+
+type WebhookDelivery struct {
+	Deliveryid     int    `json:"deliveryid"`
+	Webhookid      int    `json:"webhookid"`
+	Chatbotid      int    `json:"chatbotid"`
+	Event          string `json:"event"`
+	Payload        string `json:"payload"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	Responsestatus int    `json:"responsestatus"` // HTTP status of the last attempt, 0 if there was no response
+	Error          string `json:"error,omitempty"`
+	Nextattempt    int64  `json:"nextattempt"` // unix time of the next attempt while pending
+	Createddate    string `json:"createddate"`
+	Updateddate    string `json:"updateddate"`
+}
+
+const (
+	FeedbackRatingUp   = "up"
+	FeedbackRatingDown = "down"
+)
+
+// MessageFeedbackPayload is a visitor's rating of a model message in their conversation
+type MessageFeedbackPayload struct {
+	Conversationid string `json:"conversationid" validate:"required"`
+	Chatid         int    `json:"chatid" validate:"required"`
+	Rating         string `json:"rating" validate:"required,oneof=up down"`
+	Comment        string `json:"comment" validate:"max=1000"`
+}
+
+// MessageFeedback is the rating of a model message, a message has at most one and rating it again replaces it.
+// Username is empty when the visitor was not logged in
+type MessageFeedback struct {
+	Feedbackid     int    `json:"feedbackid"`
+	Chatid         int    `json:"chatid"`
+	Questionchatid int    `json:"questionchatid"` // the user message the rated response answered, 0 if it has none
+	Conversationid string `json:"conversationid"`
+	Chatbotid      int    `json:"chatbotid"`
+	Revisionid     int    `json:"revisionid"`
+	Rating         string `json:"rating"`
+	Comment        string `json:"comment"`
+	Username       string `json:"username"`
+	Createddate    string `json:"createddate"`
+	Updateddate    string `json:"updateddate"`
+}
+
+// FeedbackFilter selects the rated messages to review, zero values do not filter
+type FeedbackFilter struct {
+	Rating     string
+	Revisionid int
+	Commented  bool // only messages rated with a comment
+	Limit      int
+	Offset     int
+}
+
+// FeedbackReview is a rated model message with the user message it answered
+type FeedbackReview struct {
+	Feedbackid     int    `json:"feedbackid"`
+	Chatid         int    `json:"chatid"`
+	Conversationid string `json:"conversationid"`
+	Revisionid     int    `json:"revisionid"`
+	Rating         string `json:"rating"`
+	Comment        string `json:"comment"`
+	Username       string `json:"username"`
+	Usermessage    string `json:"usermessage"`
+	Modelresponse  string `json:"modelresponse"`
+	Createddate    string `json:"createddate"`
+	Updateddate    string `json:"updateddate"`
+}
+
+// ConversationSearchFilter selects the messages a full-text search looks through, zero values do not filter
+type ConversationSearchFilter struct {
+	Query      string
+	Chatbotids []int // the chatbots searched, nothing matches when empty
+	Role       string
+	From       int64 // unix time the message was sent at or after
+	To         int64 // unix time the message was sent before
+	Limit      int
+	Offset     int
+}
+
+// ConversationSearchResult is a message matching a search, with the matched words of the snippet
+// wrapped in <mark> tags and the rest of the snippet HTML escaped
+type ConversationSearchResult struct {
+	Chatid         int    `json:"chatid"`
+	Conversationid string `json:"conversationid"`
+	Chatbotid      int    `json:"chatbotid"`
+	Chatbotname    string `json:"chatbotname"`
+	Role           string `json:"role"`
+	Branch         int    `json:"branch"`
+	Sequence       int    `json:"sequence"`
+	Snippet        string `json:"snippet"`
+	Createddate    string `json:"createddate"`
+}
+
+type ChatbotRevision struct {
+	Revisionid      int    `json:"revisionid"`
 	Chatbotid       int    `json:"chatbotid"`
-	Username        string `json:"username"`
+	Revision        int    `json:"revision"`
 	Chatbotname     string `json:"chatbotname"`
 	Description     string `json:"description"`
 	Behaviour       string `json:"behaviour"`
 	Usercontext     string `json:"usercontext"`
+	Filepath        string `json:"filepath"`
+	FileUpdatedDate string `json:"fileUpdatedDate"`
+	Author          string `json:"author"`
+	Message         string `json:"message"`
 	Createddate     string `json:"createddate"`
-	Updateddate     string `json:"updateddate"`
-	Lastused        string `json:"lastused"`
-	IsShared        bool   `json:"isShared"`
+}
+
+type NewChatbotRevision struct {
+	Chatbotid       int    `json:"chatbotid"`
+	Chatbotname     string `json:"chatbotname"`
+	Description     string `json:"description"`
+	Behaviour       string `json:"behaviour"`
+	Usercontext     string `json:"usercontext"`
 	Filepath        string `json:"filepath"`
 	FileUpdatedDate string `json:"fileUpdatedDate"`
+	Author          string `json:"author"`
+	Message         string `json:"message"`
+}
+
+// Operations of a line in a revision diff.
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type RevisionFieldDiff struct {
+	Field   string     `json:"field"`
+	Changed bool       `json:"changed"`
+	Lines   []DiffLine `json:"lines"`
+}
+
+type RevisionDiff struct {
+	Chatbotid int                 `json:"chatbotid"`
+	From      int                 `json:"from"`
+	To        int                 `json:"to"`
+	Fields    []RevisionFieldDiff `json:"fields"`
+}
+
+// ChatbotTemplate is a starting configuration for new chatbots. Built-in templates ship with the
+// server and are identified by Key, user saved templates by Templateid.
+type ChatbotTemplate struct {
+	Templateid  int    `json:"templateid,omitempty"`
+	Key         string `json:"key,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Behaviour   string `json:"behaviour"`
+	Usercontext string `json:"usercontext"`
+	Filepath    string `json:"filepath"`
+	BuiltIn     bool   `json:"builtIn"`
+	Createddate string `json:"createddate,omitempty"`
+}
+
+type NewChatbotTemplate struct {
+	Username    string `json:"username" validate:"required"`
+	Name        string `json:"name" validate:"required,min=3,max=50"`
+	Description string `json:"description"`
+	Behaviour   string `json:"behaviour"`
+	Usercontext string `json:"usercontext"`
+	Filepath    string `json:"filepath"`
+}
+
+type ChatbotTemplateList struct {
+	BuiltIn []ChatbotTemplate `json:"builtIn"`
+	User    []ChatbotTemplate `json:"user"`
+}
+
+// Version of the chatbot export bundle format, bumped when the manifest changes incompatibly.
+const ChatbotExportFormatVersion = 1
+
+// ChatbotExportManifest is stored as manifest.json in a chatbot export bundle,
+// next to the knowledge files listed in Files.
+type ChatbotExportManifest struct {
+	FormatVersion int                 `json:"formatVersion"`
+	ExportedAt    string              `json:"exportedAt"`
+	Chatbot       Chatbot             `json:"chatbot"`
+	Files         []ChatbotExportFile `json:"files"`
+}
+
+type ChatbotExportFile struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
 }
 
 type User struct {
@@ -83,6 +515,35 @@ type ChatRequest struct {
 // ChatResponse defines the response body for chatting with a chatbot.
 type ChatResponse struct {
 	Response string `json:"response"`
+	Branch   int    `json:"branch"` // branch of the conversation the response was saved to
+}
+
+// RegenerateMessagePayload asks for a new response to the last user message of the conversation
+type RegenerateMessagePayload struct {
+	Conversationid string `json:"conversationid" validate:"required"`
+}
+
+// EditMessagePayload replaces a user message of the conversation and asks for a response to it
+type EditMessagePayload struct {
+	Conversationid string `json:"conversationid" validate:"required"`
+	Chatid         int    `json:"chatid" validate:"required"`
+	Message        string `json:"message" validate:"required"`
+}
+
+const (
+	ConversationBranchRegenerate = "regenerate"
+	ConversationBranchEdit       = "edit"
+)
+
+// ConversationBranch is an alternative continuation of a conversation. It shares the messages of its parent branch
+// before Forksequence and has its own from there on. Branch 0 is the original conversation and has no row
+type ConversationBranch struct {
+	Conversationid string `json:"conversationid"`
+	Branch         int    `json:"branch"`
+	Parentbranch   int    `json:"parentbranch"`
+	Forksequence   int    `json:"forksequence"`
+	Reason         string `json:"reason"` // regenerate or edit
+	Createddate    string `json:"createddate"`
 }
 
 type Conversation struct {
@@ -94,6 +555,32 @@ type Conversation struct {
 	Role           string `json:"role"`
 	Chat           string `json:"chat"`
 	Createddate    string `json:"createddate"`
+	Revisionid     int    `json:"revisionid"`
+	Sequence       int    `json:"sequence"`
+	Interrupted    bool   `json:"interrupted"` // the response was cut short because the client disconnected
+	Branch         int    `json:"branch"`
+}
+
+// ConversationTranscript is the exported form of a branch of a conversation. Its JSON is a stable schema,
+// fields are only ever added and Version changes if one has to change meaning
+type ConversationTranscript struct {
+	Version        int                 `json:"version"`
+	Conversationid string              `json:"conversationid"`
+	Owner          string              `json:"owner"`
+	Chatbotname    string              `json:"chatbotname"`
+	Branch         int                 `json:"branch"`
+	Exporteddate   string              `json:"exporteddate"`
+	Messages       []TranscriptMessage `json:"messages"`
+}
+
+type TranscriptMessage struct {
+	Chatid      int    `json:"chatid"`
+	Sequence    int    `json:"sequence"`
+	Role        string `json:"role"` // user or model
+	Text        string `json:"text"`
+	Createddate string `json:"createddate"`
+	Revisionid  int    `json:"revisionid"`
+	Interrupted bool   `json:"interrupted"`
 }
 
 type NewConversation struct {
@@ -104,6 +591,54 @@ type NewConversation struct {
 	Role           string `json:"role"`
 	Chat           string `json:"chat"`
 	Createddate    string `json:"createddate"`
+	Revisionid     int    `json:"revisionid"`
+	Redactpii      bool   `json:"-"` // personal data is redacted from the message before it is saved
+}
+
+// ConversationTurn is a user message and the model response to it, which are saved together
+type ConversationTurn struct {
+	Conversationid string     `json:"conversationid"`
+	Chatbotid      int        `json:"chatbotid"`
+	Username       string     `json:"username"`
+	Chatbotname    string     `json:"chatbotname"`
+	Revisionid     int        `json:"revisionid"`
+	UserMessage    string     `json:"usermessage"`
+	ModelResponse  string     `json:"modelresponse"`
+	Createddate    string     `json:"createddate"`
+	Interrupted    bool       `json:"interrupted"`
+	Attachmentids  []int      `json:"attachmentids,omitempty"` // files sent with the user message
+	ToolCalls      []ToolCall `json:"toolcalls,omitempty"`     // tools the model called for the response
+	Branch         int        `json:"branch"`
+	// Fork is set when the turn starts a new branch, which is created together with the turn
+	Fork *ConversationBranch `json:"fork,omitempty"`
+	// Regenerated turns answer a user message already saved before the fork, so only the response is saved
+	Regenerated bool `json:"regenerated,omitempty"`
+	// Redactpii turns have personal data redacted from their messages and tool calls before they are saved
+	Redactpii bool `json:"redactpii,omitempty"`
+}
+
+// ToolCall is a tool the model called while answering a message. Chatid is the model message it belongs to,
+// Error is set instead of Result when the call failed
+type ToolCall struct {
+	Toolcallid     int    `json:"toolcallid"`
+	Conversationid string `json:"conversationid"`
+	Chatbotid      int    `json:"chatbotid"`
+	Chatid         int    `json:"chatid"`
+	Name           string `json:"name"`
+	Arguments      string `json:"arguments"`
+	Result         string `json:"result"`
+	Error          string `json:"error,omitempty"`
+	Durationms     int64  `json:"durationms"`
+	Createddate    string `json:"createddate"`
+}
+
+// ConversationSummary replaces the messages of a conversation up to Uptosequence when they are sent to the model
+type ConversationSummary struct {
+	Conversationid string `json:"conversationid"`
+	Chatbotid      int    `json:"chatbotid"`
+	Summary        string `json:"summary"`
+	Uptosequence   int    `json:"uptosequence"`
+	Updateddate    string `json:"updateddate"`
 }
 
 type UpdateConversation struct {
@@ -116,6 +651,30 @@ type UpdateConversation struct {
 	Createddate    string `json:"createddate"`
 }
 
+// Attachment is a file a visitor sent with a message. Chatid is the user message it belongs to,
+// 0 until the turn is saved
+type Attachment struct {
+	Attachmentid   int    `json:"attachmentid"`
+	Conversationid string `json:"conversationid"`
+	Chatbotid      int    `json:"chatbotid"`
+	Chatid         int    `json:"chatid"`
+	Filename       string `json:"filename"`
+	Filepath       string `json:"-"`
+	Mimetype       string `json:"mimetype"`
+	Size           int64  `json:"size"`
+	Createddate    string `json:"createddate"`
+}
+
+type NewAttachment struct {
+	Conversationid string `json:"conversationid"`
+	Chatbotid      int    `json:"chatbotid"`
+	Filename       string `json:"filename"`
+	Filepath       string `json:"filepath"`
+	Mimetype       string `json:"mimetype"`
+	Size           int64  `json:"size"`
+	Createddate    string `json:"createddate"`
+}
+
 type APIFile struct {
 	Fileid      int    `json:"fileid"`
 	Chatbotid   int    `json:"chatbotid"`
@@ -138,3 +697,68 @@ type UpdateAPIFile struct {
 	Filepath    string `json:"filepath"`
 	Fileuri     string `json:"fileuri"`
 }
+
+// Workspace roles, ordered from most to least privileged.
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleEditor = "editor"
+	WorkspaceRoleViewer = "viewer"
+)
+
+// Workspace invitation statuses.
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusDeclined = "declined"
+)
+
+type Workspace struct {
+	Workspaceid int    `json:"workspaceid"`
+	Name        string `json:"name"`
+	Owner       string `json:"owner"`
+	Createddate string `json:"createddate"`
+	Role        string `json:"role,omitempty"`
+}
+
+type NewWorkspace struct {
+	Name  string `json:"name" validate:"required,min=3"`
+	Owner string `json:"owner" validate:"required"`
+}
+
+type CreateWorkspacePayload struct {
+	Name string `json:"name" validate:"required,min=3"`
+}
+
+type WorkspaceMember struct {
+	Workspaceid int    `json:"workspaceid"`
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	Createddate string `json:"createddate"`
+}
+
+type InviteWorkspaceMemberPayload struct {
+	Username string `json:"username" validate:"required"`
+	Role     string `json:"role" validate:"required,oneof=editor viewer"`
+}
+
+type UpdateWorkspaceMemberPayload struct {
+	Role string `json:"role" validate:"required,oneof=editor viewer"`
+}
+
+type WorkspaceInvitation struct {
+	Inviteid      int    `json:"inviteid"`
+	Workspaceid   int    `json:"workspaceid"`
+	Workspacename string `json:"workspacename"`
+	Username      string `json:"username"`
+	Role          string `json:"role"`
+	Invitedby     string `json:"invitedby"`
+	Status        string `json:"status"`
+	Createddate   string `json:"createddate"`
+}
+
+type NewWorkspaceInvitation struct {
+	Workspaceid int    `json:"workspaceid"`
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	Invitedby   string `json:"invitedby"`
+}
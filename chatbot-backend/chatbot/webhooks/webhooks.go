@@ -0,0 +1,344 @@
+// Package webhooks sends chatbot events to the webhooks subscribed by their owners. Deliveries are queued in the
+// database, signed with the webhook's secret and retried with backoff until the receiver accepts them
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/tracing"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/validate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" followed by Sign of the timestamp and body
+const (
+	HeaderEvent     = "X-Chatbot-Event"
+	HeaderDelivery  = "X-Chatbot-Delivery"
+	HeaderTimestamp = "X-Chatbot-Timestamp"
+	HeaderSignature = "X-Chatbot-Signature"
+)
+
+const (
+	maxAttempts         = 6
+	firstRetryDelay     = 30 * time.Second
+	pollInterval        = 5 * time.Second
+	deliveryBatchSize   = 20
+	maxResponseBodySize = 64 * 1024
+)
+
+// Event is the JSON body of a delivery
+type Event struct {
+	Event       string `json:"event"`
+	Chatbotid   int    `json:"chatbotid"`
+	Createddate string `json:"createddate"`
+	Data        any    `json:"data"`
+}
+
+// Dispatcher queues chatbot events for their webhooks and delivers them in the background
+type Dispatcher struct {
+	store  types.ChatbotWebhookStoreInterface
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewDispatcher(store types.ChatbotWebhookStoreInterface) *Dispatcher {
+	return &Dispatcher{
+		store: store,
+		client: &http.Client{
+			Timeout: time.Duration(config.Envs.WebhookTimeoutSeconds) * time.Second,
+			// a redirect could point the delivery at a host that is not allowed, so it counts as a failed attempt
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Notify queues the event for the chatbot's webhooks that subscribed to it without blocking the caller.
+// A nil Dispatcher does nothing, so handlers can be built without one
+func (d *Dispatcher) Notify(ctx context.Context, chatbotID int, event string, data any) {
+	if d == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	utils.RunInBackground(func() {
+		if err := d.enqueue(ctx, chatbotID, event, data); err != nil {
+			slog.ErrorContext(ctx, "Error queueing webhook event", "chatbotid", chatbotID, "event", event, "error", err)
+		}
+	})
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, chatbotID int, event string, data any) error {
+	webhooks, err := d.store.GetWebhooksByChatbotID(ctx, chatbotID)
+	if err != nil {
+		return err
+	}
+	payload, err := newPayload(chatbotID, event, data)
+	if err != nil {
+		return err
+	}
+
+	queued := false
+	for _, webhook := range webhooks {
+		if !slices.Contains(webhook.Events, event) {
+			continue
+		}
+		_, err := d.store.CreateDelivery(ctx, types.WebhookDelivery{
+			Webhookid:   webhook.Webhookid,
+			Chatbotid:   chatbotID,
+			Event:       event,
+			Payload:     payload,
+			Status:      types.WebhookDeliveryPending,
+			Nextattempt: time.Now().Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		d.wakeUp()
+	}
+	return nil
+}
+
+func (d *Dispatcher) wakeUp() {
+	select {
+	case d.wake <- struct{}{}:
+	default: // already woken
+	}
+}
+
+// Run delivers queued events as they are queued and retries failed deliveries once they are due, until ctx is done.
+// Deliveries still pending at shutdown are sent after the next start
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.Flush(ctx); err != nil {
+			slog.ErrorContext(ctx, "Error delivering webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Flush attempts a batch of the deliveries that are due, at the same time so one slow receiver does not hold up the rest
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	deliveries, err := d.store.GetDueDeliveries(ctx, time.Now().Unix(), deliveryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+
+	if len(deliveries) == deliveryBatchSize {
+		d.wakeUp() // there may be more
+	}
+	return nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery types.WebhookDelivery) {
+	webhook, err := d.store.GetWebhookByID(ctx, delivery.Chatbotid, delivery.Webhookid)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting webhook to deliver", "webhookid", delivery.Webhookid, "error", err)
+		return
+	}
+
+	delivery.Attempts++
+	if webhook == nil {
+		delivery.Status = types.WebhookDeliveryFailed
+		delivery.Error = "webhook was deleted"
+	} else {
+		status, err := d.send(ctx, *webhook, delivery)
+		recordAttempt(&delivery, status, err, time.Now())
+	}
+	outcome := "success"
+	switch delivery.Status {
+	case types.WebhookDeliveryPending:
+		outcome = "retry"
+	case types.WebhookDeliveryFailed:
+		outcome = "failed"
+		slog.WarnContext(ctx, "Giving up on webhook delivery", "webhookid", delivery.Webhookid, "deliveryid", delivery.Deliveryid, "attempts", delivery.Attempts, "error", delivery.Error)
+	}
+	metrics.WebhookDeliveryAttemptsTotal.WithLabelValues(delivery.Event, outcome).Inc()
+
+	if err := d.store.UpdateDelivery(ctx, delivery); err != nil {
+		slog.ErrorContext(ctx, "Error saving webhook delivery", "deliveryid", delivery.Deliveryid, "error", err)
+	}
+}
+
+// recordAttempt sets the outcome of an attempt on the delivery, scheduling the next attempt if it failed
+func recordAttempt(delivery *types.WebhookDelivery, status int, err error, now time.Time) {
+	delivery.Responsestatus = status
+	if err == nil {
+		delivery.Status = types.WebhookDeliverySucceeded
+		delivery.Error = ""
+		return
+	}
+
+	delivery.Error = err.Error()
+	if delivery.Attempts >= maxAttempts {
+		delivery.Status = types.WebhookDeliveryFailed
+		return
+	}
+	delivery.Status = types.WebhookDeliveryPending
+	delivery.Nextattempt = now.Add(retryDelay(delivery.Attempts)).Unix()
+}
+
+// retryDelay doubles the wait after every failed attempt, 30 seconds after the first up to 8 minutes after the fifth
+func retryDelay(attempts int) time.Duration {
+	return firstRetryDelay << (attempts - 1)
+}
+
+// Test sends a ping to the webhook once, without retrying, and records it with the other deliveries
+func (d *Dispatcher) Test(ctx context.Context, webhook types.ChatbotWebhook) (*types.WebhookDelivery, error) {
+	payload, err := newPayload(webhook.Chatbotid, types.WebhookEventPing, map[string]any{"webhookid": webhook.Webhookid})
+	if err != nil {
+		return nil, err
+	}
+	delivery := types.WebhookDelivery{
+		Webhookid: webhook.Webhookid,
+		Chatbotid: webhook.Chatbotid,
+		Event:     types.WebhookEventPing,
+		Payload:   payload,
+		Status:    types.WebhookDeliveryPending,
+		// not due until well after it is sent, so Run does not send it again
+		Nextattempt: time.Now().Add(firstRetryDelay).Unix(),
+	}
+	delivery.Deliveryid, err = d.store.CreateDelivery(ctx, delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Attempts = 1
+	status, sendErr := d.send(ctx, webhook, delivery)
+	recordAttempt(&delivery, status, sendErr, time.Now())
+	if sendErr != nil {
+		delivery.Status = types.WebhookDeliveryFailed
+	}
+	if err := d.store.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// send posts the delivery to the webhook and returns the response status, 0 if there was no response
+func (d *Dispatcher) send(ctx context.Context, webhook types.ChatbotWebhook, delivery types.WebhookDelivery) (int, error) {
+	ctx, span := tracing.Start(ctx, "webhook.deliver", trace.WithAttributes(
+		attribute.String("webhook.event", delivery.Event),
+		attribute.Int("webhook.id", webhook.Webhookid),
+		attribute.Int("webhook.attempt", delivery.Attempts),
+	))
+	defer span.End()
+
+	// the allowed hosts may have changed since the webhook was saved
+	if err := CheckURL(webhook.Url); err != nil {
+		return 0, err
+	}
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		tracing.RecordError(span, err)
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.Deliveryid))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return 0, fmt.Errorf("sending webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+	// read some of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBodySize))
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+		tracing.RecordError(span, err)
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+func newPayload(chatbotID int, event string, data any) (string, error) {
+	currentTime, _ := utils.GetCurrentTime()
+	payload, err := json.Marshal(Event{
+		Event:       event,
+		Chatbotid:   chatbotID,
+		Createddate: currentTime,
+		Data:        data,
+	})
+	return string(payload), err
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp and body joined by a dot, keyed with the webhook's secret.
+// Receivers compute it again to check the delivery came from us, and reject old timestamps so it cannot be replayed
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generates the secret the deliveries of a new webhook are signed with
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// CheckURL checks that a webhook url is http or https on one of the hosts in WEBHOOK_ALLOWED_HOSTS
+func CheckURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook url must be an http or https url")
+	}
+	if !validate.HostInList(parsed.Hostname(), config.Envs.WebhookAllowedHosts) {
+		return fmt.Errorf("webhook host %s is not allowed", parsed.Hostname())
+	}
+	return nil
+}
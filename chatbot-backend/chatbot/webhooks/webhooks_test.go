@@ -0,0 +1,203 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/types"
+)
+
+type mockWebhookStore struct {
+	types.ChatbotWebhookStoreInterface
+	mu         sync.Mutex
+	webhooks   []types.ChatbotWebhook
+	deliveries []types.WebhookDelivery
+}
+
+func (m *mockWebhookStore) GetWebhooksByChatbotID(ctx context.Context, chatbotID int) ([]types.ChatbotWebhook, error) {
+	webhooks := []types.ChatbotWebhook{}
+	for _, webhook := range m.webhooks {
+		if webhook.Chatbotid == chatbotID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockWebhookStore) GetWebhookByID(ctx context.Context, chatbotID int, webhookID int) (*types.ChatbotWebhook, error) {
+	for _, webhook := range m.webhooks {
+		if webhook.Chatbotid == chatbotID && webhook.Webhookid == webhookID {
+			return &webhook, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockWebhookStore) CreateDelivery(ctx context.Context, delivery types.WebhookDelivery) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.Deliveryid = len(m.deliveries) + 1
+	m.deliveries = append(m.deliveries, delivery)
+	return delivery.Deliveryid, nil
+}
+
+func (m *mockWebhookStore) GetDueDeliveries(ctx context.Context, now int64, limit int) ([]types.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	due := []types.WebhookDelivery{}
+	for _, delivery := range m.deliveries {
+		if delivery.Status == types.WebhookDeliveryPending && delivery.Nextattempt <= now {
+			due = append(due, delivery)
+		}
+	}
+	return due, nil
+}
+
+func (m *mockWebhookStore) UpdateDelivery(ctx context.Context, delivery types.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[delivery.Deliveryid-1] = delivery
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"event":"ping"}' | openssl dgst -sha256 -hmac secret
+	expected := "4d39bd2442f073b6bc62e95d0297ce25475582a17389ab860abdc778fe1d9f77"
+	signature := Sign("secret", "1700000000", []byte(`{"event":"ping"}`))
+	if signature != expected {
+		t.Fatalf("expected %s, got %s", expected, signature)
+	}
+	if signature == Sign("other", "1700000000", []byte(`{"event":"ping"}`)) {
+		t.Error("expected the signature to depend on the secret")
+	}
+	if signature == Sign("secret", "1700000001", []byte(`{"event":"ping"}`)) {
+		t.Error("expected the signature to depend on the timestamp")
+	}
+}
+
+func TestRecordAttempt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	delivery := types.WebhookDelivery{Attempts: 1}
+	recordAttempt(&delivery, http.StatusBadGateway, io.ErrUnexpectedEOF, now)
+	if delivery.Status != types.WebhookDeliveryPending || delivery.Nextattempt != now.Add(30*time.Second).Unix() {
+		t.Errorf("expected a retry in 30 seconds, got %+v", delivery)
+	}
+
+	delivery.Attempts = 3
+	recordAttempt(&delivery, http.StatusBadGateway, io.ErrUnexpectedEOF, now)
+	if delivery.Nextattempt != now.Add(2*time.Minute).Unix() {
+		t.Errorf("expected the wait to double after every attempt, got %v", delivery.Nextattempt-now.Unix())
+	}
+
+	delivery.Attempts = maxAttempts
+	recordAttempt(&delivery, 0, io.ErrUnexpectedEOF, now)
+	if delivery.Status != types.WebhookDeliveryFailed {
+		t.Errorf("expected to give up after %d attempts, got %s", maxAttempts, delivery.Status)
+	}
+
+	recordAttempt(&delivery, http.StatusOK, nil, now)
+	if delivery.Status != types.WebhookDeliverySucceeded || delivery.Error != "" {
+		t.Errorf("expected the delivery to succeed, got %+v", delivery)
+	}
+}
+
+func TestDispatcherDeliversSignedEvents(t *testing.T) {
+	var mu sync.Mutex
+	received := []*http.Request{}
+	bodies := [][]byte{}
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	config.Envs.WebhookAllowedHosts = serverURL.Hostname()
+	config.Envs.WebhookTimeoutSeconds = 5
+
+	store := &mockWebhookStore{webhooks: []types.ChatbotWebhook{
+		{Webhookid: 1, Chatbotid: 7, Url: server.URL, Events: []string{types.WebhookEventMessageExchanged}, Secret: "whsec_test"},
+		{Webhookid: 2, Chatbotid: 7, Url: server.URL, Events: []string{types.WebhookEventChatbotUpdated}, Secret: "whsec_other"},
+	}}
+	dispatcher := NewDispatcher(store)
+	ctx := context.Background()
+
+	if err := dispatcher.enqueue(ctx, 7, types.WebhookEventMessageExchanged, map[string]any{"usermessage": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.deliveries) != 1 {
+		t.Fatalf("expected a delivery for the subscribed webhook only, got %d", len(store.deliveries))
+	}
+
+	if err := dispatcher.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if delivery := store.deliveries[0]; delivery.Status != types.WebhookDeliveryPending || delivery.Attempts != 1 || delivery.Responsestatus != http.StatusServiceUnavailable {
+		t.Fatalf("expected the failed delivery to be retried, got %+v", delivery)
+	}
+
+	// the retry is not due yet
+	dispatcher.Flush(ctx)
+	if len(received) != 1 {
+		t.Fatalf("expected the retry to wait, got %d requests", len(received))
+	}
+	store.deliveries[0].Nextattempt = time.Now().Unix()
+	dispatcher.Flush(ctx)
+	if delivery := store.deliveries[0]; delivery.Status != types.WebhookDeliverySucceeded || delivery.Attempts != 2 {
+		t.Fatalf("expected the retry to succeed, got %+v", delivery)
+	}
+
+	request, body := received[1], bodies[1]
+	signature := "sha256=" + Sign("whsec_test", request.Header.Get(HeaderTimestamp), body)
+	if request.Header.Get(HeaderSignature) != signature {
+		t.Errorf("expected signature %s, got %s", signature, request.Header.Get(HeaderSignature))
+	}
+	if request.Header.Get(HeaderEvent) != types.WebhookEventMessageExchanged || request.Header.Get(HeaderDelivery) != "1" {
+		t.Errorf("unexpected event headers %v", request.Header)
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil || event.Chatbotid != 7 || event.Data.(map[string]any)["usermessage"] != "hi" {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestDispatcherTest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://internal.local/", http.StatusFound)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	config.Envs.WebhookAllowedHosts = serverURL.Hostname()
+
+	store := &mockWebhookStore{}
+	delivery, err := NewDispatcher(store).Test(context.Background(), types.ChatbotWebhook{Webhookid: 1, Chatbotid: 7, Url: server.URL, Secret: "whsec_test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != types.WebhookDeliveryFailed || delivery.Responsestatus != http.StatusFound {
+		t.Errorf("expected the redirect not to be followed and the test not to be retried, got %+v", delivery)
+	}
+	if store.deliveries[0].Event != types.WebhookEventPing {
+		t.Errorf("expected the test to be in the delivery log, got %+v", store.deliveries)
+	}
+
+	config.Envs.WebhookAllowedHosts = ""
+	if err := CheckURL(server.URL); err == nil {
+		t.Error("expected the host to be rejected without WEBHOOK_ALLOWED_HOSTS")
+	}
+}
@@ -1,20 +1,40 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/moderation"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/retention"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/service/chatbotservice"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/service/conversation"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/service/health"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/service/user"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/service/workspace"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/webhooks"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/middleware"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/tracing"
 	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/validate"
 )
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	logging.Setup(os.Stdout, config.Envs.LogLevel)
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Envs.OTLPEndpoint, config.Envs.ServiceName)
+	if err != nil {
+		slog.Error("Error setting up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
 
 	dbConnection, dberr := validate.CheckAndInitDB()
 	if dberr != nil {
@@ -23,52 +43,144 @@ func main() {
 
 	mainRouter := http.NewServeMux()
 	mainStack := middleware.CreateStack(
+		middleware.RequestID,
+		middleware.Tracing,
 		middleware.Logging,
-		middleware.CORS,
+		middleware.CORS(nil),
 	)
 	mainRouter.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// write to the response which returns to client
 		fmt.Fprintf(w, "Hello world!")
 	})
+	// not proxied under /api, so these are only reachable from inside the deployment
+	mainRouter.Handle("GET /metrics", metrics.Handler())
+	healthHandler := health.NewHandler(dbConnection)
+	healthHandler.RegisterRoutes(mainRouter)
 
 	userSubRouter := http.NewServeMux()
 	userStore := user.NewStore(dbConnection)
 	userHandler := user.NewHandler(userStore)
 	userHandler.RegisterRoutes(userSubRouter)
 
-	mainRouter.Handle("/api/user/", http.StripPrefix("/api/user", mainStack(userSubRouter)))
+	mainRouter.Handle("/api/user/", http.StripPrefix("/api/user", mainStack(middleware.Metrics("/api/user")(userSubRouter))))
+
+	workspaceSubRouter := http.NewServeMux()
+	workspaceStore := workspace.NewStore(dbConnection)
+	workspaceHandler := workspace.NewHandler(workspaceStore, userStore)
+	workspaceHandler.RegisterRoutes(workspaceSubRouter)
+
+	mainRouter.Handle("/api/workspace/", http.StripPrefix("/api/workspace", mainStack(middleware.Metrics("/api/workspace")(workspaceSubRouter))))
 
 	chatbotSubRouter := http.NewServeMux()
 	chatbotStore := chatbotservice.NewStore(dbConnection)
-	chatbotHandler := chatbotservice.NewHandler(chatbotStore, userStore)
+	revisionStore := chatbotservice.NewRevisionStore(dbConnection)
+	templateStore := chatbotservice.NewTemplateStore(dbConnection)
+	toolStore := chatbotservice.NewToolStore(dbConnection)
+	webhookStore := chatbotservice.NewWebhookStore(dbConnection)
+	feedbackStore := chatbotservice.NewFeedbackStore(dbConnection)
+	searchStore := chatbotservice.NewSearchStore(dbConnection)
+	retentionStore := chatbotservice.NewRetentionStore(dbConnection)
+	moderationStore := chatbotservice.NewModerationStore(dbConnection)
+	webhookDispatcher := webhooks.NewDispatcher(webhookStore)
+	chatbotHandler := chatbotservice.NewHandler(chatbotStore, userStore, workspaceStore, revisionStore, templateStore, toolStore, webhookStore, feedbackStore, searchStore, retentionStore, moderationStore, webhookDispatcher)
 	chatbotHandler.RegisterRoutes(chatbotSubRouter)
 
-	mainRouter.Handle("/api/chatbot/", http.StripPrefix("/api/chatbot", mainStack(chatbotSubRouter)))
+	mainRouter.Handle("/api/chatbot/", http.StripPrefix("/api/chatbot", mainStack(middleware.Metrics("/api/chatbot")(chatbotSubRouter))))
+
+	// saves chat turns queued while the database was busy until shutdown
+	spoolCtx, stopSpool := context.WithCancel(context.Background())
+	defer stopSpool()
+
+	// delivers chatbot events to their webhooks until shutdown, deliveries still pending are sent after a restart
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	utils.RunInBackground(func() { webhookDispatcher.Run(webhookCtx) })
+
+	// deletes conversations past the retention of their chatbot until shutdown
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	purger := retention.NewPurger(retentionStore)
+	utils.RunInBackground(func() { purger.Run(purgeCtx) })
 
 	apiKey := config.Envs.GEMINI_API_KEY
 	if apiKey != "" {
 		conversationSubRouter := http.NewServeMux()
 		conversationStore := conversation.NewConversationStore(dbConnection)
 		apiFileStore := conversation.NewAPIFileStore(dbConnection)
-		conversationHandler, err := conversation.NewHandler(chatbotStore, conversationStore, apiFileStore, apiKey)
+		attachmentStore := conversation.NewAttachmentStore(dbConnection)
+		turnSpool, err := conversation.NewTurnSpool(config.Envs.TurnSpoolPath, conversationStore)
+		if err != nil {
+			slog.Error("Error reading queued conversation turns", "error", err)
+			os.Exit(1)
+		}
+		utils.RunInBackground(func() { turnSpool.Run(spoolCtx) })
+		// messages are checked against the moderation rules of their chatbot, a classifier can be passed to check them further
+		moderator := moderation.NewModerator(moderationStore, nil)
+
+		conversationHandler, err := conversation.NewHandler(chatbotStore, conversationStore, apiFileStore, attachmentStore, userStore, workspaceStore, revisionStore, toolStore, feedbackStore, webhookDispatcher, moderator, turnSpool, apiKey)
 		if err != nil {
-			log.Fatalf("Error when starting conversation service, %v", err)
+			slog.Error("Error when starting conversation service", "error", err)
+			os.Exit(1)
 		} else {
 			conversationHandler.RegisterRoutes(conversationSubRouter)
-			mainRouter.Handle("/api/conversation/", http.StripPrefix("/api/conversation", mainStack(conversationSubRouter)))
+			// chatbots embedded on other sites can be chatted with from the origins they allow
+			conversationStack := middleware.CreateStack(
+				middleware.RequestID,
+				middleware.Tracing,
+				middleware.Logging,
+				middleware.CORS(conversationHandler.AllowedOrigins),
+			)
+			mainRouter.Handle("/api/conversation/", http.StripPrefix("/api/conversation", conversationStack(middleware.Metrics("/api/conversation")(conversationSubRouter))))
 		}
 	} else {
-		log.Fatal("Gemini API key not set, not starting conversation service")
+		slog.Error("Gemini API key not set, not starting conversation service")
+		os.Exit(1)
 	}
 
 	// set server and start
 	server := http.Server{
-		Addr:    ":" + config.Envs.Port,
-		Handler: mainRouter,
+		Addr:              ":" + config.Envs.Port,
+		Handler:           mainRouter,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Duration(config.Envs.ReadTimeoutSeconds) * time.Second,
+		// streamed chat responses clear their write deadline so they are not cut off
+		WriteTimeout: time.Duration(config.Envs.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:  time.Duration(config.Envs.IdleTimeoutSeconds) * time.Second,
 	}
-	log.Printf("Starting server on :%s...\n", config.Envs.Port)
-	err := server.ListenAndServe()
-	if err != nil {
-		log.Printf("Error starting server: %s\n", err)
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "port", config.Envs.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("Error starting server", "error", err)
+		return
+	case <-signalCtx.Done():
+		stop()
+	}
+
+	// stop accepting connections, let in-flight requests and streams finish,
+	// then wait for the goroutines still saving conversation turns before closing the database
+	slog.Info("Shutting down server", "timeout_seconds", config.Envs.ShutdownTimeoutSeconds)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Envs.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error waiting for in-flight requests to finish", "error", err)
+	}
+	stopSpool()
+	stopWebhooks()
+	stopPurge()
+	if err := utils.WaitForBackground(shutdownCtx); err != nil {
+		slog.Error("Error waiting for background tasks to finish", "error", err)
+	}
+	if err := dbConnection.Close(); err != nil {
+		slog.Error("Error closing database", "error", err)
 	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+var backgroundTasks sync.WaitGroup
+
+// RunInBackground runs fn in a goroutine that graceful shutdown waits for,
+// for work that should not block the response such as saving a conversation turn
+func RunInBackground(fn func()) {
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		fn()
+	}()
+}
+
+// WaitForBackground waits for the goroutines started with RunInBackground to finish, or for ctx to be done
+func WaitForBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		backgroundTasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "requestID"
+	fieldsKey    contextKey = "logFields"
+)
+
+// Setup makes slog write JSON lines at the given level (debug, info, warn or error) and be used as the default logger.
+// Messages from the standard log package go through the same handler
+func Setup(out io.Writer, level string) {
+	var logLevel slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		logLevel = slog.LevelDebug
+	case "warn":
+		logLevel = slog.LevelWarn
+	case "error":
+		logLevel = slog.LevelError
+	default:
+		logLevel = slog.LevelInfo
+	}
+
+	handler := slog.NewJSONHandler(out, &slog.HandlerOptions{Level: logLevel})
+	slog.SetDefault(slog.New(NewContextHandler(handler)))
+}
+
+// ContextHandler adds the request ID, trace IDs and request fields stored in the context to every record,
+// so logging with slog.InfoContext(r.Context(), ...) can be correlated with the request
+type ContextHandler struct {
+	slog.Handler
+}
+
+func NewContextHandler(handler slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: handler}
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	record.AddAttrs(Fields(ctx)...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewContextHandler(h.Handler.WithAttrs(attrs))
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return NewContextHandler(h.Handler.WithGroup(name))
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// requestFields are filled in while the request is handled, such as the user once authenticated
+type requestFields struct {
+	mu     sync.Mutex
+	keys   []string
+	values map[string]slog.Value
+}
+
+// WithFields adds an empty set of request fields to the context for handlers to fill in with AddFields
+func WithFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey, &requestFields{values: map[string]slog.Value{}})
+}
+
+// AddFields records key value pairs for the rest of the request, replacing earlier values of the same key.
+// It does nothing if the context has no request fields
+func AddFields(ctx context.Context, args ...any) {
+	fields, ok := ctx.Value(fieldsKey).(*requestFields)
+	if !ok {
+		return
+	}
+
+	record := slog.Record{}
+	record.Add(args...)
+
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	record.Attrs(func(attr slog.Attr) bool {
+		if _, exists := fields.values[attr.Key]; !exists {
+			fields.keys = append(fields.keys, attr.Key)
+		}
+		fields.values[attr.Key] = attr.Value
+		return true
+	})
+}
+
+// Fields returns the request fields recorded so far in the order they were first added
+func Fields(ctx context.Context) []slog.Attr {
+	fields, ok := ctx.Value(fieldsKey).(*requestFields)
+	if !ok {
+		return nil
+	}
+
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	attrs := make([]slog.Attr, 0, len(fields.keys))
+	for _, key := range fields.keys {
+		attrs = append(attrs, slog.Attr{Key: key, Value: fields.values[key]})
+	}
+	return attrs
+}
@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewContextHandler(slog.NewJSONHandler(&buf, nil)))
+
+	ctx := WithFields(WithRequestID(context.Background(), "req-1"))
+	AddFields(ctx, "user", "alice", "chatbotid", 3)
+	AddFields(ctx, "chatbotid", 4)
+	logger.InfoContext(ctx, "handled")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid JSON log line %q: %v", buf.String(), err)
+	}
+	if record["request_id"] != "req-1" {
+		t.Errorf("expected request_id req-1, got %v", record["request_id"])
+	}
+	if record["user"] != "alice" {
+		t.Errorf("expected user alice, got %v", record["user"])
+	}
+	if record["chatbotid"] != float64(4) {
+		t.Errorf("expected chatbotid to be replaced with 4, got %v", record["chatbotid"])
+	}
+}
+
+func TestAddFieldsWithoutRequestFields(t *testing.T) {
+	ctx := context.Background()
+	AddFields(ctx, "user", "alice")
+	if fields := Fields(ctx); len(fields) != 0 {
+		t.Errorf("expected no fields, got %v", fields)
+	}
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chatbot"
+
+// results of looking up a chatbot file in the Gemini file cache
+const (
+	FileCacheHit     = "hit"
+	FileCacheMiss    = "miss"
+	FileCacheExpired = "expired"
+)
+
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by route pattern, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	LLMRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "Time until the model responds, by model and call type. For streamed calls this is the time to the first chunk.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30, 60},
+	}, []string{"model", "call"})
+
+	LLMTokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "Tokens reported by the model, by model and token type (prompt or response).",
+	}, []string{"model", "type"})
+
+	LLMErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_errors_total",
+		Help:      "Failed model calls, by model and call type.",
+	}, []string{"model", "call"})
+
+	StreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stream_duration_seconds",
+		Help:      "Time from the start of a streamed model response to its end, by model.",
+		Buckets:   []float64{1, 2, 5, 10, 20, 30, 60, 120},
+	}, []string{"model"})
+
+	StreamsInterruptedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "streams_interrupted_total",
+		Help:      "Streamed model responses stopped early because the client disconnected, by model.",
+	}, []string{"model"})
+
+	ToolCallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "Tools called by the model, by tool kind (webhook or builtin) and outcome (success or error).",
+	}, []string{"kind", "outcome"})
+
+	WebhookDeliveryAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_attempts_total",
+		Help:      "Attempts to deliver chatbot event webhooks, by event and outcome (success, retry or failed).",
+	}, []string{"event", "outcome"})
+
+	MessageFeedbackTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "message_feedback_total",
+		Help:      "Ratings visitors gave to chatbot responses, by rating (up or down).",
+	}, []string{"rating"})
+
+	ConversationsPurgedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conversations_purged_total",
+		Help:      "Conversations deleted for being past the retention policy of their chatbot.",
+	})
+
+	ModerationActionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "moderation_actions_total",
+		Help:      "Messages flagged or blocked by moderation, by stage (input or output) and action (flag or block).",
+	}, []string{"stage", "action"})
+
+	FileCacheTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gemini_file_cache_total",
+		Help:      "Lookups of uploaded chatbot files, by result (hit, miss or expired).",
+	}, []string{"result"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by SQLite store methods, by store method.",
+		Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1},
+	}, []string{"query"})
+)
+
+// Handler serves the collected metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveDBQuery records the time since start for a store method, meant to be deferred at the top of the method
+func ObserveDBQuery(query string, start time.Time) {
+	DBQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+// ObserveLLMTokens records the token counts reported in a model response
+func ObserveLLMTokens(model string, promptTokens int32, responseTokens int32) {
+	LLMTokensTotal.WithLabelValues(model, "prompt").Add(float64(promptTokens))
+	LLMTokensTotal.WithLabelValues(model, "response").Add(float64(responseTokens))
+}
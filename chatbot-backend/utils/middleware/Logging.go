@@ -1,9 +1,14 @@
 package middleware
 
 import (
-	"log"
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
 )
 
 type wrappedResponseWriter struct {
@@ -24,6 +29,26 @@ func (w *wrappedResponseWriter) Flush() {
 	// If the underlying ResponseWriter is not a Flusher
 }
 
+// Hijack lets WebSocket connections take over the underlying connection
+func (w *wrappedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (w *wrappedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Logging writes one structured log line per request, including the fields handlers
+// added to the request context such as the user, chatbotid and conversationid
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -32,7 +57,20 @@ func Logging(next http.Handler) http.Handler {
 			statusCode:     http.StatusOK,
 		}
 
-		next.ServeHTTP(wrappedResponseWriter, r)
-		log.Printf("Received %s at %s Replied with %d %s\n", r.Method, r.URL.Path, wrappedResponseWriter.statusCode, time.Since(start))
+		ctx := logging.WithFields(r.Context())
+		next.ServeHTTP(wrappedResponseWriter, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if wrappedResponseWriter.statusCode >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if wrappedResponseWriter.statusCode >= http.StatusBadRequest {
+			level = slog.LevelWarn
+		}
+		slog.LogAttrs(ctx, level, "request handled",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", wrappedResponseWriter.statusCode),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		)
 	})
 }
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/chatbot/config"
+)
+
+func TestCORS(t *testing.T) {
+	config.Envs.FrontendDomain = "https://app.example.com"
+	handler := CORS(func(r *http.Request) []string {
+		return []string{"https://shop.example.org"}
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name        string
+		origin      string
+		allowed     string
+		credentials bool
+	}{
+		{name: "frontend gets credentials", origin: "https://app.example.com", allowed: "https://app.example.com", credentials: true},
+		{name: "resolved origin without credentials", origin: "https://shop.example.org", allowed: "https://shop.example.org", credentials: false},
+		{name: "unknown origin falls back to the frontend", origin: "https://evil.example.net", allowed: "https://app.example.com", credentials: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.allowed {
+				t.Errorf("expected allowed origin %s, got %s", tt.allowed, got)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("expected credentials %v, got %v", tt.credentials, got)
+			}
+			if rr.Header().Get("Vary") != "Origin" {
+				t.Error("expected the response to vary by origin")
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metrics counts requests and their latency by route, method and status, and names the request span after the route.
+// It must wrap the router directly so it can read the pattern the router matched,
+// prefix is the path the router is mounted at so routes of different routers can be told apart
+func Metrics(prefix string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			wrappedResponseWriter := &wrappedResponseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			next.ServeHTTP(wrappedResponseWriter, r)
+
+			route := routeLabel(prefix, r.Pattern)
+			status := strconv.Itoa(wrappedResponseWriter.statusCode)
+			metrics.HTTPRequestsTotal.WithLabelValues(route, r.Method, status).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		})
+	}
+}
+
+// routeLabel turns a pattern such as "GET /{chatbotid}" into "/api/chatbot/{chatbotid}",
+// keeping the number of label values bounded by the number of registered routes
+func routeLabel(prefix string, pattern string) string {
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, found := strings.Cut(pattern, " "); found {
+		pattern = path
+	}
+	return prefix + pattern
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRouteLabel(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{pattern: "GET /{chatbotid}", expected: "/api/chatbot/{chatbotid}"},
+		{pattern: "/", expected: "/api/chatbot/"},
+		{pattern: "", expected: "unmatched"},
+	}
+
+	for _, tt := range tests {
+		if got := routeLabel("/api/chatbot", tt.pattern); got != tt.expected {
+			t.Errorf("routeLabel(%q) = %q, expected %q", tt.pattern, got, tt.expected)
+		}
+	}
+}
+
+func TestMetricsUsesMatchedPattern(t *testing.T) {
+	router := http.NewServeMux()
+	router.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := Metrics("/api/test")(router)
+
+	counter := metrics.HTTPRequestsTotal.WithLabelValues("/api/test/items/{id}", http.MethodGet, "418")
+	before := testutil.ToFloat64(counter)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/2", nil))
+
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("expected 2 requests counted for the route pattern, got %v", got)
+	}
+}
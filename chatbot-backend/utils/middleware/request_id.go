@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// incoming request IDs are only kept if they are safe to put in logs and response headers
+var validRequestIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-\.:]{1,128}$`)
+
+// RequestID gives every request an ID, reusing the X-Request-ID sent by the client or a proxy when there is one.
+// The ID is returned in the response header and stored in the request context for logging
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestIDRegex.MatchString(requestID) {
+			generatedID, err := utils.GenerateSecureToken(16)
+			if err != nil {
+				slog.Error("Error generating request ID", "error", err)
+			}
+			requestID = generatedID
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), requestID)))
+	})
+}
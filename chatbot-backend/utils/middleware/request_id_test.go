@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+)
+
+func TestRequestID(t *testing.T) {
+	var contextID string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextID = logging.RequestIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "keeps valid incoming ID", incoming: "abc-123", keep: true},
+		{name: "generates ID when missing", incoming: "", keep: false},
+		{name: "replaces unsafe incoming ID", incoming: "bad id\nline", keep: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			responseID := rr.Header().Get(RequestIDHeader)
+			if responseID == "" || responseID != contextID {
+				t.Fatalf("expected matching response and context IDs, got %q and %q", responseID, contextID)
+			}
+			if tt.keep && responseID != tt.incoming {
+				t.Errorf("expected incoming ID %q to be kept, got %q", tt.incoming, responseID)
+			}
+			if !tt.keep && responseID == tt.incoming {
+				t.Errorf("expected a generated ID, got %q", responseID)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/logging"
+	"github.com/Owen-Choh/SC4052-Cloud-Computing-Assignment-2/chatbot-backend/utils/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the trace of the caller when a traceparent header is sent.
+// The span is renamed after the matched route by the Metrics middleware, which can see the pattern
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("request_id", logging.RequestIDFromContext(ctx)),
+			),
+		)
+		defer span.End()
+
+		wrappedResponseWriter := &wrappedResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(wrappedResponseWriter, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(wrappedResponseWriter.statusCode))
+		if wrappedResponseWriter.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrappedResponseWriter.statusCode))
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -61,3 +63,12 @@ func GetCurrentTime() (string, error) {
 func GenerateUUID() uuid.UUID {
 	return uuid.New()
 }
+
+// GenerateSecureToken returns a random hex encoded token from numBytes bytes of crypto/rand
+func GenerateSecureToken(numBytes int) (string, error) {
+	buffer := make([]byte, numBytes)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
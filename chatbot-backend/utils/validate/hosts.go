@@ -0,0 +1,43 @@
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// HostInList reports whether host is in the comma separated list of hosts, where *.example.com
+// matches the subdomains of example.com. IPv6 hosts may be listed with or without brackets
+func HostInList(host string, hosts string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+	for _, allowed := range strings.Split(hosts, ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "" {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == strings.Trim(allowed, "[]") {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeOrigin checks that origin is an http or https origin, such as https://example.com:8443,
+// and returns it in the lower case form browsers send in the Origin header
+func NormalizeOrigin(origin string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		(parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return "", fmt.Errorf("%q is not an origin like https://example.com", origin)
+	}
+	return strings.ToLower(parsed.Scheme + "://" + parsed.Host), nil
+}
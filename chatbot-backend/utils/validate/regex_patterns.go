@@ -4,3 +4,4 @@ import "regexp"
 
 var ValidChatbotNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
 var ValidFileNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-\. ]+$`)
+var ValidToolNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_\-]{0,62}$`)